@@ -1,6 +1,8 @@
 package v1beta1
 
 import (
+	"fmt"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
@@ -19,6 +21,16 @@ const (
 
 	// ControlPlaneCreatingCondition indicates the control plane is being created
 	ControlPlaneCreatingCondition = "Creating"
+
+	// ControlPlaneUpgradingCondition indicates the control plane is being upgraded to a new Kubernetes version
+	ControlPlaneUpgradingCondition = "Upgrading"
+
+	// ControlPlaneAddonsReadyCondition indicates all EKS addons declared in controlPlaneConfig.addons are active
+	ControlPlaneAddonsReadyCondition = "AddonsReady"
+
+	// ControlPlaneEndpointAccessReadyCondition indicates the API server endpoint access in
+	// controlPlaneConfig.endpointAccess is applied to the cluster
+	ControlPlaneEndpointAccessReadyCondition = "EndpointAccessReady"
 )
 
 // Default timeout values
@@ -30,6 +42,15 @@ const (
 	DefaultVPCReadyTimeout = 15
 )
 
+// Default WorkspaceTemplate names, looked up in the namespace of the control plane
+const (
+	// DefaultSpotRoleCheckTemplate is the default WorkspaceTemplate checking for the EC2 Spot service-linked role
+	DefaultSpotRoleCheckTemplate = "spot-role-check"
+
+	// DefaultSpotRoleCreateTemplate is the default WorkspaceTemplate creating the EC2 Spot service-linked role
+	DefaultSpotRoleCreateTemplate = "spot-role-create"
+)
+
 // Condition Reasons
 const (
 	// ReasonCreating indicates the control plane is being created
@@ -52,18 +73,70 @@ const (
 
 	// ReasonWorkspaceError indicates an error with the workspace
 	ReasonWorkspaceError = "WorkspaceError"
+
+	// ReasonUpgrading indicates the control plane is being upgraded
+	ReasonUpgrading = "Upgrading"
+
+	// ReasonUpgradeCompleted indicates the control plane runs the desired Kubernetes version
+	ReasonUpgradeCompleted = "UpgradeCompleted"
+
+	// ReasonVersionUnknown indicates the workspace does not report the Kubernetes version of the control plane
+	ReasonVersionUnknown = "VersionUnknown"
+
+	// ReasonAddonsReady indicates all declared EKS addons are active at their desired versions
+	ReasonAddonsReady = "AddonsReady"
+
+	// ReasonAddonsProgressing indicates EKS addons are being created, updated or deleted
+	ReasonAddonsProgressing = "AddonsProgressing"
+
+	// ReasonEndpointAccessApplied indicates the desired endpoint access is applied to the cluster
+	ReasonEndpointAccessApplied = "EndpointAccessApplied"
+
+	// ReasonEndpointAccessUpdating indicates the endpoint access of the cluster is being changed
+	ReasonEndpointAccessUpdating = "EndpointAccessUpdating"
+)
+
+// Addon states
+const (
+	// AddonStateCreating indicates the addon is declared but not installed yet
+	AddonStateCreating = "Creating"
+
+	// AddonStateUpdating indicates the addon runs a different version than declared
+	AddonStateUpdating = "Updating"
+
+	// AddonStateActive indicates the addon is installed at its desired version
+	AddonStateActive = "Active"
+)
+
+const (
+	// RetryAnnotation requests another attempt for a control plane that failed with
+	// VPCReadyTimeout or ControlPlaneTimeout. The timeouts restart from the time the
+	// annotation is handled, and the controller removes it afterwards.
+	RetryAnnotation = "controlplane.cluster.x-k8s.io/retry"
+
+	// KubeconfigTokenExpirationAnnotation records on the kubeconfig Secret when the embedded
+	// token expires, in RFC 3339 format. The controller rotates the token before that time.
+	KubeconfigTokenExpirationAnnotation = "controlplane.cluster.x-k8s.io/token-expiration"
 )
 
 // CAPTControlPlaneSpec defines the desired state of CAPTControlPlane
 type CAPTControlPlaneSpec struct {
 	// Version defines the desired Kubernetes version.
+	// The control plane is upgraded one minor version at a time; the minor
+	// version may only be raised by one above the version in status.version.
 	// +kubebuilder:validation:Required
 	Version string `json:"version"`
 
 	// WorkspaceTemplateRef is a reference to the WorkspaceTemplate used for creating the control plane.
+	// The namespace defaults to the namespace of the control plane.
 	// +kubebuilder:validation:Required
 	WorkspaceTemplateRef WorkspaceTemplateReference `json:"workspaceTemplateRef"`
 
+	// SpotRoleTemplates references the WorkspaceTemplates used to check for and create
+	// the EC2 Spot service-linked role.
+	// +optional
+	SpotRoleTemplates *SpotRoleTemplates `json:"spotRoleTemplates,omitempty"`
+
 	// ControlPlaneConfig contains additional configuration for the EKS control plane.
 	// +optional
 	ControlPlaneConfig *ControlPlaneConfig `json:"controlPlaneConfig,omitempty"`
@@ -93,15 +166,30 @@ type WorkspaceTemplateReference struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// SpotRoleTemplates references the WorkspaceTemplates managing the EC2 Spot service-linked role
+type SpotRoleTemplates struct {
+	// CheckTemplateRef is a reference to the WorkspaceTemplate reporting whether the role exists
+	// in its role_exists output. Defaults to spot-role-check in the namespace of the control plane.
+	// +optional
+	CheckTemplateRef *WorkspaceTemplateReference `json:"checkTemplateRef,omitempty"`
+
+	// CreateTemplateRef is a reference to the WorkspaceTemplate creating the role and reporting
+	// it in its role_arn output. Defaults to spot-role-create in the namespace of the control plane.
+	// +optional
+	CreateTemplateRef *WorkspaceTemplateReference `json:"createTemplateRef,omitempty"`
+}
+
 // TimeoutConfig defines timeout settings for various operations
 type TimeoutConfig struct {
-	// ControlPlaneTimeout is the timeout in minutes for control plane creation
+	// ControlPlaneTimeout is the timeout in minutes for control plane creation.
+	// The control plane fails with ControlPlaneTimeout once it is exceeded.
 	// +optional
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:default=30
 	ControlPlaneTimeout *int `json:"controlPlaneTimeout,omitempty"`
 
-	// VPCReadyTimeout is the timeout in minutes for VPC ready check
+	// VPCReadyTimeout is the timeout in minutes for VPC ready check.
+	// The control plane fails with VPCReadyTimeout once it is exceeded.
 	// +optional
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:default=15
@@ -119,7 +207,9 @@ type ControlPlaneConfig struct {
 	// +optional
 	EndpointAccess *EndpointAccess `json:"endpointAccess,omitempty"`
 
-	// Addons defines the EKS addons to be installed
+	// Addons defines the EKS addons to be installed. They are passed to the control plane
+	// WorkspaceTemplate as the addons variable, a map from addon name to its addon_version
+	// and configuration_values. Addons can be added, removed and upgraded in place.
 	// +optional
 	Addons []Addon `json:"addons,omitempty"`
 
@@ -138,8 +228,11 @@ type EndpointAccess struct {
 	// +optional
 	Private bool `json:"private,omitempty"`
 
-	// PublicCIDRs is a list of CIDR blocks that can access the API server
+	// PublicCIDRs is a list of CIDR blocks that can access the public API server endpoint.
+	// All addresses may access it if empty. It may only be set with public access and is
+	// passed to the WorkspaceTemplate as the endpoint_public_access_cidrs variable.
 	// +optional
+	// +kubebuilder:validation:MaxItems=40
 	PublicCIDRs []string `json:"publicCIDRs,omitempty"`
 }
 
@@ -149,7 +242,8 @@ type Addon struct {
 	// +kubebuilder:validation:Required
 	Name string `json:"name"`
 
-	// Version is the version of the addon
+	// Version is the version of the addon, e.g. v1.11.1-eksbuild.9.
+	// The default version for the cluster's Kubernetes version is used if empty.
 	// +optional
 	Version string `json:"version,omitempty"`
 
@@ -158,6 +252,21 @@ type Addon struct {
 	ConfigurationValues string `json:"configurationValues,omitempty"`
 }
 
+// AddonStatus reports the state of an EKS addon
+type AddonStatus struct {
+	// Name is the name of the addon
+	Name string `json:"name"`
+
+	// Version is the installed version of the addon, as reported by the
+	// cluster_addons output of the workspace
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// State is the state of the addon
+	// +kubebuilder:validation:Enum=Creating;Updating;Active
+	State string `json:"state"`
+}
+
 // WorkspaceTemplateStatus contains the status of the WorkspaceTemplate
 type WorkspaceTemplateStatus struct {
 	// Ready indicates if the WorkspaceTemplate is ready
@@ -215,6 +324,11 @@ type CAPTControlPlaneStatus struct {
 	// +kubebuilder:default=false
 	SecretsReady bool `json:"secretsReady"`
 
+	// KubeconfigLastRotationTime is the last time the kubeconfig Secret was generated,
+	// including the rotations of its token before it expires.
+	// +optional
+	KubeconfigLastRotationTime *metav1.Time `json:"kubeconfigLastRotationTime,omitempty"`
+
 	// WorkspaceTemplateStatus contains the status of the WorkspaceTemplate
 	// +optional
 	WorkspaceTemplateStatus *WorkspaceTemplateStatus `json:"workspaceTemplateStatus,omitempty"`
@@ -234,10 +348,43 @@ type CAPTControlPlaneStatus struct {
 	// +optional
 	FailureMessage *string `json:"failureMessage,omitempty"`
 
+	// VPCWaitStartTime is the time the control plane started waiting for its VPC.
+	// It is cleared once the VPC is ready.
+	// +optional
+	VPCWaitStartTime *metav1.Time `json:"vpcWaitStartTime,omitempty"`
+
+	// CreationStartTime is the time the control plane creation started, after the
+	// VPC became ready. It is cleared once the control plane is ready.
+	// +optional
+	CreationStartTime *metav1.Time `json:"creationStartTime,omitempty"`
+
+	// InitializedTime is the time the control plane first became ready. Unlike
+	// initialized, it is kept when the control plane is not ready anymore, so the
+	// VPC ready and creation timeouts only bound the initial creation.
+	// +optional
+	InitializedTime *metav1.Time `json:"initializedTime,omitempty"`
+
+	// Version is the Kubernetes version the control plane runs, as reported by
+	// the cluster_version output of the workspace. It differs from spec.version
+	// while an upgrade is in progress, and is empty while the version is unknown.
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// EndpointAccess is the API server endpoint access applied to the cluster, as
+	// reported by the endpoint_access output of the workspace
+	// +optional
+	EndpointAccess *EndpointAccess `json:"endpointAccess,omitempty"`
+
+	// Addons reports the EKS addons declared in controlPlaneConfig.addons
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Addons []AddonStatus `json:"addons,omitempty"`
+
 	// Phase represents the current phase of the control plane
-	// Valid values are: "Creating", "Ready", "Failed"
+	// Valid values are: "Creating", "Upgrading", "Ready", "Failed"
 	// +optional
-	// +kubebuilder:validation:Enum=Creating;Ready;Failed
+	// +kubebuilder:validation:Enum=Creating;Upgrading;Ready;Failed
 	Phase string `json:"phase,omitempty"`
 
 	// Conditions defines current service state of the CAPTControlPlane.
@@ -262,6 +409,15 @@ type CAPTControlPlane struct {
 	Status CAPTControlPlaneStatus `json:"status,omitempty"`
 }
 
+// GetWorkspaceTemplateApplyName returns the name of the control plane WorkspaceTemplateApply,
+// defaulting to {name}-eks-controlplane-apply
+func (c *CAPTControlPlane) GetWorkspaceTemplateApplyName() string {
+	if c.Spec.WorkspaceTemplateApplyName != "" {
+		return c.Spec.WorkspaceTemplateApplyName
+	}
+	return fmt.Sprintf("%s-eks-controlplane-apply", c.Name)
+}
+
 //+kubebuilder:object:root=true
 
 // CAPTControlPlaneList contains a list of CAPTControlPlane
@@ -44,6 +44,21 @@ func (in *Addon) DeepCopy() *Addon {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AddonStatus) DeepCopyInto(out *AddonStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AddonStatus.
+func (in *AddonStatus) DeepCopy() *AddonStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AddonStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CAPTControlPlane) DeepCopyInto(out *CAPTControlPlane) {
 	*out = *in
@@ -107,6 +122,11 @@ func (in *CAPTControlPlaneList) DeepCopyObject() runtime.Object {
 func (in *CAPTControlPlaneSpec) DeepCopyInto(out *CAPTControlPlaneSpec) {
 	*out = *in
 	out.WorkspaceTemplateRef = in.WorkspaceTemplateRef
+	if in.SpotRoleTemplates != nil {
+		in, out := &in.SpotRoleTemplates, &out.SpotRoleTemplates
+		*out = new(SpotRoleTemplates)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ControlPlaneConfig != nil {
 		in, out := &in.ControlPlaneConfig, &out.ControlPlaneConfig
 		*out = new(ControlPlaneConfig)
@@ -135,6 +155,10 @@ func (in *CAPTControlPlaneSpec) DeepCopy() *CAPTControlPlaneSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CAPTControlPlaneStatus) DeepCopyInto(out *CAPTControlPlaneStatus) {
 	*out = *in
+	if in.KubeconfigLastRotationTime != nil {
+		in, out := &in.KubeconfigLastRotationTime, &out.KubeconfigLastRotationTime
+		*out = (*in).DeepCopy()
+	}
 	if in.WorkspaceTemplateStatus != nil {
 		in, out := &in.WorkspaceTemplateStatus, &out.WorkspaceTemplateStatus
 		*out = new(WorkspaceTemplateStatus)
@@ -155,6 +179,28 @@ func (in *CAPTControlPlaneStatus) DeepCopyInto(out *CAPTControlPlaneStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.VPCWaitStartTime != nil {
+		in, out := &in.VPCWaitStartTime, &out.VPCWaitStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CreationStartTime != nil {
+		in, out := &in.CreationStartTime, &out.CreationStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.InitializedTime != nil {
+		in, out := &in.InitializedTime, &out.InitializedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.EndpointAccess != nil {
+		in, out := &in.EndpointAccess, &out.EndpointAccess
+		*out = new(EndpointAccess)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Addons != nil {
+		in, out := &in.Addons, &out.Addons
+		*out = make([]AddonStatus, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]v1.Condition, len(*in))
@@ -315,6 +361,31 @@ func (in *EndpointAccess) DeepCopy() *EndpointAccess {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpotRoleTemplates) DeepCopyInto(out *SpotRoleTemplates) {
+	*out = *in
+	if in.CheckTemplateRef != nil {
+		in, out := &in.CheckTemplateRef, &out.CheckTemplateRef
+		*out = new(WorkspaceTemplateReference)
+		**out = **in
+	}
+	if in.CreateTemplateRef != nil {
+		in, out := &in.CreateTemplateRef, &out.CreateTemplateRef
+		*out = new(WorkspaceTemplateReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpotRoleTemplates.
+func (in *SpotRoleTemplates) DeepCopy() *SpotRoleTemplates {
+	if in == nil {
+		return nil
+	}
+	out := new(SpotRoleTemplates)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TimeoutConfig) DeepCopyInto(out *TimeoutConfig) {
 	*out = *in
@@ -56,6 +56,12 @@ type CAPTClusterSpec struct {
 	// +optional
 	VPCConfig *VPCConfig `json:"vpcConfig,omitempty"`
 
+	// IdentityRef references the CAPTClusterIdentity providing the AWS credentials of the
+	// cluster. The control plane and machines of the cluster use the same identity.
+	// If unset, workspaces use the ProviderConfig referenced by their templates.
+	// +optional
+	IdentityRef *IdentityReference `json:"identityRef,omitempty"`
+
 	// WorkspaceTemplateApplyName is the name of the WorkspaceTemplateApply used for this cluster.
 	// This field is managed by the controller and should not be modified manually.
 	// +optional
@@ -164,6 +170,23 @@ func (s *CAPTClusterSpec) ValidateVPCConfiguration() error {
 	return nil
 }
 
+// GetVPCName returns the name of the managed VPC, defaulting to {cluster-name}-vpc
+func (c *CAPTCluster) GetVPCName() string {
+	if c.Spec.VPCConfig != nil && c.Spec.VPCConfig.Name != "" {
+		return c.Spec.VPCConfig.Name
+	}
+	return fmt.Sprintf("%s-vpc", c.Name)
+}
+
+// GetWorkspaceTemplateApplyName returns the name of the VPC WorkspaceTemplateApply,
+// defaulting to {cluster-name}-vpc
+func (c *CAPTCluster) GetWorkspaceTemplateApplyName() string {
+	if c.Spec.WorkspaceTemplateApplyName != "" {
+		return c.Spec.WorkspaceTemplateApplyName
+	}
+	return fmt.Sprintf("%s-vpc", c.Name)
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="VPC-ID",type="string",JSONPath=".status.vpcId"
@@ -0,0 +1,135 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// CAPTClusterIdentityReadyCondition indicates whether the ProviderConfig of the identity is up to date
+	CAPTClusterIdentityReadyCondition = "Ready"
+
+	// ReasonProviderConfigReady represents that the ProviderConfig of the identity is up to date
+	ReasonProviderConfigReady = "ProviderConfigReady"
+
+	// ReasonInvalidIdentity represents that the identity sets neither or both of secretRef and roleARN
+	ReasonInvalidIdentity = "InvalidIdentity"
+
+	// IdentityCredentialsFile is the file, relative to the Terraform module, that the AWS
+	// shared credentials of a secretRef identity are written to
+	IdentityCredentialsFile = "aws-creds.ini"
+
+	// IdentityProviderConfigPrefix prefixes the names of the ProviderConfigs managed for identities.
+	// They may only be used through identityRef, which checks the allowed namespaces, so templates
+	// and variables may not name them.
+	IdentityProviderConfigPrefix = "capt-identity-"
+
+	// IdentityWebIdentityTokenFile is the service account token of the provider-terraform
+	// pod that roleARN identities assume their role with, as projected by IRSA
+	IdentityWebIdentityTokenFile = "/var/run/secrets/eks.amazonaws.com/serviceaccount/token"
+)
+
+// AllowedNamespaces selects the namespaces whose clusters may use an identity
+type AllowedNamespaces struct {
+	// List is a list of namespace names
+	// +optional
+	List []string `json:"list,omitempty"`
+
+	// Selector selects namespaces by their labels. An empty selector matches all namespaces.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// CAPTClusterIdentitySpec defines the desired state of CAPTClusterIdentity
+type CAPTClusterIdentitySpec struct {
+	// AllowedNamespaces selects the namespaces whose clusters may use this identity.
+	// A namespace is allowed if it is in the list or matches the selector.
+	// If unset, no namespace is allowed; an empty object allows all namespaces.
+	// +optional
+	AllowedNamespaces *AllowedNamespaces `json:"allowedNamespaces,omitempty"`
+
+	// SecretRef references a Secret key holding an AWS shared credentials file.
+	// Exactly one of SecretRef and RoleARN must be set.
+	// +optional
+	SecretRef *xpv1.SecretKeySelector `json:"secretRef,omitempty"`
+
+	// RoleARN is an IAM role assumed with the IRSA web identity of provider-terraform.
+	// Exactly one of SecretRef and RoleARN must be set.
+	// +optional
+	RoleARN string `json:"roleARN,omitempty"`
+
+	// Configuration is additional Terraform configuration injected into every workspace
+	// using this identity, such as required providers or kubectl and helm providers.
+	// The aws provider is configured by the controller and must not be declared here.
+	// +optional
+	Configuration string `json:"configuration,omitempty"`
+}
+
+// CAPTClusterIdentityStatus defines the observed state of CAPTClusterIdentity
+type CAPTClusterIdentityStatus struct {
+	// ProviderConfigName is the name of the provider-terraform ProviderConfig managed for this identity
+	// +optional
+	ProviderConfigName string `json:"providerConfigName,omitempty"`
+
+	// Conditions defines current service state of the CAPTClusterIdentity
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// ProviderConfigName returns the name of the ProviderConfig managed for the identity
+func (i *CAPTClusterIdentity) ProviderConfigName() string {
+	return IdentityProviderConfigPrefix + i.Name
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:path=captclusteridentities,scope=Cluster,categories=cluster-api
+// +kubebuilder:printcolumn:name="PROVIDERCONFIG",type="string",JSONPath=".status.providerConfigName"
+// +kubebuilder:printcolumn:name="READY",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+// +kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CAPTClusterIdentity is the Schema for the captclusteridentities API. It provides the AWS
+// credentials of the clusters referencing it through a ProviderConfig managed by the controller.
+type CAPTClusterIdentity struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CAPTClusterIdentitySpec   `json:"spec,omitempty"`
+	Status CAPTClusterIdentityStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CAPTClusterIdentityList contains a list of CAPTClusterIdentity
+type CAPTClusterIdentityList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CAPTClusterIdentity `json:"items"`
+}
+
+// IdentityReference references a CAPTClusterIdentity
+type IdentityReference struct {
+	// Name is the name of the CAPTClusterIdentity
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CAPTClusterIdentity{}, &CAPTClusterIdentityList{})
+}
@@ -0,0 +1,149 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// FargateProfileReadyCondition reports whether the Fargate profile is active
+	FargateProfileReadyCondition = "Ready"
+
+	// ReasonFargateProfileActive means the Fargate profile is active
+	ReasonFargateProfileActive = "FargateProfileActive"
+	// ReasonFargateProfileProvisioning means the Fargate profile workspace is being applied
+	ReasonFargateProfileProvisioning = "FargateProfileProvisioning"
+	// ReasonFargateProfileFailed means the Fargate profile could not be created
+	ReasonFargateProfileFailed = "FargateProfileFailed"
+
+	// FargateProfileStateActive is the state of a Fargate profile that schedules pods
+	FargateProfileStateActive = "ACTIVE"
+)
+
+// CaptFargateProfileSpec defines the desired state of CaptFargateProfile
+type CaptFargateProfileSpec struct {
+	// ClusterName is the name of the Cluster the Fargate profile belongs to
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	ClusterName string `json:"clusterName"`
+
+	// WorkspaceTemplateRef is a reference to the WorkspaceTemplate used for creating the Fargate profile
+	// +kubebuilder:validation:Required
+	WorkspaceTemplateRef WorkspaceTemplateReference `json:"workspaceTemplateRef"`
+
+	// ProfileName is the name of the EKS Fargate profile. It defaults to the name of the
+	// CaptFargateProfile.
+	// +optional
+	ProfileName string `json:"profileName,omitempty"`
+
+	// Selectors select the pods that run on Fargate
+	// +kubebuilder:validation:MinItems=1
+	// +kubebuilder:validation:MaxItems=5
+	Selectors []FargateSelector `json:"selectors"`
+
+	// SubnetIDs are the private subnets of the pods. They default to the private subnets of
+	// the VPC of the cluster.
+	// +optional
+	SubnetIDs []string `json:"subnetIDs,omitempty"`
+
+	// PodExecutionRoleARN is the IAM role the pods are run with. The WorkspaceTemplate creates a
+	// role if it is not set.
+	// +optional
+	PodExecutionRoleARN string `json:"podExecutionRoleARN,omitempty"`
+
+	// AdditionalTags is a map of additional AWS tags to apply to the Fargate profile
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
+}
+
+// FargateSelector selects the pods of a namespace, optionally by labels
+type FargateSelector struct {
+	// Namespace is the namespace of the pods
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+
+	// Labels the pods must have
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// CaptFargateProfileStatus defines the observed state of CaptFargateProfile
+type CaptFargateProfileStatus struct {
+	// Ready denotes that the Fargate profile is active
+	// +optional
+	Ready bool `json:"ready"`
+
+	// ProfileARN is the ARN of the Fargate profile
+	// +optional
+	ProfileARN string `json:"profileARN,omitempty"`
+
+	// State is the status of the Fargate profile reported by EKS, such as CREATING or ACTIVE
+	// +optional
+	State string `json:"state,omitempty"`
+
+	// WorkspaceTemplateApplyName is the name of the WorkspaceTemplateApply of the Fargate profile
+	// +optional
+	WorkspaceTemplateApplyName string `json:"workspaceTemplateApplyName,omitempty"`
+
+	// Conditions defines current service state of the CaptFargateProfile
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// FailureReason indicates that there is a terminal problem reconciling the
+	// state, and will be set to a token value suitable for programmatic
+	// interpretation.
+	// +optional
+	FailureReason *string `json:"failureReason,omitempty"`
+
+	// FailureMessage indicates that there is a terminal problem reconciling the
+	// state, and will be set to a descriptive error message.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:path=captfargateprofiles,scope=Namespaced,categories=cluster-api
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName",description="Cluster to which this CaptFargateProfile belongs"
+//+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Fargate profile Ready status"
+//+kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="Fargate profile state reported by EKS"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CaptFargateProfile is the Schema for the captfargateprofiles API. It manages an EKS Fargate
+// profile of a cluster.
+type CaptFargateProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CaptFargateProfileSpec   `json:"spec,omitempty"`
+	Status CaptFargateProfileStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CaptFargateProfileList contains a list of CaptFargateProfile
+type CaptFargateProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CaptFargateProfile `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CaptFargateProfile{}, &CaptFargateProfileList{})
+}
@@ -17,14 +17,22 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
 // CaptMachineSpec defines the desired state of CaptMachine
 type CaptMachineSpec struct {
-	// NodeGroupRef is a reference to the NodeGroup this machine belongs to
-	// +kubebuilder:validation:Required
-	NodeGroupRef NodeGroupReference `json:"nodeGroupRef"`
+	// NodeGroupRef is a reference to the NodeGroup this machine belongs to. Machines cloned by
+	// Cluster API without one join the node group named after their MachineDeployment.
+	// +optional
+	NodeGroupRef *NodeGroupReference `json:"nodeGroupRef,omitempty"`
+
+	// ProviderID is the ID of the EC2 instance in the form aws:///<availability-zone>/<instance-id>,
+	// matching the providerID of its Node. It is set by the controller once the instance exists.
+	// +optional
+	ProviderID *string `json:"providerID,omitempty"`
 
 	// WorkspaceTemplateRef is a reference to the WorkspaceTemplate used for creating the machine
 	// +kubebuilder:validation:Required
@@ -41,6 +49,14 @@ type CaptMachineSpec struct {
 	// Tags is a map of tags to apply to the node
 	// +optional
 	Tags map[string]string `json:"tags,omitempty"`
+
+	// Taints specifies the taints to apply to the node
+	// +optional
+	Taints []corev1.Taint `json:"taints,omitempty"`
+
+	// AdditionalTags is a map of additional AWS tags to apply to the node, merged over Tags
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
 }
 
 // NodeGroupReference contains the information necessary to let you specify a NodeGroup
@@ -68,6 +84,10 @@ type CaptMachineStatus struct {
 	// +optional
 	PrivateIP *string `json:"privateIp,omitempty"`
 
+	// Addresses are the addresses of the instance, copied to the Machine by Cluster API
+	// +optional
+	Addresses []clusterv1.MachineAddress `json:"addresses,omitempty"`
+
 	// LastTransitionTime is the last time the Ready condition changed
 	// +optional
 	LastTransitionTime *metav1.Time `json:"lastTransitionTime,omitempty"`
@@ -90,8 +110,11 @@ type CaptMachineStatus struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:resource:path=captmachines,scope=Namespaced,categories=cluster-api
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels.cluster\\.x-k8s\\.io/cluster-name",description="Cluster to which this CaptMachine belongs"
 //+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Machine Ready status"
 //+kubebuilder:printcolumn:name="Instance ID",type="string",JSONPath=".status.instanceId",description="EC2 Instance ID"
+//+kubebuilder:printcolumn:name="Machine",type="string",JSONPath=".metadata.ownerReferences[?(@.kind==\"Machine\")].name",description="Machine object which owns this CaptMachine"
 //+kubebuilder:printcolumn:name="Node Group",type="string",JSONPath=".spec.nodeGroupRef.name",description="Node Group name"
 
 // CaptMachine is the Schema for the captmachines API
@@ -21,6 +21,51 @@ import (
 	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+const (
+	// DefaultReplicas is the default number of machines of a CaptMachineDeployment or CaptMachineSet.
+	DefaultReplicas = 1
+
+	// DefaultRollingUpdateMaxUnavailable is the default value of MaxUnavailable for RollingUpdate strategy.
+	DefaultRollingUpdateMaxUnavailable = 0
+
+	// DefaultRollingUpdateMaxSurge is the default value of MaxSurge for RollingUpdate strategy.
+	DefaultRollingUpdateMaxSurge = 1
+
+	// DefaultRevisionHistoryLimit is the default value of RevisionHistoryLimit.
+	DefaultRevisionHistoryLimit = 10
+
+	// DefaultProgressDeadlineSeconds is the default value of ProgressDeadlineSeconds.
+	DefaultProgressDeadlineSeconds = 600
+)
+
+const (
+	// MachineDeploymentAvailableCondition indicates whether enough machines are available,
+	// that is at least the desired replicas minus maxUnavailable
+	MachineDeploymentAvailableCondition = "Available"
+
+	// MachineDeploymentProgressingCondition indicates whether the rollout of the current
+	// template is progressing, complete or stuck
+	MachineDeploymentProgressingCondition = "Progressing"
+
+	// ReasonMinimumReplicasAvailable represents that enough machines are available
+	ReasonMinimumReplicasAvailable = "MinimumReplicasAvailable"
+
+	// ReasonMinimumReplicasUnavailable represents that fewer machines than required are available
+	ReasonMinimumReplicasUnavailable = "MinimumReplicasUnavailable"
+
+	// ReasonNewMachineSetAvailable represents that all machines run the current template and are available
+	ReasonNewMachineSetAvailable = "NewMachineSetAvailable"
+
+	// ReasonMachineSetUpdated represents that the rollout of the current template is in progress
+	ReasonMachineSetUpdated = "MachineSetUpdated"
+
+	// ReasonProgressDeadlineExceeded represents that the rollout made no progress within progressDeadlineSeconds
+	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+
+	// ReasonDeploymentPaused represents that the rollout is paused
+	ReasonDeploymentPaused = "DeploymentPaused"
+)
+
 // CaptMachineDeploymentSpec defines the desired state of CaptMachineDeployment
 type CaptMachineDeploymentSpec struct {
 	// Replicas is the number of desired replicas.
@@ -68,7 +113,8 @@ type CaptMachineDeploymentSpec struct {
 
 // MachineDeploymentStrategy describes how to replace existing machines with new ones.
 type MachineDeploymentStrategy struct {
-	// Type of deployment. Can be "Recreate" or "RollingUpdate". Default is RollingUpdate.
+	// Type of deployment. Can be "Recreate" or "RollingUpdate". New deployments default to
+	// RollingUpdate; deployments stored without a strategy are replaced with Recreate.
 	// +optional
 	Type string `json:"type,omitempty"`
 
@@ -102,14 +148,22 @@ type CaptMachineDeploymentStatus struct {
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 
-	// The generation observed by the deployment controller.
+	// Total number of machines created from the current template of the deployment.
 	// +optional
 	UpdatedReplicas int32 `json:"updatedReplicas,omitempty"`
 
+	// Total number of machines created from the current template that are available.
+	// +optional
+	UpdatedAvailableReplicas int32 `json:"updatedAvailableReplicas,omitempty"`
+
 	// Total number of non-terminated machines targeted by this deployment (their labels match the selector).
 	// +optional
 	Replicas int32 `json:"replicas,omitempty"`
 
+	// Total number of ready machines targeted by this deployment.
+	// +optional
+	ReadyReplicas int32 `json:"readyReplicas,omitempty"`
+
 	// Total number of available machines (ready for at least minReadySeconds).
 	// +optional
 	AvailableReplicas int32 `json:"availableReplicas,omitempty"`
@@ -124,6 +178,11 @@ type CaptMachineDeploymentStatus struct {
 	// +optional
 	Conditions []metav1.Condition `json:"conditions,omitempty"`
 
+	// ProgressStartTime is the time the rollout last started or made progress. The rollout
+	// exceeds its deadline when it makes no progress for progressDeadlineSeconds after it.
+	// +optional
+	ProgressStartTime *metav1.Time `json:"progressStartTime,omitempty"`
+
 	// Count of hash collisions for the MachineDeployment. The MachineDeployment controller
 	// uses this field as a collision avoidance mechanism when it needs to create the name for the
 	// newest MachineSet.
@@ -145,10 +204,11 @@ type CaptMachineDeploymentStatus struct {
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:subresource:scale:specpath=.spec.replicas,statuspath=.status.replicas
-//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Ready')].status"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type=='Available')].status"
 //+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas"
 //+kubebuilder:printcolumn:name="Updated",type="integer",JSONPath=".status.updatedReplicas"
 //+kubebuilder:printcolumn:name="Available",type="integer",JSONPath=".status.availableReplicas"
+//+kubebuilder:printcolumn:name="Progress",type="string",JSONPath=".status.conditions[?(@.type=='Progressing')].reason"
 
 // CaptMachineDeployment is the Schema for the captmachinedeployments API
 type CaptMachineDeployment struct {
@@ -0,0 +1,161 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MachinePoolReadyCondition reports whether the node group workspace has been applied
+	MachinePoolReadyCondition = "Ready"
+	// MachinePoolScalingCondition reports whether the node group has the replicas of the MachinePool
+	MachinePoolScalingCondition = "Scaling"
+
+	// ReasonNodeGroupReady means the node group workspace is applied
+	ReasonNodeGroupReady = "NodeGroupReady"
+	// ReasonNodeGroupProvisioning means the node group workspace is being applied
+	ReasonNodeGroupProvisioning = "NodeGroupProvisioning"
+	// ReasonReplicasOutOfRange means the replicas of the MachinePool are outside of the scaling bounds
+	ReasonReplicasOutOfRange = "ReplicasOutOfRange"
+	// ReasonScaledToReplicas means the node group has the desired replicas
+	ReasonScaledToReplicas = "ScaledToReplicas"
+	// ReasonScalingInProgress means the node group has not reached the desired replicas yet
+	ReasonScalingInProgress = "ScalingInProgress"
+)
+
+// CaptMachinePoolSpec defines the desired state of CaptMachinePool
+type CaptMachinePoolSpec struct {
+	// WorkspaceTemplateRef is a reference to the WorkspaceTemplate used for creating the node group
+	// +kubebuilder:validation:Required
+	WorkspaceTemplateRef WorkspaceTemplateReference `json:"workspaceTemplateRef"`
+
+	// NodeGroupName is the name of the EKS managed node group. It defaults to the name of the
+	// CaptMachinePool.
+	// +optional
+	NodeGroupName string `json:"nodeGroupName,omitempty"`
+
+	// InstanceType is the EC2 instance type to use for the nodes
+	// +kubebuilder:validation:Required
+	InstanceType string `json:"instanceType"`
+
+	// Scaling defines the bounds of the node group. The replicas of the MachinePool are the
+	// desired size of the node group within these bounds.
+	// +optional
+	Scaling *MachinePoolScaling `json:"scaling,omitempty"`
+
+	// Labels is a map of kubernetes labels to apply to the nodes
+	// +optional
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Taints specifies the taints to apply to the nodes
+	// +optional
+	Taints []corev1.Taint `json:"taints,omitempty"`
+
+	// AdditionalTags is a map of additional AWS tags to apply to the node group
+	// +optional
+	AdditionalTags map[string]string `json:"additionalTags,omitempty"`
+
+	// ProviderIDList are the providerIDs of the instances of the node group, set by the controller
+	// from the instances output and refreshed from EC2 between applies
+	// +optional
+	ProviderIDList []string `json:"providerIDList,omitempty"`
+}
+
+// MachinePoolScaling defines the bounds of a managed node group
+type MachinePoolScaling struct {
+	// MinSize is the minimum size of the node group
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MinSize *int32 `json:"minSize,omitempty"`
+
+	// MaxSize is the maximum size of the node group
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxSize *int32 `json:"maxSize,omitempty"`
+}
+
+// CaptMachinePoolStatus defines the observed state of CaptMachinePool
+type CaptMachinePoolStatus struct {
+	// Ready denotes that the node group has been created
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Replicas is the number of instances of the node group in the providerIDList
+	// +optional
+	Replicas int32 `json:"replicas"`
+
+	// DesiredSize is the desired size applied to the node group
+	// +optional
+	DesiredSize int32 `json:"desiredSize,omitempty"`
+
+	// NodeGroupARN is the ARN of the node group
+	// +optional
+	NodeGroupARN string `json:"nodeGroupARN,omitempty"`
+
+	// WorkspaceTemplateApplyName is the name of the WorkspaceTemplateApply of the node group
+	// +optional
+	WorkspaceTemplateApplyName string `json:"workspaceTemplateApplyName,omitempty"`
+
+	// Conditions defines current service state of the CaptMachinePool
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// FailureReason indicates that there is a terminal problem reconciling the
+	// state, and will be set to a token value suitable for programmatic
+	// interpretation.
+	// +optional
+	FailureReason *string `json:"failureReason,omitempty"`
+
+	// FailureMessage indicates that there is a terminal problem reconciling the
+	// state, and will be set to a descriptive error message.
+	// +optional
+	FailureMessage *string `json:"failureMessage,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:path=captmachinepools,scope=Namespaced,categories=cluster-api
+//+kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".metadata.labels.cluster\\.x-k8s\\.io/cluster-name",description="Cluster to which this CaptMachinePool belongs"
+//+kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Node group Ready status"
+//+kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Number of instances of the node group"
+//+kubebuilder:printcolumn:name="Desired",type="integer",JSONPath=".status.desiredSize",description="Desired size of the node group"
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// CaptMachinePool is the Schema for the captmachinepools API. It implements the Cluster API
+// InfraMachinePool contract with an EKS managed node group.
+type CaptMachinePool struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CaptMachinePoolSpec   `json:"spec,omitempty"`
+	Status CaptMachinePoolStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CaptMachinePoolList contains a list of CaptMachinePool
+type CaptMachinePoolList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CaptMachinePool `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CaptMachinePool{}, &CaptMachinePoolList{})
+}
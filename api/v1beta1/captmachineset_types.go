@@ -35,6 +35,12 @@ type CaptMachineSetSpec struct {
 	// Template is the object that describes the machine that will be created if
 	// insufficient replicas are detected.
 	Template CaptMachineTemplateSpec `json:"template"`
+
+	// MinReadySeconds is the minimum number of seconds for which a newly created machine should
+	// be ready for it to be considered available.
+	// Defaults to 0 (machine will be considered available as soon as it is ready)
+	// +optional
+	MinReadySeconds int32 `json:"minReadySeconds,omitempty"`
 }
 
 // CaptMachineTemplateSpec describes the data needed to create a CaptMachine from a template
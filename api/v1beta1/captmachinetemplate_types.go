@@ -19,6 +19,7 @@ package v1beta1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
 // NodeType defines the type of node group
@@ -38,8 +39,14 @@ type CaptInfraMachineTemplateSpec struct {
 	Template CaptInfraMachineTemplateResource `json:"template"`
 }
 
-// CaptInfraMachineTemplateResource describes the data needed to create a CaptMachine from a template
+// CaptInfraMachineTemplateResource describes the data needed to create a CaptMachine from a template.
+// Cluster API clones the spec into the CaptMachines of a MachineDeployment; NodeType and Scaling
+// only apply to the node group and are not part of a CaptMachine.
 type CaptInfraMachineTemplateResource struct {
+	// Standard object's metadata copied to the CaptMachines created from the template
+	// +optional
+	ObjectMeta clusterv1.ObjectMeta `json:"metadata,omitempty"`
+
 	// Spec is the specification of the desired behavior of the machine.
 	Spec CaptInfraMachineTemplateResourceSpec `json:"spec"`
 }
@@ -50,6 +57,11 @@ type CaptInfraMachineTemplateResourceSpec struct {
 	// +kubebuilder:validation:Required
 	WorkspaceTemplateRef WorkspaceTemplateReference `json:"workspaceTemplateRef"`
 
+	// NodeGroupRef is a reference to the NodeGroup the machines belong to. It defaults to the
+	// node group named after the MachineDeployment of a machine.
+	// +optional
+	NodeGroupRef *NodeGroupReference `json:"nodeGroupRef,omitempty"`
+
 	// NodeType specifies the type of node group (ManagedNodeGroup or Fargate)
 	// +kubebuilder:validation:Required
 	NodeType NodeType `json:"nodeType"`
@@ -66,6 +78,10 @@ type CaptInfraMachineTemplateResourceSpec struct {
 	// +optional
 	Labels map[string]string `json:"labels,omitempty"`
 
+	// Tags is a map of tags to apply to the node
+	// +optional
+	Tags map[string]string `json:"tags,omitempty"`
+
 	// Taints specifies the taints to apply to the nodes
 	// +optional
 	Taints []corev1.Taint `json:"taints,omitempty"`
@@ -17,7 +17,11 @@ limitations under the License.
 package v1beta1
 
 import (
+	"encoding/json"
+	"fmt"
+
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -37,24 +41,399 @@ type WorkspaceTemplateApplySpec struct {
 	// +optional
 	Variables map[string]string `json:"variables,omitempty"`
 
+	// StructuredVariables provides variables whose values are arbitrary JSON values
+	// such as lists, maps, numbers and booleans. They are passed to the workspace through
+	// its varmap so that Terraform receives them with their original types, and can also be
+	// referenced as ${name} in the template, where they are rendered as HCL literals.
+	// A name must not be used in both Variables and StructuredVariables.
+	// +optional
+	StructuredVariables map[string]apiextensionsv1.JSON `json:"structuredVariables,omitempty"`
+
+	// VariablesFrom provides variables whose values are resolved by the controller from
+	// Secrets, ConfigMaps or the outputs of other WorkspaceTemplateApplies each time the
+	// template is rendered. The workspace is updated whenever a source changes.
+	// Sources must be in the namespace of the WorkspaceTemplateApply. Values of ConfigMaps
+	// and outputs are rendered like variables, while values of Secrets are never written
+	// to the Workspace spec: they are passed to Terraform through a JSON var file stored in
+	// the <name>-variables-<revision> Secret of each revision, and cannot be referenced as
+	// ${name}. Secret values are part of the revision, so a changed Secret is planned and
+	// approved according to the applyPolicy, and rollbackTo restores the previous values.
+	// +optional
+	VariablesFrom []VariableFrom `json:"variablesFrom,omitempty"`
+
+	// IdentityRef references the CAPTClusterIdentity whose ProviderConfig the workspace uses,
+	// replacing the providerConfigRef of the template. The namespace of the apply must be
+	// allowed by the identity. If the region variable is set, it is also passed to the
+	// workspace as AWS_REGION.
+	// +optional
+	IdentityRef *IdentityReference `json:"identityRef,omitempty"`
+
 	// WaitForSecrets specifies a list of secrets that must exist before creating the workspace
 	// +optional
 	WaitForSecrets []xpv1.SecretReference `json:"waitForSecrets,omitempty"`
 
-	// WaitForWorkspaces specifies a list of workspaces that must be ready before creating this workspace
+	// WaitForWorkspaces specifies a list of workspaces that must be ready before creating this workspace.
+	// Workspaces of other WorkspaceTemplateApplies are named as in their status.workspaceName.
 	// +optional
 	WaitForWorkspaces []WorkspaceReference `json:"waitForWorkspaces,omitempty"`
 
+	// DependsOn lists the WorkspaceTemplateApplies that must be applied and ready before
+	// this one is applied. Dependencies must be in the namespace of the WorkspaceTemplateApply
+	// and form a directed acyclic graph: cycles and missing dependencies are reported through
+	// the DependenciesReady condition. The workspace of an apply is not deleted while other
+	// applies still depend on it, through dependsOn or waitForWorkspaces, so that dependents
+	// are torn down first.
+	// +optional
+	DependsOn []WorkspaceTemplateApplyReference `json:"dependsOn,omitempty"`
+
+	// ApplyPolicy specifies how changes to the rendered Workspace are applied.
+	// Auto applies every change. PlanOnly renders revisions into a separate <workspace>-plan
+	// Workspace with the Observe-only management policy, so that Terraform only plans them,
+	// and reports the plan in status.plan. ManualApproval plans each new revision like
+	// PlanOnly and applies it once the approved-revision annotation is set to that revision.
+	// The applied Workspace keeps the last applied revision while a revision is planned.
+	// The plan Workspace uses the Terraform workspace of the applied Workspace, so plans
+	// of updates are only accurate when the ProviderConfig stores state in a remote backend.
+	// +kubebuilder:validation:Enum=Auto;PlanOnly;ManualApproval
+	// +kubebuilder:default=Auto
+	// +optional
+	ApplyPolicy ApplyPolicy `json:"applyPolicy,omitempty"`
+
+	// RevisionHistoryLimit is the number of previously applied revisions to keep in
+	// addition to the current one. Each applied rendering of the Workspace is stored in a
+	// ControllerRevision labelled with the name of this WorkspaceTemplateApply. Variables
+	// from Secrets are stored as references, never as values.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=10
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// RollbackTo pins the Workspace to a previously applied revision from the revision
+	// history, ignoring changes to the template and variables. Clear it to resume applying
+	// the current rendering of the template. Variables from Secrets keep their current
+	// values on rollback.
+	// +optional
+	RollbackTo string `json:"rollbackTo,omitempty"`
+
+	// DriftDetection enables periodic drift detection on the applied Workspace.
+	// Each check plans the applied revision in a separate Observe-only Workspace and
+	// reports changes through the Drifted condition and status.drift. The applied
+	// Workspace keeps its management policies, so provider-terraform still applies drift
+	// at its next poll unless the template omits the Update action. Like plans, drift
+	// checks need the ProviderConfig to store state in a remote backend.
+	// +optional
+	DriftDetection *DriftDetection `json:"driftDetection,omitempty"`
+
 	// RetainWorkspaceOnDelete specifies whether to retain the Workspace when this WorkspaceTemplateApply is deleted
 	// This is useful when the Workspace manages shared resources that should outlive this WorkspaceTemplateApply
 	// +optional
 	RetainWorkspaceOnDelete bool `json:"retainWorkspaceOnDelete,omitempty"`
 }
 
+const (
+	// VariablesResolvedCondition indicates whether every variable referenced by the template could be resolved
+	VariablesResolvedCondition xpv1.ConditionType = "VariablesResolved"
+
+	// ReasonVariablesResolved represents that all template variables were resolved
+	ReasonVariablesResolved xpv1.ConditionReason = "VariablesResolved"
+
+	// ReasonUnresolvedVariables represents that the template references variables without a value or default
+	ReasonUnresolvedVariables xpv1.ConditionReason = "UnresolvedVariables"
+
+	// ReasonVariableSourcesUnavailable represents that some variablesFrom sources could not be resolved yet
+	ReasonVariableSourcesUnavailable xpv1.ConditionReason = "VariableSourcesUnavailable"
+
+	// DependenciesReadyCondition indicates whether every WorkspaceTemplateApply listed in dependsOn is ready
+	DependenciesReadyCondition xpv1.ConditionType = "DependenciesReady"
+
+	// ReasonDependenciesReady represents that all dependencies are applied and ready
+	ReasonDependenciesReady xpv1.ConditionReason = "DependenciesReady"
+
+	// ReasonWaitingForDependencies represents that some dependencies are not ready yet
+	ReasonWaitingForDependencies xpv1.ConditionReason = "WaitingForDependencies"
+
+	// ReasonDependencyNotFound represents that some dependencies do not exist
+	ReasonDependencyNotFound xpv1.ConditionReason = "DependencyNotFound"
+
+	// ReasonDependencyCycle represents that the dependency graph contains a cycle
+	ReasonDependencyCycle xpv1.ConditionReason = "DependencyCycle"
+
+	// ReasonDependencyNamespaceNotAllowed represents that a dependency is in another namespace
+	ReasonDependencyNamespaceNotAllowed xpv1.ConditionReason = "DependencyNamespaceNotAllowed"
+
+	// BlockedByDependentsCondition indicates that the deletion of the workspace is blocked
+	// because other WorkspaceTemplateApplies still depend on it
+	BlockedByDependentsCondition xpv1.ConditionType = "BlockedByDependents"
+
+	// ReasonDependentsExist represents that live dependents still reference the WorkspaceTemplateApply
+	ReasonDependentsExist xpv1.ConditionReason = "DependentsExist"
+
+	// ReasonNoDependents represents that no dependents reference the WorkspaceTemplateApply
+	ReasonNoDependents xpv1.ConditionReason = "NoDependents"
+
+	// IdentityReadyCondition indicates whether the CAPTClusterIdentity of identityRef can be used
+	IdentityReadyCondition xpv1.ConditionType = "IdentityReady"
+
+	// ReasonIdentityReady represents that the workspace uses the ProviderConfig of the identity
+	ReasonIdentityReady xpv1.ConditionReason = "IdentityReady"
+
+	// ReasonIdentityNotFound represents that the referenced CAPTClusterIdentity does not exist
+	ReasonIdentityNotFound xpv1.ConditionReason = "IdentityNotFound"
+
+	// ReasonNamespaceNotAllowed represents that the identity does not allow the namespace of the apply
+	ReasonNamespaceNotAllowed xpv1.ConditionReason = "NamespaceNotAllowed"
+
+	// ReasonProviderConfigNotReady represents that the ProviderConfig of the identity is not created yet
+	ReasonProviderConfigNotReady xpv1.ConditionReason = "ProviderConfigNotReady"
+
+	// ReasonProviderConfigNotAllowed represents that the rendered workspace names the ProviderConfig
+	// of an identity without referencing the identity through identityRef
+	ReasonProviderConfigNotAllowed xpv1.ConditionReason = "ProviderConfigNotAllowed"
+)
+
+// ApplyPolicy specifies how changes to a WorkspaceTemplateApply are applied
+type ApplyPolicy string
+
+const (
+	// ApplyPolicyAuto applies every change immediately
+	ApplyPolicyAuto ApplyPolicy = "Auto"
+
+	// ApplyPolicyPlanOnly only plans changes and never applies them
+	ApplyPolicyPlanOnly ApplyPolicy = "PlanOnly"
+
+	// ApplyPolicyManualApproval plans changes and applies them once approved
+	ApplyPolicyManualApproval ApplyPolicy = "ManualApproval"
+)
+
+const (
+	// ApprovedRevisionAnnotation approves a revision of a WorkspaceTemplateApply with the
+	// ManualApproval apply policy. Its value must match status.plan.revision.
+	ApprovedRevisionAnnotation = "infrastructure.cluster.x-k8s.io/approved-revision"
+
+	// ApprovedCondition indicates whether the rendered revision may be applied
+	ApprovedCondition xpv1.ConditionType = "Approved"
+
+	// ReasonApproved represents that the rendered revision is applied
+	ReasonApproved xpv1.ConditionReason = "Approved"
+
+	// ReasonPlanOnly represents that the apply policy only allows planning
+	ReasonPlanOnly xpv1.ConditionReason = "PlanOnly"
+
+	// ReasonAwaitingApproval represents that the rendered revision waits for approval
+	ReasonAwaitingApproval xpv1.ConditionReason = "AwaitingApproval"
+)
+
+const (
+	// RolledBackCondition indicates whether the Workspace is pinned to a revision through rollbackTo
+	RolledBackCondition xpv1.ConditionType = "RolledBack"
+
+	// ReasonRolledBack represents that the Workspace is pinned to the rollbackTo revision
+	ReasonRolledBack xpv1.ConditionReason = "RolledBack"
+
+	// ReasonRevisionNotFound represents that the rollbackTo revision is not in the revision history
+	ReasonRevisionNotFound xpv1.ConditionReason = "RevisionNotFound"
+
+	// ReasonFollowingTemplate represents that the Workspace follows the template again after a rollback
+	ReasonFollowingTemplate xpv1.ConditionReason = "FollowingTemplate"
+)
+
+// DriftDetection configures drift detection of the applied Workspace
+type DriftDetection struct {
+	// Interval between drift checks
+	// +kubebuilder:default="10m"
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// AutoRemediate has provider-terraform re-apply the current revision as soon as drift
+	// is detected instead of at its next poll. The revision is planned again shortly after
+	// to verify that the re-apply removed the drift; drift that persists is reported with
+	// the DriftRemediationFailed reason and remediated again at the next check.
+	// Remediation requires the template to allow the Update management action.
+	// +optional
+	AutoRemediate bool `json:"autoRemediate,omitempty"`
+}
+
+const (
+	// DriftedCondition indicates whether the infrastructure has drifted from the applied revision
+	DriftedCondition xpv1.ConditionType = "Drifted"
+
+	// ReasonNoDrift represents that the last drift check found no changes
+	ReasonNoDrift xpv1.ConditionReason = "NoDrift"
+
+	// ReasonDriftDetected represents that the last drift check found changes
+	ReasonDriftDetected xpv1.ConditionReason = "DriftDetected"
+
+	// ReasonRemediatingDrift represents that the applied revision is being re-applied to remediate drift
+	ReasonRemediatingDrift xpv1.ConditionReason = "RemediatingDrift"
+
+	// ReasonDriftCheckFailed represents that the last drift check could not plan the applied revision
+	ReasonDriftCheckFailed xpv1.ConditionReason = "DriftCheckFailed"
+
+	// ReasonDriftRemediationFailed represents that re-applying the applied revision did not remove the drift
+	ReasonDriftRemediationFailed xpv1.ConditionReason = "DriftRemediationFailed"
+)
+
 // ValidateConfiguration validates the WorkspaceTemplateApplySpec configuration
 func (s *WorkspaceTemplateApplySpec) ValidateConfiguration() error {
-	// 現時点では特別なバリデーションは必要ないが、
-	// 将来的に必要になった場合のために関数を用意しておく
+	for name := range s.StructuredVariables {
+		if _, ok := s.Variables[name]; ok {
+			return fmt.Errorf("variable %q is defined in both variables and structuredVariables", name)
+		}
+	}
+
+	seen := make(map[string]bool, len(s.VariablesFrom))
+	for _, v := range s.VariablesFrom {
+		if seen[v.Name] {
+			return fmt.Errorf("variable %q is defined more than once in variablesFrom", v.Name)
+		}
+		seen[v.Name] = true
+
+		if _, ok := s.Variables[v.Name]; ok {
+			return fmt.Errorf("variable %q is defined in both variables and variablesFrom", v.Name)
+		}
+		if _, ok := s.StructuredVariables[v.Name]; ok {
+			return fmt.Errorf("variable %q is defined in both structuredVariables and variablesFrom", v.Name)
+		}
+		if err := v.ValueFrom.validate(); err != nil {
+			return fmt.Errorf("variable %q: %w", v.Name, err)
+		}
+	}
+
+	seenDependencies := make(map[WorkspaceTemplateApplyReference]bool, len(s.DependsOn))
+	for _, dep := range s.DependsOn {
+		if seenDependencies[dep] {
+			return fmt.Errorf("dependency %q is listed more than once in dependsOn", dep.Name)
+		}
+		seenDependencies[dep] = true
+	}
+	return nil
+}
+
+// ValidateSourceNamespaces checks that the variablesFrom sources are in the given namespace,
+// the namespace of the WorkspaceTemplateApply, so that an apply cannot read Secrets,
+// ConfigMaps or outputs of other namespaces through the controller
+func (s *WorkspaceTemplateApplySpec) ValidateSourceNamespaces(namespace string) error {
+	for _, v := range s.VariablesFrom {
+		var sourceNamespace string
+		switch source := v.ValueFrom; {
+		case source.SecretKeyRef != nil:
+			sourceNamespace = source.SecretKeyRef.Namespace
+		case source.ConfigMapKeyRef != nil:
+			sourceNamespace = source.ConfigMapKeyRef.Namespace
+		case source.OutputRef != nil:
+			sourceNamespace = source.OutputRef.Namespace
+		}
+		if sourceNamespace != "" && sourceNamespace != namespace {
+			return fmt.Errorf("variable %q: source namespace %q must be the namespace of the WorkspaceTemplateApply", v.Name, sourceNamespace)
+		}
+	}
+	return nil
+}
+
+// ValidateDependencyNamespaces checks that the dependsOn dependencies are in the given
+// namespace, the namespace of the WorkspaceTemplateApply, so that an apply can neither block
+// the deletion of applies of other namespaces nor observe whether they are ready
+func (s *WorkspaceTemplateApplySpec) ValidateDependencyNamespaces(namespace string) error {
+	for _, dep := range s.DependsOn {
+		if dep.Namespace != "" && dep.Namespace != namespace {
+			return fmt.Errorf("dependency %q: namespace %q must be the namespace of the WorkspaceTemplateApply", dep.Name, dep.Namespace)
+		}
+	}
+	return nil
+}
+
+// VariableFrom defines a variable whose value is resolved from another resource
+type VariableFrom struct {
+	// Name of the variable as referenced in the template
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// ValueFrom specifies where the value of the variable comes from
+	// +kubebuilder:validation:Required
+	ValueFrom VariableSource `json:"valueFrom"`
+}
+
+// VariableSource specifies the source of a variable value. Exactly one source must be set.
+type VariableSource struct {
+	// SecretKeyRef selects a key of a Secret in the namespace of the WorkspaceTemplateApply.
+	// The value is passed to Terraform as a variable of the same name through a var file.
+	// +optional
+	SecretKeyRef *KeySelector `json:"secretKeyRef,omitempty"`
+
+	// ConfigMapKeyRef selects a key of a ConfigMap in the namespace of the WorkspaceTemplateApply.
+	// +optional
+	ConfigMapKeyRef *KeySelector `json:"configMapKeyRef,omitempty"`
+
+	// OutputRef selects a Terraform output of another WorkspaceTemplateApply in the same namespace.
+	// Non-string outputs are passed with their original types like structured variables.
+	// +optional
+	OutputRef *OutputReference `json:"outputRef,omitempty"`
+
+	// Optional specifies that the variable may be left unset while its source is not available,
+	// in which case the default in the template, if any, applies
+	// +optional
+	Optional bool `json:"optional,omitempty"`
+}
+
+func (s *VariableSource) validate() error {
+	count := 0
+	if s.SecretKeyRef != nil {
+		count++
+	}
+	if s.ConfigMapKeyRef != nil {
+		count++
+	}
+	if s.OutputRef != nil {
+		count++
+	}
+	if count != 1 {
+		return fmt.Errorf("exactly one of secretKeyRef, configMapKeyRef or outputRef must be specified")
+	}
+	return nil
+}
+
+// KeySelector selects a key of a Secret or ConfigMap
+type KeySelector struct {
+	// Name of the referenced object
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the referenced object. If set, it must be the namespace of the
+	// WorkspaceTemplateApply.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Key to select
+	// +kubebuilder:validation:Required
+	Key string `json:"key"`
+}
+
+// OutputReference selects a Terraform output of a WorkspaceTemplateApply
+type OutputReference struct {
+	// Name of the referenced WorkspaceTemplateApply
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the referenced WorkspaceTemplateApply. If set, it must be the namespace
+	// of the WorkspaceTemplateApply.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// Output is the name of the Terraform output
+	// +kubebuilder:validation:Required
+	Output string `json:"output"`
+}
+
+// SetStructuredVariable encodes the given value as JSON and stores it as a structured variable
+func (s *WorkspaceTemplateApplySpec) SetStructuredVariable(name string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode structured variable %q: %w", name, err)
+	}
+	if s.StructuredVariables == nil {
+		s.StructuredVariables = map[string]apiextensionsv1.JSON{}
+	}
+	s.StructuredVariables[name] = apiextensionsv1.JSON{Raw: raw}
 	return nil
 }
 
@@ -80,9 +459,22 @@ type WorkspaceReference struct {
 	Namespace string `json:"namespace,omitempty"`
 }
 
+// WorkspaceTemplateApplyReference defines a reference to a WorkspaceTemplateApply
+type WorkspaceTemplateApplyReference struct {
+	// Name of the referenced WorkspaceTemplateApply
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the referenced WorkspaceTemplateApply.
+	// If omitted, the namespace of the referencing WorkspaceTemplateApply is used.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
 // WorkspaceTemplateApplyStatus defines the observed state of WorkspaceTemplateApply
 type WorkspaceTemplateApplyStatus struct {
-	// WorkspaceName is the name of the created Terraform Workspace
+	// WorkspaceName is the name of the created Terraform Workspace. Workspaces are cluster-scoped,
+	// so the name is prefixed with the namespace of the WorkspaceTemplateApply.
 	// +optional
 	WorkspaceName string `json:"workspaceName,omitempty"`
 
@@ -94,15 +486,102 @@ type WorkspaceTemplateApplyStatus struct {
 	// +optional
 	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
 
+	// LastAppliedRevision is the hash of the rendered Workspace spec that was last applied.
+	// It changes whenever the referenced WorkspaceTemplate or the variables change.
+	// +optional
+	LastAppliedRevision string `json:"lastAppliedRevision,omitempty"`
+
+	// ObservedTemplateGeneration is the generation of the WorkspaceTemplate that was last applied
+	// +optional
+	ObservedTemplateGeneration int64 `json:"observedTemplateGeneration,omitempty"`
+
+	// Plan reports the Terraform plan of a revision that has not been applied because of
+	// the apply policy. It is cleared once the revision is applied.
+	// +optional
+	Plan *PlanStatus `json:"plan,omitempty"`
+
+	// Drift reports the drift checks of the applied Workspace
+	// +optional
+	Drift *DriftStatus `json:"drift,omitempty"`
+
+	// Outputs contains the non-sensitive Terraform outputs of the workspace
+	// +optional
+	Outputs map[string]apiextensionsv1.JSON `json:"outputs,omitempty"`
+
+	// SensitiveOutputs references the sensitive Terraform outputs of the workspace.
+	// Their values are not copied into the status and can be read from the referenced Secret.
+	// +optional
+	SensitiveOutputs []SensitiveOutput `json:"sensitiveOutputs,omitempty"`
+
 	// Conditions of the resource.
 	// +optional
 	Conditions []xpv1.Condition `json:"conditions,omitempty"`
 }
 
+// PlanStatus reports the Terraform plan of a rendered revision.
+// provider-terraform only reports whether the plan has changes, not the changes themselves,
+// so the plan also lists the inputs of the Workspace that the revision changes.
+type PlanStatus struct {
+	// Revision is the revision of the rendered Workspace spec that was planned
+	Revision string `json:"revision"`
+
+	// ChangedInputs lists the inputs of the applied Workspace that the revision changes,
+	// such as module, var.<name>, env.<name>, varFiles, args and providerConfigRef.
+	// It is empty when no revision has been applied yet.
+	// +optional
+	ChangedInputs []string `json:"changedInputs,omitempty"`
+
+	// HasChanges indicates whether applying the revision would change the infrastructure.
+	// It is unset until the plan has completed.
+	// +optional
+	HasChanges *bool `json:"hasChanges,omitempty"`
+
+	// Summary is a human readable summary of the plan
+	// +optional
+	Summary string `json:"summary,omitempty"`
+
+	// LastPlannedTime is the last time the revision was submitted for planning
+	// +optional
+	LastPlannedTime *metav1.Time `json:"lastPlannedTime,omitempty"`
+}
+
+// DriftStatus reports the drift checks of the applied Workspace
+type DriftStatus struct {
+	// LastCheckTime is the last time a drift check was started
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+
+	// LastDetectedTime is the last time drift was detected
+	// +optional
+	LastDetectedTime *metav1.Time `json:"lastDetectedTime,omitempty"`
+
+	// LastRemediationTime is the last time the applied revision was re-applied to remediate drift
+	// +optional
+	LastRemediationTime *metav1.Time `json:"lastRemediationTime,omitempty"`
+
+	// ChangedResources is the number of resources with changes found by the last drift check.
+	// It is only set when the drift Workspace reports a Terraform plan summary in its
+	// conditions; provider-terraform does not always do so, and the field is then left
+	// empty even though the Drifted condition is true.
+	// +optional
+	ChangedResources *int32 `json:"changedResources,omitempty"`
+}
+
+// SensitiveOutput references a sensitive Terraform output stored in a Secret
+type SensitiveOutput struct {
+	// Name of the Terraform output
+	Name string `json:"name"`
+
+	// SecretKeyRef selects the Secret key holding the value of the output.
+	// String outputs are stored as they are, other types are stored as JSON.
+	SecretKeyRef xpv1.SecretKeySelector `json:"secretKeyRef"`
+}
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="WORKSPACE",type="string",JSONPath=".status.workspaceName"
 //+kubebuilder:printcolumn:name="APPLIED",type="boolean",JSONPath=".status.applied"
+//+kubebuilder:printcolumn:name="REVISION",type="string",JSONPath=".status.lastAppliedRevision",priority=1
 //+kubebuilder:printcolumn:name="AGE",type="date",JSONPath=".metadata.creationTimestamp"
 //+kubebuilder:resource:categories={capt,terraform},shortName=wtapply,scope=Namespaced,path=workspacetemplateapplies,singular=workspacetemplateapply
 //+groupName=infrastructure.cluster.x-k8s.io
@@ -27,12 +27,38 @@ package v1beta1
 import (
 	commonv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	apiv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AllowedNamespaces) DeepCopyInto(out *AllowedNamespaces) {
+	*out = *in
+	if in.List != nil {
+		in, out := &in.List, &out.List
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AllowedNamespaces.
+func (in *AllowedNamespaces) DeepCopy() *AllowedNamespaces {
+	if in == nil {
+		return nil
+	}
+	out := new(AllowedNamespaces)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CAPTCluster) DeepCopyInto(out *CAPTCluster) {
 	*out = *in
@@ -60,6 +86,112 @@ func (in *CAPTCluster) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAPTClusterIdentity) DeepCopyInto(out *CAPTClusterIdentity) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAPTClusterIdentity.
+func (in *CAPTClusterIdentity) DeepCopy() *CAPTClusterIdentity {
+	if in == nil {
+		return nil
+	}
+	out := new(CAPTClusterIdentity)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CAPTClusterIdentity) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAPTClusterIdentityList) DeepCopyInto(out *CAPTClusterIdentityList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CAPTClusterIdentity, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAPTClusterIdentityList.
+func (in *CAPTClusterIdentityList) DeepCopy() *CAPTClusterIdentityList {
+	if in == nil {
+		return nil
+	}
+	out := new(CAPTClusterIdentityList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CAPTClusterIdentityList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAPTClusterIdentitySpec) DeepCopyInto(out *CAPTClusterIdentitySpec) {
+	*out = *in
+	if in.AllowedNamespaces != nil {
+		in, out := &in.AllowedNamespaces, &out.AllowedNamespaces
+		*out = new(AllowedNamespaces)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(commonv1.SecretKeySelector)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAPTClusterIdentitySpec.
+func (in *CAPTClusterIdentitySpec) DeepCopy() *CAPTClusterIdentitySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CAPTClusterIdentitySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CAPTClusterIdentityStatus) DeepCopyInto(out *CAPTClusterIdentityStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAPTClusterIdentityStatus.
+func (in *CAPTClusterIdentityStatus) DeepCopy() *CAPTClusterIdentityStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CAPTClusterIdentityStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CAPTClusterList) DeepCopyInto(out *CAPTClusterList) {
 	*out = *in
@@ -105,6 +237,11 @@ func (in *CAPTClusterSpec) DeepCopyInto(out *CAPTClusterSpec) {
 		*out = new(VPCConfig)
 		**out = **in
 	}
+	if in.IdentityRef != nil {
+		in, out := &in.IdentityRef, &out.IdentityRef
+		*out = new(IdentityReference)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CAPTClusterSpec.
@@ -180,9 +317,136 @@ func (in *CAPTClusterWorkspaceStatus) DeepCopy() *CAPTClusterWorkspaceStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptFargateProfile) DeepCopyInto(out *CaptFargateProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptFargateProfile.
+func (in *CaptFargateProfile) DeepCopy() *CaptFargateProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptFargateProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CaptFargateProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptFargateProfileList) DeepCopyInto(out *CaptFargateProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CaptFargateProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptFargateProfileList.
+func (in *CaptFargateProfileList) DeepCopy() *CaptFargateProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptFargateProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CaptFargateProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptFargateProfileSpec) DeepCopyInto(out *CaptFargateProfileSpec) {
+	*out = *in
+	out.WorkspaceTemplateRef = in.WorkspaceTemplateRef
+	if in.Selectors != nil {
+		in, out := &in.Selectors, &out.Selectors
+		*out = make([]FargateSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SubnetIDs != nil {
+		in, out := &in.SubnetIDs, &out.SubnetIDs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AdditionalTags != nil {
+		in, out := &in.AdditionalTags, &out.AdditionalTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptFargateProfileSpec.
+func (in *CaptFargateProfileSpec) DeepCopy() *CaptFargateProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptFargateProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptFargateProfileStatus) DeepCopyInto(out *CaptFargateProfileStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
+		*out = new(string)
+		**out = **in
+	}
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptFargateProfileStatus.
+func (in *CaptFargateProfileStatus) DeepCopy() *CaptFargateProfileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptFargateProfileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CaptInfraMachineTemplateResource) DeepCopyInto(out *CaptInfraMachineTemplateResource) {
 	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
 }
 
@@ -200,6 +464,11 @@ func (in *CaptInfraMachineTemplateResource) DeepCopy() *CaptInfraMachineTemplate
 func (in *CaptInfraMachineTemplateResourceSpec) DeepCopyInto(out *CaptInfraMachineTemplateResourceSpec) {
 	*out = *in
 	out.WorkspaceTemplateRef = in.WorkspaceTemplateRef
+	if in.NodeGroupRef != nil {
+		in, out := &in.NodeGroupRef, &out.NodeGroupRef
+		*out = new(NodeGroupReference)
+		**out = **in
+	}
 	if in.Scaling != nil {
 		in, out := &in.Scaling, &out.Scaling
 		*out = new(ScalingConfig)
@@ -212,6 +481,13 @@ func (in *CaptInfraMachineTemplateResourceSpec) DeepCopyInto(out *CaptInfraMachi
 			(*out)[key] = val
 		}
 	}
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	if in.Taints != nil {
 		in, out := &in.Taints, &out.Taints
 		*out = make([]corev1.Taint, len(*in))
@@ -391,6 +667,10 @@ func (in *CaptMachineDeploymentStatus) DeepCopyInto(out *CaptMachineDeploymentSt
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.ProgressStartTime != nil {
+		in, out := &in.ProgressStartTime, &out.ProgressStartTime
+		*out = (*in).DeepCopy()
+	}
 	if in.CollisionCount != nil {
 		in, out := &in.CollisionCount, &out.CollisionCount
 		*out = new(int32)
@@ -401,55 +681,193 @@ func (in *CaptMachineDeploymentStatus) DeepCopyInto(out *CaptMachineDeploymentSt
 		*out = new(string)
 		**out = **in
 	}
-	if in.FailureMessage != nil {
-		in, out := &in.FailureMessage, &out.FailureMessage
-		*out = new(string)
-		**out = **in
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachineDeploymentStatus.
+func (in *CaptMachineDeploymentStatus) DeepCopy() *CaptMachineDeploymentStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptMachineDeploymentStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptMachineList) DeepCopyInto(out *CaptMachineList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CaptMachine, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachineList.
+func (in *CaptMachineList) DeepCopy() *CaptMachineList {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptMachineList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CaptMachineList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptMachinePool) DeepCopyInto(out *CaptMachinePool) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachinePool.
+func (in *CaptMachinePool) DeepCopy() *CaptMachinePool {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptMachinePool)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CaptMachinePool) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptMachinePoolList) DeepCopyInto(out *CaptMachinePoolList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CaptMachinePool, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachinePoolList.
+func (in *CaptMachinePoolList) DeepCopy() *CaptMachinePoolList {
+	if in == nil {
+		return nil
+	}
+	out := new(CaptMachinePoolList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CaptMachinePoolList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CaptMachinePoolSpec) DeepCopyInto(out *CaptMachinePoolSpec) {
+	*out = *in
+	out.WorkspaceTemplateRef = in.WorkspaceTemplateRef
+	if in.Scaling != nil {
+		in, out := &in.Scaling, &out.Scaling
+		*out = new(MachinePoolScaling)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Taints != nil {
+		in, out := &in.Taints, &out.Taints
+		*out = make([]corev1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalTags != nil {
+		in, out := &in.AdditionalTags, &out.AdditionalTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ProviderIDList != nil {
+		in, out := &in.ProviderIDList, &out.ProviderIDList
+		*out = make([]string, len(*in))
+		copy(*out, *in)
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachineDeploymentStatus.
-func (in *CaptMachineDeploymentStatus) DeepCopy() *CaptMachineDeploymentStatus {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachinePoolSpec.
+func (in *CaptMachinePoolSpec) DeepCopy() *CaptMachinePoolSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(CaptMachineDeploymentStatus)
+	out := new(CaptMachinePoolSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *CaptMachineList) DeepCopyInto(out *CaptMachineList) {
+func (in *CaptMachinePoolStatus) DeepCopyInto(out *CaptMachinePoolStatus) {
 	*out = *in
-	out.TypeMeta = in.TypeMeta
-	in.ListMeta.DeepCopyInto(&out.ListMeta)
-	if in.Items != nil {
-		in, out := &in.Items, &out.Items
-		*out = make([]CaptMachine, len(*in))
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
 		for i := range *in {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.FailureReason != nil {
+		in, out := &in.FailureReason, &out.FailureReason
+		*out = new(string)
+		**out = **in
+	}
+	if in.FailureMessage != nil {
+		in, out := &in.FailureMessage, &out.FailureMessage
+		*out = new(string)
+		**out = **in
+	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachineList.
-func (in *CaptMachineList) DeepCopy() *CaptMachineList {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachinePoolStatus.
+func (in *CaptMachinePoolStatus) DeepCopy() *CaptMachinePoolStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(CaptMachineList)
+	out := new(CaptMachinePoolStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
-// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *CaptMachineList) DeepCopyObject() runtime.Object {
-	if c := in.DeepCopy(); c != nil {
-		return c
-	}
-	return nil
-}
-
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CaptMachineSet) DeepCopyInto(out *CaptMachineSet) {
 	*out = *in
@@ -570,7 +988,16 @@ func (in *CaptMachineSetStatus) DeepCopy() *CaptMachineSetStatus {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CaptMachineSpec) DeepCopyInto(out *CaptMachineSpec) {
 	*out = *in
-	out.NodeGroupRef = in.NodeGroupRef
+	if in.NodeGroupRef != nil {
+		in, out := &in.NodeGroupRef, &out.NodeGroupRef
+		*out = new(NodeGroupReference)
+		**out = **in
+	}
+	if in.ProviderID != nil {
+		in, out := &in.ProviderID, &out.ProviderID
+		*out = new(string)
+		**out = **in
+	}
 	out.WorkspaceTemplateRef = in.WorkspaceTemplateRef
 	if in.Labels != nil {
 		in, out := &in.Labels, &out.Labels
@@ -586,6 +1013,20 @@ func (in *CaptMachineSpec) DeepCopyInto(out *CaptMachineSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.Taints != nil {
+		in, out := &in.Taints, &out.Taints
+		*out = make([]corev1.Taint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AdditionalTags != nil {
+		in, out := &in.AdditionalTags, &out.AdditionalTags
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CaptMachineSpec.
@@ -611,6 +1052,11 @@ func (in *CaptMachineStatus) DeepCopyInto(out *CaptMachineStatus) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Addresses != nil {
+		in, out := &in.Addresses, &out.Addresses
+		*out = make([]apiv1beta1.MachineAddress, len(*in))
+		copy(*out, *in)
+	}
 	if in.LastTransitionTime != nil {
 		in, out := &in.LastTransitionTime, &out.LastTransitionTime
 		*out = (*in).DeepCopy()
@@ -719,6 +1165,110 @@ func (in *CaptMachineTemplateSpec) DeepCopy() *CaptMachineTemplateSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftDetection) DeepCopyInto(out *DriftDetection) {
+	*out = *in
+	if in.Interval != nil {
+		in, out := &in.Interval, &out.Interval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftDetection.
+func (in *DriftDetection) DeepCopy() *DriftDetection {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftDetection)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DriftStatus) DeepCopyInto(out *DriftStatus) {
+	*out = *in
+	if in.LastCheckTime != nil {
+		in, out := &in.LastCheckTime, &out.LastCheckTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastDetectedTime != nil {
+		in, out := &in.LastDetectedTime, &out.LastDetectedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRemediationTime != nil {
+		in, out := &in.LastRemediationTime, &out.LastRemediationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.ChangedResources != nil {
+		in, out := &in.ChangedResources, &out.ChangedResources
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DriftStatus.
+func (in *DriftStatus) DeepCopy() *DriftStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DriftStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FargateSelector) DeepCopyInto(out *FargateSelector) {
+	*out = *in
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FargateSelector.
+func (in *FargateSelector) DeepCopy() *FargateSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(FargateSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IdentityReference) DeepCopyInto(out *IdentityReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IdentityReference.
+func (in *IdentityReference) DeepCopy() *IdentityReference {
+	if in == nil {
+		return nil
+	}
+	out := new(IdentityReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KeySelector) DeepCopyInto(out *KeySelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KeySelector.
+func (in *KeySelector) DeepCopy() *KeySelector {
+	if in == nil {
+		return nil
+	}
+	out := new(KeySelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MachineDeploymentStrategy) DeepCopyInto(out *MachineDeploymentStrategy) {
 	*out = *in
@@ -739,6 +1289,31 @@ func (in *MachineDeploymentStrategy) DeepCopy() *MachineDeploymentStrategy {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachinePoolScaling) DeepCopyInto(out *MachinePoolScaling) {
+	*out = *in
+	if in.MinSize != nil {
+		in, out := &in.MinSize, &out.MinSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxSize != nil {
+		in, out := &in.MaxSize, &out.MaxSize
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachinePoolScaling.
+func (in *MachinePoolScaling) DeepCopy() *MachinePoolScaling {
+	if in == nil {
+		return nil
+	}
+	out := new(MachinePoolScaling)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MachineRollingUpdateDeployment) DeepCopyInto(out *MachineRollingUpdateDeployment) {
 	*out = *in
@@ -779,6 +1354,50 @@ func (in *NodeGroupReference) DeepCopy() *NodeGroupReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputReference) DeepCopyInto(out *OutputReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputReference.
+func (in *OutputReference) DeepCopy() *OutputReference {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlanStatus) DeepCopyInto(out *PlanStatus) {
+	*out = *in
+	if in.ChangedInputs != nil {
+		in, out := &in.ChangedInputs, &out.ChangedInputs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HasChanges != nil {
+		in, out := &in.HasChanges, &out.HasChanges
+		*out = new(bool)
+		**out = **in
+	}
+	if in.LastPlannedTime != nil {
+		in, out := &in.LastPlannedTime, &out.LastPlannedTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlanStatus.
+func (in *PlanStatus) DeepCopy() *PlanStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlanStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ScalingConfig) DeepCopyInto(out *ScalingConfig) {
 	*out = *in
@@ -794,6 +1413,22 @@ func (in *ScalingConfig) DeepCopy() *ScalingConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SensitiveOutput) DeepCopyInto(out *SensitiveOutput) {
+	*out = *in
+	out.SecretKeyRef = in.SecretKeyRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SensitiveOutput.
+func (in *SensitiveOutput) DeepCopy() *SensitiveOutput {
+	if in == nil {
+		return nil
+	}
+	out := new(SensitiveOutput)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VPCConfig) DeepCopyInto(out *VPCConfig) {
 	*out = *in
@@ -809,6 +1444,52 @@ func (in *VPCConfig) DeepCopy() *VPCConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VariableFrom) DeepCopyInto(out *VariableFrom) {
+	*out = *in
+	in.ValueFrom.DeepCopyInto(&out.ValueFrom)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VariableFrom.
+func (in *VariableFrom) DeepCopy() *VariableFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(VariableFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VariableSource) DeepCopyInto(out *VariableSource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(KeySelector)
+		**out = **in
+	}
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(KeySelector)
+		**out = **in
+	}
+	if in.OutputRef != nil {
+		in, out := &in.OutputRef, &out.OutputRef
+		*out = new(OutputReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VariableSource.
+func (in *VariableSource) DeepCopy() *VariableSource {
+	if in == nil {
+		return nil
+	}
+	out := new(VariableSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkspaceReference) DeepCopyInto(out *WorkspaceReference) {
 	*out = *in
@@ -910,6 +1591,21 @@ func (in *WorkspaceTemplateApplyList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WorkspaceTemplateApplyReference) DeepCopyInto(out *WorkspaceTemplateApplyReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceTemplateApplyReference.
+func (in *WorkspaceTemplateApplyReference) DeepCopy() *WorkspaceTemplateApplyReference {
+	if in == nil {
+		return nil
+	}
+	out := new(WorkspaceTemplateApplyReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WorkspaceTemplateApplySpec) DeepCopyInto(out *WorkspaceTemplateApplySpec) {
 	*out = *in
@@ -926,6 +1622,25 @@ func (in *WorkspaceTemplateApplySpec) DeepCopyInto(out *WorkspaceTemplateApplySp
 			(*out)[key] = val
 		}
 	}
+	if in.StructuredVariables != nil {
+		in, out := &in.StructuredVariables, &out.StructuredVariables
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.VariablesFrom != nil {
+		in, out := &in.VariablesFrom, &out.VariablesFrom
+		*out = make([]VariableFrom, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.IdentityRef != nil {
+		in, out := &in.IdentityRef, &out.IdentityRef
+		*out = new(IdentityReference)
+		**out = **in
+	}
 	if in.WaitForSecrets != nil {
 		in, out := &in.WaitForSecrets, &out.WaitForSecrets
 		*out = make([]commonv1.SecretReference, len(*in))
@@ -936,6 +1651,21 @@ func (in *WorkspaceTemplateApplySpec) DeepCopyInto(out *WorkspaceTemplateApplySp
 		*out = make([]WorkspaceReference, len(*in))
 		copy(*out, *in)
 	}
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]WorkspaceTemplateApplyReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+	if in.DriftDetection != nil {
+		in, out := &in.DriftDetection, &out.DriftDetection
+		*out = new(DriftDetection)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WorkspaceTemplateApplySpec.
@@ -955,6 +1685,28 @@ func (in *WorkspaceTemplateApplyStatus) DeepCopyInto(out *WorkspaceTemplateApply
 		in, out := &in.LastAppliedTime, &out.LastAppliedTime
 		*out = (*in).DeepCopy()
 	}
+	if in.Plan != nil {
+		in, out := &in.Plan, &out.Plan
+		*out = new(PlanStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Drift != nil {
+		in, out := &in.Drift, &out.Drift
+		*out = new(DriftStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make(map[string]apiextensionsv1.JSON, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.SensitiveOutputs != nil {
+		in, out := &in.SensitiveOutputs, &out.SensitiveOutputs
+		*out = make([]SensitiveOutput, len(*in))
+		copy(*out, *in)
+	}
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]commonv1.Condition, len(*in))
@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"flag"
 	"fmt"
@@ -29,19 +30,26 @@ import (
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
 
 	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
 	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
 	"github.com/appthrust/capt/internal/controller"
 	controlplanecontroller "github.com/appthrust/capt/internal/controller/controlplane"
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
+	"github.com/appthrust/capt/internal/controller/nodegroup"
+	webhookcontrolplanev1beta1 "github.com/appthrust/capt/internal/webhook/controlplane/v1beta1"
+	webhookinfrastructurev1beta1 "github.com/appthrust/capt/internal/webhook/infrastructure/v1beta1"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
 	//+kubebuilder:scaffold:imports
@@ -57,6 +65,11 @@ const (
 	infrastructureController = "infrastructure"
 )
 
+const (
+	kubeconfigAuthToken = "token"
+	kubeconfigAuthExec  = "exec"
+)
+
 var allControllers = []string{
 	controlPlaneController,
 	infrastructureController,
@@ -80,6 +93,7 @@ func init() {
 	utilruntime.Must(controlplanev1beta1.AddToScheme(scheme))
 	utilruntime.Must(tfv1beta1.SchemeBuilder.AddToScheme(scheme))
 	utilruntime.Must(clusterv1.AddToScheme(scheme))
+	utilruntime.Must(expv1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -88,11 +102,28 @@ func main() {
 	var enableLeaderElection bool
 	var probeAddr string
 	var enabledControllers controllerFlag
+	var webhookPort int
+	var webhookCertDir string
+	var kubeconfigAuth string
+	var awsCredentialsSecret string
+	var awsCredentialsProfile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.IntVar(&webhookPort, "webhook-port", 9443, "The port the webhook server binds to.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/tmp/k8s-webhook-server/serving-certs/",
+		"The directory containing the serving certificate of the webhook server.")
+	flag.StringVar(&kubeconfigAuth, "kubeconfig-auth", kubeconfigAuthToken,
+		"How generated workload cluster kubeconfigs authenticate: "+kubeconfigAuthToken+" embeds a token signed with the AWS credentials of the manager, "+
+			"or of the secretRef of the cluster's CAPTClusterIdentity, with clusters of roleARN identities using the exec plugin; "+
+			kubeconfigAuthExec+" uses the aws eks get-token exec plugin.")
+	flag.StringVar(&awsCredentialsSecret, "aws-credentials-secret", "",
+		"The namespace/name of a Secret holding an AWS shared credentials file under the credentials key, used to sign kubeconfig tokens and list node group instances. "+
+			"The AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables are used if not set.")
+	flag.StringVar(&awsCredentialsProfile, "aws-credentials-profile", kubeconfig.DefaultProfile,
+		"The profile read from the shared credentials file of --aws-credentials-secret.")
 	flag.Var(&enabledControllers, "enable-controller", "The controller to enable. Can be specified multiple times. Valid options: "+strings.Join(allControllers, ", "))
 	opts := zap.Options{
 		Development: true,
@@ -137,8 +168,12 @@ func main() {
 			BindAddress: metricsAddr,
 		},
 		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       leaderElectionID,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    webhookPort,
+			CertDir: webhookCertDir,
+		}),
+		LeaderElection:   enableLeaderElection,
+		LeaderElectionID: leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
@@ -152,6 +187,14 @@ func main() {
 			os.Exit(1)
 		}
 
+		if err = (&controller.CAPTClusterIdentityReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CAPTClusterIdentity")
+			os.Exit(1)
+		}
+
 		if err = (&controller.WorkspaceTemplateReconciler{
 			Client: mgr.GetClient(),
 			Scheme: mgr.GetScheme(),
@@ -191,6 +234,31 @@ func main() {
 			os.Exit(1)
 		}
 
+		credentials, err := newCredentials(mgr, awsCredentialsSecret, awsCredentialsProfile)
+		if err != nil {
+			setupLog.Error(err, "invalid AWS credentials")
+			os.Exit(1)
+		}
+		if err = (&controller.CaptMachinePoolReconciler{
+			Client:      mgr.GetClient(),
+			Scheme:      mgr.GetScheme(),
+			Recorder:    mgr.GetEventRecorderFor("captmachinepool-controller"),
+			Credentials: credentials,
+			Instances:   &nodegroup.EC2Lister{},
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CaptMachinePool")
+			os.Exit(1)
+		}
+
+		if err = (&controller.CaptFargateProfileReconciler{
+			Client:   mgr.GetClient(),
+			Scheme:   mgr.GetScheme(),
+			Recorder: mgr.GetEventRecorderFor("captfargateprofile-controller"),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "CaptFargateProfile")
+			os.Exit(1)
+		}
+
 		if err = (&controller.CaptMachineTemplateReconciler{
 			Client: mgr.GetClient(),
 			Scheme: mgr.GetScheme(),
@@ -202,10 +270,16 @@ func main() {
 
 	if enabledControllerMap[controlPlaneController] {
 		setupLog.Info("setting up control-plane controllers")
+		tokenGenerator, err := newTokenGenerator(mgr, kubeconfigAuth, awsCredentialsSecret, awsCredentialsProfile)
+		if err != nil {
+			setupLog.Error(err, "invalid kubeconfig authentication")
+			os.Exit(1)
+		}
 		if err = (&controlplanecontroller.Reconciler{
-			Client:   mgr.GetClient(),
-			Scheme:   mgr.GetScheme(),
-			Recorder: mgr.GetEventRecorderFor("captcontrolplane-controller"),
+			Client:         mgr.GetClient(),
+			Scheme:         mgr.GetScheme(),
+			Recorder:       mgr.GetEventRecorderFor("captcontrolplane-controller"),
+			TokenGenerator: tokenGenerator,
 		}).SetupWithManager(mgr); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "CAPTControlPlane")
 			os.Exit(1)
@@ -221,6 +295,16 @@ func main() {
 		}
 	}
 
+	// Webhooks are served by every manager: the webhook configurations of config/default
+	// cover all CAPT resources, while the clusterctl components of each provider only
+	// route the resources of that provider to their manager.
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err := setupWebhooks(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook")
+			os.Exit(1)
+		}
+	}
+
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -238,3 +322,75 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// newTokenGenerator returns the generator of kubeconfig tokens for the given authentication,
+// or nil if kubeconfigs use the exec plugin. It signs for clusters without a CAPTClusterIdentity;
+// the control plane controller signs for the others with the credentials of their identity.
+// Token authentication falls back to the exec plugin when the manager has no static AWS
+// credentials, i.e. neither --aws-credentials-secret nor the AWS_* environment variables.
+func newTokenGenerator(mgr ctrl.Manager, auth, credentialsSecret, profile string) (kubeconfig.TokenGenerator, error) {
+	switch auth {
+	case kubeconfigAuthExec:
+		return nil, nil
+	case kubeconfigAuthToken:
+	default:
+		return nil, fmt.Errorf("unknown kubeconfig authentication %q, valid options: %s, %s", auth, kubeconfigAuthToken, kubeconfigAuthExec)
+	}
+
+	if credentialsSecret == "" {
+		if _, err := (kubeconfig.EnvCredentials{}).Retrieve(context.Background()); err != nil {
+			setupLog.Info("WARNING: no static AWS credentials to sign kubeconfig tokens with, "+
+				"generated kubeconfigs use the exec plugin; set --aws-credentials-secret to embed tokens",
+				"reason", err.Error())
+			return nil, nil
+		}
+	}
+
+	credentials, err := newCredentials(mgr, credentialsSecret, profile)
+	if err != nil {
+		return nil, err
+	}
+	return kubeconfig.NewSTSTokenGenerator(kubeconfig.NewSigV4Signer(credentials)), nil
+}
+
+// newCredentials returns the AWS credentials of the manager, read from the given Secret or the
+// environment if no Secret is set
+func newCredentials(mgr ctrl.Manager, credentialsSecret, profile string) (kubeconfig.CredentialsProvider, error) {
+	if credentialsSecret == "" {
+		return kubeconfig.EnvCredentials{}, nil
+	}
+	namespace, name, ok := strings.Cut(credentialsSecret, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("--aws-credentials-secret must be namespace/name, got %q", credentialsSecret)
+	}
+	return &kubeconfig.SecretCredentials{
+		Client:  mgr.GetAPIReader(),
+		Secret:  types.NamespacedName{Namespace: namespace, Name: name},
+		Profile: profile,
+	}, nil
+}
+
+// setupWebhooks registers the validating webhooks of all CAPT resources
+func setupWebhooks(mgr ctrl.Manager) error {
+	for _, webhook := range []struct {
+		kind  string
+		setup func(ctrl.Manager) error
+	}{
+		{"CAPTCluster", webhookinfrastructurev1beta1.SetupCAPTClusterWebhookWithManager},
+		{"CAPTClusterIdentity", webhookinfrastructurev1beta1.SetupCAPTClusterIdentityWebhookWithManager},
+		{"WorkspaceTemplate", webhookinfrastructurev1beta1.SetupWorkspaceTemplateWebhookWithManager},
+		{"WorkspaceTemplateApply", webhookinfrastructurev1beta1.SetupWorkspaceTemplateApplyWebhookWithManager},
+		{"CaptMachine", webhookinfrastructurev1beta1.SetupCaptMachineWebhookWithManager},
+		{"CaptMachineSet", webhookinfrastructurev1beta1.SetupCaptMachineSetWebhookWithManager},
+		{"CaptMachineDeployment", webhookinfrastructurev1beta1.SetupCaptMachineDeploymentWebhookWithManager},
+		{"CaptMachinePool", webhookinfrastructurev1beta1.SetupCaptMachinePoolWebhookWithManager},
+		{"CaptMachineTemplate", webhookinfrastructurev1beta1.SetupCaptMachineTemplateWebhookWithManager},
+		{"CaptFargateProfile", webhookinfrastructurev1beta1.SetupCaptFargateProfileWebhookWithManager},
+		{"CAPTControlPlane", webhookcontrolplanev1beta1.SetupCAPTControlPlaneWebhookWithManager},
+	} {
+		if err := webhook.setup(mgr); err != nil {
+			return fmt.Errorf("%s: %w", webhook.kind, err)
+		}
+	}
+	return nil
+}
@@ -215,7 +215,10 @@ func (r *Reconciler) cleanupWorkspaceTemplateApply(ctx context.Context, captClus
 			return err
 		}
 		logger.Info("Deleted WorkspaceTemplateApply while waiting for parent Cluster")
-	} else if !apierrors.IsNotFound(err) {
+	} else if apierrors.IsNotFound(err) {
+		// Nothing to clean up; the name may have been set by the defaulting webhook
+		return nil
+	} else {
 		return err
 	}
 
@@ -108,20 +108,14 @@ func (r *Reconciler) handleVPCTemplate(ctx context.Context, captCluster *infrast
 }
 
 func (r *Reconciler) getVPCName(captCluster *infrastructurev1beta1.CAPTCluster) string {
-	if captCluster.Spec.VPCConfig != nil && captCluster.Spec.VPCConfig.Name != "" {
-		return captCluster.Spec.VPCConfig.Name
-	}
-	return fmt.Sprintf("%s-vpc", captCluster.Name)
+	return captCluster.GetVPCName()
 }
 
 func (r *Reconciler) getOrCreateWorkspaceTemplateApply(ctx context.Context, captCluster *infrastructurev1beta1.CAPTCluster) (*infrastructurev1beta1.WorkspaceTemplateApply, error) {
 	logger := log.FromContext(ctx)
 
 	// Determine the name for WorkspaceTemplateApply
-	applyName := captCluster.Spec.WorkspaceTemplateApplyName
-	if applyName == "" {
-		applyName = fmt.Sprintf("%s-vpc", captCluster.Name)
-	}
+	applyName := captCluster.GetWorkspaceTemplateApplyName()
 
 	// Get VPC name
 	vpcName := r.getVPCName(captCluster)
@@ -143,7 +137,9 @@ func (r *Reconciler) getOrCreateWorkspaceTemplateApply(ctx context.Context, capt
 				"cluster_name": captCluster.Name,
 				"vpc_name":     vpcName,
 				"environment":  "production", // TODO: Make this configurable
+				"region":       captCluster.Spec.Region,
 			},
+			IdentityRef: captCluster.Spec.IdentityRef.DeepCopy(),
 		}
 		if err := r.Update(ctx, latest); err != nil {
 			if apierrors.IsConflict(err) {
@@ -172,7 +168,9 @@ func (r *Reconciler) getOrCreateWorkspaceTemplateApply(ctx context.Context, capt
 				"cluster_name": captCluster.Name,
 				"vpc_name":     vpcName,
 				"environment":  "production", // TODO: Make this configurable
+				"region":       captCluster.Spec.Region,
 			},
+			IdentityRef: captCluster.Spec.IdentityRef.DeepCopy(),
 		},
 	}
 
@@ -258,9 +256,7 @@ func (r *Reconciler) updateVPCStatus(ctx context.Context, captCluster *infrastru
 
 		if errorMessage != "" {
 			captCluster.Status.WorkspaceTemplateStatus.LastFailureMessage = errorMessage
-			if workspaceApply.Status.LastAppliedTime != nil {
-				captCluster.Status.WorkspaceTemplateStatus.LastFailedRevision = workspaceApply.Status.LastAppliedTime.String()
-			}
+			captCluster.Status.WorkspaceTemplateStatus.LastFailedRevision = workspaceApply.Status.LastAppliedRevision
 		}
 
 		if err := r.updateStatus(ctx, captCluster, cluster); err != nil {
@@ -305,9 +301,8 @@ func (r *Reconciler) verifyVPCID(ctx context.Context, captCluster *infrastructur
 
 	captCluster.Status.Ready = true
 	captCluster.Status.WorkspaceTemplateStatus.Ready = true
-	if workspaceApply.Status.LastAppliedTime != nil {
-		captCluster.Status.WorkspaceTemplateStatus.LastAppliedRevision = workspaceApply.Status.LastAppliedTime.String()
-	}
+	captCluster.Status.WorkspaceTemplateStatus.LastAppliedRevision = workspaceApply.Status.LastAppliedRevision
+	captCluster.Status.WorkspaceTemplateStatus.LastAppliedTime = workspaceApply.Status.LastAppliedTime
 
 	// Clear any previous failure status
 	captCluster.Status.FailureReason = nil
@@ -0,0 +1,97 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
+)
+
+// CAPTClusterIdentityReconciler reconciles a CAPTClusterIdentity object
+type CAPTClusterIdentityReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captclusteridentities,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captclusteridentities/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=tf.upbound.io,resources=providerconfigs,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile keeps the ProviderConfig of a CAPTClusterIdentity in sync with its spec. The
+// ProviderConfig is owned by the identity and garbage collected with it.
+func (r *CAPTClusterIdentityReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	clusterIdentity := &infrastructurev1beta1.CAPTClusterIdentity{}
+	if err := r.Get(ctx, req.NamespacedName, clusterIdentity); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	patchBase := clusterIdentity.DeepCopy()
+
+	if err := identity.Validate(clusterIdentity); err != nil {
+		meta.SetStatusCondition(&clusterIdentity.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.CAPTClusterIdentityReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonInvalidIdentity,
+			Message: err.Error(),
+		})
+		return ctrl.Result{}, r.Status().Patch(ctx, clusterIdentity, client.MergeFrom(patchBase))
+	}
+
+	providerConfig := &tfv1beta1.ProviderConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: clusterIdentity.ProviderConfigName()},
+	}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, providerConfig, func() error {
+		providerConfig.Spec = identity.ProviderConfigSpec(clusterIdentity)
+		return controllerutil.SetControllerReference(clusterIdentity, providerConfig, r.Scheme)
+	})
+	if err != nil {
+		return ctrl.Result{}, fmt.Errorf("failed to create or update ProviderConfig %s: %w", providerConfig.Name, err)
+	}
+	if result != controllerutil.OperationResultNone {
+		logger.Info("Reconciled ProviderConfig", "providerConfig", providerConfig.Name, "operation", result)
+	}
+
+	clusterIdentity.Status.ProviderConfigName = providerConfig.Name
+	meta.SetStatusCondition(&clusterIdentity.Status.Conditions, metav1.Condition{
+		Type:    infrastructurev1beta1.CAPTClusterIdentityReadyCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  infrastructurev1beta1.ReasonProviderConfigReady,
+		Message: fmt.Sprintf("ProviderConfig %s is up to date", providerConfig.Name),
+	})
+	return ctrl.Result{}, r.Status().Patch(ctx, clusterIdentity, client.MergeFrom(patchBase))
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CAPTClusterIdentityReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrastructurev1beta1.CAPTClusterIdentity{}).
+		Owns(&tfv1beta1.ProviderConfig{}).
+		Complete(r)
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
+	"github.com/appthrust/capt/internal/controller/outputs"
+)
+
+const (
+	// CaptFargateProfileFinalizer allows CaptFargateProfileReconciler to delete the Fargate profile
+	// before the CaptFargateProfile is removed from the apiserver.
+	CaptFargateProfileFinalizer = "captfargateprofile.infrastructure.cluster.x-k8s.io"
+
+	// fargateProfileDeletionRequeue is the period for requeuing while the Fargate profile is destroyed
+	fargateProfileDeletionRequeue = 10 * time.Second
+)
+
+// CaptFargateProfileReconciler reconciles a CaptFargateProfile object
+type CaptFargateProfileReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captfargateprofiles,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captfargateprofiles/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captfargateprofiles/finalizers,verbs=update
+
+// Reconcile handles CaptFargateProfile reconciliation
+func (r *CaptFargateProfileReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	profile := &infrastructurev1beta1.CaptFargateProfile{}
+	if err := r.Get(ctx, req.NamespacedName, profile); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	cluster, err := getCluster(ctx, r.Client, profile.Namespace, profile.Spec.ClusterName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if annotations.HasPaused(profile) || (cluster != nil && cluster.Spec.Paused) {
+		logger.Info("Reconciliation is paused for this CaptFargateProfile")
+		return ctrl.Result{}, nil
+	}
+
+	// Handle deletion
+	if !profile.DeletionTimestamp.IsZero() {
+		return r.reconcileDelete(ctx, profile)
+	}
+
+	// Add finalizer if it doesn't exist, and let the profile be deleted together with its cluster
+	if !controllerutil.ContainsFinalizer(profile, CaptFargateProfileFinalizer) || (cluster != nil && !isOwnedBy(profile, cluster)) {
+		controllerutil.AddFinalizer(profile, CaptFargateProfileFinalizer)
+		if cluster != nil {
+			if err := controllerutil.SetOwnerReference(cluster, profile, r.Scheme); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		if err := r.Update(ctx, profile); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The Fargate profile is created once the cluster infrastructure exists
+	if cluster == nil || !cluster.Status.InfrastructureReady {
+		logger.Info("Waiting for the cluster infrastructure to be ready")
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.reconcileFargateProfile(ctx, profile, cluster); err != nil {
+		logger.Error(err, "Failed to reconcile Fargate profile")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// isOwnedBy reports whether the Cluster is an owner of the profile
+func isOwnedBy(profile *infrastructurev1beta1.CaptFargateProfile, cluster *clusterv1.Cluster) bool {
+	for _, ref := range profile.OwnerReferences {
+		if ref.UID == cluster.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileFargateProfile creates or updates the WorkspaceTemplateApply of the Fargate profile
+func (r *CaptFargateProfileReconciler) reconcileFargateProfile(ctx context.Context, profile *infrastructurev1beta1.CaptFargateProfile, cluster *clusterv1.Cluster) error {
+	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fargateProfileApplyName(profile),
+			Namespace: profile.Namespace,
+		},
+	}
+
+	// Fargate profiles use the identity of their cluster
+	identityRef, err := identity.ForCluster(ctx, r.Client, profile.Namespace, cluster.Name)
+	if err != nil {
+		return err
+	}
+	workspaces, err := getClusterWorkspaces(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, apply, func() error {
+		apply.Spec.TemplateRef = profile.Spec.WorkspaceTemplateRef
+		apply.Spec.IdentityRef = identityRef
+		apply.Spec.Variables = map[string]string{
+			"cluster_name": eksClusterName(cluster),
+			"profile_name": fargateProfileName(profile),
+		}
+		if profile.Spec.PodExecutionRoleARN != "" {
+			apply.Spec.Variables["pod_execution_role_arn"] = profile.Spec.PodExecutionRoleARN
+		}
+		workspaces.applyTo(&apply.Spec, profile.Namespace)
+
+		apply.Spec.StructuredVariables = nil
+		if err := apply.Spec.SetStructuredVariable("selectors", profile.Spec.Selectors); err != nil {
+			return err
+		}
+		// Subnets of the profile replace the private subnets of the VPC
+		if profile.Spec.SubnetIDs != nil {
+			apply.Spec.VariablesFrom = nil
+			if err := apply.Spec.SetStructuredVariable("subnet_ids", profile.Spec.SubnetIDs); err != nil {
+				return err
+			}
+		}
+		if profile.Spec.AdditionalTags != nil {
+			if err := apply.Spec.SetStructuredVariable("tags", profile.Spec.AdditionalTags); err != nil {
+				return err
+			}
+		}
+
+		return controllerutil.SetControllerReference(profile, apply, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update WorkspaceTemplateApply: %w", err)
+	}
+
+	return r.updateStatus(ctx, profile, apply)
+}
+
+// fargateProfileApplyName returns the name of the WorkspaceTemplateApply of the profile
+func fargateProfileApplyName(profile *infrastructurev1beta1.CaptFargateProfile) string {
+	return fmt.Sprintf("%s-fargate", profile.Name)
+}
+
+// fargateProfileName returns the name of the EKS Fargate profile
+func fargateProfileName(profile *infrastructurev1beta1.CaptFargateProfile) string {
+	if profile.Spec.ProfileName != "" {
+		return profile.Spec.ProfileName
+	}
+	return profile.Name
+}
+
+// updateStatus updates the status of the profile from the Fargate profile outputs
+func (r *CaptFargateProfileReconciler) updateStatus(ctx context.Context, profile *infrastructurev1beta1.CaptFargateProfile, apply *infrastructurev1beta1.WorkspaceTemplateApply) error {
+	if apply.Status.Applied {
+		arn, _, err := outputs.FromApply[string](ctx, r.Client, apply, "fargate_profile_arn")
+		if err != nil {
+			return err
+		}
+		state, _, err := outputs.FromApply[string](ctx, r.Client, apply, "fargate_profile_status")
+		if err != nil {
+			return err
+		}
+		if arn != "" {
+			profile.Status.ProfileARN = arn
+		}
+		if state != "" {
+			profile.Status.State = state
+		}
+	}
+
+	applyReady := apply.Status.Applied
+	for _, condition := range apply.Status.Conditions {
+		if condition.Type == xpv1.TypeReady {
+			applyReady = applyReady && condition.Status == corev1.ConditionTrue
+		}
+		if condition.Type == "Failed" && condition.Status == corev1.ConditionTrue {
+			message := condition.Message
+			reason := string(condition.Reason)
+			profile.Status.FailureMessage = &message
+			profile.Status.FailureReason = &reason
+		}
+	}
+	profile.Status.Ready = applyReady && profile.Status.State == infrastructurev1beta1.FargateProfileStateActive
+	profile.Status.WorkspaceTemplateApplyName = apply.Name
+
+	switch {
+	case profile.Status.Ready:
+		meta.SetStatusCondition(&profile.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.FargateProfileReadyCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  infrastructurev1beta1.ReasonFargateProfileActive,
+			Message: fmt.Sprintf("Fargate profile %s is active", fargateProfileName(profile)),
+		})
+	case strings.HasSuffix(profile.Status.State, "_FAILED"):
+		message := fmt.Sprintf("Fargate profile %s is in state %s", fargateProfileName(profile), profile.Status.State)
+		// Report the failure once when the profile enters the state
+		if ready := meta.FindStatusCondition(profile.Status.Conditions, infrastructurev1beta1.FargateProfileReadyCondition); ready == nil ||
+			ready.Reason != infrastructurev1beta1.ReasonFargateProfileFailed {
+			r.Recorder.Event(profile, corev1.EventTypeWarning, infrastructurev1beta1.ReasonFargateProfileFailed, message)
+		}
+		meta.SetStatusCondition(&profile.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.FargateProfileReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonFargateProfileFailed,
+			Message: message,
+		})
+	default:
+		meta.SetStatusCondition(&profile.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.FargateProfileReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonFargateProfileProvisioning,
+			Message: fmt.Sprintf("Waiting for WorkspaceTemplateApply %s to be applied", apply.Name),
+		})
+	}
+
+	return r.Status().Update(ctx, profile)
+}
+
+// reconcileDelete deletes the Fargate profile. The finalizer is kept until the
+// WorkspaceTemplateApply is gone, which is once provider-terraform has destroyed the profile.
+func (r *CaptFargateProfileReconciler) reconcileDelete(ctx context.Context, profile *infrastructurev1beta1.CaptFargateProfile) (ctrl.Result, error) {
+	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fargateProfileApplyName(profile),
+			Namespace: profile.Namespace,
+		},
+	}
+	if err := r.Delete(ctx, apply); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	err := r.Get(ctx, client.ObjectKeyFromObject(apply), apply)
+	if err == nil {
+		log.FromContext(ctx).Info("Waiting for the Fargate profile to be destroyed", "workspaceTemplateApply", apply.Name)
+		return ctrl.Result{RequeueAfter: fargateProfileDeletionRequeue}, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(profile, CaptFargateProfileFinalizer)
+	if err := r.Update(ctx, profile); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// clusterToCaptFargateProfiles returns the CaptFargateProfiles of a Cluster
+func (r *CaptFargateProfileReconciler) clusterToCaptFargateProfiles(ctx context.Context, obj client.Object) []reconcile.Request {
+	profiles := &infrastructurev1beta1.CaptFargateProfileList{}
+	if err := r.List(ctx, profiles, client.InNamespace(obj.GetNamespace())); err != nil {
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range profiles.Items {
+		if profiles.Items[i].Spec.ClusterName == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&profiles.Items[i])})
+		}
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CaptFargateProfileReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrastructurev1beta1.CaptFargateProfile{}).
+		Owns(&infrastructurev1beta1.WorkspaceTemplateApply{}).
+		// Resume profiles when their cluster is unpaused and its infrastructure is ready
+		Watches(
+			&clusterv1.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(r.clusterToCaptFargateProfiles),
+			builder.WithPredicates(predicates.ClusterUnpausedAndInfrastructureReady(mgr.GetLogger())),
+		).
+		Complete(r)
+}
@@ -0,0 +1,243 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+// newFargateProfileObjects returns a CaptFargateProfile and the Cluster, CAPTCluster and
+// CAPTControlPlane it belongs to
+func newFargateProfileObjects() (*v1beta1.CaptFargateProfile, []client.Object) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default", UID: "cluster-uid"},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{Kind: "CAPTCluster", Name: "demo", Namespace: "default"},
+			ControlPlaneRef:   &corev1.ObjectReference{Kind: "CAPTControlPlane", Name: "demo-cp", Namespace: "default"},
+		},
+		Status: clusterv1.ClusterStatus{InfrastructureReady: true},
+	}
+	captCluster := &v1beta1.CAPTCluster{ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"}}
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "demo-cp", Namespace: "default"}}
+	profile := &v1beta1.CaptFargateProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default"},
+		Spec: v1beta1.CaptFargateProfileSpec{
+			ClusterName:          "demo",
+			WorkspaceTemplateRef: v1beta1.WorkspaceTemplateReference{Name: "eks-fargate-profile-template", Namespace: "default"},
+			Selectors: []v1beta1.FargateSelector{
+				{Namespace: "batch", Labels: map[string]string{"compute": "fargate"}},
+			},
+		},
+	}
+	return profile, []client.Object{cluster, captCluster, controlPlane}
+}
+
+func newFargateProfileReconciler(objs ...client.Object) (*CaptFargateProfileReconciler, *record.FakeRecorder) {
+	scheme := newSourcesScheme()
+	_ = clusterv1.AddToScheme(scheme)
+	_ = controlplanev1beta1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	return &CaptFargateProfileReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objs...).
+			WithStatusSubresource(&v1beta1.CaptFargateProfile{}, &v1beta1.WorkspaceTemplateApply{}).
+			Build(),
+		Scheme:   scheme,
+		Recorder: recorder,
+	}, recorder
+}
+
+func reconcileFargateProfile(t *testing.T, r *CaptFargateProfileReconciler) *v1beta1.CaptFargateProfile {
+	t.Helper()
+	key := types.NamespacedName{Name: "batch", Namespace: "default"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	profile := &v1beta1.CaptFargateProfile{}
+	if err := r.Get(context.Background(), key, profile); err != nil {
+		t.Fatalf("failed to get CaptFargateProfile: %v", err)
+	}
+	return profile
+}
+
+// setFargateOutputs marks the WorkspaceTemplateApply of the profile as applied with the given state
+func setFargateOutputs(t *testing.T, r *CaptFargateProfileReconciler, state string) {
+	t.Helper()
+	ctx := context.Background()
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "batch-fargate", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	apply.Status.Applied = true
+	apply.Status.Outputs = map[string]apiextensionsv1.JSON{
+		"fargate_profile_arn":    {Raw: []byte(`"arn:aws:eks:us-west-2:123456789012:fargateprofile/demo-cp/batch/abc"`)},
+		"fargate_profile_status": {Raw: []byte(`"` + state + `"`)},
+	}
+	if err := r.Status().Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply status: %v", err)
+	}
+}
+
+func TestCaptFargateProfileReconcile(t *testing.T) {
+	profile, objs := newFargateProfileObjects()
+	r, _ := newFargateProfileReconciler(append(objs, profile)...)
+	ctx := context.Background()
+
+	got := reconcileFargateProfile(t, r)
+	if len(got.OwnerReferences) != 1 || got.OwnerReferences[0].Kind != "Cluster" {
+		t.Errorf("ownerReferences = %v, expected the Cluster", got.OwnerReferences)
+	}
+	if ready := meta.FindStatusCondition(got.Status.Conditions, v1beta1.FargateProfileReadyCondition); ready == nil ||
+		ready.Reason != v1beta1.ReasonFargateProfileProvisioning {
+		t.Errorf("Ready = %v, expected reason %s", ready, v1beta1.ReasonFargateProfileProvisioning)
+	}
+
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "batch-fargate", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	if apply.Spec.Variables["cluster_name"] != "demo-cp" || apply.Spec.Variables["profile_name"] != "batch" {
+		t.Errorf("variables = %v, expected the EKS cluster and profile names", apply.Spec.Variables)
+	}
+	if _, ok := apply.Spec.Variables["pod_execution_role_arn"]; ok {
+		t.Error("expected the pod execution role to be left to the template")
+	}
+	if selectors := apply.Spec.StructuredVariables["selectors"]; string(selectors.Raw) != `[{"namespace":"batch","labels":{"compute":"fargate"}}]` {
+		t.Errorf("selectors = %s, expected the selectors of the profile", selectors.Raw)
+	}
+	if len(apply.Spec.DependsOn) != 1 || apply.Spec.DependsOn[0].Name != "demo-cp-eks-controlplane-apply" {
+		t.Errorf("dependsOn = %v, expected the control plane WorkspaceTemplateApply", apply.Spec.DependsOn)
+	}
+	if len(apply.Spec.VariablesFrom) != 1 || apply.Spec.VariablesFrom[0].ValueFrom.OutputRef.Name != "demo-vpc" {
+		t.Errorf("variablesFrom = %v, expected the private subnets of the VPC", apply.Spec.VariablesFrom)
+	}
+
+	setFargateOutputs(t, r, v1beta1.FargateProfileStateActive)
+	got = reconcileFargateProfile(t, r)
+	if !got.Status.Ready || got.Status.State != v1beta1.FargateProfileStateActive || got.Status.ProfileARN == "" {
+		t.Errorf("ready = %v, state = %q, profileARN = %q, expected an active profile", got.Status.Ready, got.Status.State, got.Status.ProfileARN)
+	}
+	if ready := meta.FindStatusCondition(got.Status.Conditions, v1beta1.FargateProfileReadyCondition); ready == nil ||
+		ready.Reason != v1beta1.ReasonFargateProfileActive {
+		t.Errorf("Ready = %v, expected reason %s", ready, v1beta1.ReasonFargateProfileActive)
+	}
+}
+
+func TestCaptFargateProfileExplicitSubnetsAndRole(t *testing.T) {
+	profile, objs := newFargateProfileObjects()
+	profile.Spec.SubnetIDs = []string{"subnet-0aaa", "subnet-0bbb"}
+	profile.Spec.PodExecutionRoleARN = "arn:aws:iam::123456789012:role/fargate-pods"
+	r, _ := newFargateProfileReconciler(append(objs, profile)...)
+
+	reconcileFargateProfile(t, r)
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "batch-fargate", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	if apply.Spec.Variables["pod_execution_role_arn"] != profile.Spec.PodExecutionRoleARN {
+		t.Errorf("pod_execution_role_arn = %q, expected %q", apply.Spec.Variables["pod_execution_role_arn"], profile.Spec.PodExecutionRoleARN)
+	}
+	if subnets := apply.Spec.StructuredVariables["subnet_ids"]; string(subnets.Raw) != `["subnet-0aaa","subnet-0bbb"]` {
+		t.Errorf("subnet_ids = %s, expected the subnets of the profile", subnets.Raw)
+	}
+	if len(apply.Spec.VariablesFrom) != 0 {
+		t.Errorf("variablesFrom = %v, expected the VPC subnets not to be used", apply.Spec.VariablesFrom)
+	}
+}
+
+func TestCaptFargateProfileFailed(t *testing.T) {
+	profile, objs := newFargateProfileObjects()
+	r, recorder := newFargateProfileReconciler(append(objs, profile)...)
+
+	reconcileFargateProfile(t, r)
+	setFargateOutputs(t, r, "CREATE_FAILED")
+	var got *v1beta1.CaptFargateProfile
+	for range 2 {
+		got = reconcileFargateProfile(t, r)
+	}
+	if got.Status.Ready {
+		t.Error("expected a failed profile not to be ready")
+	}
+	if ready := meta.FindStatusCondition(got.Status.Conditions, v1beta1.FargateProfileReadyCondition); ready == nil ||
+		ready.Reason != v1beta1.ReasonFargateProfileFailed {
+		t.Errorf("Ready = %v, expected reason %s", ready, v1beta1.ReasonFargateProfileFailed)
+	}
+	// The event is only recorded when the profile enters the failed state
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected 1 event, got %d", len(recorder.Events))
+	}
+}
+
+func TestCaptFargateProfileWaitsForCluster(t *testing.T) {
+	profile, _ := newFargateProfileObjects()
+	r, _ := newFargateProfileReconciler(profile)
+
+	reconcileFargateProfile(t, r)
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	err := r.Get(context.Background(), types.NamespacedName{Name: "batch-fargate", Namespace: "default"}, apply)
+	if err == nil {
+		t.Error("expected no WorkspaceTemplateApply before the cluster exists")
+	}
+}
+
+func TestCaptFargateProfileDeletionWaitsForProfile(t *testing.T) {
+	profile, objs := newFargateProfileObjects()
+	r, _ := newFargateProfileReconciler(append(objs, profile)...)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "batch", Namespace: "default"}
+
+	reconcileFargateProfile(t, r)
+	// provider-terraform keeps the WorkspaceTemplateApply until the profile is destroyed
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "batch-fargate", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	apply.Finalizers = []string{"test.capt/destroy"}
+	if err := r.Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	if err := r.Delete(ctx, profile); err != nil {
+		t.Fatalf("failed to delete CaptFargateProfile: %v", err)
+	}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != fargateProfileDeletionRequeue {
+		t.Errorf("RequeueAfter = %v, expected %v while the profile is destroyed", result.RequeueAfter, fargateProfileDeletionRequeue)
+	}
+	got := &v1beta1.CaptFargateProfile{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("expected the profile to be kept until the Fargate profile is destroyed: %v", err)
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(apply), apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	apply.Finalizers = nil
+	if err := r.Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, got); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the profile to be removed once the Fargate profile is destroyed, got %v", err)
+	}
+}
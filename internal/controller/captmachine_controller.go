@@ -25,12 +25,22 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/predicates"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
+	"github.com/appthrust/capt/internal/controller/outputs"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -50,6 +60,9 @@ type CaptMachineReconciler struct {
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captmachines,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captmachines/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captmachines/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=clusters,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machines,verbs=get;list;watch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captclusters,verbs=get;list;watch
 
 // Reconcile handles CaptMachine reconciliation
 func (r *CaptMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -61,6 +74,26 @@ func (r *CaptMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
+	// Machines cloned from a CaptMachineTemplate belong to a Cluster API Machine, standalone machines
+	// of a CaptMachineSet have none
+	owner, err := util.GetOwnerMachine(ctx, r.Client, machine.ObjectMeta)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if _, cloned := machine.Annotations[clusterv1.TemplateClonedFromNameAnnotation]; cloned && owner == nil {
+		logger.Info("Waiting for the Machine controller to set the owner reference")
+		return ctrl.Result{}, nil
+	}
+
+	cluster, err := getCluster(ctx, r.Client, machine.Namespace, machine.Labels[clusterv1.ClusterNameLabel])
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if annotations.HasPaused(machine) || (cluster != nil && cluster.Spec.Paused) {
+		logger.Info("Reconciliation is paused for this CaptMachine")
+		return ctrl.Result{}, nil
+	}
+
 	// Handle deletion
 	if !machine.DeletionTimestamp.IsZero() {
 		return r.reconcileDelete(ctx, machine)
@@ -74,8 +107,14 @@ func (r *CaptMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		}
 	}
 
+	// Machines of a Cluster API Machine are created once the cluster infrastructure exists
+	if owner != nil && (cluster == nil || !cluster.Status.InfrastructureReady) {
+		logger.Info("Waiting for the cluster infrastructure to be ready")
+		return ctrl.Result{}, nil
+	}
+
 	// Create or update WorkspaceTemplateApply
-	if err := r.reconcileWorkspaceTemplateApply(ctx, machine); err != nil {
+	if err := r.reconcileWorkspaceTemplateApply(ctx, machine, owner, cluster); err != nil {
 		logger.Error(err, "Failed to reconcile WorkspaceTemplateApply")
 		return ctrl.Result{}, err
 	}
@@ -84,7 +123,7 @@ func (r *CaptMachineReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 }
 
 // reconcileWorkspaceTemplateApply creates or updates the WorkspaceTemplateApply for the machine
-func (r *CaptMachineReconciler) reconcileWorkspaceTemplateApply(ctx context.Context, machine *infrastructurev1beta1.CaptMachine) error {
+func (r *CaptMachineReconciler) reconcileWorkspaceTemplateApply(ctx context.Context, machine *infrastructurev1beta1.CaptMachine, owner *clusterv1.Machine, cluster *clusterv1.Cluster) error {
 	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      fmt.Sprintf("%s-machine", machine.Name),
@@ -92,18 +131,32 @@ func (r *CaptMachineReconciler) reconcileWorkspaceTemplateApply(ctx context.Cont
 		},
 	}
 
-	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, apply, func() error {
+	// Machines use the identity of their cluster
+	identityRef, err := identity.ForCluster(ctx, r.Client, machine.Namespace, machine.Labels[clusterv1.ClusterNameLabel])
+	if err != nil {
+		return err
+	}
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, apply, func() error {
 		apply.Spec.TemplateRef = machine.Spec.WorkspaceTemplateRef
-		apply.Spec.Variables = map[string]string{
-			"instance_type": machine.Spec.InstanceType,
-			"node_group":    machine.Spec.NodeGroupRef.Name,
-		}
+		apply.Spec.IdentityRef = identityRef
+		apply.Spec.Variables = machineVariables(machine, owner, cluster)
 
+		apply.Spec.StructuredVariables = nil
 		if machine.Spec.Labels != nil {
-			apply.Spec.Variables["labels"] = fmt.Sprintf("%v", machine.Spec.Labels)
+			if err := apply.Spec.SetStructuredVariable("labels", machine.Spec.Labels); err != nil {
+				return err
+			}
+		}
+		if tags := machineTags(machine); tags != nil {
+			if err := apply.Spec.SetStructuredVariable("tags", tags); err != nil {
+				return err
+			}
 		}
-		if machine.Spec.Tags != nil {
-			apply.Spec.Variables["tags"] = fmt.Sprintf("%v", machine.Spec.Tags)
+		if machine.Spec.Taints != nil {
+			if err := apply.Spec.SetStructuredVariable("taints", machine.Spec.Taints); err != nil {
+				return err
+			}
 		}
 
 		return controllerutil.SetControllerReference(machine, apply, r.Scheme)
@@ -114,7 +167,51 @@ func (r *CaptMachineReconciler) reconcileWorkspaceTemplateApply(ctx context.Cont
 	}
 
 	// Update machine status based on WorkspaceTemplateApply status
-	return r.updateStatus(ctx, machine, apply)
+	return r.updateStatus(ctx, machine, apply, failureDomain(owner))
+}
+
+// machineVariables returns the variables of the machine workspace. Machines of a Cluster API
+// Machine also get the EKS cluster name and the availability zone of their failure domain.
+func machineVariables(machine *infrastructurev1beta1.CaptMachine, owner *clusterv1.Machine, cluster *clusterv1.Cluster) map[string]string {
+	variables := map[string]string{
+		"instance_type": machine.Spec.InstanceType,
+	}
+	switch {
+	case machine.Spec.NodeGroupRef != nil:
+		variables["node_group"] = machine.Spec.NodeGroupRef.Name
+	case owner != nil && owner.Labels[clusterv1.MachineDeploymentNameLabel] != "":
+		variables["node_group"] = owner.Labels[clusterv1.MachineDeploymentNameLabel]
+	}
+	if cluster != nil {
+		variables["cluster_name"] = eksClusterName(cluster)
+	}
+	if zone := failureDomain(owner); zone != "" {
+		variables["availability_zone"] = zone
+	}
+	return variables
+}
+
+// machineTags returns the tags of the machine with its additional tags merged over them
+func machineTags(machine *infrastructurev1beta1.CaptMachine) map[string]string {
+	if machine.Spec.AdditionalTags == nil {
+		return machine.Spec.Tags
+	}
+	tags := make(map[string]string, len(machine.Spec.Tags)+len(machine.Spec.AdditionalTags))
+	for k, v := range machine.Spec.Tags {
+		tags[k] = v
+	}
+	for k, v := range machine.Spec.AdditionalTags {
+		tags[k] = v
+	}
+	return tags
+}
+
+// failureDomain returns the failure domain chosen for the Machine, which is an availability zone
+func failureDomain(owner *clusterv1.Machine) string {
+	if owner == nil {
+		return ""
+	}
+	return ptr.Deref(owner.Spec.FailureDomain, "")
 }
 
 // reconcileDelete handles CaptMachine deletion
@@ -140,17 +237,50 @@ func (r *CaptMachineReconciler) reconcileDelete(ctx context.Context, machine *in
 	return ctrl.Result{}, nil
 }
 
-// updateStatus updates CaptMachine status
-func (r *CaptMachineReconciler) updateStatus(ctx context.Context, machine *infrastructurev1beta1.CaptMachine, apply *infrastructurev1beta1.WorkspaceTemplateApply) error {
-	// Update status based on WorkspaceTemplateApply status
+// updateStatus updates CaptMachine status, and the providerID once the instance exists
+func (r *CaptMachineReconciler) updateStatus(ctx context.Context, machine *infrastructurev1beta1.CaptMachine, apply *infrastructurev1beta1.WorkspaceTemplateApply, zone string) error {
+	wasReady := machine.Status.Ready
+
+	// Get instance details from Terraform outputs
+	instance := machineInstance{availabilityZone: zone}
 	if apply.Status.Applied {
-		machine.Status.Ready = true
-		machine.Status.LastTransitionTime = &metav1.Time{Time: time.Now()}
+		for name, value := range map[string]*string{
+			"instance_id":       &instance.id,
+			"private_ip":        &instance.privateIP,
+			"private_dns":       &instance.privateDNS,
+			"public_ip":         &instance.publicIP,
+			"availability_zone": &instance.availabilityZone,
+		} {
+			output, found, err := outputs.FromApply[string](ctx, r.Client, apply, name)
+			if err != nil {
+				return err
+			}
+			if found && output != "" {
+				*value = output
+			}
+		}
+	}
 
-		// TODO: Get instance details from Terraform outputs
-		// This will require changes to WorkspaceTemplateApply to expose outputs
-	} else {
-		machine.Status.Ready = false
+	// Cluster API copies the providerID to the Machine and matches the Node by it. The spec is
+	// patched before the status is changed, as the patch response replaces the machine.
+	if providerID := instance.providerID(); providerID != "" && ptr.Deref(machine.Spec.ProviderID, "") != providerID {
+		base := machine.DeepCopy()
+		machine.Spec.ProviderID = &providerID
+		if err := r.Patch(ctx, machine, client.MergeFrom(base)); err != nil {
+			return fmt.Errorf("failed to set providerID: %w", err)
+		}
+	}
+
+	// Update status based on WorkspaceTemplateApply status
+	machine.Status.Ready = apply.Status.Applied
+	if instance.id != "" {
+		machine.Status.InstanceID = &instance.id
+	}
+	if instance.privateIP != "" {
+		machine.Status.PrivateIP = &instance.privateIP
+	}
+	if apply.Status.Applied {
+		machine.Status.Addresses = instance.addresses()
 	}
 
 	// Update conditions
@@ -166,13 +296,76 @@ func (r *CaptMachineReconciler) updateStatus(ctx context.Context, machine *infra
 		}
 	}
 
+	// The transition time tells how long the machine has been ready for minReadySeconds
+	if machine.Status.Ready != wasReady || machine.Status.LastTransitionTime == nil {
+		machine.Status.LastTransitionTime = &metav1.Time{Time: time.Now()}
+	}
+
 	return r.Status().Update(ctx, machine)
 }
 
+// machineInstance holds the details of the EC2 instance of a machine from the Terraform outputs
+type machineInstance struct {
+	id               string
+	privateIP        string
+	privateDNS       string
+	publicIP         string
+	availabilityZone string
+}
+
+// providerID returns the providerID the AWS cloud provider sets on the Node of the instance, or
+// an empty string while the instance or its availability zone is unknown
+func (i machineInstance) providerID() string {
+	if i.id == "" || i.availabilityZone == "" {
+		return ""
+	}
+	return fmt.Sprintf("aws:///%s/%s", i.availabilityZone, i.id)
+}
+
+// addresses returns the addresses of the instance
+func (i machineInstance) addresses() []clusterv1.MachineAddress {
+	var addresses []clusterv1.MachineAddress
+	if i.privateIP != "" {
+		addresses = append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineInternalIP, Address: i.privateIP})
+	}
+	if i.privateDNS != "" {
+		addresses = append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineInternalDNS, Address: i.privateDNS})
+	}
+	if i.publicIP != "" {
+		addresses = append(addresses, clusterv1.MachineAddress{Type: clusterv1.MachineExternalIP, Address: i.publicIP})
+	}
+	return addresses
+}
+
+// clusterToCaptMachines returns the CaptMachines of a Cluster
+func (r *CaptMachineReconciler) clusterToCaptMachines(ctx context.Context, obj client.Object) []reconcile.Request {
+	machines := &infrastructurev1beta1.CaptMachineList{}
+	if err := r.List(ctx, machines, client.InNamespace(obj.GetNamespace()),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(machines.Items))
+	for i := range machines.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&machines.Items[i])})
+	}
+	return requests
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CaptMachineReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&infrastructurev1beta1.CaptMachine{}).
 		Owns(&infrastructurev1beta1.WorkspaceTemplateApply{}).
+		// Pick up the owner reference, failure domain and deletion of Cluster API Machines
+		Watches(
+			&clusterv1.Machine{},
+			handler.EnqueueRequestsFromMapFunc(util.MachineToInfrastructureMapFunc(infrastructurev1beta1.GroupVersion.WithKind("CaptMachine"))),
+		).
+		// Resume machines when their cluster is unpaused and its infrastructure is ready
+		Watches(
+			&clusterv1.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(r.clusterToCaptMachines),
+			builder.WithPredicates(predicates.ClusterUnpausedAndInfrastructureReady(mgr.GetLogger())),
+		).
 		Complete(r)
 }
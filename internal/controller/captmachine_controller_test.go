@@ -0,0 +1,213 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+// newContractObjects returns a CaptMachine cloned by Cluster API for a Machine of the
+// MachineDeployment workers, and the Machine and Cluster it belongs to
+func newContractObjects() (*v1beta1.CaptMachine, *clusterv1.Machine, *clusterv1.Cluster) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec: clusterv1.ClusterSpec{
+			ControlPlaneRef: &corev1.ObjectReference{Kind: "CAPTControlPlane", Name: "demo-cp", Namespace: "default"},
+		},
+		Status: clusterv1.ClusterStatus{InfrastructureReady: true},
+	}
+	owner := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "workers-abc12",
+			Namespace: "default",
+			UID:       "machine-uid",
+			Labels: map[string]string{
+				clusterv1.ClusterNameLabel:           "demo",
+				clusterv1.MachineDeploymentNameLabel: "workers",
+			},
+		},
+		Spec: clusterv1.MachineSpec{ClusterName: "demo", FailureDomain: ptr.To("us-west-2a")},
+	}
+	machine := &v1beta1.CaptMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "workers-abc12",
+			Namespace:   "default",
+			Labels:      map[string]string{clusterv1.ClusterNameLabel: "demo"},
+			Annotations: map[string]string{clusterv1.TemplateClonedFromNameAnnotation: "workers"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: clusterv1.GroupVersion.String(),
+				Kind:       "Machine",
+				Name:       owner.Name,
+				UID:        owner.UID,
+			}},
+		},
+		Spec: v1beta1.CaptMachineSpec{
+			WorkspaceTemplateRef: v1beta1.WorkspaceTemplateReference{Name: "machine-template", Namespace: "default"},
+			InstanceType:         "t3.medium",
+			Tags:                 map[string]string{"Environment": "dev", "Team": "platform"},
+			AdditionalTags:       map[string]string{"Environment": "prod"},
+		},
+	}
+	return machine, owner, cluster
+}
+
+func newMachineReconciler(objs ...client.Object) *CaptMachineReconciler {
+	scheme := newSourcesScheme()
+	_ = clusterv1.AddToScheme(scheme)
+	return &CaptMachineReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objs...).
+			WithStatusSubresource(&v1beta1.CaptMachine{}, &v1beta1.WorkspaceTemplateApply{}).
+			Build(),
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(10),
+	}
+}
+
+func reconcileMachine(t *testing.T, r *CaptMachineReconciler) *v1beta1.CaptMachine {
+	t.Helper()
+	key := types.NamespacedName{Name: "workers-abc12", Namespace: "default"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	machine := &v1beta1.CaptMachine{}
+	if err := r.Get(context.Background(), key, machine); err != nil {
+		t.Fatalf("failed to get CaptMachine: %v", err)
+	}
+	return machine
+}
+
+func TestCaptMachineInfraMachineContract(t *testing.T) {
+	machine, owner, cluster := newContractObjects()
+	r := newMachineReconciler(machine, owner, cluster)
+	ctx := context.Background()
+
+	reconcileMachine(t, r)
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "workers-abc12-machine", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	expected := map[string]string{
+		"instance_type":     "t3.medium",
+		"node_group":        "workers",
+		"cluster_name":      "demo-cp",
+		"availability_zone": "us-west-2a",
+	}
+	for name, value := range expected {
+		if apply.Spec.Variables[name] != value {
+			t.Errorf("variable %s = %q, expected %q", name, apply.Spec.Variables[name], value)
+		}
+	}
+	var tags map[string]string
+	if err := json.Unmarshal(apply.Spec.StructuredVariables["tags"].Raw, &tags); err != nil || tags["Environment"] != "prod" || tags["Team"] != "platform" {
+		t.Errorf("tags = %v (%v), expected additional tags merged over tags", tags, err)
+	}
+
+	// The instance is created
+	apply.Status.Applied = true
+	apply.Status.Outputs = map[string]apiextensionsv1.JSON{
+		"instance_id": {Raw: []byte(`"i-0123456789abcdef0"`)},
+		"private_ip":  {Raw: []byte(`"10.0.1.15"`)},
+		"private_dns": {Raw: []byte(`"ip-10-0-1-15.us-west-2.compute.internal"`)},
+	}
+	if err := r.Status().Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply status: %v", err)
+	}
+
+	got := reconcileMachine(t, r)
+	if providerID := ptr.Deref(got.Spec.ProviderID, ""); providerID != "aws:///us-west-2a/i-0123456789abcdef0" {
+		t.Errorf("providerID = %q, expected aws:///us-west-2a/i-0123456789abcdef0", providerID)
+	}
+	if !got.Status.Ready || ptr.Deref(got.Status.InstanceID, "") != "i-0123456789abcdef0" {
+		t.Errorf("ready = %v, instanceID = %v, expected a ready instance", got.Status.Ready, got.Status.InstanceID)
+	}
+	expectedAddresses := []clusterv1.MachineAddress{
+		{Type: clusterv1.MachineInternalIP, Address: "10.0.1.15"},
+		{Type: clusterv1.MachineInternalDNS, Address: "ip-10-0-1-15.us-west-2.compute.internal"},
+	}
+	if len(got.Status.Addresses) != len(expectedAddresses) {
+		t.Fatalf("addresses = %v, expected %v", got.Status.Addresses, expectedAddresses)
+	}
+	for i := range expectedAddresses {
+		if got.Status.Addresses[i] != expectedAddresses[i] {
+			t.Errorf("address %d = %v, expected %v", i, got.Status.Addresses[i], expectedAddresses[i])
+		}
+	}
+}
+
+func TestCaptMachineWaitsForCluster(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*v1beta1.CaptMachine, *clusterv1.Machine, *clusterv1.Cluster)
+	}{
+		{
+			name: "cluster paused",
+			mutate: func(_ *v1beta1.CaptMachine, _ *clusterv1.Machine, cluster *clusterv1.Cluster) {
+				cluster.Spec.Paused = true
+			},
+		},
+		{
+			name: "machine paused",
+			mutate: func(machine *v1beta1.CaptMachine, _ *clusterv1.Machine, _ *clusterv1.Cluster) {
+				machine.Annotations[clusterv1.PausedAnnotation] = "true"
+			},
+		},
+		{
+			name: "no owner Machine yet",
+			mutate: func(machine *v1beta1.CaptMachine, _ *clusterv1.Machine, _ *clusterv1.Cluster) {
+				machine.OwnerReferences = nil
+			},
+		},
+		{
+			name: "cluster infrastructure not ready",
+			mutate: func(_ *v1beta1.CaptMachine, _ *clusterv1.Machine, cluster *clusterv1.Cluster) {
+				cluster.Status.InfrastructureReady = false
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			machine, owner, cluster := newContractObjects()
+			tt.mutate(machine, owner, cluster)
+			r := newMachineReconciler(machine, owner, cluster)
+
+			reconcileMachine(t, r)
+			err := r.Get(context.Background(), types.NamespacedName{Name: "workers-abc12-machine", Namespace: "default"}, &v1beta1.WorkspaceTemplateApply{})
+			if !apierrors.IsNotFound(err) {
+				t.Errorf("expected no WorkspaceTemplateApply, got error %v", err)
+			}
+		})
+	}
+}
+
+func TestMachineInstanceProviderID(t *testing.T) {
+	tests := []struct {
+		instance machineInstance
+		expected string
+	}{
+		{instance: machineInstance{id: "i-0abc", availabilityZone: "us-east-1b"}, expected: "aws:///us-east-1b/i-0abc"},
+		{instance: machineInstance{id: "i-0abc"}, expected: ""},
+		{instance: machineInstance{availabilityZone: "us-east-1b"}, expected: ""},
+	}
+	for _, tt := range tests {
+		if got := tt.instance.providerID(); got != tt.expected {
+			t.Errorf("providerID() of %+v = %q, expected %q", tt.instance, got, tt.expected)
+		}
+	}
+}
@@ -18,8 +18,6 @@ package controller
 
 import (
 	"context"
-	"fmt"
-	"reflect"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -41,18 +39,6 @@ const (
 	// DefaultDeploymentUniqueLabelKey is the default key of the selector that is added
 	// to existing MachineSets to prevent the existing MachineSets from selecting new machines.
 	DefaultDeploymentUniqueLabelKey = "capt-deployment-hash"
-
-	// DefaultRollingUpdateMaxUnavailable is the default value of MaxUnavailable for RollingUpdate strategy.
-	DefaultRollingUpdateMaxUnavailable = 0
-
-	// DefaultRollingUpdateMaxSurge is the default value of MaxSurge for RollingUpdate strategy.
-	DefaultRollingUpdateMaxSurge = 1
-
-	// DefaultRevisionHistoryLimit is the default value of RevisionHistoryLimit.
-	DefaultRevisionHistoryLimit = 10
-
-	// DefaultProgressDeadlineSeconds is the default value of ProgressDeadlineSeconds.
-	DefaultProgressDeadlineSeconds = 600
 )
 
 // CaptMachineDeploymentReconciler reconciles a CaptMachineDeployment object
@@ -98,7 +84,8 @@ func (r *CaptMachineDeploymentReconciler) Reconcile(ctx context.Context, req ctr
 	}
 
 	// Update status
-	if err := r.updateStatus(ctx, deployment, machineSets); err != nil {
+	deadlineIn, err := r.updateStatus(ctx, deployment, machineSets)
+	if err != nil {
 		logger.Error(err, "Failed to update status")
 		return ctrl.Result{}, err
 	}
@@ -108,21 +95,14 @@ func (r *CaptMachineDeploymentReconciler) Reconcile(ctx context.Context, req ctr
 		return ctrl.Result{}, nil
 	}
 
-	// Check progress deadline
-	if deployment.Spec.ProgressDeadlineSeconds != nil {
-		if err := r.checkProgressDeadline(deployment); err != nil {
-			logger.Error(err, "Failed to check progress deadline")
-			return ctrl.Result{}, err
-		}
-	}
-
 	// Reconcile MachineSets
 	if err := r.reconcileMachineSets(ctx, deployment, machineSets); err != nil {
 		logger.Error(err, "Failed to reconcile machine sets")
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Check again once the progress deadline has passed
+	return ctrl.Result{RequeueAfter: deadlineIn}, nil
 }
 
 // reconcileDelete handles CaptMachineDeployment deletion
@@ -166,58 +146,9 @@ func (r *CaptMachineDeploymentReconciler) listMachineSets(ctx context.Context, d
 	return owned, nil
 }
 
-// updateStatus updates the status of the deployment
-func (r *CaptMachineDeploymentReconciler) updateStatus(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) error {
-	newStatus := infrastructurev1beta1.CaptMachineDeploymentStatus{
-		ObservedGeneration: deployment.Generation,
-	}
-
-	// Calculate replicas
-	for _, machineSet := range machineSets {
-		newStatus.Replicas += machineSet.Status.Replicas
-		newStatus.UpdatedReplicas += machineSet.Status.ReadyReplicas
-		newStatus.AvailableReplicas += machineSet.Status.ReadyReplicas
-	}
-
-	// Update status if it has changed
-	if !reflect.DeepEqual(deployment.Status, newStatus) {
-		deployment.Status = newStatus
-		return r.Status().Update(ctx, deployment)
-	}
-
-	return nil
-}
-
-// checkProgressDeadline checks if the deployment has exceeded its progress deadline
-func (r *CaptMachineDeploymentReconciler) checkProgressDeadline(deployment *infrastructurev1beta1.CaptMachineDeployment) error {
-	if deployment.Status.ObservedGeneration < deployment.Generation {
-		// No deadline exceeded because we haven't observed the latest revision yet
-		return nil
-	}
-
-	deadline := DefaultProgressDeadlineSeconds
-	if deployment.Spec.ProgressDeadlineSeconds != nil {
-		deadline = int(*deployment.Spec.ProgressDeadlineSeconds)
-	}
-
-	// Check if the deployment is making progress
-	if deployment.Status.UpdatedReplicas < deployment.Status.Replicas {
-		// Calculate the time elapsed since the deployment started
-		// TODO: Store the deployment start time in the status
-		return fmt.Errorf("deployment %s/%s has not made progress within %d seconds", deployment.Namespace, deployment.Name, deadline)
-	}
-
-	return nil
-}
-
 // reconcileMachineSets reconciles the MachineSets owned by the deployment
 func (r *CaptMachineDeploymentReconciler) reconcileMachineSets(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) error {
-	if len(machineSets) == 0 {
-		// Create new MachineSet
-		return r.createInitialMachineSet(ctx, deployment)
-	}
-
-	// Handle rolling update if needed
+	// Handle rolling update if requested
 	if deployment.Spec.Strategy != nil && deployment.Spec.Strategy.Type == "RollingUpdate" {
 		return r.rolloutRolling(ctx, deployment, machineSets)
 	}
@@ -226,47 +157,6 @@ func (r *CaptMachineDeploymentReconciler) reconcileMachineSets(ctx context.Conte
 	return r.rolloutRecreate(ctx, deployment, machineSets)
 }
 
-// createInitialMachineSet creates the initial MachineSet for the deployment
-func (r *CaptMachineDeploymentReconciler) createInitialMachineSet(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment) error {
-	machineSet := &infrastructurev1beta1.CaptMachineSet{
-		ObjectMeta: metav1.ObjectMeta{
-			GenerateName: fmt.Sprintf("%s-", deployment.Name),
-			Namespace:    deployment.Namespace,
-			Labels:       deployment.Spec.Template.ObjectMeta.Labels,
-		},
-		Spec: infrastructurev1beta1.CaptMachineSetSpec{
-			Replicas: deployment.Spec.Replicas,
-			Selector: deployment.Spec.Selector,
-			Template: deployment.Spec.Template,
-		},
-	}
-
-	if err := controllerutil.SetControllerReference(deployment, machineSet, r.Scheme); err != nil {
-		return err
-	}
-
-	return r.Create(ctx, machineSet)
-}
-
-// rolloutRolling implements the rolling update strategy
-func (r *CaptMachineDeploymentReconciler) rolloutRolling(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) error {
-	// TODO: Implement rolling update logic
-	return nil
-}
-
-// rolloutRecreate implements the recreate strategy
-func (r *CaptMachineDeploymentReconciler) rolloutRecreate(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) error {
-	// Delete old MachineSets
-	for i := range machineSets {
-		if err := r.Delete(ctx, &machineSets[i]); err != nil {
-			return err
-		}
-	}
-
-	// Create new MachineSet
-	return r.createInitialMachineSet(ctx, deployment)
-}
-
 // SetupWithManager sets up the controller with the Manager.
 func (r *CaptMachineDeploymentReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
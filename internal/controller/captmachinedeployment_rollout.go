@@ -0,0 +1,443 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// rolloutRolling implements the rolling update strategy. The MachineSet of the current template
+// is scaled up by at most maxSurge machines above the desired replicas, and old MachineSets are
+// scaled down while at least maxUnavailable machines below the desired replicas stay available.
+func (r *CaptMachineDeploymentReconciler) rolloutRolling(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) error {
+	newMS, oldMSs := splitMachineSets(deployment, machineSets)
+	if newMS == nil {
+		replicas := deploymentReplicas(deployment)
+		if len(oldMSs) > 0 {
+			var err error
+			if replicas, err = newMachineSetReplicas(deployment, oldMSs, nil); err != nil {
+				return err
+			}
+		}
+		created, err := r.createMachineSet(ctx, deployment, replicas)
+		if err != nil {
+			return err
+		}
+		newMS = created
+	}
+	allMSs := append(oldMSs, newMS)
+
+	// Scale up, if we can
+	if err := r.reconcileNewMachineSet(ctx, deployment, allMSs, newMS); err != nil {
+		return err
+	}
+
+	// Scale down, if we can
+	if err := r.reconcileOldMachineSets(ctx, deployment, allMSs, oldMSs, newMS); err != nil {
+		return err
+	}
+
+	return r.cleanupDeployment(ctx, deployment, oldMSs)
+}
+
+// rolloutRecreate implements the recreate strategy. Old MachineSets are scaled down to zero and
+// the MachineSet of the current template is only scaled up once all old machines are gone.
+func (r *CaptMachineDeploymentReconciler) rolloutRecreate(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) error {
+	newMS, oldMSs := splitMachineSets(deployment, machineSets)
+
+	// Scale down old MachineSets
+	scaledDown := false
+	for _, ms := range oldMSs {
+		if machineSetReplicas(ms) == 0 {
+			continue
+		}
+		if err := r.scaleMachineSet(ctx, deployment, ms, 0); err != nil {
+			return err
+		}
+		scaledDown = true
+	}
+	if scaledDown {
+		return nil
+	}
+
+	// Wait for the old machines to be deleted, the MachineSet status update requeues the deployment
+	for _, ms := range oldMSs {
+		if ms.Status.Replicas > 0 {
+			return nil
+		}
+	}
+
+	replicas := deploymentReplicas(deployment)
+	if newMS == nil {
+		if _, err := r.createMachineSet(ctx, deployment, replicas); err != nil {
+			return err
+		}
+	} else if err := r.scaleMachineSet(ctx, deployment, newMS, replicas); err != nil {
+		return err
+	}
+
+	return r.cleanupDeployment(ctx, deployment, oldMSs)
+}
+
+// reconcileNewMachineSet scales the MachineSet of the current template towards the desired replicas
+func (r *CaptMachineDeploymentReconciler) reconcileNewMachineSet(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, allMSs []*infrastructurev1beta1.CaptMachineSet, newMS *infrastructurev1beta1.CaptMachineSet) error {
+	desired := deploymentReplicas(deployment)
+	current := machineSetReplicas(newMS)
+	if current > desired {
+		return r.scaleMachineSet(ctx, deployment, newMS, desired)
+	}
+
+	replicas, err := newMachineSetReplicas(deployment, allMSs, newMS)
+	if err != nil {
+		return err
+	}
+	return r.scaleMachineSet(ctx, deployment, newMS, replicas)
+}
+
+// reconcileOldMachineSets scales down old MachineSets without dropping below the minimum number of
+// available machines. Machines of old MachineSets that are not available are removed first.
+func (r *CaptMachineDeploymentReconciler) reconcileOldMachineSets(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, allMSs, oldMSs []*infrastructurev1beta1.CaptMachineSet, newMS *infrastructurev1beta1.CaptMachineSet) error {
+	if totalReplicas(oldMSs) == 0 {
+		return nil
+	}
+
+	_, maxUnavailable, err := rollingUpdateFenceposts(deployment)
+	if err != nil {
+		return err
+	}
+	minAvailable := deploymentReplicas(deployment) - maxUnavailable
+
+	// Machines of the new MachineSet that are not available yet still count against maxUnavailable,
+	// so old machines must not be removed in their place
+	newUnavailable := max(machineSetReplicas(newMS)-newMS.Status.AvailableReplicas, 0)
+	maxScaledDown := totalReplicas(allMSs) - minAvailable - newUnavailable
+	if maxScaledDown <= 0 {
+		return nil
+	}
+
+	sortByCreation(oldMSs)
+	var cleanedUp int32
+	for _, ms := range oldMSs {
+		if cleanedUp >= maxScaledDown {
+			break
+		}
+		replicas := machineSetReplicas(ms)
+		unavailable := replicas - ms.Status.AvailableReplicas
+		if unavailable <= 0 {
+			continue
+		}
+		scaleDown := min(unavailable, maxScaledDown-cleanedUp)
+		if err := r.scaleMachineSet(ctx, deployment, ms, replicas-scaleDown); err != nil {
+			return err
+		}
+		cleanedUp += scaleDown
+	}
+
+	// Scale down the oldest MachineSets while the available machines exceed the minimum
+	var available int32
+	for _, ms := range allMSs {
+		available += ms.Status.AvailableReplicas
+	}
+	if available <= minAvailable {
+		return nil
+	}
+	totalScaleDown := available - minAvailable
+	var scaledDown int32
+	for _, ms := range oldMSs {
+		if scaledDown >= totalScaleDown {
+			break
+		}
+		replicas := machineSetReplicas(ms)
+		if replicas == 0 {
+			continue
+		}
+		scaleDown := min(replicas, totalScaleDown-scaledDown)
+		if err := r.scaleMachineSet(ctx, deployment, ms, replicas-scaleDown); err != nil {
+			return err
+		}
+		scaledDown += scaleDown
+	}
+	return nil
+}
+
+// cleanupDeployment deletes the oldest scaled down MachineSets beyond the revision history limit
+func (r *CaptMachineDeploymentReconciler) cleanupDeployment(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, oldMSs []*infrastructurev1beta1.CaptMachineSet) error {
+	limit := int32(infrastructurev1beta1.DefaultRevisionHistoryLimit)
+	if deployment.Spec.RevisionHistoryLimit != nil {
+		limit = *deployment.Spec.RevisionHistoryLimit
+	}
+
+	var cleanable []*infrastructurev1beta1.CaptMachineSet
+	for _, ms := range oldMSs {
+		if machineSetReplicas(ms) == 0 && ms.Status.Replicas == 0 && ms.DeletionTimestamp.IsZero() {
+			cleanable = append(cleanable, ms)
+		}
+	}
+	diff := len(cleanable) - int(limit)
+	if diff <= 0 {
+		return nil
+	}
+
+	sortByCreation(cleanable)
+	for _, ms := range cleanable[:diff] {
+		if err := r.Delete(ctx, ms); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		r.Recorder.Eventf(deployment, corev1.EventTypeNormal, "SuccessfulDelete", "Deleted old MachineSet %s", ms.Name)
+	}
+	return nil
+}
+
+// createMachineSet creates the MachineSet of the current template of the deployment. The MachineSet
+// is named and labelled after the template hash, so its machines are only selected by it.
+func (r *CaptMachineDeploymentReconciler) createMachineSet(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, replicas int32) (*infrastructurev1beta1.CaptMachineSet, error) {
+	hash, err := computeTemplateHash(&deployment.Spec.Template, deployment.Status.CollisionCount)
+	if err != nil {
+		return nil, err
+	}
+
+	template := deployment.Spec.Template.DeepCopy()
+	template.ObjectMeta.Labels = cloneAndAddLabel(template.ObjectMeta.Labels, DefaultDeploymentUniqueLabelKey, hash)
+	selector := &metav1.LabelSelector{}
+	if deployment.Spec.Selector != nil {
+		selector = deployment.Spec.Selector.DeepCopy()
+	}
+	selector.MatchLabels = cloneAndAddLabel(selector.MatchLabels, DefaultDeploymentUniqueLabelKey, hash)
+
+	machineSet := &infrastructurev1beta1.CaptMachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-%s", deployment.Name, hash),
+			Namespace: deployment.Namespace,
+			Labels:    template.ObjectMeta.Labels,
+		},
+		Spec: infrastructurev1beta1.CaptMachineSetSpec{
+			Replicas:        &replicas,
+			Selector:        selector,
+			Template:        *template,
+			MinReadySeconds: deployment.Spec.MinReadySeconds,
+		},
+	}
+	if err := controllerutil.SetControllerReference(deployment, machineSet, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	err = r.Create(ctx, machineSet)
+	if apierrors.IsAlreadyExists(err) {
+		existing := &infrastructurev1beta1.CaptMachineSet{}
+		if err := r.Get(ctx, types.NamespacedName{Name: machineSet.Name, Namespace: machineSet.Namespace}, existing); err != nil {
+			return nil, err
+		}
+		// The cache may not have seen a MachineSet created by an earlier reconcile yet
+		if metav1.IsControlledBy(existing, deployment) && equalIgnoreHash(&existing.Spec.Template, &deployment.Spec.Template) {
+			return existing, nil
+		}
+
+		// A different MachineSet has the name, try the next one on the next reconcile
+		collisionCount := int32(0)
+		if deployment.Status.CollisionCount != nil {
+			collisionCount = *deployment.Status.CollisionCount
+		}
+		collisionCount++
+		deployment.Status.CollisionCount = &collisionCount
+		if err := r.Status().Update(ctx, deployment); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("hash collision for MachineSet %s, collision count is now %d", machineSet.Name, collisionCount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.Recorder.Eventf(deployment, corev1.EventTypeNormal, "SuccessfulCreate", "Created MachineSet %s with %d replicas", machineSet.Name, replicas)
+	return machineSet, nil
+}
+
+// scaleMachineSet sets the replicas of a MachineSet and keeps its minReadySeconds in sync with the deployment
+func (r *CaptMachineDeploymentReconciler) scaleMachineSet(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSet *infrastructurev1beta1.CaptMachineSet, replicas int32) error {
+	current := machineSetReplicas(machineSet)
+	if current == replicas && machineSet.Spec.MinReadySeconds == deployment.Spec.MinReadySeconds {
+		return nil
+	}
+
+	patchBase := machineSet.DeepCopy()
+	machineSet.Spec.Replicas = &replicas
+	machineSet.Spec.MinReadySeconds = deployment.Spec.MinReadySeconds
+	if err := r.Patch(ctx, machineSet, client.MergeFrom(patchBase)); err != nil {
+		return err
+	}
+
+	if current != replicas {
+		r.Recorder.Eventf(deployment, corev1.EventTypeNormal, "ScalingMachineSet", "Scaled MachineSet %s from %d to %d", machineSet.Name, current, replicas)
+	}
+	return nil
+}
+
+// splitMachineSets returns the MachineSet of the current template of the deployment, if any, and the
+// old MachineSets. If several MachineSets match the template the oldest one is used.
+func splitMachineSets(deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) (*infrastructurev1beta1.CaptMachineSet, []*infrastructurev1beta1.CaptMachineSet) {
+	all := make([]*infrastructurev1beta1.CaptMachineSet, 0, len(machineSets))
+	for i := range machineSets {
+		all = append(all, &machineSets[i])
+	}
+	sortByCreation(all)
+
+	var newMS *infrastructurev1beta1.CaptMachineSet
+	var oldMSs []*infrastructurev1beta1.CaptMachineSet
+	for _, ms := range all {
+		if newMS == nil && equalIgnoreHash(&ms.Spec.Template, &deployment.Spec.Template) {
+			newMS = ms
+			continue
+		}
+		oldMSs = append(oldMSs, ms)
+	}
+	return newMS, oldMSs
+}
+
+// newMachineSetReplicas returns the replicas of the new MachineSet allowed by maxSurge. newMS is nil
+// if the MachineSet of the current template has not been created yet.
+func newMachineSetReplicas(deployment *infrastructurev1beta1.CaptMachineDeployment, allMSs []*infrastructurev1beta1.CaptMachineSet, newMS *infrastructurev1beta1.CaptMachineSet) (int32, error) {
+	maxSurge, _, err := rollingUpdateFenceposts(deployment)
+	if err != nil {
+		return 0, err
+	}
+
+	desired := deploymentReplicas(deployment)
+	var current int32
+	if newMS != nil {
+		current = machineSetReplicas(newMS)
+	}
+	maxTotal := desired + maxSurge
+	total := totalReplicas(allMSs)
+	if total >= maxTotal {
+		// Cannot scale up
+		return current, nil
+	}
+	return current + min(maxTotal-total, max(desired-current, 0)), nil
+}
+
+// rollingUpdateFenceposts resolves maxSurge and maxUnavailable of the deployment to machine counts.
+// maxSurge is rounded up and maxUnavailable rounded down; if both are zero one machine may be unavailable.
+func rollingUpdateFenceposts(deployment *infrastructurev1beta1.CaptMachineDeployment) (int32, int32, error) {
+	maxSurge := intstr.FromInt32(infrastructurev1beta1.DefaultRollingUpdateMaxSurge)
+	maxUnavailable := intstr.FromInt32(infrastructurev1beta1.DefaultRollingUpdateMaxUnavailable)
+	if strategy := deployment.Spec.Strategy; strategy != nil && strategy.RollingUpdate != nil {
+		maxSurge = *intstr.ValueOrDefault(strategy.RollingUpdate.MaxSurge, maxSurge)
+		maxUnavailable = *intstr.ValueOrDefault(strategy.RollingUpdate.MaxUnavailable, maxUnavailable)
+	}
+
+	desired := int(deploymentReplicas(deployment))
+	surge, err := intstr.GetScaledValueFromIntOrPercent(&maxSurge, desired, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxSurge: %w", err)
+	}
+	unavailable, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, desired, false)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid maxUnavailable: %w", err)
+	}
+
+	if surge == 0 && unavailable == 0 {
+		unavailable = 1
+	}
+	return int32(surge), int32(min(unavailable, desired)), nil
+}
+
+// computeTemplateHash returns the value of the DefaultDeploymentUniqueLabelKey label of MachineSets
+// created from the template. The collision count is mixed in to resolve name collisions.
+func computeTemplateHash(template *infrastructurev1beta1.CaptMachineTemplateSpec, collisionCount *int32) (string, error) {
+	unlabelled := template.DeepCopy()
+	delete(unlabelled.ObjectMeta.Labels, DefaultDeploymentUniqueLabelKey)
+	data, err := json.Marshal(unlabelled)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal machine template: %w", err)
+	}
+
+	hasher := fnv.New32a()
+	_, _ = hasher.Write(data)
+	if collisionCount != nil {
+		_, _ = fmt.Fprintf(hasher, "%d", *collisionCount)
+	}
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32())), nil
+}
+
+// equalIgnoreHash returns true if two machine templates only differ in the template hash label
+func equalIgnoreHash(a, b *infrastructurev1beta1.CaptMachineTemplateSpec) bool {
+	a, b = a.DeepCopy(), b.DeepCopy()
+	delete(a.ObjectMeta.Labels, DefaultDeploymentUniqueLabelKey)
+	delete(b.ObjectMeta.Labels, DefaultDeploymentUniqueLabelKey)
+	return equality.Semantic.DeepEqual(a, b)
+}
+
+// cloneAndAddLabel returns a copy of the labels with the given label added
+func cloneAndAddLabel(labels map[string]string, key, value string) map[string]string {
+	cloned := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		cloned[k] = v
+	}
+	cloned[key] = value
+	return cloned
+}
+
+// sortByCreation sorts MachineSets from the oldest to the newest
+func sortByCreation(machineSets []*infrastructurev1beta1.CaptMachineSet) {
+	sort.SliceStable(machineSets, func(i, j int) bool {
+		if machineSets[i].CreationTimestamp.Equal(&machineSets[j].CreationTimestamp) {
+			return machineSets[i].Name < machineSets[j].Name
+		}
+		return machineSets[i].CreationTimestamp.Before(&machineSets[j].CreationTimestamp)
+	})
+}
+
+// deploymentReplicas returns the desired replicas of a deployment
+func deploymentReplicas(deployment *infrastructurev1beta1.CaptMachineDeployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return infrastructurev1beta1.DefaultReplicas
+	}
+	return *deployment.Spec.Replicas
+}
+
+// machineSetReplicas returns the desired replicas of a MachineSet
+func machineSetReplicas(machineSet *infrastructurev1beta1.CaptMachineSet) int32 {
+	if machineSet.Spec.Replicas == nil {
+		return infrastructurev1beta1.DefaultReplicas
+	}
+	return *machineSet.Spec.Replicas
+}
+
+// totalReplicas returns the sum of the desired replicas of the MachineSets
+func totalReplicas(machineSets []*infrastructurev1beta1.CaptMachineSet) int32 {
+	var total int32
+	for _, ms := range machineSets {
+		total += machineSetReplicas(ms)
+	}
+	return total
+}
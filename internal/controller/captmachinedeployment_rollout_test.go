@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func newRolloutDeployment(replicas int32, instanceType string) *v1beta1.CaptMachineDeployment {
+	return &v1beta1.CaptMachineDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "default", UID: "workers-uid"},
+		Spec: v1beta1.CaptMachineDeploymentSpec{
+			Replicas: ptr.To(replicas),
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "workers"}},
+			Template: v1beta1.CaptMachineTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"pool": "workers"}},
+				Spec: v1beta1.CaptMachineSpec{
+					NodeGroupRef:         &v1beta1.NodeGroupReference{Name: "workers", Namespace: "default"},
+					WorkspaceTemplateRef: v1beta1.WorkspaceTemplateReference{Name: "machine"},
+					InstanceType:         instanceType,
+				},
+			},
+			Strategy: &v1beta1.MachineDeploymentStrategy{
+				Type: "RollingUpdate",
+				RollingUpdate: &v1beta1.MachineRollingUpdateDeployment{
+					MaxSurge:       ptr.To(intstr.FromInt32(1)),
+					MaxUnavailable: ptr.To(intstr.FromInt32(0)),
+				},
+			},
+		},
+	}
+}
+
+// newRolloutReconciler returns a reconciler for the deployment and its MachineSets
+func newRolloutReconciler(deployment *v1beta1.CaptMachineDeployment, objs ...client.Object) *CaptMachineDeploymentReconciler {
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(append(objs, deployment)...).
+		WithStatusSubresource(&v1beta1.CaptMachineDeployment{}, &v1beta1.CaptMachineSet{}).
+		Build()
+	return &CaptMachineDeploymentReconciler{Client: c, Scheme: newSourcesScheme(), Recorder: record.NewFakeRecorder(100)}
+}
+
+// newOldMachineSet returns a MachineSet of the deployment created from another template
+func newOldMachineSet(deployment *v1beta1.CaptMachineDeployment, name string, age time.Duration, replicas int32) *v1beta1.CaptMachineSet {
+	old := newRolloutDeployment(replicas, "t3.small")
+	ms := &v1beta1.CaptMachineSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         "default",
+			Labels:            map[string]string{"pool": "workers"},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: v1beta1.GroupVersion.String(), Kind: "CaptMachineDeployment",
+				Name: deployment.Name, UID: deployment.UID, Controller: ptr.To(true),
+			}},
+		},
+		Spec: v1beta1.CaptMachineSetSpec{
+			Replicas: ptr.To(replicas),
+			Selector: old.Spec.Selector,
+			Template: old.Spec.Template,
+		},
+		Status: v1beta1.CaptMachineSetStatus{Replicas: replicas, ReadyReplicas: replicas, AvailableReplicas: replicas},
+	}
+	return ms
+}
+
+// rollout runs one rollout step and returns the resulting MachineSets by name
+func rollout(t *testing.T, r *CaptMachineDeploymentReconciler, deployment *v1beta1.CaptMachineDeployment) map[string]*v1beta1.CaptMachineSet {
+	t.Helper()
+	ctx := context.Background()
+	machineSets, err := r.listMachineSets(ctx, deployment)
+	if err != nil {
+		t.Fatalf("listMachineSets() error = %v", err)
+	}
+	if err := r.reconcileMachineSets(ctx, deployment, machineSets); err != nil {
+		t.Fatalf("reconcileMachineSets() error = %v", err)
+	}
+
+	if machineSets, err = r.listMachineSets(ctx, deployment); err != nil {
+		t.Fatalf("listMachineSets() error = %v", err)
+	}
+	result := map[string]*v1beta1.CaptMachineSet{}
+	for i := range machineSets {
+		result[machineSets[i].Name] = &machineSets[i]
+	}
+	return result
+}
+
+// setAvailable records the given number of available machines on a MachineSet
+func setAvailable(t *testing.T, r *CaptMachineDeploymentReconciler, ms *v1beta1.CaptMachineSet, replicas, available int32) {
+	t.Helper()
+	ms.Status = v1beta1.CaptMachineSetStatus{Replicas: replicas, ReadyReplicas: available, AvailableReplicas: available}
+	if err := r.Status().Update(context.Background(), ms); err != nil {
+		t.Fatalf("failed to update MachineSet status: %v", err)
+	}
+}
+
+func TestRolloutRollingCreatesMachineSet(t *testing.T) {
+	deployment := newRolloutDeployment(2, "t3.medium")
+	deployment.Spec.MinReadySeconds = 30
+	r := newRolloutReconciler(deployment)
+
+	machineSets := rollout(t, r, deployment)
+	if len(machineSets) != 1 {
+		t.Fatalf("expected 1 MachineSet, got %d", len(machineSets))
+	}
+
+	hash, err := computeTemplateHash(&deployment.Spec.Template, nil)
+	if err != nil {
+		t.Fatalf("computeTemplateHash() error = %v", err)
+	}
+	ms := machineSets["workers-"+hash]
+	if ms == nil {
+		t.Fatalf("expected MachineSet workers-%s, got %v", hash, machineSets)
+	}
+	if *ms.Spec.Replicas != 2 || ms.Spec.MinReadySeconds != 30 {
+		t.Errorf("replicas = %d, minReadySeconds = %d, expected 2 and 30", *ms.Spec.Replicas, ms.Spec.MinReadySeconds)
+	}
+	for name, labels := range map[string]map[string]string{
+		"labels":          ms.Labels,
+		"selector":        ms.Spec.Selector.MatchLabels,
+		"template labels": ms.Spec.Template.ObjectMeta.Labels,
+	} {
+		if labels[DefaultDeploymentUniqueLabelKey] != hash || labels["pool"] != "workers" {
+			t.Errorf("%s = %v, expected the pool and template hash labels", name, labels)
+		}
+	}
+	if _, found := deployment.Spec.Template.ObjectMeta.Labels[DefaultDeploymentUniqueLabelKey]; found {
+		t.Errorf("the template hash label leaked into the deployment template")
+	}
+
+	// An unchanged template keeps the MachineSet
+	if machineSets = rollout(t, r, deployment); len(machineSets) != 1 || machineSets["workers-"+hash] == nil {
+		t.Errorf("expected MachineSet workers-%s to be kept, got %v", hash, machineSets)
+	}
+}
+
+func TestRolloutRollingReplacesMachines(t *testing.T) {
+	deployment := newRolloutDeployment(3, "t3.medium")
+	old := newOldMachineSet(deployment, "workers-old", time.Hour, 3)
+	r := newRolloutReconciler(deployment, old)
+	hash, _ := computeTemplateHash(&deployment.Spec.Template, nil)
+	newName := "workers-" + hash
+
+	// maxSurge 1 and maxUnavailable 0 replace one machine at a time
+	for step, expected := range []struct{ old, new int32 }{
+		{old: 3, new: 1},
+		{old: 2, new: 1},
+		{old: 2, new: 2},
+		{old: 1, new: 2},
+		{old: 1, new: 3},
+		{old: 0, new: 3},
+	} {
+		machineSets := rollout(t, r, deployment)
+		if machineSets[newName] == nil || machineSets["workers-old"] == nil {
+			t.Fatalf("step %d: expected the old and new MachineSets, got %v", step, machineSets)
+		}
+		oldReplicas, newReplicas := *machineSets["workers-old"].Spec.Replicas, *machineSets[newName].Spec.Replicas
+		if oldReplicas != expected.old || newReplicas != expected.new {
+			t.Fatalf("step %d: old = %d, new = %d, expected %d and %d", step, oldReplicas, newReplicas, expected.old, expected.new)
+		}
+
+		// The MachineSet controller brings up the machines, which become available
+		setAvailable(t, r, machineSets["workers-old"], oldReplicas, oldReplicas)
+		setAvailable(t, r, machineSets[newName], newReplicas, newReplicas)
+	}
+}
+
+func TestRolloutRollingWaitsForAvailability(t *testing.T) {
+	deployment := newRolloutDeployment(2, "t3.medium")
+	old := newOldMachineSet(deployment, "workers-old", time.Hour, 2)
+	r := newRolloutReconciler(deployment, old)
+	hash, _ := computeTemplateHash(&deployment.Spec.Template, nil)
+	newName := "workers-" + hash
+
+	machineSets := rollout(t, r, deployment)
+	// The new machine is ready but has not been ready for minReadySeconds
+	setAvailable(t, r, machineSets[newName], 1, 0)
+
+	for range 3 {
+		machineSets = rollout(t, r, deployment)
+		if *machineSets["workers-old"].Spec.Replicas != 2 || *machineSets[newName].Spec.Replicas != 1 {
+			t.Fatalf("old = %d, new = %d, expected the rollout to wait at 2 and 1",
+				*machineSets["workers-old"].Spec.Replicas, *machineSets[newName].Spec.Replicas)
+		}
+	}
+}
+
+func TestRolloutRollingMaxUnavailable(t *testing.T) {
+	deployment := newRolloutDeployment(4, "t3.medium")
+	deployment.Spec.Strategy.RollingUpdate = &v1beta1.MachineRollingUpdateDeployment{
+		MaxSurge:       ptr.To(intstr.FromInt32(0)),
+		MaxUnavailable: ptr.To(intstr.FromString("50%")),
+	}
+	old := newOldMachineSet(deployment, "workers-old", time.Hour, 4)
+	r := newRolloutReconciler(deployment, old)
+	hash, _ := computeTemplateHash(&deployment.Spec.Template, nil)
+	newName := "workers-" + hash
+
+	// Without surge, two old machines are removed before new ones are created
+	machineSets := rollout(t, r, deployment)
+	if *machineSets["workers-old"].Spec.Replicas != 2 || *machineSets[newName].Spec.Replicas != 0 {
+		t.Fatalf("old = %d, new = %d, expected 2 and 0",
+			*machineSets["workers-old"].Spec.Replicas, *machineSets[newName].Spec.Replicas)
+	}
+
+	setAvailable(t, r, machineSets["workers-old"], 2, 2)
+	machineSets = rollout(t, r, deployment)
+	if *machineSets["workers-old"].Spec.Replicas != 2 || *machineSets[newName].Spec.Replicas != 2 {
+		t.Fatalf("old = %d, new = %d, expected 2 and 2",
+			*machineSets["workers-old"].Spec.Replicas, *machineSets[newName].Spec.Replicas)
+	}
+}
+
+func TestRolloutRevisionHistoryLimit(t *testing.T) {
+	deployment := newRolloutDeployment(1, "t3.medium")
+	deployment.Spec.RevisionHistoryLimit = ptr.To[int32](1)
+	objs := []client.Object{
+		newOldMachineSet(deployment, "workers-oldest", 3*time.Hour, 0),
+		newOldMachineSet(deployment, "workers-older", 2*time.Hour, 0),
+		newOldMachineSet(deployment, "workers-old", time.Hour, 0),
+	}
+	r := newRolloutReconciler(deployment, objs...)
+
+	machineSets := rollout(t, r, deployment)
+	if len(machineSets) != 2 || machineSets["workers-old"] == nil {
+		t.Errorf("expected the newest old MachineSet and the new one to be kept, got %v", machineSets)
+	}
+}
+
+func TestRolloutRecreate(t *testing.T) {
+	deployment := newRolloutDeployment(2, "t3.medium")
+	deployment.Spec.Strategy = &v1beta1.MachineDeploymentStrategy{Type: "Recreate"}
+	old := newOldMachineSet(deployment, "workers-old", time.Hour, 2)
+	r := newRolloutReconciler(deployment, old)
+
+	// Old machines are removed before the new MachineSet is created
+	machineSets := rollout(t, r, deployment)
+	if len(machineSets) != 1 || *machineSets["workers-old"].Spec.Replicas != 0 {
+		t.Fatalf("expected the old MachineSet to be scaled down, got %v", machineSets)
+	}
+	machineSets = rollout(t, r, deployment)
+	if len(machineSets) != 1 {
+		t.Fatalf("expected to wait for the old machines, got %v", machineSets)
+	}
+
+	setAvailable(t, r, machineSets["workers-old"], 0, 0)
+	machineSets = rollout(t, r, deployment)
+	hash, _ := computeTemplateHash(&deployment.Spec.Template, nil)
+	if ms := machineSets["workers-"+hash]; ms == nil || *ms.Spec.Replicas != 2 {
+		t.Fatalf("expected MachineSet workers-%s with 2 replicas, got %v", hash, machineSets)
+	}
+
+	// Nothing is recreated once the rollout is done
+	if again := rollout(t, r, deployment); len(again) != 2 || again["workers-"+hash].UID != machineSets["workers-"+hash].UID {
+		t.Errorf("expected the MachineSets to be kept, got %v", again)
+	}
+}
+
+func TestRolloutHashCollision(t *testing.T) {
+	deployment := newRolloutDeployment(1, "t3.medium")
+	hash, _ := computeTemplateHash(&deployment.Spec.Template, nil)
+	// A MachineSet of another template already has the name of the new MachineSet
+	taken := newOldMachineSet(deployment, "workers-"+hash, time.Hour, 0)
+	r := newRolloutReconciler(deployment, taken)
+
+	ctx := context.Background()
+	machineSets, _ := r.listMachineSets(ctx, deployment)
+	if err := r.reconcileMachineSets(ctx, deployment, machineSets); err == nil {
+		t.Fatalf("expected a hash collision error")
+	}
+	got := &v1beta1.CaptMachineDeployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "workers", Namespace: "default"}, got); err != nil {
+		t.Fatalf("failed to get CaptMachineDeployment: %v", err)
+	}
+	if got.Status.CollisionCount == nil || *got.Status.CollisionCount != 1 {
+		t.Fatalf("collisionCount = %v, expected 1", got.Status.CollisionCount)
+	}
+
+	if result := rollout(t, r, got); len(result) != 2 {
+		t.Errorf("expected a MachineSet with the next hash, got %v", result)
+	}
+}
+
+func TestRollingUpdateFenceposts(t *testing.T) {
+	tests := []struct {
+		name                   string
+		replicas               int32
+		maxSurge               intstr.IntOrString
+		maxUnavailable         intstr.IntOrString
+		expectedSurge          int32
+		expectedMaxUnavailable int32
+	}{
+		{name: "numbers", replicas: 3, maxSurge: intstr.FromInt32(2), maxUnavailable: intstr.FromInt32(1), expectedSurge: 2, expectedMaxUnavailable: 1},
+		{name: "percentages round surge up and unavailable down", replicas: 3, maxSurge: intstr.FromString("50%"), maxUnavailable: intstr.FromString("50%"), expectedSurge: 2, expectedMaxUnavailable: 1},
+		{name: "both zero", replicas: 3, maxSurge: intstr.FromInt32(0), maxUnavailable: intstr.FromString("10%"), expectedMaxUnavailable: 1},
+		{name: "unavailable capped at replicas", replicas: 2, maxSurge: intstr.FromInt32(0), maxUnavailable: intstr.FromInt32(5), expectedMaxUnavailable: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := newRolloutDeployment(tt.replicas, "t3.medium")
+			deployment.Spec.Strategy.RollingUpdate = &v1beta1.MachineRollingUpdateDeployment{
+				MaxSurge:       &tt.maxSurge,
+				MaxUnavailable: &tt.maxUnavailable,
+			}
+			surge, unavailable, err := rollingUpdateFenceposts(deployment)
+			if err != nil {
+				t.Fatalf("rollingUpdateFenceposts() error = %v", err)
+			}
+			if surge != tt.expectedSurge || unavailable != tt.expectedMaxUnavailable {
+				t.Errorf("got %d and %d, expected %d and %d", surge, unavailable, tt.expectedSurge, tt.expectedMaxUnavailable)
+			}
+		})
+	}
+}
+
+func TestComputeTemplateHash(t *testing.T) {
+	template := newRolloutDeployment(1, "t3.medium").Spec.Template
+	hash, _ := computeTemplateHash(&template, nil)
+
+	labelled := template.DeepCopy()
+	labelled.ObjectMeta.Labels[DefaultDeploymentUniqueLabelKey] = hash
+	if labelledHash, _ := computeTemplateHash(labelled, nil); labelledHash != hash {
+		t.Errorf("the template hash label changed the hash from %s to %s", hash, labelledHash)
+	}
+	if !equalIgnoreHash(labelled, &template) {
+		t.Errorf("expected templates that only differ in the hash label to be equal")
+	}
+
+	changed := newRolloutDeployment(1, "t3.large").Spec.Template
+	if changedHash, _ := computeTemplateHash(&changed, nil); changedHash == hash {
+		t.Errorf("expected a different hash for a different template")
+	}
+	if collisionHash, _ := computeTemplateHash(&template, ptr.To[int32](1)); collisionHash == hash {
+		t.Errorf("expected the collision count to change the hash")
+	}
+}
+
+func TestMachineAvailableIn(t *testing.T) {
+	now := time.Now()
+	machine := &v1beta1.CaptMachine{
+		Status: v1beta1.CaptMachineStatus{Ready: true, LastTransitionTime: &metav1.Time{Time: now.Add(-10 * time.Second)}},
+	}
+
+	if remaining := machineAvailableIn(machine, 0, now); remaining != 0 {
+		t.Errorf("expected the machine to be available without minReadySeconds, got %s", remaining)
+	}
+	if remaining := machineAvailableIn(machine, 5, now); remaining != 0 {
+		t.Errorf("expected the machine to be available after 5s, got %s", remaining)
+	}
+	if remaining := machineAvailableIn(machine, 30, now); remaining != 20*time.Second {
+		t.Errorf("expected the machine to be available in 20s, got %s", remaining)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// updateStatus updates the status of the deployment from its MachineSets. It returns the time
+// until the progress deadline of a rollout in progress passes, or zero if there is none.
+func (r *CaptMachineDeploymentReconciler) updateStatus(ctx context.Context, deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet) (time.Duration, error) {
+	newStatus, deadlineIn := calculateStatus(deployment, machineSets, time.Now())
+
+	// Report a rollout that got stuck once
+	if progressing := meta.FindStatusCondition(newStatus.Conditions, infrastructurev1beta1.MachineDeploymentProgressingCondition); progressing != nil &&
+		progressing.Reason == infrastructurev1beta1.ReasonProgressDeadlineExceeded &&
+		!meta.IsStatusConditionPresentAndEqual(deployment.Status.Conditions, progressing.Type, progressing.Status) {
+		r.Recorder.Event(deployment, corev1.EventTypeWarning, infrastructurev1beta1.ReasonProgressDeadlineExceeded, progressing.Message)
+	}
+
+	// Update status if it has changed
+	if !equality.Semantic.DeepEqual(deployment.Status, newStatus) {
+		deployment.Status = newStatus
+		return deadlineIn, r.Status().Update(ctx, deployment)
+	}
+
+	return deadlineIn, nil
+}
+
+// calculateStatus returns the status of the deployment with its replica counts, the Available and
+// Progressing conditions, and the time until the progress deadline passes.
+func calculateStatus(deployment *infrastructurev1beta1.CaptMachineDeployment, machineSets []infrastructurev1beta1.CaptMachineSet, now time.Time) (infrastructurev1beta1.CaptMachineDeploymentStatus, time.Duration) {
+	old := deployment.Status
+	status := *old.DeepCopy()
+	status.ObservedGeneration = deployment.Generation
+	status.Replicas, status.ReadyReplicas, status.AvailableReplicas = 0, 0, 0
+	status.UpdatedReplicas, status.UpdatedAvailableReplicas = 0, 0
+
+	newMS, _ := splitMachineSets(deployment, machineSets)
+	for i := range machineSets {
+		status.Replicas += machineSets[i].Status.Replicas
+		status.ReadyReplicas += machineSets[i].Status.ReadyReplicas
+		status.AvailableReplicas += machineSets[i].Status.AvailableReplicas
+	}
+	if newMS != nil {
+		status.UpdatedReplicas = newMS.Status.Replicas
+		status.UpdatedAvailableReplicas = newMS.Status.AvailableReplicas
+	}
+	desired := deploymentReplicas(deployment)
+	status.UnavailableReplicas = max(desired-status.AvailableReplicas, 0)
+
+	// Available
+	minAvailable := desired
+	if deployment.Spec.Strategy != nil && deployment.Spec.Strategy.Type == "RollingUpdate" {
+		if _, maxUnavailable, err := rollingUpdateFenceposts(deployment); err == nil {
+			minAvailable -= maxUnavailable
+		}
+	}
+	if status.AvailableReplicas >= minAvailable {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachineDeploymentAvailableCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  infrastructurev1beta1.ReasonMinimumReplicasAvailable,
+			Message: fmt.Sprintf("%d of %d machines are available", status.AvailableReplicas, desired),
+		})
+	} else {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachineDeploymentAvailableCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonMinimumReplicasUnavailable,
+			Message: fmt.Sprintf("%d of %d machines are available, %d required", status.AvailableReplicas, desired, minAvailable),
+		})
+	}
+
+	// Progressing
+	switch {
+	case deployment.Spec.Paused:
+		// Progress is not estimated while paused, the deadline starts over on resume
+		status.ProgressStartTime = nil
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachineDeploymentProgressingCondition,
+			Status:  metav1.ConditionUnknown,
+			Reason:  infrastructurev1beta1.ReasonDeploymentPaused,
+			Message: "Deployment is paused",
+		})
+		return status, 0
+	case newMS != nil && status.UpdatedReplicas == desired && status.UpdatedAvailableReplicas == desired && status.Replicas == desired:
+		status.ProgressStartTime = nil
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachineDeploymentProgressingCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  infrastructurev1beta1.ReasonNewMachineSetAvailable,
+			Message: fmt.Sprintf("MachineSet %s has successfully progressed", newMS.Name),
+		})
+		return status, 0
+	case status.ProgressStartTime == nil || old.ObservedGeneration != deployment.Generation || madeProgress(&old, &status):
+		status.ProgressStartTime = &metav1.Time{Time: now}
+	}
+
+	message := "Waiting for the MachineSet of the current template to be created"
+	if newMS != nil {
+		message = fmt.Sprintf("MachineSet %s is progressing", newMS.Name)
+	}
+	deadlineSeconds := int32(infrastructurev1beta1.DefaultProgressDeadlineSeconds)
+	if deployment.Spec.ProgressDeadlineSeconds != nil {
+		deadlineSeconds = *deployment.Spec.ProgressDeadlineSeconds
+	}
+	deadline := status.ProgressStartTime.Add(time.Duration(deadlineSeconds) * time.Second)
+	if !now.Before(deadline) {
+		if newMS != nil {
+			message = fmt.Sprintf("MachineSet %s has not made progress within %d seconds", newMS.Name, deadlineSeconds)
+		} else {
+			message = fmt.Sprintf("The MachineSet of the current template has not been created within %d seconds", deadlineSeconds)
+		}
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachineDeploymentProgressingCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonProgressDeadlineExceeded,
+			Message: message,
+		})
+		return status, 0
+	}
+
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:    infrastructurev1beta1.MachineDeploymentProgressingCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  infrastructurev1beta1.ReasonMachineSetUpdated,
+		Message: message,
+	})
+	return status, deadline.Sub(now)
+}
+
+// madeProgress returns true if machines of the current template were added or became available,
+// or machines of old templates were removed, since the previous status
+func madeProgress(old, status *infrastructurev1beta1.CaptMachineDeploymentStatus) bool {
+	return status.UpdatedReplicas > old.UpdatedReplicas ||
+		status.UpdatedAvailableReplicas > old.UpdatedAvailableReplicas ||
+		status.AvailableReplicas > old.AvailableReplicas ||
+		status.Replicas-status.UpdatedReplicas < old.Replicas-old.UpdatedReplicas
+}
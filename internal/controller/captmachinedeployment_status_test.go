@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+// newCurrentMachineSet returns the MachineSet of the current template of the deployment
+func newCurrentMachineSet(deployment *v1beta1.CaptMachineDeployment, replicas, available int32) v1beta1.CaptMachineSet {
+	hash, _ := computeTemplateHash(&deployment.Spec.Template, nil)
+	template := deployment.Spec.Template.DeepCopy()
+	template.ObjectMeta.Labels = cloneAndAddLabel(template.ObjectMeta.Labels, DefaultDeploymentUniqueLabelKey, hash)
+	return v1beta1.CaptMachineSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers-" + hash, Namespace: "default"},
+		Spec:       v1beta1.CaptMachineSetSpec{Replicas: ptr.To(replicas), Template: *template},
+		Status:     v1beta1.CaptMachineSetStatus{Replicas: replicas, ReadyReplicas: available, AvailableReplicas: available},
+	}
+}
+
+func TestCalculateStatus(t *testing.T) {
+	now := time.Now()
+	deployment := newRolloutDeployment(3, "t3.medium")
+	deployment.Generation = 2
+	deployment.Spec.ProgressDeadlineSeconds = ptr.To[int32](600)
+	old := newOldMachineSet(deployment, "workers-old", time.Hour, 2)
+	current := newCurrentMachineSet(deployment, 2, 1)
+
+	status, deadlineIn := calculateStatus(deployment, []v1beta1.CaptMachineSet{*old, current}, now)
+	if status.Replicas != 4 || status.ReadyReplicas != 3 || status.AvailableReplicas != 3 {
+		t.Errorf("replicas = %d, ready = %d, available = %d, expected 4, 3 and 3", status.Replicas, status.ReadyReplicas, status.AvailableReplicas)
+	}
+	if status.UpdatedReplicas != 2 || status.UpdatedAvailableReplicas != 1 || status.UnavailableReplicas != 0 {
+		t.Errorf("updated = %d, updated available = %d, unavailable = %d, expected 2, 1 and 0",
+			status.UpdatedReplicas, status.UpdatedAvailableReplicas, status.UnavailableReplicas)
+	}
+	if status.ObservedGeneration != 2 {
+		t.Errorf("observedGeneration = %d, expected 2", status.ObservedGeneration)
+	}
+	if !meta.IsStatusConditionTrue(status.Conditions, v1beta1.MachineDeploymentAvailableCondition) {
+		t.Errorf("expected the deployment to be available, got %v", status.Conditions)
+	}
+	progressing := meta.FindStatusCondition(status.Conditions, v1beta1.MachineDeploymentProgressingCondition)
+	if progressing == nil || progressing.Reason != v1beta1.ReasonMachineSetUpdated {
+		t.Fatalf("Progressing = %v, expected reason %s", progressing, v1beta1.ReasonMachineSetUpdated)
+	}
+	if status.ProgressStartTime == nil || !status.ProgressStartTime.Time.Equal(now) {
+		t.Errorf("progressStartTime = %v, expected %v", status.ProgressStartTime, now)
+	}
+	if deadlineIn != 600*time.Second {
+		t.Errorf("deadlineIn = %s, expected 10m", deadlineIn)
+	}
+}
+
+func TestCalculateStatusProgress(t *testing.T) {
+	start := time.Now().Add(-time.Hour)
+	deployment := newRolloutDeployment(2, "t3.medium")
+	deployment.Spec.ProgressDeadlineSeconds = ptr.To[int32](600)
+	old := newOldMachineSet(deployment, "workers-old", 2*time.Hour, 2)
+
+	tests := []struct {
+		name            string
+		machineSets     []v1beta1.CaptMachineSet
+		paused          bool
+		expectedStatus  metav1.ConditionStatus
+		expectedReason  string
+		expectStartTime *time.Time
+	}{
+		{
+			name:            "no progress within the deadline",
+			machineSets:     []v1beta1.CaptMachineSet{*old, newCurrentMachineSet(deployment, 1, 0)},
+			expectedStatus:  metav1.ConditionFalse,
+			expectedReason:  v1beta1.ReasonProgressDeadlineExceeded,
+			expectStartTime: &start,
+		},
+		{
+			name:           "progress resets the deadline",
+			machineSets:    []v1beta1.CaptMachineSet{*old, newCurrentMachineSet(deployment, 1, 1)},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: v1beta1.ReasonMachineSetUpdated,
+		},
+		{
+			name:           "complete",
+			machineSets:    []v1beta1.CaptMachineSet{newCurrentMachineSet(deployment, 2, 2)},
+			expectedStatus: metav1.ConditionTrue,
+			expectedReason: v1beta1.ReasonNewMachineSetAvailable,
+		},
+		{
+			name:           "paused",
+			machineSets:    []v1beta1.CaptMachineSet{*old, newCurrentMachineSet(deployment, 1, 0)},
+			paused:         true,
+			expectedStatus: metav1.ConditionUnknown,
+			expectedReason: v1beta1.ReasonDeploymentPaused,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deployment := deployment.DeepCopy()
+			deployment.Spec.Paused = tt.paused
+			// The previous reconcile saw the new MachineSet created without available machines
+			deployment.Status = v1beta1.CaptMachineDeploymentStatus{
+				Replicas:          3,
+				UpdatedReplicas:   1,
+				AvailableReplicas: 2,
+				ProgressStartTime: &metav1.Time{Time: start},
+			}
+
+			status, deadlineIn := calculateStatus(deployment, tt.machineSets, time.Now())
+			progressing := meta.FindStatusCondition(status.Conditions, v1beta1.MachineDeploymentProgressingCondition)
+			if progressing == nil || progressing.Status != tt.expectedStatus || progressing.Reason != tt.expectedReason {
+				t.Fatalf("Progressing = %v, expected %s with reason %s", progressing, tt.expectedStatus, tt.expectedReason)
+			}
+			if tt.expectStartTime != nil && (status.ProgressStartTime == nil || !status.ProgressStartTime.Time.Equal(*tt.expectStartTime)) {
+				t.Errorf("progressStartTime = %v, expected %v", status.ProgressStartTime, *tt.expectStartTime)
+			}
+			if tt.expectedReason != v1beta1.ReasonMachineSetUpdated && deadlineIn != 0 {
+				t.Errorf("deadlineIn = %s, expected no deadline to wait for", deadlineIn)
+			}
+		})
+	}
+}
+
+func TestCalculateStatusMinimumAvailable(t *testing.T) {
+	deployment := newRolloutDeployment(3, "t3.medium")
+	machineSets := []v1beta1.CaptMachineSet{newCurrentMachineSet(deployment, 3, 2)}
+
+	// maxUnavailable 0 requires all machines
+	status, _ := calculateStatus(deployment, machineSets, time.Now())
+	available := meta.FindStatusCondition(status.Conditions, v1beta1.MachineDeploymentAvailableCondition)
+	if available == nil || available.Reason != v1beta1.ReasonMinimumReplicasUnavailable {
+		t.Errorf("Available = %v, expected reason %s", available, v1beta1.ReasonMinimumReplicasUnavailable)
+	}
+	if status.UnavailableReplicas != 1 {
+		t.Errorf("unavailableReplicas = %d, expected 1", status.UnavailableReplicas)
+	}
+
+	deployment.Spec.Strategy.RollingUpdate.MaxUnavailable = ptr.To(intstr.FromInt32(1))
+	status, _ = calculateStatus(deployment, machineSets, time.Now())
+	if !meta.IsStatusConditionTrue(status.Conditions, v1beta1.MachineDeploymentAvailableCondition) {
+		t.Errorf("expected the deployment to be available with maxUnavailable 1, got %v", status.Conditions)
+	}
+}
+
+func TestUpdateStatusProgressDeadlineEvent(t *testing.T) {
+	deployment := newRolloutDeployment(2, "t3.medium")
+	deployment.Spec.ProgressDeadlineSeconds = ptr.To[int32](600)
+	deployment.Status = v1beta1.CaptMachineDeploymentStatus{
+		Replicas:          3,
+		UpdatedReplicas:   1,
+		AvailableReplicas: 2,
+		ProgressStartTime: &metav1.Time{Time: time.Now().Add(-time.Hour)},
+	}
+	old := newOldMachineSet(deployment, "workers-old", 2*time.Hour, 2)
+	current := newCurrentMachineSet(deployment, 1, 0)
+	r := newRolloutReconciler(deployment)
+	recorder := record.NewFakeRecorder(10)
+	r.Recorder = recorder
+
+	ctx := context.Background()
+	got := &v1beta1.CaptMachineDeployment{}
+	for range 2 {
+		if err := r.Get(ctx, types.NamespacedName{Name: "workers", Namespace: "default"}, got); err != nil {
+			t.Fatalf("failed to get CaptMachineDeployment: %v", err)
+		}
+		if _, err := r.updateStatus(ctx, got, []v1beta1.CaptMachineSet{*old, current}); err != nil {
+			t.Fatalf("updateStatus() error = %v", err)
+		}
+	}
+
+	// The event is only recorded when the deadline is first exceeded
+	if len(recorder.Events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(recorder.Events))
+	}
+	if event := <-recorder.Events; event != "Warning ProgressDeadlineExceeded MachineSet "+current.Name+" has not made progress within 600 seconds" {
+		t.Errorf("unexpected event %q", event)
+	}
+}
@@ -0,0 +1,503 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/annotations"
+	"sigs.k8s.io/cluster-api/util/predicates"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
+	"github.com/appthrust/capt/internal/controller/identity"
+	"github.com/appthrust/capt/internal/controller/nodegroup"
+	"github.com/appthrust/capt/internal/controller/outputs"
+)
+
+const (
+	// CaptMachinePoolFinalizer allows CaptMachinePoolReconciler to delete the node group
+	// before the CaptMachinePool is removed from the apiserver.
+	CaptMachinePoolFinalizer = "captmachinepool.infrastructure.cluster.x-k8s.io"
+
+	// nodeGroupRefreshInterval is the period at which the instances of ready node groups are listed
+	nodeGroupRefreshInterval = time.Minute
+
+	// nodeGroupDeletionRequeue is the period for requeuing while the node group is destroyed
+	nodeGroupDeletionRequeue = 10 * time.Second
+)
+
+// CaptMachinePoolReconciler reconciles a CaptMachinePool object
+type CaptMachinePoolReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// Credentials are the AWS credentials of the manager, used to list the instances of node
+	// groups of clusters without an identity
+	Credentials kubeconfig.CredentialsProvider
+	// Instances lists the instances of node groups between applies. If nil, the providerIDList
+	// only follows the instances output of the node group workspace.
+	Instances nodegroup.Lister
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captmachinepools,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captmachinepools/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captmachinepools/finalizers,verbs=update
+//+kubebuilder:rbac:groups=cluster.x-k8s.io,resources=machinepools,verbs=get;list;watch
+
+// Reconcile handles CaptMachinePool reconciliation
+func (r *CaptMachinePoolReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	pool := &infrastructurev1beta1.CaptMachinePool{}
+	if err := r.Get(ctx, req.NamespacedName, pool); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The MachinePool holds the replicas and the cluster of the pool
+	owner, err := r.getOwnerMachinePool(ctx, pool)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	deleting := !pool.DeletionTimestamp.IsZero()
+	if owner == nil && !deleting {
+		logger.Info("Waiting for the MachinePool controller to set the owner reference")
+		return ctrl.Result{}, nil
+	}
+
+	// The MachinePool may already be gone when the pool is deleted, the cluster label still
+	// names the cluster
+	clusterName := pool.Labels[clusterv1.ClusterNameLabel]
+	if owner != nil {
+		clusterName = owner.Spec.ClusterName
+	}
+	cluster, err := getCluster(ctx, r.Client, pool.Namespace, clusterName)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if annotations.HasPaused(pool) || (cluster != nil && cluster.Spec.Paused) {
+		logger.Info("Reconciliation is paused for this CaptMachinePool")
+		return ctrl.Result{}, nil
+	}
+
+	// Handle deletion
+	if deleting {
+		return r.reconcileDelete(ctx, pool)
+	}
+
+	// Add finalizer if it doesn't exist
+	if !controllerutil.ContainsFinalizer(pool, CaptMachinePoolFinalizer) {
+		controllerutil.AddFinalizer(pool, CaptMachinePoolFinalizer)
+		if err := r.Update(ctx, pool); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// The node group is created once the cluster infrastructure exists
+	if cluster == nil || !cluster.Status.InfrastructureReady {
+		logger.Info("Waiting for the cluster infrastructure to be ready")
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.reconcileNodeGroup(ctx, pool, owner, cluster); err != nil {
+		logger.Error(err, "Failed to reconcile node group")
+		return ctrl.Result{}, err
+	}
+
+	// The instances of the node group change without an apply when it scales or replaces
+	// instances, so they are listed again periodically
+	if r.Instances != nil && pool.Status.Ready {
+		return ctrl.Result{RequeueAfter: nodeGroupRefreshInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// getOwnerMachinePool returns the MachinePool owning the pool, or nil if it has none yet or the
+// pool is deleted after its MachinePool
+func (r *CaptMachinePoolReconciler) getOwnerMachinePool(ctx context.Context, pool *infrastructurev1beta1.CaptMachinePool) (*expv1.MachinePool, error) {
+	for _, ref := range pool.OwnerReferences {
+		if ref.Kind != "MachinePool" {
+			continue
+		}
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			return nil, err
+		}
+		if gv.Group != expv1.GroupVersion.Group {
+			continue
+		}
+		machinePool := &expv1.MachinePool{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: pool.Namespace}, machinePool); err != nil {
+			if apierrors.IsNotFound(err) && !pool.DeletionTimestamp.IsZero() {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to get MachinePool %s/%s: %w", pool.Namespace, ref.Name, err)
+		}
+		return machinePool, nil
+	}
+	return nil, nil
+}
+
+// reconcileNodeGroup creates or updates the WorkspaceTemplateApply of the node group
+func (r *CaptMachinePoolReconciler) reconcileNodeGroup(ctx context.Context, pool *infrastructurev1beta1.CaptMachinePool, owner *expv1.MachinePool, cluster *clusterv1.Cluster) error {
+	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-nodegroup", pool.Name),
+			Namespace: pool.Namespace,
+		},
+	}
+
+	// Pools use the identity of their cluster
+	identityRef, err := identity.ForCluster(ctx, r.Client, pool.Namespace, cluster.Name)
+	if err != nil {
+		return err
+	}
+	workspaces, err := getClusterWorkspaces(ctx, r.Client, cluster)
+	if err != nil {
+		return err
+	}
+	size := nodeGroupSizeFor(pool, owner)
+
+	_, err = controllerutil.CreateOrUpdate(ctx, r.Client, apply, func() error {
+		apply.Spec.TemplateRef = pool.Spec.WorkspaceTemplateRef
+		apply.Spec.IdentityRef = identityRef
+		apply.Spec.Variables = map[string]string{
+			"cluster_name":    eksClusterName(cluster),
+			"node_group_name": nodeGroupName(pool),
+			"instance_type":   pool.Spec.InstanceType,
+			"desired_size":    strconv.Itoa(int(size.desired)),
+			"min_size":        strconv.Itoa(int(size.min)),
+			"max_size":        strconv.Itoa(int(size.max)),
+		}
+		workspaces.applyTo(&apply.Spec, pool.Namespace)
+
+		apply.Spec.StructuredVariables = nil
+		if pool.Spec.Labels != nil {
+			if err := apply.Spec.SetStructuredVariable("labels", pool.Spec.Labels); err != nil {
+				return err
+			}
+		}
+		if pool.Spec.Taints != nil {
+			if err := apply.Spec.SetStructuredVariable("taints", pool.Spec.Taints); err != nil {
+				return err
+			}
+		}
+		if pool.Spec.AdditionalTags != nil {
+			if err := apply.Spec.SetStructuredVariable("tags", pool.Spec.AdditionalTags); err != nil {
+				return err
+			}
+		}
+		if owner.Spec.FailureDomains != nil {
+			if err := apply.Spec.SetStructuredVariable("availability_zones", owner.Spec.FailureDomains); err != nil {
+				return err
+			}
+		}
+
+		return controllerutil.SetControllerReference(pool, apply, r.Scheme)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create or update WorkspaceTemplateApply: %w", err)
+	}
+
+	instances, err := r.nodeGroupInstances(ctx, pool, apply, cluster, identityRef)
+	if err != nil {
+		return err
+	}
+	return r.updateStatus(ctx, pool, apply, size, instances)
+}
+
+// nodeGroupInstances returns the instances of an applied node group. The instances output of
+// the node group workspace only changes when the workspace is applied, so the instances are
+// listed with the EC2 API when possible to follow scaling and instance replacement between
+// applies. The output is used if they cannot be listed.
+func (r *CaptMachinePoolReconciler) nodeGroupInstances(ctx context.Context, pool *infrastructurev1beta1.CaptMachinePool, apply *infrastructurev1beta1.WorkspaceTemplateApply, cluster *clusterv1.Cluster, identityRef *infrastructurev1beta1.IdentityReference) ([]nodeGroupInstance, error) {
+	if !apply.Status.Applied {
+		return nil, nil
+	}
+	instances, err := r.listInstances(ctx, pool, cluster, identityRef)
+	if err == nil && instances != nil {
+		return instances, nil
+	}
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list node group instances, using the instances output")
+	}
+	instances, _, err = outputs.FromApply[[]nodeGroupInstance](ctx, r.Client, apply, "instances")
+	return instances, err
+}
+
+// listInstances lists the instances of the node group with the credentials of the identity of
+// the cluster, or of the manager if the cluster has none. It returns nil if the instances
+// cannot be listed by the manager.
+func (r *CaptMachinePoolReconciler) listInstances(ctx context.Context, pool *infrastructurev1beta1.CaptMachinePool, cluster *clusterv1.Cluster, identityRef *infrastructurev1beta1.IdentityReference) ([]nodeGroupInstance, error) {
+	if r.Instances == nil {
+		return nil, nil
+	}
+	credentials := r.Credentials
+	if identityRef != nil {
+		var err error
+		if credentials, err = identity.Credentials(ctx, r.Client, identityRef.Name, pool.Namespace); err != nil {
+			return nil, err
+		}
+	}
+	region, err := getClusterRegion(ctx, r.Client, cluster)
+	if err != nil || credentials == nil || region == "" {
+		return nil, err
+	}
+
+	listed, err := r.Instances.ListInstances(ctx, credentials, region, eksClusterName(cluster), nodeGroupName(pool))
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]nodeGroupInstance, 0, len(listed))
+	for _, instance := range listed {
+		instances = append(instances, nodeGroupInstance{ID: instance.ID, AvailabilityZone: instance.AvailabilityZone})
+	}
+	return instances, nil
+}
+
+// nodeGroupName returns the name of the EKS managed node group of the pool
+func nodeGroupName(pool *infrastructurev1beta1.CaptMachinePool) string {
+	if pool.Spec.NodeGroupName != "" {
+		return pool.Spec.NodeGroupName
+	}
+	return pool.Name
+}
+
+// nodeGroupSize is the scaling configuration of a managed node group
+type nodeGroupSize struct {
+	desired, min, max int32
+	// replicas are the replicas of the MachinePool, which differ from desired if they are out of bounds
+	replicas int32
+}
+
+// nodeGroupSizeFor maps the replicas of the MachinePool to the desired size of the node group
+// within the scaling bounds of the pool. Bounds that are not set fit the replicas.
+func nodeGroupSizeFor(pool *infrastructurev1beta1.CaptMachinePool, owner *expv1.MachinePool) nodeGroupSize {
+	replicas := ptr.Deref(owner.Spec.Replicas, 1)
+	size := nodeGroupSize{replicas: replicas}
+	if scaling := pool.Spec.Scaling; scaling != nil {
+		size.min = ptr.Deref(scaling.MinSize, 0)
+		size.max = ptr.Deref(scaling.MaxSize, 0)
+	}
+	if size.max == 0 {
+		size.max = max(replicas, size.min, 1)
+	}
+	size.desired = min(max(replicas, size.min), size.max)
+	return size
+}
+
+// nodeGroupInstance is an instance of the node group in the instances output
+type nodeGroupInstance struct {
+	ID               string `json:"id"`
+	AvailabilityZone string `json:"availability_zone"`
+}
+
+// updateStatus updates the providerIDList and status of the pool from the node group instances
+// and outputs
+func (r *CaptMachinePoolReconciler) updateStatus(ctx context.Context, pool *infrastructurev1beta1.CaptMachinePool, apply *infrastructurev1beta1.WorkspaceTemplateApply, size nodeGroupSize, instances []nodeGroupInstance) error {
+	var providerIDs []string
+	var arn string
+	if apply.Status.Applied {
+		var err error
+		for _, instance := range instances {
+			if providerID := (machineInstance{id: instance.ID, availabilityZone: instance.AvailabilityZone}).providerID(); providerID != "" {
+				providerIDs = append(providerIDs, providerID)
+			}
+		}
+		slices.Sort(providerIDs)
+		if arn, _, err = outputs.FromApply[string](ctx, r.Client, apply, "node_group_arn"); err != nil {
+			return err
+		}
+	}
+
+	// Cluster API matches the Nodes of the MachinePool by the providerIDList. The spec is patched
+	// before the status is changed, as the patch response replaces the pool.
+	if apply.Status.Applied && !slices.Equal(pool.Spec.ProviderIDList, providerIDs) {
+		base := pool.DeepCopy()
+		pool.Spec.ProviderIDList = providerIDs
+		if err := r.Patch(ctx, pool, client.MergeFrom(base)); err != nil {
+			return fmt.Errorf("failed to set providerIDList: %w", err)
+		}
+	}
+
+	pool.Status.Ready = apply.Status.Applied
+	pool.Status.Replicas = int32(len(pool.Spec.ProviderIDList))
+	pool.Status.DesiredSize = size.desired
+	pool.Status.WorkspaceTemplateApplyName = apply.Name
+	if arn != "" {
+		pool.Status.NodeGroupARN = arn
+	}
+	for _, condition := range apply.Status.Conditions {
+		if condition.Type == xpv1.TypeReady {
+			pool.Status.Ready = pool.Status.Ready && condition.Status == corev1.ConditionTrue
+		}
+		if condition.Type == "Failed" && condition.Status == corev1.ConditionTrue {
+			message := condition.Message
+			reason := string(condition.Reason)
+			pool.Status.FailureMessage = &message
+			pool.Status.FailureReason = &reason
+		}
+	}
+
+	if pool.Status.Ready {
+		meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachinePoolReadyCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  infrastructurev1beta1.ReasonNodeGroupReady,
+			Message: fmt.Sprintf("Node group %s is ready", nodeGroupName(pool)),
+		})
+	} else {
+		meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachinePoolReadyCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonNodeGroupProvisioning,
+			Message: fmt.Sprintf("Waiting for WorkspaceTemplateApply %s to be applied", apply.Name),
+		})
+	}
+
+	switch {
+	case size.desired != size.replicas:
+		message := fmt.Sprintf("MachinePool replicas %d are outside of the scaling bounds %d to %d, the desired size is %d",
+			size.replicas, size.min, size.max, size.desired)
+		// Report the replicas once when they leave the bounds
+		if scaling := meta.FindStatusCondition(pool.Status.Conditions, infrastructurev1beta1.MachinePoolScalingCondition); scaling == nil ||
+			scaling.Reason != infrastructurev1beta1.ReasonReplicasOutOfRange {
+			r.Recorder.Event(pool, corev1.EventTypeWarning, infrastructurev1beta1.ReasonReplicasOutOfRange, message)
+		}
+		meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachinePoolScalingCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonReplicasOutOfRange,
+			Message: message,
+		})
+	case pool.Status.Ready && pool.Status.Replicas == size.desired:
+		meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachinePoolScalingCondition,
+			Status:  metav1.ConditionTrue,
+			Reason:  infrastructurev1beta1.ReasonScaledToReplicas,
+			Message: fmt.Sprintf("Node group has %d instances", size.desired),
+		})
+	default:
+		meta.SetStatusCondition(&pool.Status.Conditions, metav1.Condition{
+			Type:    infrastructurev1beta1.MachinePoolScalingCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  infrastructurev1beta1.ReasonScalingInProgress,
+			Message: fmt.Sprintf("Node group has %d of %d instances", pool.Status.Replicas, size.desired),
+		})
+	}
+
+	return r.Status().Update(ctx, pool)
+}
+
+// reconcileDelete deletes the node group of the pool. The finalizer is kept until the
+// WorkspaceTemplateApply is gone, which is once provider-terraform has destroyed the node group.
+func (r *CaptMachinePoolReconciler) reconcileDelete(ctx context.Context, pool *infrastructurev1beta1.CaptMachinePool) (ctrl.Result, error) {
+	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-nodegroup", pool.Name),
+			Namespace: pool.Namespace,
+		},
+	}
+	if err := r.Delete(ctx, apply); client.IgnoreNotFound(err) != nil {
+		return ctrl.Result{}, err
+	}
+	err := r.Get(ctx, client.ObjectKeyFromObject(apply), apply)
+	if err == nil {
+		log.FromContext(ctx).Info("Waiting for the node group to be destroyed", "workspaceTemplateApply", apply.Name)
+		return ctrl.Result{RequeueAfter: nodeGroupDeletionRequeue}, nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+
+	controllerutil.RemoveFinalizer(pool, CaptMachinePoolFinalizer)
+	if err := r.Update(ctx, pool); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// machinePoolToCaptMachinePool returns the CaptMachinePool referenced by a MachinePool
+func (r *CaptMachinePoolReconciler) machinePoolToCaptMachinePool(_ context.Context, obj client.Object) []reconcile.Request {
+	machinePool, ok := obj.(*expv1.MachinePool)
+	if !ok {
+		return nil
+	}
+	ref := machinePool.Spec.Template.Spec.InfrastructureRef
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || gv.Group != infrastructurev1beta1.GroupVersion.Group || ref.Kind != "CaptMachinePool" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: ref.Name, Namespace: machinePool.Namespace}}}
+}
+
+// clusterToCaptMachinePools returns the CaptMachinePools of a Cluster
+func (r *CaptMachinePoolReconciler) clusterToCaptMachinePools(ctx context.Context, obj client.Object) []reconcile.Request {
+	pools := &infrastructurev1beta1.CaptMachinePoolList{}
+	if err := r.List(ctx, pools, client.InNamespace(obj.GetNamespace()),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: obj.GetName()}); err != nil {
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(pools.Items))
+	for i := range pools.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pools.Items[i])})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CaptMachinePoolReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrastructurev1beta1.CaptMachinePool{}).
+		Owns(&infrastructurev1beta1.WorkspaceTemplateApply{}).
+		// Resize the node group when the replicas of the MachinePool change
+		Watches(
+			&expv1.MachinePool{},
+			handler.EnqueueRequestsFromMapFunc(r.machinePoolToCaptMachinePool),
+		).
+		// Resume pools when their cluster is unpaused and its infrastructure is ready
+		Watches(
+			&clusterv1.Cluster{},
+			handler.EnqueueRequestsFromMapFunc(r.clusterToCaptMachinePools),
+			builder.WithPredicates(predicates.ClusterUnpausedAndInfrastructureReady(mgr.GetLogger())),
+		).
+		Complete(r)
+}
@@ -0,0 +1,360 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	expv1 "sigs.k8s.io/cluster-api/exp/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	"github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
+	"github.com/appthrust/capt/internal/controller/nodegroup"
+)
+
+// fakeInstances lists fixed node group instances and records the node groups it was asked for
+type fakeInstances struct {
+	instances []nodegroup.Instance
+	calls     []string
+}
+
+func (f *fakeInstances) ListInstances(_ context.Context, _ kubeconfig.CredentialsProvider, region, clusterName, nodeGroupName string) ([]nodegroup.Instance, error) {
+	f.calls = append(f.calls, region+"/"+clusterName+"/"+nodeGroupName)
+	return f.instances, nil
+}
+
+// newPoolObjects returns a CaptMachinePool of a MachinePool with the given replicas, and the
+// Cluster, CAPTCluster and CAPTControlPlane it belongs to
+func newPoolObjects(replicas int32) (*v1beta1.CaptMachinePool, *expv1.MachinePool, []client.Object) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{Kind: "CAPTCluster", Name: "demo", Namespace: "default"},
+			ControlPlaneRef:   &corev1.ObjectReference{Kind: "CAPTControlPlane", Name: "demo-cp", Namespace: "default"},
+		},
+		Status: clusterv1.ClusterStatus{InfrastructureReady: true},
+	}
+	captCluster := &v1beta1.CAPTCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "default"},
+		Spec:       v1beta1.CAPTClusterSpec{Region: "us-west-2"},
+	}
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{ObjectMeta: metav1.ObjectMeta{Name: "demo-cp", Namespace: "default"}}
+	machinePool := &expv1.MachinePool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool-0", Namespace: "default", UID: "machinepool-uid"},
+		Spec: expv1.MachinePoolSpec{
+			ClusterName: "demo",
+			Replicas:    ptr.To(replicas),
+			Template: clusterv1.MachineTemplateSpec{Spec: clusterv1.MachineSpec{
+				ClusterName: "demo",
+				InfrastructureRef: corev1.ObjectReference{
+					APIVersion: v1beta1.GroupVersion.String(),
+					Kind:       "CaptMachinePool",
+					Name:       "pool-0",
+				},
+			}},
+		},
+	}
+	pool := &v1beta1.CaptMachinePool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pool-0",
+			Namespace: "default",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "demo"},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: expv1.GroupVersion.String(),
+				Kind:       "MachinePool",
+				Name:       machinePool.Name,
+				UID:        machinePool.UID,
+			}},
+		},
+		Spec: v1beta1.CaptMachinePoolSpec{
+			WorkspaceTemplateRef: v1beta1.WorkspaceTemplateReference{Name: "eks-machinepool-template", Namespace: "default"},
+			InstanceType:         "t3.medium",
+			Scaling:              &v1beta1.MachinePoolScaling{MinSize: ptr.To[int32](1), MaxSize: ptr.To[int32](5)},
+		},
+	}
+	return pool, machinePool, []client.Object{cluster, captCluster, controlPlane}
+}
+
+func newPoolReconciler(objs ...client.Object) (*CaptMachinePoolReconciler, *record.FakeRecorder) {
+	scheme := newSourcesScheme()
+	_ = clusterv1.AddToScheme(scheme)
+	_ = expv1.AddToScheme(scheme)
+	_ = controlplanev1beta1.AddToScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	return &CaptMachinePoolReconciler{
+		Client: fake.NewClientBuilder().
+			WithScheme(scheme).
+			WithObjects(objs...).
+			WithStatusSubresource(&v1beta1.CaptMachinePool{}, &v1beta1.WorkspaceTemplateApply{}).
+			Build(),
+		Scheme:   scheme,
+		Recorder: recorder,
+	}, recorder
+}
+
+func reconcilePool(t *testing.T, r *CaptMachinePoolReconciler) *v1beta1.CaptMachinePool {
+	t.Helper()
+	key := types.NamespacedName{Name: "pool-0", Namespace: "default"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	pool := &v1beta1.CaptMachinePool{}
+	if err := r.Get(context.Background(), key, pool); err != nil {
+		t.Fatalf("failed to get CaptMachinePool: %v", err)
+	}
+	return pool
+}
+
+func TestCaptMachinePoolNodeGroup(t *testing.T) {
+	pool, machinePool, objs := newPoolObjects(2)
+	r, _ := newPoolReconciler(append(objs, pool, machinePool)...)
+	ctx := context.Background()
+
+	reconcilePool(t, r)
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "pool-0-nodegroup", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	expected := map[string]string{
+		"cluster_name":    "demo-cp",
+		"node_group_name": "pool-0",
+		"instance_type":   "t3.medium",
+		"desired_size":    "2",
+		"min_size":        "1",
+		"max_size":        "5",
+	}
+	for name, value := range expected {
+		if apply.Spec.Variables[name] != value {
+			t.Errorf("variable %s = %q, expected %q", name, apply.Spec.Variables[name], value)
+		}
+	}
+	if len(apply.Spec.DependsOn) != 1 || apply.Spec.DependsOn[0].Name != "demo-cp-eks-controlplane-apply" {
+		t.Errorf("dependsOn = %v, expected the control plane WorkspaceTemplateApply", apply.Spec.DependsOn)
+	}
+	if len(apply.Spec.VariablesFrom) != 1 || apply.Spec.VariablesFrom[0].ValueFrom.OutputRef.Name != "demo-vpc" {
+		t.Errorf("variablesFrom = %v, expected the private subnets of the VPC", apply.Spec.VariablesFrom)
+	}
+
+	// The node group is created with two instances
+	apply.Status.Applied = true
+	apply.Status.Outputs = map[string]apiextensionsv1.JSON{
+		"node_group_arn": {Raw: []byte(`"arn:aws:eks:us-west-2:123456789012:nodegroup/demo-cp/pool-0/abc"`)},
+		"instances":      {Raw: []byte(`[{"id":"i-0bbb","availability_zone":"us-west-2b"},{"id":"i-0aaa","availability_zone":"us-west-2a"}]`)},
+	}
+	if err := r.Status().Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply status: %v", err)
+	}
+
+	got := reconcilePool(t, r)
+	expectedIDs := []string{"aws:///us-west-2a/i-0aaa", "aws:///us-west-2b/i-0bbb"}
+	if !slices.Equal(got.Spec.ProviderIDList, expectedIDs) {
+		t.Errorf("providerIDList = %v, expected %v", got.Spec.ProviderIDList, expectedIDs)
+	}
+	if !got.Status.Ready || got.Status.Replicas != 2 || got.Status.DesiredSize != 2 {
+		t.Errorf("ready = %v, replicas = %d, desiredSize = %d, expected a ready pool of 2", got.Status.Ready, got.Status.Replicas, got.Status.DesiredSize)
+	}
+	if got.Status.NodeGroupARN == "" {
+		t.Error("expected the node group ARN to be reported")
+	}
+	if scaling := meta.FindStatusCondition(got.Status.Conditions, v1beta1.MachinePoolScalingCondition); scaling == nil || scaling.Reason != v1beta1.ReasonScaledToReplicas {
+		t.Errorf("Scaling = %v, expected reason %s", scaling, v1beta1.ReasonScaledToReplicas)
+	}
+}
+
+// setPoolApplied marks the node group WorkspaceTemplateApply of the pool as applied and ready
+// with the given instances output
+func setPoolApplied(t *testing.T, r *CaptMachinePoolReconciler, instances string) {
+	t.Helper()
+	ctx := context.Background()
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "pool-0-nodegroup", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	apply.Status.Applied = true
+	apply.Status.Conditions = []xpv1.Condition{xpv1.Available()}
+	apply.Status.Outputs = map[string]apiextensionsv1.JSON{"instances": {Raw: []byte(instances)}}
+	if err := r.Status().Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply status: %v", err)
+	}
+}
+
+func TestCaptMachinePoolRefreshesInstances(t *testing.T) {
+	pool, machinePool, objs := newPoolObjects(2)
+	r, _ := newPoolReconciler(append(objs, pool, machinePool)...)
+	instances := &fakeInstances{instances: []nodegroup.Instance{{ID: "i-0aaa", AvailabilityZone: "us-west-2a"}}}
+	r.Credentials = kubeconfig.EnvCredentials{}
+	r.Instances = instances
+	key := types.NamespacedName{Name: "pool-0", Namespace: "default"}
+
+	reconcilePool(t, r)
+	if len(instances.calls) != 0 {
+		t.Errorf("expected no instances to be listed before the node group is applied, got %v", instances.calls)
+	}
+	setPoolApplied(t, r, `[{"id":"i-0aaa","availability_zone":"us-west-2a"}]`)
+	got := reconcilePool(t, r)
+	if !slices.Equal(got.Spec.ProviderIDList, []string{"aws:///us-west-2a/i-0aaa"}) || got.Status.Replicas != 1 {
+		t.Errorf("providerIDList = %v, replicas = %d, expected the listed instance", got.Spec.ProviderIDList, got.Status.Replicas)
+	}
+	if !slices.Equal(instances.calls, []string{"us-west-2/demo-cp/pool-0"}) {
+		t.Errorf("listed %v, expected the node group of the EKS cluster in its region", instances.calls)
+	}
+
+	// The node group scales out without an apply
+	instances.instances = append(instances.instances, nodegroup.Instance{ID: "i-0bbb", AvailabilityZone: "us-west-2b"})
+	result, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != nodeGroupRefreshInterval {
+		t.Errorf("RequeueAfter = %v, expected the refresh interval %v", result.RequeueAfter, nodeGroupRefreshInterval)
+	}
+	if err := r.Get(context.Background(), key, got); err != nil {
+		t.Fatalf("failed to get CaptMachinePool: %v", err)
+	}
+	expectedIDs := []string{"aws:///us-west-2a/i-0aaa", "aws:///us-west-2b/i-0bbb"}
+	if !slices.Equal(got.Spec.ProviderIDList, expectedIDs) || got.Status.Replicas != 2 {
+		t.Errorf("providerIDList = %v, replicas = %d, expected %v", got.Spec.ProviderIDList, got.Status.Replicas, expectedIDs)
+	}
+}
+
+func TestCaptMachinePoolDeletionWaitsForNodeGroup(t *testing.T) {
+	pool, machinePool, objs := newPoolObjects(2)
+	r, _ := newPoolReconciler(append(objs, pool, machinePool)...)
+	ctx := context.Background()
+	key := types.NamespacedName{Name: "pool-0", Namespace: "default"}
+
+	reconcilePool(t, r)
+	// provider-terraform keeps the WorkspaceTemplateApply until the node group is destroyed
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(ctx, types.NamespacedName{Name: "pool-0-nodegroup", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	apply.Finalizers = []string{"test.capt/destroy"}
+	if err := r.Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	// The MachinePool is deleted before the pool
+	if err := r.Delete(ctx, machinePool); err != nil {
+		t.Fatalf("failed to delete MachinePool: %v", err)
+	}
+	if err := r.Delete(ctx, pool); err != nil {
+		t.Fatalf("failed to delete CaptMachinePool: %v", err)
+	}
+
+	result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != nodeGroupDeletionRequeue {
+		t.Errorf("RequeueAfter = %v, expected %v while the node group is destroyed", result.RequeueAfter, nodeGroupDeletionRequeue)
+	}
+	got := &v1beta1.CaptMachinePool{}
+	if err := r.Get(ctx, key, got); err != nil {
+		t.Fatalf("expected the pool to be kept until the node group is destroyed: %v", err)
+	}
+
+	if err := r.Get(ctx, client.ObjectKeyFromObject(apply), apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	apply.Finalizers = nil
+	if err := r.Update(ctx, apply); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := r.Get(ctx, key, got); !apierrors.IsNotFound(err) {
+		t.Errorf("expected the pool to be removed once the node group is destroyed, got %v", err)
+	}
+}
+
+func TestCaptMachinePoolReplicasOutOfRange(t *testing.T) {
+	pool, machinePool, objs := newPoolObjects(8)
+	r, recorder := newPoolReconciler(append(objs, pool, machinePool)...)
+
+	var got *v1beta1.CaptMachinePool
+	for range 2 {
+		got = reconcilePool(t, r)
+	}
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.Get(context.Background(), types.NamespacedName{Name: "pool-0-nodegroup", Namespace: "default"}, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	if apply.Spec.Variables["desired_size"] != "5" {
+		t.Errorf("desired_size = %q, expected the maximum size 5", apply.Spec.Variables["desired_size"])
+	}
+	if scaling := meta.FindStatusCondition(got.Status.Conditions, v1beta1.MachinePoolScalingCondition); scaling == nil || scaling.Reason != v1beta1.ReasonReplicasOutOfRange {
+		t.Errorf("Scaling = %v, expected reason %s", scaling, v1beta1.ReasonReplicasOutOfRange)
+	}
+	// The event is only recorded when the replicas leave the bounds
+	if len(recorder.Events) != 1 {
+		t.Errorf("expected 1 event, got %d", len(recorder.Events))
+	}
+}
+
+func TestCaptMachinePoolWaitsForOwner(t *testing.T) {
+	pool, machinePool, objs := newPoolObjects(2)
+	pool.OwnerReferences = nil
+	r, _ := newPoolReconciler(append(objs, pool, machinePool)...)
+
+	got := reconcilePool(t, r)
+	if len(got.Finalizers) != 0 {
+		t.Errorf("expected the pool to be left alone until it is owned, got finalizers %v", got.Finalizers)
+	}
+}
+
+func TestNodeGroupSizeFor(t *testing.T) {
+	tests := []struct {
+		name     string
+		replicas int32
+		scaling  *v1beta1.MachinePoolScaling
+		expected nodeGroupSize
+	}{
+		{
+			name:     "no bounds",
+			replicas: 3,
+			expected: nodeGroupSize{desired: 3, min: 0, max: 3, replicas: 3},
+		},
+		{
+			name:     "no bounds scaled to zero",
+			replicas: 0,
+			expected: nodeGroupSize{desired: 0, min: 0, max: 1, replicas: 0},
+		},
+		{
+			name:     "below the minimum",
+			replicas: 1,
+			scaling:  &v1beta1.MachinePoolScaling{MinSize: ptr.To[int32](2)},
+			expected: nodeGroupSize{desired: 2, min: 2, max: 2, replicas: 1},
+		},
+		{
+			name:     "within bounds",
+			replicas: 4,
+			scaling:  &v1beta1.MachinePoolScaling{MinSize: ptr.To[int32](1), MaxSize: ptr.To[int32](10)},
+			expected: nodeGroupSize{desired: 4, min: 1, max: 10, replicas: 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := &v1beta1.CaptMachinePool{Spec: v1beta1.CaptMachinePoolSpec{Scaling: tt.scaling}}
+			machinePool := &expv1.MachinePool{Spec: expv1.MachinePoolSpec{Replicas: ptr.To(tt.replicas)}}
+			if got := nodeGroupSizeFor(pool, machinePool); got != tt.expected {
+				t.Errorf("nodeGroupSizeFor() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
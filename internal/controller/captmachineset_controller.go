@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"time"
 
 	"k8s.io/apimachinery/pkg/runtime"
@@ -85,7 +86,8 @@ func (r *CaptMachineSetReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 	}
 
 	// Update status
-	if err := r.updateStatus(ctx, machineSet, machines); err != nil {
+	availableIn, err := r.updateStatus(ctx, machineSet, machines)
+	if err != nil {
 		logger.Error(err, "Failed to update status")
 		return ctrl.Result{}, err
 	}
@@ -96,7 +98,8 @@ func (r *CaptMachineSetReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, nil
+	// Check again once ready machines have been ready for minReadySeconds
+	return ctrl.Result{RequeueAfter: availableIn}, nil
 }
 
 // reconcileDelete handles CaptMachineSet deletion
@@ -140,17 +143,27 @@ func (r *CaptMachineSetReconciler) listMachines(ctx context.Context, machineSet
 	return owned, nil
 }
 
-// updateStatus updates the status of the machine set
-func (r *CaptMachineSetReconciler) updateStatus(ctx context.Context, machineSet *infrastructurev1beta1.CaptMachineSet, machines []infrastructurev1beta1.CaptMachine) error {
+// updateStatus updates the status of the machine set. It returns the time until the next
+// ready machine becomes available, or zero if no machine is waiting for minReadySeconds.
+func (r *CaptMachineSetReconciler) updateStatus(ctx context.Context, machineSet *infrastructurev1beta1.CaptMachineSet, machines []infrastructurev1beta1.CaptMachine) (time.Duration, error) {
 	newStatus := infrastructurev1beta1.CaptMachineSetStatus{
 		Replicas:      int32(len(machines)),
 		ReadyReplicas: 0,
 	}
 
-	// Count ready replicas
-	for _, machine := range machines {
-		if machine.Status.Ready {
-			newStatus.ReadyReplicas++
+	// Count ready and available replicas
+	now := time.Now()
+	var availableIn time.Duration
+	for i := range machines {
+		if !machines[i].Status.Ready {
+			continue
+		}
+		newStatus.ReadyReplicas++
+		remaining := machineAvailableIn(&machines[i], machineSet.Spec.MinReadySeconds, now)
+		if remaining == 0 {
+			newStatus.AvailableReplicas++
+		} else if availableIn == 0 || remaining < availableIn {
+			availableIn = remaining
 		}
 	}
 
@@ -160,16 +173,28 @@ func (r *CaptMachineSetReconciler) updateStatus(ctx context.Context, machineSet
 	// Update status if it has changed
 	if !reflect.DeepEqual(machineSet.Status, newStatus) {
 		machineSet.Status = newStatus
-		return r.Status().Update(ctx, machineSet)
+		return availableIn, r.Status().Update(ctx, machineSet)
 	}
 
-	return nil
+	return availableIn, nil
+}
+
+// machineAvailableIn returns how long a ready machine still has to stay ready to be available
+func machineAvailableIn(machine *infrastructurev1beta1.CaptMachine, minReadySeconds int32, now time.Time) time.Duration {
+	if minReadySeconds == 0 || machine.Status.LastTransitionTime == nil {
+		return 0
+	}
+	availableAt := machine.Status.LastTransitionTime.Add(time.Duration(minReadySeconds) * time.Second)
+	if !availableAt.After(now) {
+		return 0
+	}
+	return availableAt.Sub(now)
 }
 
 // reconcileMachines reconciles the machines owned by the machine set
 func (r *CaptMachineSetReconciler) reconcileMachines(ctx context.Context, machineSet *infrastructurev1beta1.CaptMachineSet, machines []infrastructurev1beta1.CaptMachine) error {
 	// Get the number of desired replicas
-	replicas := int32(1)
+	replicas := int32(infrastructurev1beta1.DefaultReplicas)
 	if machineSet.Spec.Replicas != nil {
 		replicas = *machineSet.Spec.Replicas
 	}
@@ -180,7 +205,13 @@ func (r *CaptMachineSetReconciler) reconcileMachines(ctx context.Context, machin
 		// Scale up
 		return r.createMachines(ctx, machineSet, -diff)
 	} else if diff > 0 {
-		// Scale down
+		// Scale down, removing machines that are not ready and then the newest ones first
+		sort.SliceStable(machines, func(i, j int) bool {
+			if machines[i].Status.Ready != machines[j].Status.Ready {
+				return !machines[i].Status.Ready
+			}
+			return machines[j].CreationTimestamp.Before(&machines[i].CreationTimestamp)
+		})
 		return r.deleteMachines(ctx, machines[0:diff])
 	}
 
@@ -0,0 +1,128 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+//+kubebuilder:rbac:groups=controlplane.cluster.x-k8s.io,resources=captcontrolplanes,verbs=get;list;watch
+
+// getCluster returns the named Cluster, or nil if the name is empty or the Cluster does not exist
+func getCluster(ctx context.Context, c client.Client, namespace, name string) (*clusterv1.Cluster, error) {
+	if name == "" {
+		return nil, nil
+	}
+	cluster, err := util.GetClusterByName(ctx, c, namespace, name)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	return cluster, err
+}
+
+// eksClusterName returns the name of the EKS cluster of a Cluster, which is named after its
+// control plane
+func eksClusterName(cluster *clusterv1.Cluster) string {
+	if cluster.Spec.ControlPlaneRef != nil {
+		return cluster.Spec.ControlPlaneRef.Name
+	}
+	return cluster.Name
+}
+
+// clusterWorkspaces holds the names of the VPC and control plane WorkspaceTemplateApplies of a
+// Cluster. A name is empty if the Cluster does not use the CAPT resource for it.
+type clusterWorkspaces struct {
+	vpc          string
+	controlPlane string
+}
+
+// getClusterWorkspaces looks up the WorkspaceTemplateApplies of the CAPTCluster and
+// CAPTControlPlane of a Cluster
+func getClusterWorkspaces(ctx context.Context, c client.Reader, cluster *clusterv1.Cluster) (clusterWorkspaces, error) {
+	var workspaces clusterWorkspaces
+
+	if ref := cluster.Spec.InfrastructureRef; ref != nil && ref.Kind == "CAPTCluster" {
+		captCluster := &infrastructurev1beta1.CAPTCluster{}
+		err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cluster.Namespace}, captCluster)
+		switch {
+		case err == nil:
+			workspaces.vpc = captCluster.GetWorkspaceTemplateApplyName()
+		case !apierrors.IsNotFound(err):
+			return workspaces, fmt.Errorf("failed to get CAPTCluster %s/%s: %w", cluster.Namespace, ref.Name, err)
+		}
+	}
+
+	if ref := cluster.Spec.ControlPlaneRef; ref != nil && ref.Kind == "CAPTControlPlane" {
+		controlPlane := &controlplanev1beta1.CAPTControlPlane{}
+		err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cluster.Namespace}, controlPlane)
+		switch {
+		case err == nil:
+			workspaces.controlPlane = controlPlane.GetWorkspaceTemplateApplyName()
+		case !apierrors.IsNotFound(err):
+			return workspaces, fmt.Errorf("failed to get CAPTControlPlane %s/%s: %w", cluster.Namespace, ref.Name, err)
+		}
+	}
+
+	return workspaces, nil
+}
+
+// applyTo makes a WorkspaceTemplateApply of a node resource in the cluster wait for the control
+// plane, and passes the private subnets of the VPC to its template as ${subnet_ids}
+func (w clusterWorkspaces) applyTo(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec, namespace string) {
+	spec.DependsOn = nil
+	if w.controlPlane != "" {
+		spec.DependsOn = []infrastructurev1beta1.WorkspaceTemplateApplyReference{{Name: w.controlPlane, Namespace: namespace}}
+	}
+
+	spec.VariablesFrom = nil
+	if w.vpc != "" {
+		spec.VariablesFrom = []infrastructurev1beta1.VariableFrom{{
+			Name: "subnet_ids",
+			ValueFrom: infrastructurev1beta1.VariableSource{
+				OutputRef: &infrastructurev1beta1.OutputReference{Name: w.vpc, Namespace: namespace, Output: "private_subnets"},
+				Optional:  true,
+			},
+		}}
+	}
+}
+
+// getClusterRegion returns the AWS region of the CAPTCluster of a Cluster, or an empty string if
+// the Cluster does not use a CAPTCluster
+func getClusterRegion(ctx context.Context, c client.Reader, cluster *clusterv1.Cluster) (string, error) {
+	ref := cluster.Spec.InfrastructureRef
+	if ref == nil || ref.Kind != "CAPTCluster" {
+		return "", nil
+	}
+	captCluster := &infrastructurev1beta1.CAPTCluster{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: cluster.Namespace}, captCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get CAPTCluster %s/%s: %w", cluster.Namespace, ref.Name, err)
+	}
+	return captCluster.Spec.Region, nil
+}
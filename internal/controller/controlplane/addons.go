@@ -0,0 +1,117 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/outputs"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// addonsVariable is the template variable receiving the declared EKS addons
+	addonsVariable = "addons"
+
+	// clusterAddonsOutput is the workspace output mapping installed EKS addons to their versions
+	clusterAddonsOutput = "cluster_addons"
+)
+
+// addonVariable is the value of an addon in the addons template variable. The attributes
+// match the cluster_addons input of the terraform-aws-modules/eks module.
+type addonVariable struct {
+	AddonVersion        string `json:"addon_version,omitempty"`
+	ConfigurationValues string `json:"configuration_values,omitempty"`
+}
+
+// addonsVariableValue returns the addons template variable for the declared addons
+func addonsVariableValue(addons []controlplanev1beta1.Addon) map[string]addonVariable {
+	value := make(map[string]addonVariable, len(addons))
+	for _, addon := range addons {
+		value[addon.Name] = addonVariable{
+			AddonVersion:        addon.Version,
+			ConfigurationValues: addon.ConfigurationValues,
+		}
+	}
+	return value
+}
+
+// addonStatuses compares the declared addons with the installed addon versions, in the order
+// they are declared. Addons that are not declared are not reported: the template may keep
+// installing an addon removed from controlPlaneConfig.addons as one of its defaults.
+func addonStatuses(addons []controlplanev1beta1.Addon, installed map[string]string) []controlplanev1beta1.AddonStatus {
+	statuses := make([]controlplanev1beta1.AddonStatus, 0, len(addons))
+	for _, addon := range addons {
+		version, ok := installed[addon.Name]
+		status := controlplanev1beta1.AddonStatus{Name: addon.Name, Version: version}
+		switch {
+		case !ok:
+			status.State = controlplanev1beta1.AddonStateCreating
+		case addon.Version != "" && addon.Version != version:
+			status.State = controlplanev1beta1.AddonStateUpdating
+		default:
+			status.State = controlplanev1beta1.AddonStateActive
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// reconcileAddons reports the state of the EKS addons in status.addons and the AddonsReady condition.
+// It returns true while addons are being created or updated.
+// Templates without a cluster_addons output do not report addons.
+func (r *Reconciler) reconcileAddons(
+	ctx context.Context,
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply,
+) bool {
+	logger := log.FromContext(ctx)
+
+	var addons []controlplanev1beta1.Addon
+	if controlPlane.Spec.ControlPlaneConfig != nil {
+		addons = controlPlane.Spec.ControlPlaneConfig.Addons
+	}
+
+	installed, found, err := outputs.FromApply[map[string]string](ctx, r.Client, workspaceApply, clusterAddonsOutput)
+	if err != nil {
+		logger.Error(err, "Failed to get cluster addons output")
+		return false
+	}
+	if !found {
+		controlPlane.Status.Addons = nil
+		meta.RemoveStatusCondition(&controlPlane.Status.Conditions, controlplanev1beta1.ControlPlaneAddonsReadyCondition)
+		return false
+	}
+
+	controlPlane.Status.Addons = addonStatuses(addons, installed)
+
+	var progressing []string
+	for _, status := range controlPlane.Status.Addons {
+		if status.State != controlplanev1beta1.AddonStateActive {
+			progressing = append(progressing, fmt.Sprintf("%s (%s)", status.Name, status.State))
+		}
+	}
+	if len(progressing) > 0 {
+		meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
+			Type:               controlplanev1beta1.ControlPlaneAddonsReadyCondition,
+			Status:             metav1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             controlplanev1beta1.ReasonAddonsProgressing,
+			Message:            fmt.Sprintf("Waiting for addons: %s", strings.Join(progressing, ", ")),
+		})
+		return true
+	}
+
+	meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
+		Type:               controlplanev1beta1.ControlPlaneAddonsReadyCondition,
+		Status:             metav1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             controlplanev1beta1.ReasonAddonsReady,
+		Message:            "All addons are active",
+	})
+	return false
+}
@@ -0,0 +1,138 @@
+package controlplane
+
+import (
+	"context"
+	"testing"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestAddonStatuses(t *testing.T) {
+	addons := []controlplanev1beta1.Addon{
+		{Name: "vpc-cni", Version: "v1.19.0-eksbuild.1"},
+		{Name: "coredns"},
+		{Name: "aws-ebs-csi-driver"},
+	}
+	installed := map[string]string{
+		"vpc-cni":    "v1.18.3-eksbuild.1",
+		"coredns":    "v1.11.1-eksbuild.9",
+		"kube-proxy": "v1.31.0-eksbuild.2",
+		"snapshot":   "v8.0.0-eksbuild.1",
+	}
+
+	assert.Equal(t, []controlplanev1beta1.AddonStatus{
+		{Name: "vpc-cni", Version: "v1.18.3-eksbuild.1", State: controlplanev1beta1.AddonStateUpdating},
+		{Name: "coredns", Version: "v1.11.1-eksbuild.9", State: controlplanev1beta1.AddonStateActive},
+		{Name: "aws-ebs-csi-driver", State: controlplanev1beta1.AddonStateCreating},
+		// kube-proxy and snapshot are installed by the template without being declared
+	}, addonStatuses(addons, installed))
+}
+
+func TestReconcileAddons(t *testing.T) {
+	applyWithAddons := func(raw string) *infrastructurev1beta1.WorkspaceTemplateApply {
+		apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-apply", Namespace: "default"},
+		}
+		if raw != "" {
+			apply.Status.Outputs = map[string]apiextensionsv1.JSON{clusterAddonsOutput: {Raw: []byte(raw)}}
+		}
+		return apply
+	}
+
+	tests := []struct {
+		name            string
+		outputs         string
+		wantProgressing bool
+		wantCondition   *metav1.ConditionStatus
+		wantAddons      int
+	}{
+		{
+			name:            "addon being created",
+			outputs:         `{"coredns":"v1.11.1-eksbuild.9"}`,
+			wantProgressing: true,
+			wantCondition:   ptr.To(metav1.ConditionFalse),
+			wantAddons:      2,
+		},
+		{
+			name:          "all addons active",
+			outputs:       `{"coredns":"v1.11.1-eksbuild.9","vpc-cni":"v1.19.0-eksbuild.1"}`,
+			wantCondition: ptr.To(metav1.ConditionTrue),
+			wantAddons:    2,
+		},
+		{
+			name:          "undeclared template addons",
+			outputs:       `{"coredns":"v1.11.1-eksbuild.9","vpc-cni":"v1.19.0-eksbuild.1","kube-proxy":"v1.31.0-eksbuild.2"}`,
+			wantCondition: ptr.To(metav1.ConditionTrue),
+			wantAddons:    2,
+		},
+		{
+			name: "template without addons output",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{Client: fake.NewClientBuilder().WithScheme(setupScheme()).Build()}
+			controlPlane := &controlplanev1beta1.CAPTControlPlane{
+				Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+					ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{
+						Addons: []controlplanev1beta1.Addon{
+							{Name: "coredns"},
+							{Name: "vpc-cni", Version: "v1.19.0-eksbuild.1"},
+						},
+					},
+				},
+			}
+
+			progressing := r.reconcileAddons(context.Background(), controlPlane, applyWithAddons(tt.outputs))
+
+			assert.Equal(t, tt.wantProgressing, progressing)
+			assert.Len(t, controlPlane.Status.Addons, tt.wantAddons)
+			condition := meta.FindStatusCondition(controlPlane.Status.Conditions, controlplanev1beta1.ControlPlaneAddonsReadyCondition)
+			if tt.wantCondition == nil {
+				assert.Nil(t, condition)
+				return
+			}
+			require.NotNil(t, condition)
+			assert.Equal(t, *tt.wantCondition, condition.Status)
+		})
+	}
+}
+
+func TestGenerateWorkspaceTemplateApplySpecAddons(t *testing.T) {
+	r := &Reconciler{Client: fake.NewClientBuilder().WithScheme(setupScheme()).Build()}
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "default"},
+		Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+			Version: "v1.31.0",
+			ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{
+				Region: "ap-northeast-1",
+				Addons: []controlplanev1beta1.Addon{
+					{Name: "coredns", ConfigurationValues: `{"computeType":"Fargate"}`},
+					{Name: "vpc-cni", Version: "v1.19.0-eksbuild.1"},
+				},
+			},
+		},
+	}
+
+	spec, err := r.generateWorkspaceTemplateApplySpec(controlPlane)
+	require.NoError(t, err)
+	require.Contains(t, spec.StructuredVariables, addonsVariable)
+	assert.JSONEq(t,
+		`{"coredns":{"configuration_values":"{\"computeType\":\"Fargate\"}"},"vpc-cni":{"addon_version":"v1.19.0-eksbuild.1"}}`,
+		string(spec.StructuredVariables[addonsVariable].Raw))
+
+	// Without declared addons the template defaults apply
+	controlPlane.Spec.ControlPlaneConfig.Addons = nil
+	spec, err = r.generateWorkspaceTemplateApplySpec(controlPlane)
+	require.NoError(t, err)
+	assert.NotContains(t, spec.StructuredVariables, addonsVariable)
+}
@@ -4,102 +4,59 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"strings"
 
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
-	corev1 "k8s.io/api/core/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	"github.com/appthrust/capt/internal/controller/outputs"
 )
 
-// GetEndpointFromWorkspace attempts to get the cluster endpoint from a Workspace
-func GetEndpointFromWorkspace(ctx context.Context, c client.Client, workspaceName string) (*clusterv1.APIEndpoint, error) {
+// GetEndpointFromWorkspace attempts to get the cluster endpoint from a Workspace.
+// It returns nil without an error if the endpoint is not available yet.
+func GetEndpointFromWorkspace(ctx context.Context, c client.Client, namespace, workspaceName string) (*clusterv1.APIEndpoint, error) {
 	logger := log.FromContext(ctx)
 
-	// Define Workspace GVK
-	workspaceGVK := schema.GroupVersionKind{
-		Group:   "tf.upbound.io",
-		Version: "v1beta1",
-		Kind:    "Workspace",
-	}
-
 	// Get Workspace
-	workspace := &unstructured.Unstructured{}
-	workspace.SetGroupVersionKind(workspaceGVK)
-	if err := c.Get(ctx, types.NamespacedName{Name: workspaceName}, workspace); err != nil {
+	workspace := &tfv1beta1.Workspace{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: workspaceName}, workspace); err != nil {
 		return nil, fmt.Errorf("failed to get Workspace: %w", err)
 	}
 
 	logger.Info("Found Workspace", "name", workspace.GetName())
 
-	// Try to get endpoint from outputs first
-	outputs, found, err := unstructured.NestedMap(workspace.Object, "status", "atProvider", "outputs")
+	// The endpoint is read from the outputs, or from the connection secret if it is not exposed there
+	endpoint, found, err := outputs.FromWorkspace[string](ctx, c, workspace, "cluster_endpoint")
 	if err != nil {
-		return nil, fmt.Errorf("failed to get outputs from Workspace: %w", err)
+		return nil, fmt.Errorf("failed to get cluster_endpoint from Workspace: %w", err)
 	}
-
-	if found && outputs != nil {
-		if endpoint, ok := outputs["cluster_endpoint"].(string); ok {
-			logger.Info("Found cluster_endpoint in Workspace outputs", "endpoint", endpoint)
-			return &clusterv1.APIEndpoint{
-				Host: endpoint,
-				Port: 443, // EKS API server always uses port 443
-			}, nil
-		}
+	if !found || endpoint == "" {
 		logger.Info("cluster_endpoint not found in Workspace outputs")
-	}
-
-	// Try to get endpoint from secret if outputs don't have it
-	secretRef, found, err := unstructured.NestedMap(workspace.Object, "spec", "writeConnectionSecretToRef")
-	if err != nil {
-		return nil, fmt.Errorf("failed to get writeConnectionSecretToRef from Workspace: %w", err)
-	}
-
-	if !found || secretRef == nil {
-		logger.Info("writeConnectionSecretToRef not found in Workspace")
 		return nil, nil
 	}
 
-	secretName, ok := secretRef["name"].(string)
-	if !ok {
-		return nil, fmt.Errorf("secret name not found in writeConnectionSecretToRef")
-	}
+	endpoint = decodeEndpoint(endpoint)
+	logger.Info("Found cluster_endpoint", "endpoint", endpoint)
+	return &clusterv1.APIEndpoint{
+		Host: endpoint,
+		Port: 443, // EKS API server always uses port 443
+	}, nil
+}
 
-	secretNamespace, ok := secretRef["namespace"].(string)
-	if !ok {
-		return nil, fmt.Errorf("secret namespace not found in writeConnectionSecretToRef")
+// decodeEndpoint returns the endpoint URL of an output. Existing templates publish the
+// endpoint base64-encoded in the connection secret, so both plain and base64-encoded
+// URLs are accepted.
+func decodeEndpoint(endpoint string) string {
+	if strings.Contains(endpoint, "://") {
+		return endpoint
 	}
-
-	// Get secret
-	secret := &corev1.Secret{}
-	if err := c.Get(ctx, types.NamespacedName{Name: secretName, Namespace: secretNamespace}, secret); err != nil {
-		return nil, fmt.Errorf("failed to get secret: %w", err)
+	decoded, err := base64.StdEncoding.DecodeString(endpoint)
+	if err != nil || !strings.Contains(string(decoded), "://") {
+		return endpoint
 	}
-
-	logger.Info("Successfully retrieved secret",
-		"name", secretName,
-		"namespace", secretNamespace)
-
-	if endpointData, ok := secret.Data["cluster_endpoint"]; ok {
-		logger.Info("Found cluster_endpoint in secret",
-			"raw_length", len(endpointData),
-			"raw_data", string(endpointData))
-
-		endpoint, err := base64.StdEncoding.DecodeString(string(endpointData))
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode endpoint data: %w", err)
-		}
-
-		logger.Info("Successfully decoded endpoint", "endpoint", string(endpoint))
-		return &clusterv1.APIEndpoint{
-			Host: string(endpoint),
-			Port: 443, // EKS API server always uses port 443
-		}, nil
-	}
-
-	logger.Info("cluster_endpoint not found in secret")
-	return nil, nil
+	return string(decoded)
 }
@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGetEndpointFromWorkspace(t *testing.T) {
+	const endpoint = "https://ABCDEF.gr7.ap-northeast-1.eks.amazonaws.com"
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{
+			name:   "plain endpoint",
+			secret: endpoint,
+		},
+		{
+			name:   "base64-encoded endpoint",
+			secret: "aHR0cHM6Ly9BQkNERUYuZ3I3LmFwLW5vcnRoZWFzdC0xLmVrcy5hbWF6b25hd3MuY29t",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = corev1.AddToScheme(scheme)
+			_ = tfv1beta1.SchemeBuilder.AddToScheme(scheme)
+
+			workspace := &tfv1beta1.Workspace{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo-eks"},
+				Spec: tfv1beta1.WorkspaceSpec{
+					ResourceSpec: xpv1.ResourceSpec{
+						WriteConnectionSecretToReference: &xpv1.SecretReference{Name: "demo-eks-connection", Namespace: "default"},
+					},
+				},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo-eks-connection", Namespace: "default"},
+				Data:       map[string][]byte{"cluster_endpoint": []byte(tt.secret)},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(workspace, secret).Build()
+
+			got, err := GetEndpointFromWorkspace(context.Background(), c, "", "demo-eks")
+			if err != nil {
+				t.Fatalf("GetEndpointFromWorkspace() error = %v", err)
+			}
+			if got == nil || got.Host != endpoint || got.Port != 443 {
+				t.Errorf("GetEndpointFromWorkspace() = %v, expected %s:443", got, endpoint)
+			}
+		})
+	}
+}
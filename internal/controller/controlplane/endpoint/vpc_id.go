@@ -4,28 +4,22 @@ import (
 	"context"
 	"fmt"
 
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/appthrust/capt/internal/controller/outputs"
 )
 
-// GetVPCIDFromWorkspace attempts to get the VPC ID from a Workspace
+// GetVPCIDFromWorkspace attempts to get the VPC ID from a Workspace.
+// It returns an empty string without an error if the VPC ID is not available yet.
 func GetVPCIDFromWorkspace(ctx context.Context, c client.Client, namespace, workspaceName string) (string, error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Attempting to get VPC ID from workspace", "namespace", namespace, "workspaceName", workspaceName)
 
-	// Define Workspace GVK
-	workspaceGVK := schema.GroupVersionKind{
-		Group:   "tf.upbound.io",
-		Version: "v1beta1",
-		Kind:    "Workspace",
-	}
-
 	// Get Workspace
-	workspace := &unstructured.Unstructured{}
-	workspace.SetGroupVersionKind(workspaceGVK)
+	workspace := &tfv1beta1.Workspace{}
 	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: workspaceName}, workspace); err != nil {
 		logger.Error(err, "Failed to get Workspace", "namespace", namespace, "workspaceName", workspaceName)
 		return "", fmt.Errorf("failed to get Workspace: %w", err)
@@ -33,25 +27,16 @@ func GetVPCIDFromWorkspace(ctx context.Context, c client.Client, namespace, work
 
 	logger.Info("Found Workspace", "name", workspace.GetName())
 
-	// Try to get vpc_id from outputs
-	outputs, found, err := unstructured.NestedMap(workspace.Object, "status", "atProvider", "outputs")
+	vpcID, found, err := outputs.Get[string](workspace.Status.AtProvider.Outputs, "vpc_id")
 	if err != nil {
-		logger.Error(err, "Failed to get outputs from Workspace")
-		return "", fmt.Errorf("failed to get outputs from Workspace: %w", err)
+		logger.Error(err, "Failed to get vpc_id from Workspace outputs")
+		return "", fmt.Errorf("failed to get vpc_id from Workspace outputs: %w", err)
 	}
-
-	logger.Info("Workspace outputs status", "found", found, "outputs", outputs)
-
-	if found && outputs != nil {
-		if vpcID, ok := outputs["vpc_id"].(string); ok {
-			logger.Info("Found vpc_id in Workspace outputs", "vpc_id", vpcID)
-			return vpcID, nil
-		}
-		logger.Info("vpc_id not found in Workspace outputs or not a string")
+	if !found {
+		logger.Info("vpc_id not found in Workspace outputs")
+		return "", nil
 	}
 
-	// Log the entire workspace object for debugging
-	logger.Info("Workspace object", "workspace", workspace.Object)
-
-	return "", nil
+	logger.Info("Found vpc_id in Workspace outputs", "vpc_id", vpcID)
+	return vpcID, nil
 }
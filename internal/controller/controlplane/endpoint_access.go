@@ -0,0 +1,137 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/outputs"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// endpointPublicAccessCIDRsVariable is the template variable receiving the allowed public CIDR blocks
+	endpointPublicAccessCIDRsVariable = "endpoint_public_access_cidrs"
+
+	// endpointAccessOutput is the workspace output reporting the endpoint access applied to the cluster
+	endpointAccessOutput = "endpoint_access"
+)
+
+// anyPublicCIDR is the public access CIDR EKS uses when none are configured
+const anyPublicCIDR = "0.0.0.0/0"
+
+// publicCIDRs returns the sorted public access CIDRs, defaulting to all addresses like EKS
+func publicCIDRs(cidrs []string) []string {
+	if len(cidrs) == 0 {
+		return []string{anyPublicCIDR}
+	}
+	sorted := append([]string(nil), cidrs...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// endpointAccessApplied returns true if the applied endpoint access matches the desired one.
+// Public CIDRs are only compared while the public endpoint is enabled.
+func endpointAccessApplied(desired, applied *controlplanev1beta1.EndpointAccess) bool {
+	if desired.Public != applied.Public || desired.Private != applied.Private {
+		return false
+	}
+	if !desired.Public {
+		return true
+	}
+	want, got := publicCIDRs(desired.PublicCIDRs), publicCIDRs(applied.PublicCIDRs)
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if want[i] != got[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// desiredEndpointAccess returns the endpoint access in the control plane configuration, if any
+func desiredEndpointAccess(controlPlane *controlplanev1beta1.CAPTControlPlane) *controlplanev1beta1.EndpointAccess {
+	if controlPlane.Spec.ControlPlaneConfig == nil {
+		return nil
+	}
+	return controlPlane.Spec.ControlPlaneConfig.EndpointAccess
+}
+
+// isEndpointAccessUpdating returns true if the endpoint access applied to the cluster differs from the desired one
+func isEndpointAccessUpdating(controlPlane *controlplanev1beta1.CAPTControlPlane) bool {
+	desired := desiredEndpointAccess(controlPlane)
+	applied := controlPlane.Status.EndpointAccess
+	return desired != nil && applied != nil && !endpointAccessApplied(desired, applied)
+}
+
+// reconcileEndpointAccess records the endpoint access reported by the control plane workspace in
+// status.endpointAccess and sets the EndpointAccessReady condition. It returns true while a change
+// of the endpoint access, such as a switch from public to private access, is being applied.
+// Templates without an endpoint_access output do not report endpoint access.
+func (r *Reconciler) reconcileEndpointAccess(
+	ctx context.Context,
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply,
+) bool {
+	logger := log.FromContext(ctx)
+
+	applied, found, err := outputs.FromApply[controlplanev1beta1.EndpointAccess](ctx, r.Client, workspaceApply, endpointAccessOutput)
+	if err != nil {
+		logger.Error(err, "Failed to get endpoint access output")
+		return false
+	}
+	if !found {
+		controlPlane.Status.EndpointAccess = nil
+		meta.RemoveStatusCondition(&controlPlane.Status.Conditions, controlplanev1beta1.ControlPlaneEndpointAccessReadyCondition)
+		return false
+	}
+	wasUpdating := isEndpointAccessUpdating(controlPlane)
+	controlPlane.Status.EndpointAccess = &applied
+
+	// Applied, or the template decides without desired endpoint access
+	if !isEndpointAccessUpdating(controlPlane) {
+		if wasUpdating {
+			logger.Info("Endpoint access applied", "public", applied.Public, "private", applied.Private)
+		}
+		meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
+			Type:               controlplanev1beta1.ControlPlaneEndpointAccessReadyCondition,
+			Status:             metav1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             controlplanev1beta1.ReasonEndpointAccessApplied,
+			Message:            endpointAccessMessage(&applied),
+		})
+		return false
+	}
+
+	markEndpointAccessUpdating(controlPlane)
+	return true
+}
+
+// markEndpointAccessUpdating sets the EndpointAccessReady condition for a change to the desired endpoint access
+func markEndpointAccessUpdating(controlPlane *controlplanev1beta1.CAPTControlPlane) {
+	meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
+		Type:               controlplanev1beta1.ControlPlaneEndpointAccessReadyCondition,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             controlplanev1beta1.ReasonEndpointAccessUpdating,
+		Message:            fmt.Sprintf("Changing endpoint access to %s", endpointAccessMessage(desiredEndpointAccess(controlPlane))),
+	})
+}
+
+// endpointAccessMessage describes the endpoint access for conditions
+func endpointAccessMessage(access *controlplanev1beta1.EndpointAccess) string {
+	switch {
+	case access.Public && access.Private:
+		return fmt.Sprintf("public (%v) and private endpoint access", publicCIDRs(access.PublicCIDRs))
+	case access.Public:
+		return fmt.Sprintf("public endpoint access (%v)", publicCIDRs(access.PublicCIDRs))
+	default:
+		return "private endpoint access"
+	}
+}
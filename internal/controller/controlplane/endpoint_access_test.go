@@ -0,0 +1,158 @@
+package controlplane
+
+import (
+	"context"
+	"testing"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestEndpointAccessApplied(t *testing.T) {
+	tests := []struct {
+		name    string
+		desired controlplanev1beta1.EndpointAccess
+		applied controlplanev1beta1.EndpointAccess
+		want    bool
+	}{
+		{
+			name:    "same access",
+			desired: controlplanev1beta1.EndpointAccess{Public: true, Private: true},
+			applied: controlplanev1beta1.EndpointAccess{Public: true, Private: true, PublicCIDRs: []string{"0.0.0.0/0"}},
+			want:    true,
+		},
+		{
+			name:    "public to private",
+			desired: controlplanev1beta1.EndpointAccess{Private: true},
+			applied: controlplanev1beta1.EndpointAccess{Public: true, Private: true, PublicCIDRs: []string{"0.0.0.0/0"}},
+		},
+		{
+			name:    "CIDRs in a different order",
+			desired: controlplanev1beta1.EndpointAccess{Public: true, PublicCIDRs: []string{"203.0.113.0/24", "198.51.100.0/24"}},
+			applied: controlplanev1beta1.EndpointAccess{Public: true, PublicCIDRs: []string{"198.51.100.0/24", "203.0.113.0/24"}},
+			want:    true,
+		},
+		{
+			name:    "CIDRs changed",
+			desired: controlplanev1beta1.EndpointAccess{Public: true, PublicCIDRs: []string{"203.0.113.0/24"}},
+			applied: controlplanev1beta1.EndpointAccess{Public: true, PublicCIDRs: []string{"0.0.0.0/0"}},
+		},
+		{
+			name:    "CIDRs are ignored without public access",
+			desired: controlplanev1beta1.EndpointAccess{Private: true},
+			applied: controlplanev1beta1.EndpointAccess{Private: true, PublicCIDRs: []string{"0.0.0.0/0"}},
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, endpointAccessApplied(&tt.desired, &tt.applied))
+		})
+	}
+}
+
+func TestReconcileEndpointAccess(t *testing.T) {
+	applyWithEndpointAccess := func(raw string) *infrastructurev1beta1.WorkspaceTemplateApply {
+		apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-apply", Namespace: "default"},
+		}
+		if raw != "" {
+			apply.Status.Outputs = map[string]apiextensionsv1.JSON{endpointAccessOutput: {Raw: []byte(raw)}}
+		}
+		return apply
+	}
+
+	tests := []struct {
+		name          string
+		desired       *controlplanev1beta1.EndpointAccess
+		outputs       string
+		wantUpdating  bool
+		wantCondition *metav1.ConditionStatus
+	}{
+		{
+			name:          "switch to private access in progress",
+			desired:       &controlplanev1beta1.EndpointAccess{Private: true},
+			outputs:       `{"public":true,"private":true,"publicCIDRs":["0.0.0.0/0"]}`,
+			wantUpdating:  true,
+			wantCondition: ptr.To(metav1.ConditionFalse),
+		},
+		{
+			name:          "switch to private access applied",
+			desired:       &controlplanev1beta1.EndpointAccess{Private: true},
+			outputs:       `{"public":false,"private":true,"publicCIDRs":["0.0.0.0/0"]}`,
+			wantCondition: ptr.To(metav1.ConditionTrue),
+		},
+		{
+			name:          "endpoint access decided by the template",
+			outputs:       `{"public":true,"private":true,"publicCIDRs":["0.0.0.0/0"]}`,
+			wantCondition: ptr.To(metav1.ConditionTrue),
+		},
+		{
+			name:    "template without endpoint access output",
+			desired: &controlplanev1beta1.EndpointAccess{Private: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{Client: fake.NewClientBuilder().WithScheme(setupScheme()).Build()}
+			controlPlane := &controlplanev1beta1.CAPTControlPlane{
+				Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+					ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{EndpointAccess: tt.desired},
+				},
+			}
+
+			updating := r.reconcileEndpointAccess(context.Background(), controlPlane, applyWithEndpointAccess(tt.outputs))
+
+			assert.Equal(t, tt.wantUpdating, updating)
+			assert.Equal(t, tt.wantUpdating, isEndpointAccessUpdating(controlPlane))
+			condition := meta.FindStatusCondition(controlPlane.Status.Conditions, controlplanev1beta1.ControlPlaneEndpointAccessReadyCondition)
+			if tt.wantCondition == nil {
+				assert.Nil(t, condition)
+				assert.Nil(t, controlPlane.Status.EndpointAccess)
+				return
+			}
+			require.NotNil(t, condition)
+			assert.Equal(t, *tt.wantCondition, condition.Status)
+			assert.NotNil(t, controlPlane.Status.EndpointAccess)
+		})
+	}
+}
+
+func TestGenerateWorkspaceTemplateApplySpecPublicCIDRs(t *testing.T) {
+	r := &Reconciler{Client: fake.NewClientBuilder().WithScheme(setupScheme()).Build()}
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "default"},
+		Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+			Version: "v1.31.0",
+			ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{
+				Region: "ap-northeast-1",
+				EndpointAccess: &controlplanev1beta1.EndpointAccess{
+					Public:      true,
+					Private:     true,
+					PublicCIDRs: []string{"203.0.113.0/24"},
+				},
+			},
+		},
+	}
+
+	spec, err := r.generateWorkspaceTemplateApplySpec(controlPlane)
+	require.NoError(t, err)
+	require.Contains(t, spec.StructuredVariables, endpointPublicAccessCIDRsVariable)
+	assert.JSONEq(t, `["203.0.113.0/24"]`, string(spec.StructuredVariables[endpointPublicAccessCIDRsVariable].Raw))
+
+	// Private clusters keep the template default
+	controlPlane.Spec.ControlPlaneConfig.EndpointAccess = &controlplanev1beta1.EndpointAccess{Private: true}
+	spec, err = r.generateWorkspaceTemplateApplySpec(controlPlane)
+	require.NoError(t, err)
+	assert.NotContains(t, spec.StructuredVariables, endpointPublicAccessCIDRsVariable)
+	assert.Equal(t, "false", spec.Variables["endpoint_public_access"])
+}
@@ -0,0 +1,136 @@
+package kubeconfig
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultCredentialsKey is the Secret key holding the shared credentials file, as in the
+	// credentials Secret of the Terraform ProviderConfig
+	DefaultCredentialsKey = "credentials"
+
+	// DefaultProfile is the profile read from the shared credentials file
+	DefaultProfile = "default"
+)
+
+// Credentials are the AWS credentials used to sign requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsProvider retrieves AWS credentials
+type CredentialsProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// EnvCredentials reads AWS credentials from the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables of the manager
+type EnvCredentials struct{}
+
+// Retrieve implements CredentialsProvider
+func (EnvCredentials) Retrieve(_ context.Context) (Credentials, error) {
+	creds := Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set")
+	}
+	return creds, nil
+}
+
+// SecretCredentials reads AWS credentials from a shared credentials file stored in a Secret,
+// such as the one mounted into the Terraform workspaces by the ProviderConfig
+type SecretCredentials struct {
+	Client client.Reader
+	Secret types.NamespacedName
+	// Key is the Secret key holding the credentials file, DefaultCredentialsKey if empty
+	Key string
+	// Profile is the profile to read, DefaultProfile if empty
+	Profile string
+}
+
+// Retrieve implements CredentialsProvider
+func (s *SecretCredentials) Retrieve(ctx context.Context) (Credentials, error) {
+	key := s.Key
+	if key == "" {
+		key = DefaultCredentialsKey
+	}
+	profile := s.Profile
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	secret := &corev1.Secret{}
+	if err := s.Client.Get(ctx, s.Secret, secret); err != nil {
+		return Credentials{}, fmt.Errorf("failed to get credentials secret %s: %w", s.Secret, err)
+	}
+	data, ok := secret.Data[key]
+	if !ok {
+		return Credentials{}, fmt.Errorf("key %s not found in credentials secret %s", key, s.Secret)
+	}
+	creds, err := parseSharedCredentials(data, profile)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("invalid credentials secret %s: %w", s.Secret, err)
+	}
+	return creds, nil
+}
+
+// parseSharedCredentials reads the credentials of a profile from a shared credentials file
+func parseSharedCredentials(data []byte, profile string) (Credentials, error) {
+	var creds Credentials
+	found := false
+	section := ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(strings.TrimPrefix(line[1:len(line)-1], "profile "))
+			found = found || section == profile
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Credentials{}, err
+	}
+
+	if !found {
+		return Credentials{}, fmt.Errorf("profile %s not found", profile)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return Credentials{}, fmt.Errorf("profile %s has no access key", profile)
+	}
+	return creds, nil
+}
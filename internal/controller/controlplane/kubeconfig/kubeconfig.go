@@ -0,0 +1,105 @@
+// Package kubeconfig generates kubeconfigs for EKS clusters, authenticating either with a
+// bearer token minted from a presigned STS request or with the aws eks get-token exec plugin.
+package kubeconfig
+
+import (
+	"bytes"
+	"fmt"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// execAPIVersion is the client authentication API version of aws eks get-token
+const execAPIVersion = "client.authentication.k8s.io/v1beta1"
+
+// Config describes the cluster a kubeconfig is generated for
+type Config struct {
+	// ClusterName is the name of the Cluster API cluster, used to name the kubeconfig entries
+	ClusterName string
+	// EKSClusterName is the name of the EKS cluster
+	EKSClusterName string
+	// Region is the AWS region of the EKS cluster
+	Region string
+	// Server is the URL of the cluster endpoint
+	Server string
+	// CAData is the PEM encoded certificate authority of the cluster
+	CAData []byte
+}
+
+// userName returns the kubeconfig user, following the Cluster API naming
+func (c Config) userName() string {
+	return fmt.Sprintf("%s-admin", c.ClusterName)
+}
+
+// contextName returns the kubeconfig context, following the Cluster API naming
+func (c Config) contextName() string {
+	return fmt.Sprintf("%s@%s", c.userName(), c.ClusterName)
+}
+
+// WithToken returns a kubeconfig authenticating with the given bearer token
+func WithToken(config Config, token string) ([]byte, error) {
+	return write(config, &clientcmdapi.AuthInfo{Token: token})
+}
+
+// WithExec returns a kubeconfig authenticating with the aws eks get-token exec plugin.
+// Clients need the AWS CLI and credentials for the cluster.
+func WithExec(config Config) ([]byte, error) {
+	return write(config, &clientcmdapi.AuthInfo{
+		Exec: &clientcmdapi.ExecConfig{
+			APIVersion:      execAPIVersion,
+			Command:         "aws",
+			Args:            []string{"eks", "get-token", "--cluster-name", config.EKSClusterName, "--region", config.Region, "--output", "json"},
+			InteractiveMode: clientcmdapi.NeverExecInteractiveMode,
+		},
+	})
+}
+
+// Matches returns true if the kubeconfig targets the cluster of the config and uses
+// token or exec plugin authentication as requested
+func Matches(data []byte, config Config, withToken bool) bool {
+	if len(data) == 0 {
+		return false
+	}
+	kubeconfig, err := clientcmd.Load(data)
+	if err != nil {
+		return false
+	}
+	kubeContext, ok := kubeconfig.Contexts[kubeconfig.CurrentContext]
+	if !ok {
+		return false
+	}
+	cluster, ok := kubeconfig.Clusters[kubeContext.Cluster]
+	if !ok || cluster.Server != config.Server || !bytes.Equal(cluster.CertificateAuthorityData, config.CAData) {
+		return false
+	}
+	authInfo, ok := kubeconfig.AuthInfos[kubeContext.AuthInfo]
+	if !ok {
+		return false
+	}
+	if withToken {
+		return authInfo.Token != ""
+	}
+	return authInfo.Exec != nil
+}
+
+// write serializes a kubeconfig with a single cluster, user and context
+func write(config Config, authInfo *clientcmdapi.AuthInfo) ([]byte, error) {
+	kubeconfig := clientcmdapi.NewConfig()
+	kubeconfig.Clusters[config.ClusterName] = &clientcmdapi.Cluster{
+		Server:                   config.Server,
+		CertificateAuthorityData: config.CAData,
+	}
+	kubeconfig.AuthInfos[config.userName()] = authInfo
+	kubeconfig.Contexts[config.contextName()] = &clientcmdapi.Context{
+		Cluster:  config.ClusterName,
+		AuthInfo: config.userName(),
+	}
+	kubeconfig.CurrentContext = config.contextName()
+
+	data, err := clientcmd.Write(*kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize kubeconfig: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,153 @@
+package kubeconfig
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// signingAlgorithm is the AWS Signature Version 4 algorithm
+	signingAlgorithm = "AWS4-HMAC-SHA256"
+
+	// emptyPayloadHash is the SHA-256 hash of an empty request body
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	amzDateFormat   = "20060102T150405Z"
+	shortDateFormat = "20060102"
+)
+
+// Signer presigns requests to AWS services
+type Signer interface {
+	// Presign returns the URL of the request with the signature in its query, valid for expires from signTime
+	Presign(ctx context.Context, req *http.Request, service, region string, expires time.Duration, signTime time.Time) (string, error)
+}
+
+// SigV4Signer presigns requests with AWS Signature Version 4
+type SigV4Signer struct {
+	Credentials CredentialsProvider
+}
+
+// NewSigV4Signer creates a SigV4Signer using the given credentials
+func NewSigV4Signer(credentials CredentialsProvider) *SigV4Signer {
+	return &SigV4Signer{Credentials: credentials}
+}
+
+// Presign implements Signer
+func (s *SigV4Signer) Presign(ctx context.Context, req *http.Request, service, region string, expires time.Duration, signTime time.Time) (string, error) {
+	creds, err := s.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	return presignURL(req, creds, service, region, expires, signTime, emptyPayloadHash), nil
+}
+
+// presignURL adds the signature query parameters to the URL of the request. All headers of
+// the request, and its host, are signed; callers must send the signed headers with the URL.
+func presignURL(req *http.Request, creds Credentials, service, region string, expires time.Duration, signTime time.Time, payloadHash string) string {
+	signTime = signTime.UTC()
+	amzDate := signTime.Format(amzDateFormat)
+	scope := strings.Join([]string{signTime.Format(shortDateFormat), region, service, "aws4_request"}, "/")
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	signedHeaders := strings.Join(names, ";")
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", signingAlgorithm)
+	query.Set("X-Amz-Credential", creds.AccessKeyID+"/"+scope)
+	query.Set("X-Amz-Date", amzDate)
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires/time.Second)))
+	query.Set("X-Amz-SignedHeaders", signedHeaders)
+	if creds.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+	canonicalQuery := canonicalQueryString(query)
+
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		method, path, canonicalQuery, canonicalHeaders.String(), signedHeaders, payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{signingAlgorithm, amzDate, scope, hexSHA256(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), signTime.Format(shortDateFormat))
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	presigned := *req.URL
+	presigned.RawQuery = canonicalQuery + "&X-Amz-Signature=" + signature
+	return presigned.String()
+}
+
+// canonicalQueryString encodes the query sorted by key and value with the URI encoding of SigV4
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(key)+"="+uriEncode(value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but the unreserved characters of RFC 3986
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hexSHA256(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
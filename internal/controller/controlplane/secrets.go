@@ -3,10 +3,15 @@ package controlplane
 import (
 	"context"
 	"fmt"
+	"net"
+	"strconv"
+	"time"
 
 	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
 	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
 	"github.com/appthrust/capt/internal/controller/controlplane/secrets"
+	"github.com/appthrust/capt/internal/controller/identity"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -19,6 +24,13 @@ import (
 )
 
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captclusteridentities,verbs=get;list;watch
+
+const (
+	// kubeconfigTokenRotationMargin is how long before its expiration the kubeconfig token is rotated
+	kubeconfigTokenRotationMargin = 5 * time.Minute
+)
 
 const (
 	// Reason constants for status conditions
@@ -28,15 +40,16 @@ const (
 	ReasonEndpointNotReady  = "EndpointNotReady"
 )
 
-// reconcileSecrets handles secret management for CAPTControlPlane
-func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *controlplanev1beta1.CAPTControlPlane, cluster *clusterv1.Cluster, workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply) error {
+// reconcileSecrets handles secret management for CAPTControlPlane. It returns the time until
+// the token of the kubeconfig has to be rotated, or zero if the kubeconfig has no token.
+func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *controlplanev1beta1.CAPTControlPlane, cluster *clusterv1.Cluster, workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply) (time.Duration, error) {
 	logger := log.FromContext(ctx)
 	logger.Info("Reconciling secrets")
 
 	// Verify WorkspaceTemplateApply is ready and has a workspace name
 	if workspaceApply.Status.WorkspaceName == "" {
 		logger.Info("Workspace name not set, waiting for WorkspaceTemplateApply to be ready")
-		return nil
+		return 0, nil
 	}
 
 	// Get workspace
@@ -56,7 +69,7 @@ func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *control
 		if setErr != nil {
 			logger.Error(setErr, "Failed to set status")
 		}
-		return nil
+		return 0, nil
 	}
 
 	// Get connection secret
@@ -69,7 +82,7 @@ func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *control
 		if setErr != nil {
 			logger.Error(setErr, "Failed to set status")
 		}
-		return nil
+		return 0, nil
 	}
 
 	if err := r.Get(ctx, client.ObjectKey{
@@ -82,11 +95,11 @@ func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *control
 			if setErr != nil {
 				logger.Error(setErr, "Failed to set status")
 			}
-			return nil
+			return 0, nil
 		}
 		// If secret is not found, wait for it to be created
 		logger.Info("Waiting for secret to be created")
-		return nil
+		return 0, nil
 	}
 
 	// Initialize secret manager
@@ -100,13 +113,13 @@ func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *control
 		if setErr != nil {
 			logger.Error(setErr, "Failed to set status")
 		}
-		return nil
+		return 0, nil
 	}
 
 	// If endpoint is not ready yet, requeue
 	if endpoint == nil {
 		logger.Info("Endpoint not ready yet, will retry")
-		return nil
+		return 0, nil
 	}
 
 	// Get CA data
@@ -117,19 +130,20 @@ func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *control
 		if setErr != nil {
 			logger.Error(setErr, "Failed to set status")
 		}
-		return nil
+		return 0, nil
 	}
 
 	// Create CA secret
 	if err := r.reconcileCASecret(ctx, controlPlane, caData); err != nil {
 		logger.Error(err, "Failed to reconcile CA secret")
-		return err
+		return 0, err
 	}
 
 	// Create kubeconfig secret
-	if err := r.reconcileKubeconfigSecret(ctx, controlPlane, cluster); err != nil {
+	rotateAfter, err := r.reconcileKubeconfigSecret(ctx, controlPlane, cluster, endpoint, caData)
+	if err != nil {
 		logger.Error(err, "Failed to reconcile kubeconfig secret")
-		return err
+		return 0, err
 	}
 
 	// Mark secrets as reconciled
@@ -138,12 +152,12 @@ func (r *Reconciler) reconcileSecrets(ctx context.Context, controlPlane *control
 		controlPlane.Status.SecretsReady = true
 		if err := r.Status().Patch(ctx, controlPlane, client.MergeFrom(patchBase)); err != nil {
 			logger.Error(err, "Failed to update secrets status")
-			return nil
+			return 0, nil
 		}
 		logger.Info("Marked secrets as ready")
 	}
 
-	return nil
+	return rotateAfter, nil
 }
 
 // reconcileCASecret creates or updates the CA secret
@@ -193,27 +207,92 @@ func (r *Reconciler) reconcileCASecret(ctx context.Context, controlPlane *contro
 	return nil
 }
 
-// reconcileKubeconfigSecret creates or updates the kubeconfig secret
-func (r *Reconciler) reconcileKubeconfigSecret(ctx context.Context, controlPlane *controlplanev1beta1.CAPTControlPlane, cluster *clusterv1.Cluster) error {
+// reconcileKubeconfigSecret creates or updates the kubeconfig secret from the cluster endpoint and CA.
+// The kubeconfig authenticates with a token of the cluster's token generator, or with the aws eks
+// get-token exec plugin if it has none. It is regenerated when the endpoint, the CA or the
+// authentication method change, and when its token is about to expire. It returns the time
+// until the token has to be rotated, or zero if the kubeconfig has no token.
+func (r *Reconciler) reconcileKubeconfigSecret(
+	ctx context.Context,
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	cluster *clusterv1.Cluster,
+	endpoint *clusterv1.APIEndpoint,
+	caData string,
+) (time.Duration, error) {
 	logger := log.FromContext(ctx)
 
-	// Get outputs secret first
-	outputsSecretName := fmt.Sprintf("%s-outputs-kubeconfig", cluster.Name)
-	outputsSecret := &corev1.Secret{}
-	if err := r.Get(ctx, client.ObjectKey{
-		Name:      outputsSecretName,
-		Namespace: "default", // outputs-kubeconfigはdefaultネームスペースにある
-	}, outputsSecret); err != nil {
-		if !apierrors.IsNotFound(err) {
-			logger.Error(err, "Failed to get outputs secret")
-			return err
+	// Regenerate the kubeconfig against the re-resolved endpoint once an endpoint access change is applied
+	if isEndpointAccessUpdating(controlPlane) {
+		logger.Info("Waiting for endpoint access change to be applied")
+		return 0, nil
+	}
+
+	region := ""
+	if controlPlane.Spec.ControlPlaneConfig != nil {
+		region = controlPlane.Spec.ControlPlaneConfig.Region
+	}
+	if region == "" {
+		// Fallback to cluster annotations
+		region = cluster.Annotations["cluster.x-k8s.io/region"]
+		if region == "" {
+			logger.Info("Region not found in ControlPlaneConfig or cluster annotations")
+			return 0, nil
 		}
-		logger.Info("Waiting for outputs secret to be created", "name", outputsSecretName)
-		return nil
 	}
 
-	// Prepare kubeconfig secret
+	config := kubeconfig.Config{
+		ClusterName:    cluster.Name,
+		EKSClusterName: controlPlane.Name,
+		Region:         region,
+		Server:         endpointURL(endpoint),
+		CAData:         []byte(caData),
+	}
+
 	kubeconfigSecretName := fmt.Sprintf("%s-kubeconfig", cluster.Name)
+	existingKubeconfigSecret := &corev1.Secret{}
+	err := r.Get(ctx, client.ObjectKey{
+		Name:      kubeconfigSecretName,
+		Namespace: controlPlane.Namespace,
+	}, existingKubeconfigSecret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		logger.Error(err, "Failed to get existing kubeconfig secret")
+		return 0, err
+	}
+	exists := err == nil
+	generator, err := r.tokenGenerator(ctx, cluster)
+	if err != nil {
+		logger.Error(err, "Failed to resolve kubeconfig authentication")
+		return 0, err
+	}
+	withToken := generator != nil
+	now := time.Now()
+	if exists && kubeconfig.Matches(existingKubeconfigSecret.Data["value"], config, withToken) {
+		if !withToken {
+			return 0, nil
+		}
+		// Keep the token until it is about to expire
+		if rotateAfter := tokenRotationDelay(existingKubeconfigSecret, now); rotateAfter > 0 {
+			return rotateAfter, nil
+		}
+		logger.Info("Rotating kubeconfig token")
+	}
+
+	data, expiration, err := generateKubeconfig(ctx, config, generator)
+	if err != nil {
+		logger.Error(err, "Failed to generate kubeconfig")
+		return 0, err
+	}
+
+	annotations := map[string]string{}
+	if exists && existingKubeconfigSecret.Annotations != nil {
+		annotations = existingKubeconfigSecret.Annotations
+	}
+	delete(annotations, controlplanev1beta1.KubeconfigTokenExpirationAnnotation)
+	if withToken {
+		annotations[controlplanev1beta1.KubeconfigTokenExpirationAnnotation] = expiration.UTC().Format(time.RFC3339)
+	}
+
+	// Prepare kubeconfig secret
 	kubeconfigSecret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      kubeconfigSecretName,
@@ -221,47 +300,107 @@ func (r *Reconciler) reconcileKubeconfigSecret(ctx context.Context, controlPlane
 			Labels: map[string]string{
 				"cluster.x-k8s.io/cluster-name": cluster.Name,
 			},
+			Annotations: annotations,
 		},
 		Type: "cluster.x-k8s.io/secret",
 		Data: map[string][]byte{
-			"value": outputsSecret.Data["kubeconfig"],
+			"value": data,
 		},
 	}
 
 	// Set controller reference
 	if err := controllerutil.SetControllerReference(controlPlane, kubeconfigSecret, r.Scheme); err != nil {
 		logger.Error(err, "Failed to set controller reference for kubeconfig secret")
-		return err
+		return 0, err
 	}
 
-	// Create or update kubeconfig secret
-	existingKubeconfigSecret := &corev1.Secret{}
-	err := r.Get(ctx, client.ObjectKey{
-		Name:      kubeconfigSecretName,
-		Namespace: controlPlane.Namespace,
-	}, existingKubeconfigSecret)
-
-	if err != nil {
-		if !apierrors.IsNotFound(err) {
-			logger.Error(err, "Failed to get existing kubeconfig secret")
-			return err
-		}
+	if !exists {
 		// Create new secret
 		if err := r.Create(ctx, kubeconfigSecret); err != nil {
 			logger.Error(err, "Failed to create kubeconfig secret")
-			return err
+			return 0, err
 		}
 		logger.Info("Created kubeconfig secret")
 	} else {
-		// Update existing secret
+		// Update existing secret in place, so that its clients keep watching the same object
 		existingKubeconfigSecret.Data = kubeconfigSecret.Data
 		existingKubeconfigSecret.Labels = kubeconfigSecret.Labels
+		existingKubeconfigSecret.Annotations = kubeconfigSecret.Annotations
 		if err := r.Update(ctx, existingKubeconfigSecret); err != nil {
 			logger.Error(err, "Failed to update kubeconfig secret")
-			return err
+			return 0, err
 		}
 		logger.Info("Updated kubeconfig secret")
 	}
 
-	return nil
+	patchBase := controlPlane.DeepCopy()
+	controlPlane.Status.KubeconfigLastRotationTime = &metav1.Time{Time: now}
+	if err := r.Status().Patch(ctx, controlPlane, client.MergeFrom(patchBase)); err != nil {
+		logger.Error(err, "Failed to record kubeconfig rotation time")
+		return 0, err
+	}
+
+	if !withToken {
+		return 0, nil
+	}
+	return expiration.Add(-kubeconfigTokenRotationMargin).Sub(now), nil
+}
+
+// tokenRotationDelay returns the time until the token of the kubeconfig secret has to be
+// rotated, or zero if it has to be rotated now or its expiration is unknown
+func tokenRotationDelay(secret *corev1.Secret, now time.Time) time.Duration {
+	expiration, err := time.Parse(time.RFC3339, secret.Annotations[controlplanev1beta1.KubeconfigTokenExpirationAnnotation])
+	if err != nil {
+		return 0
+	}
+	if delay := expiration.Add(-kubeconfigTokenRotationMargin).Sub(now); delay > 0 {
+		return delay
+	}
+	return 0
+}
+
+// tokenGenerator returns the generator of the kubeconfig token of the cluster, or nil if its
+// kubeconfig uses the exec plugin. Clusters with a CAPTClusterIdentity never get a token signed
+// with the credentials of the manager: secretRef identities sign with their own credentials, and
+// roleARN identities, whose web identity only provider-terraform holds, use the exec plugin.
+func (r *Reconciler) tokenGenerator(ctx context.Context, cluster *clusterv1.Cluster) (kubeconfig.TokenGenerator, error) {
+	if r.TokenGenerator == nil {
+		return nil, nil
+	}
+	ref, err := identity.ForCluster(ctx, r.Client, cluster.Namespace, cluster.Name)
+	if err != nil {
+		return nil, err
+	}
+	if ref == nil {
+		return r.TokenGenerator, nil
+	}
+
+	credentials, err := identity.Credentials(ctx, r.Client, ref.Name, cluster.Namespace)
+	if err != nil || credentials == nil {
+		return nil, err
+	}
+	return kubeconfig.NewSTSTokenGenerator(kubeconfig.NewSigV4Signer(credentials)), nil
+}
+
+// generateKubeconfig returns a kubeconfig for the cluster authenticating with a token of the
+// generator, or with the exec plugin if it is nil, and the expiration of its token
+func generateKubeconfig(ctx context.Context, config kubeconfig.Config, generator kubeconfig.TokenGenerator) ([]byte, time.Time, error) {
+	if generator == nil {
+		data, err := kubeconfig.WithExec(config)
+		return data, time.Time{}, err
+	}
+	token, err := generator.GenerateToken(ctx, config.EKSClusterName, config.Region)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+	data, err := kubeconfig.WithToken(config, token.Value)
+	return data, token.Expiration, err
+}
+
+// endpointURL returns the URL of the cluster endpoint
+func endpointURL(endpoint *clusterv1.APIEndpoint) string {
+	if endpoint.Port == 0 || endpoint.Port == 443 {
+		return fmt.Sprintf("https://%s", endpoint.Host)
+	}
+	return fmt.Sprintf("https://%s", net.JoinHostPort(endpoint.Host, strconv.Itoa(int(endpoint.Port))))
 }
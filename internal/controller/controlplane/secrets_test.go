@@ -2,18 +2,25 @@ package controlplane
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
 	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
 	"github.com/appthrust/capt/internal/controller/controlplane/secrets"
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
@@ -189,7 +196,7 @@ func TestReconcileSecrets(t *testing.T) {
 				Scheme: scheme,
 			}
 
-			err := r.reconcileSecrets(context.Background(), tt.controlPlane, tt.cluster, tt.workspaceApply)
+			_, err := r.reconcileSecrets(context.Background(), tt.controlPlane, tt.cluster, tt.workspaceApply)
 
 			if tt.expectedError {
 				assert.Error(t, err)
@@ -255,9 +262,9 @@ func TestSecretManager(t *testing.T) {
 			workspace: &unstructured.Unstructured{
 				Object: map[string]interface{}{
 					"status": map[string]interface{}{
-						"outputs": map[string]interface{}{
-							"endpoint": map[string]interface{}{
-								"value": "https://test-endpoint:6443",
+						"atProvider": map[string]interface{}{
+							"outputs": map[string]interface{}{
+								"cluster_endpoint": "https://test-endpoint:6443",
 							},
 						},
 					},
@@ -265,7 +272,7 @@ func TestSecretManager(t *testing.T) {
 			},
 			secret: &corev1.Secret{
 				Data: map[string][]byte{
-					"ca.crt": []byte("test-ca-data"),
+					"cluster_certificate_authority_data": []byte("test-ca-data"),
 				},
 			},
 			expectedHost:  "test-endpoint",
@@ -279,8 +286,8 @@ func TestSecretManager(t *testing.T) {
 			},
 			secret: &corev1.Secret{
 				Data: map[string][]byte{
-					"endpoint": []byte("https://test-endpoint:6443"),
-					"ca.crt":   []byte("test-ca-data"),
+					"cluster_endpoint":                   []byte("https://test-endpoint:6443"),
+					"cluster_certificate_authority_data": []byte("test-ca-data"),
 				},
 			},
 			expectedHost:  "test-endpoint",
@@ -304,6 +311,7 @@ func TestSecretManager(t *testing.T) {
 			}
 
 			assert.NoError(t, err)
+			require.NotNil(t, endpoint)
 			assert.Equal(t, tt.expectedHost, endpoint.Host)
 			assert.Equal(t, tt.expectedPort, endpoint.Port)
 
@@ -313,3 +321,181 @@ func TestSecretManager(t *testing.T) {
 		})
 	}
 }
+
+// testTokenGenerator stands in for the STS token generator
+type testTokenGenerator struct {
+	calls int
+}
+
+func (g *testTokenGenerator) GenerateToken(_ context.Context, clusterName, region string) (kubeconfig.Token, error) {
+	g.calls++
+	return kubeconfig.Token{
+		Value:      fmt.Sprintf("token-%s-%s-%d", clusterName, region, g.calls),
+		Expiration: time.Now().Add(kubeconfig.TokenLifetime),
+	}, nil
+}
+
+func TestReconcileKubeconfigSecret(t *testing.T) {
+	scheme := setupScheme()
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "tenant-a", UID: "cp-uid"},
+		Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+			ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{Region: "ap-northeast-1"},
+		},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "tenant-a"}}
+	endpoint := &clusterv1.APIEndpoint{Host: "ABCDEF.gr7.ap-northeast-1.eks.amazonaws.com", Port: 443}
+	secretKey := types.NamespacedName{Name: "test-cluster-kubeconfig", Namespace: "tenant-a"}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(controlPlane).WithStatusSubresource(controlPlane).Build()
+	generator := &testTokenGenerator{}
+	r := &Reconciler{Client: c, Scheme: scheme, TokenGenerator: generator}
+
+	rotateAfter, err := r.reconcileKubeconfigSecret(context.Background(), controlPlane, cluster, endpoint, "test-ca-data")
+	require.NoError(t, err)
+	assert.InDelta(t, (kubeconfig.TokenLifetime - kubeconfigTokenRotationMargin).Seconds(), rotateAfter.Seconds(), 5)
+	require.NotNil(t, controlPlane.Status.KubeconfigLastRotationTime)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, c.Get(context.Background(), secretKey, secret))
+	assert.Equal(t, "test-cluster", secret.Labels["cluster.x-k8s.io/cluster-name"])
+	assert.Contains(t, secret.Annotations, controlplanev1beta1.KubeconfigTokenExpirationAnnotation)
+	config, err := clientcmd.Load(secret.Data["value"])
+	require.NoError(t, err)
+	assert.Equal(t, "https://ABCDEF.gr7.ap-northeast-1.eks.amazonaws.com", config.Clusters["test-cluster"].Server)
+	assert.Equal(t, []byte("test-ca-data"), config.Clusters["test-cluster"].CertificateAuthorityData)
+	assert.Equal(t, "token-test-cp-ap-northeast-1-1", config.AuthInfos["test-cluster-admin"].Token)
+
+	// A token that is not about to expire is kept
+	_, err = r.reconcileKubeconfigSecret(context.Background(), controlPlane, cluster, endpoint, "test-ca-data")
+	require.NoError(t, err)
+	assert.Equal(t, 1, generator.calls)
+
+	// A token that is about to expire is rotated in place
+	secret.Annotations[controlplanev1beta1.KubeconfigTokenExpirationAnnotation] = time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	require.NoError(t, c.Update(context.Background(), secret))
+	rotateAfter, err = r.reconcileKubeconfigSecret(context.Background(), controlPlane, cluster, endpoint, "test-ca-data")
+	require.NoError(t, err)
+	assert.Positive(t, rotateAfter)
+	assert.Equal(t, 2, generator.calls)
+	rotated := &corev1.Secret{}
+	require.NoError(t, c.Get(context.Background(), secretKey, rotated))
+	assert.Equal(t, secret.UID, rotated.UID)
+	config, err = clientcmd.Load(rotated.Data["value"])
+	require.NoError(t, err)
+	assert.Equal(t, "token-test-cp-ap-northeast-1-2", config.AuthInfos["test-cluster-admin"].Token)
+
+	// Without a token generator the exec plugin is used and nothing has to be rotated
+	r.TokenGenerator = nil
+	rotateAfter, err = r.reconcileKubeconfigSecret(context.Background(), controlPlane, cluster, endpoint, "test-ca-data")
+	require.NoError(t, err)
+	assert.Zero(t, rotateAfter)
+	require.NoError(t, c.Get(context.Background(), secretKey, secret))
+	assert.NotContains(t, secret.Annotations, controlplanev1beta1.KubeconfigTokenExpirationAnnotation)
+	config, err = clientcmd.Load(secret.Data["value"])
+	require.NoError(t, err)
+	require.NotNil(t, config.AuthInfos["test-cluster-admin"].Exec)
+	assert.Equal(t, "aws", config.AuthInfos["test-cluster-admin"].Exec.Command)
+}
+
+func TestReconcileKubeconfigSecretWithIdentity(t *testing.T) {
+	scheme := setupScheme()
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "tenant-a", UID: "cp-uid"},
+		Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+			ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{Region: "ap-northeast-1"},
+		},
+	}
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "tenant-a"},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{Kind: "CAPTCluster", Name: "test-cluster", Namespace: "tenant-a"},
+		},
+	}
+	captCluster := &infrastructurev1beta1.CAPTCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "tenant-a"},
+		Spec:       infrastructurev1beta1.CAPTClusterSpec{IdentityRef: &infrastructurev1beta1.IdentityReference{Name: "tenant-a"}},
+	}
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant-a-creds", Namespace: "capt-system"},
+		Data: map[string][]byte{
+			"credentials": []byte("[default]\naws_access_key_id = AKIATENANTA\naws_secret_access_key = secret\n"),
+		},
+	}
+	endpoint := &clusterv1.APIEndpoint{Host: "ABCDEF.gr7.ap-northeast-1.eks.amazonaws.com", Port: 443}
+	secretKey := types.NamespacedName{Name: "test-cluster-kubeconfig", Namespace: "tenant-a"}
+
+	tests := []struct {
+		name     string
+		spec     infrastructurev1beta1.CAPTClusterIdentitySpec
+		wantExec bool
+		wantErr  bool
+	}{
+		{
+			name: "secretRef identity signs with its credentials",
+			spec: infrastructurev1beta1.CAPTClusterIdentitySpec{
+				AllowedNamespaces: &infrastructurev1beta1.AllowedNamespaces{},
+				SecretRef: &xpv1.SecretKeySelector{
+					SecretReference: xpv1.SecretReference{Name: "tenant-a-creds", Namespace: "capt-system"},
+					Key:             "credentials",
+				},
+			},
+		},
+		{
+			name: "roleARN identity uses the exec plugin",
+			spec: infrastructurev1beta1.CAPTClusterIdentitySpec{
+				AllowedNamespaces: &infrastructurev1beta1.AllowedNamespaces{},
+				RoleARN:           "arn:aws:iam::123456789012:role/tenant-a",
+			},
+			wantExec: true,
+		},
+		{
+			name: "identity not allowing the namespace",
+			spec: infrastructurev1beta1.CAPTClusterIdentitySpec{
+				AllowedNamespaces: &infrastructurev1beta1.AllowedNamespaces{List: []string{"tenant-b"}},
+				RoleARN:           "arn:aws:iam::123456789012:role/tenant-a",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clusterIdentity := &infrastructurev1beta1.CAPTClusterIdentity{
+				ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"},
+				Spec:       tt.spec,
+			}
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(controlPlane.DeepCopy(), cluster, captCluster, clusterIdentity, credentials).
+				WithStatusSubresource(controlPlane).
+				Build()
+			generator := &testTokenGenerator{}
+			r := &Reconciler{Client: c, Scheme: scheme, TokenGenerator: generator}
+
+			_, err := r.reconcileKubeconfigSecret(context.Background(), controlPlane.DeepCopy(), cluster, endpoint, "test-ca-data")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			// The token of the manager is never used for clusters with an identity
+			assert.Zero(t, generator.calls)
+
+			secret := &corev1.Secret{}
+			require.NoError(t, c.Get(context.Background(), secretKey, secret))
+			config, err := clientcmd.Load(secret.Data["value"])
+			require.NoError(t, err)
+			authInfo := config.AuthInfos["test-cluster-admin"]
+			if tt.wantExec {
+				require.NotNil(t, authInfo.Exec)
+				assert.Empty(t, authInfo.Token)
+				return
+			}
+			require.True(t, strings.HasPrefix(authInfo.Token, "k8s-aws-v1."))
+			presigned, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(authInfo.Token, "k8s-aws-v1."))
+			require.NoError(t, err)
+			assert.Contains(t, string(presigned), "AKIATENANTA")
+		})
+	}
+}
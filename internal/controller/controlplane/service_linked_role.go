@@ -6,6 +6,8 @@ import (
 
 	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
 	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
+	"github.com/appthrust/capt/internal/controller/outputs"
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	terraformv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
 	corev1 "k8s.io/api/core/v1"
@@ -26,12 +28,18 @@ const (
 func (r *Reconciler) reconcileSpotServiceLinkedRole(ctx context.Context, controlPlane *controlplanev1beta1.CAPTControlPlane) error {
 	logger := log.FromContext(ctx)
 
+	// The role is managed with the identity of the cluster
+	identityRef, err := identity.ForCluster(ctx, r.Client, controlPlane.Namespace, controlPlane.Name)
+	if err != nil {
+		return err
+	}
+
 	// Create check workspace name
 	checkWorkspaceName := fmt.Sprintf("%s-spot-role-check", controlPlane.Name)
 
 	// Try to find existing check workspace apply
 	checkWorkspaceApply := &infrastructurev1beta1.WorkspaceTemplateApply{}
-	err := r.Get(ctx, types.NamespacedName{
+	err = r.Get(ctx, types.NamespacedName{
 		Name:      checkWorkspaceName,
 		Namespace: controlPlane.Namespace,
 	}, checkWorkspaceApply)
@@ -49,10 +57,8 @@ func (r *Reconciler) reconcileSpotServiceLinkedRole(ctx context.Context, control
 				Namespace: controlPlane.Namespace,
 			},
 			Spec: infrastructurev1beta1.WorkspaceTemplateApplySpec{
-				TemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{
-					Name:      "spot-role-check",
-					Namespace: controlPlane.Namespace,
-				},
+				TemplateRef: spotRoleCheckTemplateRef(controlPlane),
+				IdentityRef: identityRef,
 			},
 		}
 
@@ -95,13 +101,10 @@ func (r *Reconciler) reconcileSpotServiceLinkedRole(ctx context.Context, control
 	}
 
 	// Get role_exists from outputs
-	roleExists := false
-	if checkWorkspace.Status.AtProvider.Outputs != nil {
-		if val, ok := checkWorkspace.Status.AtProvider.Outputs["role_exists"]; ok {
-			if string(val.Raw) == "true" {
-				roleExists = true
-			}
-		}
+	roleExists, _, err := outputs.Get[bool](checkWorkspace.Status.AtProvider.Outputs, "role_exists")
+	if err != nil {
+		logger.Error(err, "invalid role_exists output", "workspace", checkWorkspaceApply.Status.WorkspaceName)
+		return err
 	}
 
 	if !roleExists {
@@ -126,10 +129,8 @@ func (r *Reconciler) reconcileSpotServiceLinkedRole(ctx context.Context, control
 					Namespace: controlPlane.Namespace,
 				},
 				Spec: infrastructurev1beta1.WorkspaceTemplateApplySpec{
-					TemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{
-						Name:      "spot-role-create",
-						Namespace: controlPlane.Namespace,
-					},
+					TemplateRef: spotRoleCreateTemplateRef(controlPlane),
+					IdentityRef: identityRef,
 				},
 			}
 
@@ -172,13 +173,29 @@ func (r *Reconciler) reconcileSpotServiceLinkedRole(ctx context.Context, control
 		}
 
 		// Check if role_arn is in outputs
-		if createWorkspace.Status.AtProvider.Outputs != nil {
-			if _, ok := createWorkspace.Status.AtProvider.Outputs["role_arn"]; !ok {
-				logger.Error(nil, "role_arn not found in outputs", "workspace", createWorkspaceApply.Status.WorkspaceName)
-				return fmt.Errorf("role_arn not found in outputs for workspace %s", createWorkspaceApply.Status.WorkspaceName)
-			}
+		if _, found, err := outputs.Get[string](createWorkspace.Status.AtProvider.Outputs, "role_arn"); err != nil || !found {
+			logger.Error(err, "role_arn not found in outputs", "workspace", createWorkspaceApply.Status.WorkspaceName)
+			return fmt.Errorf("role_arn not found in outputs for workspace %s", createWorkspaceApply.Status.WorkspaceName)
 		}
 	}
 
 	return nil
 }
+
+// spotRoleCheckTemplateRef returns the WorkspaceTemplate checking for the EC2 Spot Service-Linked Role
+func spotRoleCheckTemplateRef(controlPlane *controlplanev1beta1.CAPTControlPlane) infrastructurev1beta1.WorkspaceTemplateReference {
+	var ref *controlplanev1beta1.WorkspaceTemplateReference
+	if controlPlane.Spec.SpotRoleTemplates != nil {
+		ref = controlPlane.Spec.SpotRoleTemplates.CheckTemplateRef
+	}
+	return templateRef(controlPlane, ref, controlplanev1beta1.DefaultSpotRoleCheckTemplate)
+}
+
+// spotRoleCreateTemplateRef returns the WorkspaceTemplate creating the EC2 Spot Service-Linked Role
+func spotRoleCreateTemplateRef(controlPlane *controlplanev1beta1.CAPTControlPlane) infrastructurev1beta1.WorkspaceTemplateReference {
+	var ref *controlplanev1beta1.WorkspaceTemplateReference
+	if controlPlane.Spec.SpotRoleTemplates != nil {
+		ref = controlPlane.Spec.SpotRoleTemplates.CreateTemplateRef
+	}
+	return templateRef(controlPlane, ref, controlplanev1beta1.DefaultSpotRoleCreateTemplate)
+}
@@ -0,0 +1,96 @@
+package controlplane
+
+import (
+	"context"
+	"testing"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestTemplateRef(t *testing.T) {
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-controlplane", Namespace: "tenant-a"},
+	}
+
+	tests := []struct {
+		name     string
+		ref      *controlplanev1beta1.WorkspaceTemplateReference
+		expected infrastructurev1beta1.WorkspaceTemplateReference
+	}{
+		{
+			name:     "Unset reference uses the default in the control plane namespace",
+			expected: infrastructurev1beta1.WorkspaceTemplateReference{Name: "default-template", Namespace: "tenant-a"},
+		},
+		{
+			name:     "Name without namespace stays in the control plane namespace",
+			ref:      &controlplanev1beta1.WorkspaceTemplateReference{Name: "custom"},
+			expected: infrastructurev1beta1.WorkspaceTemplateReference{Name: "custom", Namespace: "tenant-a"},
+		},
+		{
+			name:     "Explicit namespace is kept",
+			ref:      &controlplanev1beta1.WorkspaceTemplateReference{Name: "custom", Namespace: "shared"},
+			expected: infrastructurev1beta1.WorkspaceTemplateReference{Name: "custom", Namespace: "shared"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, templateRef(controlPlane, tt.ref, "default-template"))
+		})
+	}
+}
+
+func TestReconcileSpotServiceLinkedRoleTemplateRefs(t *testing.T) {
+	scheme := setupScheme()
+
+	tests := []struct {
+		name         string
+		templates    *controlplanev1beta1.SpotRoleTemplates
+		expectedName string
+		expectedNS   string
+	}{
+		{
+			name:         "Default check template in the control plane namespace",
+			expectedName: controlplanev1beta1.DefaultSpotRoleCheckTemplate,
+			expectedNS:   "tenant-a",
+		},
+		{
+			name: "Custom check template",
+			templates: &controlplanev1beta1.SpotRoleTemplates{
+				CheckTemplateRef: &controlplanev1beta1.WorkspaceTemplateReference{Name: "tenant-spot-check", Namespace: "shared"},
+			},
+			expectedName: "tenant-spot-check",
+			expectedNS:   "shared",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controlPlane := &controlplanev1beta1.CAPTControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-controlplane", Namespace: "tenant-a", UID: "test-uid"},
+				Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+					Version:           "1.31",
+					SpotRoleTemplates: tt.templates,
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(controlPlane).Build()
+			r := &Reconciler{Client: c, Scheme: scheme}
+
+			require.NoError(t, r.reconcileSpotServiceLinkedRole(context.Background(), controlPlane))
+
+			apply := &infrastructurev1beta1.WorkspaceTemplateApply{}
+			require.NoError(t, c.Get(context.Background(), types.NamespacedName{
+				Name:      "test-controlplane-spot-role-check",
+				Namespace: "tenant-a",
+			}, apply))
+			assert.Equal(t, tt.expectedName, apply.Spec.TemplateRef.Name)
+			assert.Equal(t, tt.expectedNS, apply.Spec.TemplateRef.Namespace)
+		})
+	}
+}
@@ -97,12 +97,25 @@ func (r *Reconciler) updateStatus(
 	errorMessage := getWorkspaceError(workspaceApply)
 
 	if !ready {
-		return r.handleNotReadyStatus(ctx, controlPlane, cluster, errorMessage)
+		if errorMessage == "" {
+			reason, message, err := r.reconcileTimeouts(ctx, controlPlane, workspaceApply)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if reason != "" {
+				logger.Info("Control plane timed out", "reason", reason)
+				if r.Recorder != nil {
+					r.Recorder.Event(controlPlane, corev1.EventTypeWarning, reason, message)
+				}
+				return r.setFailedStatus(ctx, controlPlane, cluster, reason, message)
+			}
+		}
+		return r.handleNotReadyStatus(ctx, controlPlane, cluster, isWaitingForVPC(workspaceApply), errorMessage)
 	}
 
 	// Update endpoint from workspace first
 	if workspaceApply.Status.WorkspaceName != "" {
-		if apiEndpoint, err := endpoint.GetEndpointFromWorkspace(ctx, r.Client, workspaceApply.Status.WorkspaceName); err != nil {
+		if apiEndpoint, err := endpoint.GetEndpointFromWorkspace(ctx, r.Client, controlPlane.Namespace, workspaceApply.Status.WorkspaceName); err != nil {
 			errMsg := fmt.Sprintf("Failed to get endpoint from workspace: %v", err)
 			return r.setFailedStatus(ctx, controlPlane, cluster, ReasonEndpointUpdateFailed, errMsg)
 		} else if apiEndpoint != nil {
@@ -140,17 +153,29 @@ func (r *Reconciler) updateStatus(
 		Message:            "Control plane is ready",
 	})
 
-	controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneReadyCondition
+	// The control plane keeps serving while it is upgraded, so it stays ready
+	upgrading := r.reconcileVersion(ctx, controlPlane, workspaceApply)
+	addonsProgressing := r.reconcileAddons(ctx, controlPlane, workspaceApply)
+	endpointAccessUpdating := r.reconcileEndpointAccess(ctx, controlPlane, workspaceApply)
+	if upgrading {
+		controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneUpgradingCondition
+	} else {
+		controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneReadyCondition
+	}
 	controlPlane.Status.Ready = true
 	controlPlane.Status.Initialized = true
+	if controlPlane.Status.InitializedTime == nil {
+		now := metav1.Now()
+		controlPlane.Status.InitializedTime = &now
+	}
 	controlPlane.Status.WorkspaceTemplateStatus.Ready = true
 	controlPlane.Status.FailureReason = nil
 	controlPlane.Status.FailureMessage = nil
 	controlPlane.Status.WorkspaceTemplateStatus.LastFailureMessage = ""
+	controlPlane.Status.VPCWaitStartTime = nil
+	controlPlane.Status.CreationStartTime = nil
 
-	if workspaceApply.Status.LastAppliedTime != nil {
-		controlPlane.Status.WorkspaceTemplateStatus.LastAppliedRevision = workspaceApply.Status.LastAppliedTime.String()
-	}
+	controlPlane.Status.WorkspaceTemplateStatus.LastAppliedRevision = workspaceApply.Status.LastAppliedRevision
 
 	// Log the status before update
 	logger.Info("Status before final update",
@@ -177,6 +202,11 @@ func (r *Reconciler) updateStatus(
 		}
 	}
 
+	// Wait for the new version, addon and endpoint access changes to be reported more frequently
+	if upgrading || addonsProgressing || endpointAccessUpdating {
+		return ctrl.Result{RequeueAfter: initializationRequeueInterval}, nil
+	}
+
 	// Use default interval for ready state
 	return ctrl.Result{RequeueAfter: defaultRequeueInterval}, nil
 }
@@ -186,6 +216,7 @@ func (r *Reconciler) handleNotReadyStatus(
 	ctx context.Context,
 	controlPlane *controlplanev1beta1.CAPTControlPlane,
 	cluster *clusterv1.Cluster,
+	waitingForVPC bool,
 	errorMessage string,
 ) (ctrl.Result, error) {
 	// Initialize status fields
@@ -194,6 +225,21 @@ func (r *Reconciler) handleNotReadyStatus(
 	// Create a patch base before any updates
 	patchBase := controlPlane.DeepCopy()
 
+	// An initialized control plane that is being upgraded or changes its endpoint access keeps serving
+	if errorMessage == "" && (isUpgrading(controlPlane) || isEndpointAccessUpdating(controlPlane)) {
+		if isUpgrading(controlPlane) {
+			controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneUpgradingCondition
+			markUpgrading(controlPlane)
+		}
+		if isEndpointAccessUpdating(controlPlane) {
+			markEndpointAccessUpdating(controlPlane)
+		}
+		if err := r.Status().Patch(ctx, controlPlane, client.MergeFrom(patchBase)); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: initializationRequeueInterval}, nil
+	}
+
 	if errorMessage != "" {
 		meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
 			Type:               controlplanev1beta1.ControlPlaneReadyCondition,
@@ -203,6 +249,15 @@ func (r *Reconciler) handleNotReadyStatus(
 			Message:            errorMessage,
 		})
 		controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneFailedCondition
+	} else if waitingForVPC {
+		meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
+			Type:               controlplanev1beta1.ControlPlaneReadyCondition,
+			Status:             metav1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             controlplanev1beta1.ReasonWaitingForVPC,
+			Message:            "Waiting for VPC to be ready",
+		})
+		controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneCreatingCondition
 	} else {
 		meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
 			Type:               controlplanev1beta1.ControlPlaneReadyCondition,
@@ -87,8 +87,9 @@ func TestUpdateStatus(t *testing.T) {
 			},
 			workspaceApply: &infrastructurev1beta1.WorkspaceTemplateApply{
 				Status: infrastructurev1beta1.WorkspaceTemplateApplyStatus{
-					Applied:         true,
-					LastAppliedTime: &now,
+					Applied:             true,
+					LastAppliedTime:     &now,
+					LastAppliedRevision: "0123456789abcdef",
 					Conditions: []xpv1.Condition{
 						{
 							Type:   xpv1.TypeReady,
@@ -116,7 +117,7 @@ func TestUpdateStatus(t *testing.T) {
 			validate: func(t *testing.T, controlPlane *controlplanev1beta1.CAPTControlPlane) {
 				assert.NotNil(t, controlPlane.Status.WorkspaceTemplateStatus)
 				assert.True(t, controlPlane.Status.WorkspaceTemplateStatus.Ready)
-				assert.NotEmpty(t, controlPlane.Status.WorkspaceTemplateStatus.LastAppliedRevision)
+				assert.Equal(t, "0123456789abcdef", controlPlane.Status.WorkspaceTemplateStatus.LastAppliedRevision)
 			},
 		},
 		{
@@ -190,8 +191,9 @@ func TestUpdateStatus(t *testing.T) {
 			},
 			workspaceApply: &infrastructurev1beta1.WorkspaceTemplateApply{
 				Status: infrastructurev1beta1.WorkspaceTemplateApplyStatus{
-					Applied:         true,
-					LastAppliedTime: &now,
+					Applied:             true,
+					LastAppliedTime:     &now,
+					LastAppliedRevision: "0123456789abcdef",
 					Conditions: []xpv1.Condition{
 						{
 							Type:   xpv1.TypeReady,
@@ -220,7 +222,7 @@ func TestUpdateStatus(t *testing.T) {
 				assert.NotNil(t, controlPlane.Status.WorkspaceTemplateStatus)
 				assert.True(t, controlPlane.Status.WorkspaceTemplateStatus.Ready)
 				assert.Empty(t, controlPlane.Status.WorkspaceTemplateStatus.LastFailureMessage)
-				assert.NotEmpty(t, controlPlane.Status.WorkspaceTemplateStatus.LastAppliedRevision)
+				assert.Equal(t, "0123456789abcdef", controlPlane.Status.WorkspaceTemplateStatus.LastAppliedRevision)
 			},
 		},
 	}
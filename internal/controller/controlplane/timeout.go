@@ -0,0 +1,150 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// reasonRetryRequested is the event reason for a handled retry annotation
+	reasonRetryRequested = "RetryRequested"
+)
+
+// timeouts returns the VPC ready and control plane creation timeouts of the control plane
+func timeouts(controlPlane *controlplanev1beta1.CAPTControlPlane) (vpcReady, creation time.Duration) {
+	vpcReadyMinutes := controlplanev1beta1.DefaultVPCReadyTimeout
+	creationMinutes := controlplanev1beta1.DefaultControlPlaneTimeout
+	if config := controlPlane.Spec.ControlPlaneConfig; config != nil && config.Timeouts != nil {
+		if config.Timeouts.VPCReadyTimeout != nil {
+			vpcReadyMinutes = *config.Timeouts.VPCReadyTimeout
+		}
+		if config.Timeouts.ControlPlaneTimeout != nil {
+			creationMinutes = *config.Timeouts.ControlPlaneTimeout
+		}
+	}
+	return time.Duration(vpcReadyMinutes) * time.Minute, time.Duration(creationMinutes) * time.Minute
+}
+
+// hasTimedOut returns true if the control plane failed with a timeout
+func hasTimedOut(controlPlane *controlplanev1beta1.CAPTControlPlane) bool {
+	reason := controlPlane.Status.FailureReason
+	return reason != nil &&
+		(*reason == controlplanev1beta1.ReasonVPCReadyTimeout || *reason == controlplanev1beta1.ReasonControlPlaneTimeout)
+}
+
+// isWaitingForVPC returns true if the WorkspaceTemplateApply waits for its VPC dependency
+func isWaitingForVPC(workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply) bool {
+	if workspaceApply == nil {
+		return false
+	}
+	condition := FindStatusCondition(workspaceApply.Status.Conditions, infrastructurev1beta1.DependenciesReadyCondition)
+	return condition != nil && condition.Status != corev1.ConditionTrue
+}
+
+// checkTimeouts records when the control plane started waiting for its VPC and when its creation
+// started, and returns the failure reason and message once the matching timeout is exceeded.
+// Only the initial creation is bounded: a control plane that has been ready once is not timed out
+// when it is not ready anymore, e.g. while the workspace re-applies a change.
+func checkTimeouts(
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply,
+	now metav1.Time,
+) (string, string) {
+	if controlPlane.Status.Initialized || controlPlane.Status.InitializedTime != nil {
+		return "", ""
+	}
+
+	vpcReadyTimeout, creationTimeout := timeouts(controlPlane)
+
+	if isWaitingForVPC(workspaceApply) {
+		if controlPlane.Status.VPCWaitStartTime == nil {
+			controlPlane.Status.VPCWaitStartTime = &now
+		}
+		if now.Sub(controlPlane.Status.VPCWaitStartTime.Time) > vpcReadyTimeout {
+			return controlplanev1beta1.ReasonVPCReadyTimeout,
+				fmt.Sprintf("VPC was not ready within %s", vpcReadyTimeout)
+		}
+		return "", ""
+	}
+
+	controlPlane.Status.VPCWaitStartTime = nil
+	if controlPlane.Status.CreationStartTime == nil {
+		controlPlane.Status.CreationStartTime = &now
+	}
+	if now.Sub(controlPlane.Status.CreationStartTime.Time) > creationTimeout {
+		return controlplanev1beta1.ReasonControlPlaneTimeout,
+			fmt.Sprintf("Control plane was not created within %s", creationTimeout)
+	}
+	return "", ""
+}
+
+// reconcileTimeouts applies checkTimeouts to the control plane and persists the recorded start times
+func (r *Reconciler) reconcileTimeouts(
+	ctx context.Context,
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply,
+) (string, string, error) {
+	patchBase := controlPlane.DeepCopy()
+	reason, message := checkTimeouts(controlPlane, workspaceApply, metav1.Now())
+	if equality.Semantic.DeepEqual(patchBase.Status, controlPlane.Status) {
+		return reason, message, nil
+	}
+	if err := r.Status().Patch(ctx, controlPlane, client.MergeFrom(patchBase)); err != nil {
+		return "", "", fmt.Errorf("failed to record timeout start time: %v", err)
+	}
+	return reason, message, nil
+}
+
+// reconcileRetry handles the retry annotation by restarting the timeouts and clearing a timeout
+// failure from the control plane and its owner Cluster
+func (r *Reconciler) reconcileRetry(ctx context.Context, controlPlane *controlplanev1beta1.CAPTControlPlane, cluster *clusterv1.Cluster) error {
+	if _, ok := controlPlane.Annotations[controlplanev1beta1.RetryAnnotation]; !ok {
+		return nil
+	}
+	logger := log.FromContext(ctx)
+
+	timedOut := hasTimedOut(controlPlane)
+
+	patchBase := controlPlane.DeepCopy()
+	controlPlane.Status.VPCWaitStartTime = nil
+	controlPlane.Status.CreationStartTime = nil
+	if timedOut {
+		controlPlane.Status.FailureReason = nil
+		controlPlane.Status.FailureMessage = nil
+		controlPlane.Status.Phase = controlplanev1beta1.ControlPlaneCreatingCondition
+	}
+	if err := r.Status().Patch(ctx, controlPlane, client.MergeFrom(patchBase)); err != nil {
+		return fmt.Errorf("failed to reset timeouts: %v", err)
+	}
+
+	if timedOut && cluster != nil {
+		clusterPatchBase := cluster.DeepCopy()
+		cluster.Status.FailureReason = nil
+		cluster.Status.FailureMessage = nil
+		if err := r.Status().Patch(ctx, cluster, client.MergeFrom(clusterPatchBase)); err != nil {
+			return fmt.Errorf("failed to clear cluster failure: %v", err)
+		}
+	}
+
+	patchBase = controlPlane.DeepCopy()
+	delete(controlPlane.Annotations, controlplanev1beta1.RetryAnnotation)
+	if err := r.Patch(ctx, controlPlane, client.MergeFrom(patchBase)); err != nil {
+		return fmt.Errorf("failed to remove retry annotation: %v", err)
+	}
+
+	logger.Info("Retry requested, timeouts restarted")
+	if r.Recorder != nil {
+		r.Recorder.Event(controlPlane, corev1.EventTypeNormal, reasonRetryRequested, "Timeouts restarted by the retry annotation")
+	}
+	return nil
+}
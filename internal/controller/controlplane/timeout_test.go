@@ -0,0 +1,231 @@
+package controlplane
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCheckTimeouts(t *testing.T) {
+	now := metav1.Now()
+	ago := func(d time.Duration) *metav1.Time {
+		ts := metav1.NewTime(now.Add(-d))
+		return &ts
+	}
+	applyWithDependencies := func(status corev1.ConditionStatus) *infrastructurev1beta1.WorkspaceTemplateApply {
+		return &infrastructurev1beta1.WorkspaceTemplateApply{
+			Status: infrastructurev1beta1.WorkspaceTemplateApplyStatus{
+				Conditions: []xpv1.Condition{{Type: infrastructurev1beta1.DependenciesReadyCondition, Status: status}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name                  string
+		status                controlplanev1beta1.CAPTControlPlaneStatus
+		timeouts              *controlplanev1beta1.TimeoutConfig
+		workspaceApply        *infrastructurev1beta1.WorkspaceTemplateApply
+		wantReason            string
+		wantVPCWaitStarted    bool
+		wantCreationStarted   bool
+		wantCreationStartTime *metav1.Time
+	}{
+		{
+			name:               "waiting for VPC starts the VPC timeout",
+			workspaceApply:     applyWithDependencies(corev1.ConditionFalse),
+			wantVPCWaitStarted: true,
+		},
+		{
+			name:               "VPC ready timeout exceeded",
+			status:             controlplanev1beta1.CAPTControlPlaneStatus{VPCWaitStartTime: ago(16 * time.Minute)},
+			workspaceApply:     applyWithDependencies(corev1.ConditionFalse),
+			wantReason:         controlplanev1beta1.ReasonVPCReadyTimeout,
+			wantVPCWaitStarted: true,
+		},
+		{
+			name:               "configured VPC ready timeout",
+			status:             controlplanev1beta1.CAPTControlPlaneStatus{VPCWaitStartTime: ago(16 * time.Minute)},
+			timeouts:           &controlplanev1beta1.TimeoutConfig{VPCReadyTimeout: ptr.To(20)},
+			workspaceApply:     applyWithDependencies(corev1.ConditionFalse),
+			wantVPCWaitStarted: true,
+		},
+		{
+			name:                "ready VPC starts the creation timeout",
+			status:              controlplanev1beta1.CAPTControlPlaneStatus{VPCWaitStartTime: ago(5 * time.Minute)},
+			workspaceApply:      applyWithDependencies(corev1.ConditionTrue),
+			wantCreationStarted: true,
+		},
+		{
+			name:                  "creation in progress",
+			status:                controlplanev1beta1.CAPTControlPlaneStatus{CreationStartTime: ago(10 * time.Minute)},
+			workspaceApply:        &infrastructurev1beta1.WorkspaceTemplateApply{},
+			wantCreationStarted:   true,
+			wantCreationStartTime: ago(10 * time.Minute),
+		},
+		{
+			name:                "control plane timeout exceeded",
+			status:              controlplanev1beta1.CAPTControlPlaneStatus{CreationStartTime: ago(31 * time.Minute)},
+			workspaceApply:      &infrastructurev1beta1.WorkspaceTemplateApply{},
+			wantReason:          controlplanev1beta1.ReasonControlPlaneTimeout,
+			wantCreationStarted: true,
+		},
+		{
+			name:                "configured control plane timeout",
+			status:              controlplanev1beta1.CAPTControlPlaneStatus{CreationStartTime: ago(31 * time.Minute)},
+			timeouts:            &controlplanev1beta1.TimeoutConfig{ControlPlaneTimeout: ptr.To(60)},
+			workspaceApply:      &infrastructurev1beta1.WorkspaceTemplateApply{},
+			wantCreationStarted: true,
+		},
+		{
+			name:           "initialized control plane is not bounded",
+			status:         controlplanev1beta1.CAPTControlPlaneStatus{Initialized: true},
+			workspaceApply: &infrastructurev1beta1.WorkspaceTemplateApply{},
+		},
+		{
+			name:           "control plane that was ready once is not bounded",
+			status:         controlplanev1beta1.CAPTControlPlaneStatus{InitializedTime: ago(2 * time.Hour)},
+			workspaceApply: applyWithDependencies(corev1.ConditionFalse),
+		},
+		{
+			name:                "reported version does not end the creation timeout",
+			status:              controlplanev1beta1.CAPTControlPlaneStatus{Version: "v1.31.0", CreationStartTime: ago(31 * time.Minute)},
+			workspaceApply:      &infrastructurev1beta1.WorkspaceTemplateApply{},
+			wantReason:          controlplanev1beta1.ReasonControlPlaneTimeout,
+			wantCreationStarted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			controlPlane := &controlplanev1beta1.CAPTControlPlane{
+				Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+					ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{Timeouts: tt.timeouts},
+				},
+				Status: tt.status,
+			}
+
+			reason, message := checkTimeouts(controlPlane, tt.workspaceApply, now)
+
+			assert.Equal(t, tt.wantReason, reason)
+			if tt.wantReason != "" {
+				assert.NotEmpty(t, message)
+			}
+			assert.Equal(t, tt.wantVPCWaitStarted, controlPlane.Status.VPCWaitStartTime != nil)
+			assert.Equal(t, tt.wantCreationStarted, controlPlane.Status.CreationStartTime != nil)
+			if tt.wantCreationStartTime != nil {
+				assert.True(t, tt.wantCreationStartTime.Equal(controlPlane.Status.CreationStartTime))
+			}
+		})
+	}
+}
+
+func TestReconcileRetry(t *testing.T) {
+	scheme := setupScheme()
+
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "test-cp",
+			Namespace:   "default",
+			Annotations: map[string]string{controlplanev1beta1.RetryAnnotation: ""},
+		},
+		Status: controlplanev1beta1.CAPTControlPlaneStatus{
+			Phase:             controlplanev1beta1.ControlPlaneFailedCondition,
+			FailureReason:     ptr.To(controlplanev1beta1.ReasonControlPlaneTimeout),
+			FailureMessage:    ptr.To("Control plane was not created within 30m0s"),
+			CreationStartTime: &metav1.Time{Time: time.Now().Add(-time.Hour)},
+		},
+	}
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "default"},
+	}
+	cluster.Status.FailureMessage = ptr.To("Control plane was not created within 30m0s")
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(controlPlane, cluster).
+		WithStatusSubresource(controlPlane, cluster).
+		Build()
+	recorder := record.NewFakeRecorder(1)
+	r := &Reconciler{Client: fakeClient, Scheme: scheme, Recorder: recorder}
+
+	require.NoError(t, r.reconcileRetry(context.Background(), controlPlane, cluster))
+	assert.False(t, hasTimedOut(controlPlane))
+
+	updated := &controlplanev1beta1.CAPTControlPlane{}
+	require.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(controlPlane), updated))
+	assert.NotContains(t, updated.Annotations, controlplanev1beta1.RetryAnnotation)
+	assert.Nil(t, updated.Status.FailureReason)
+	assert.Nil(t, updated.Status.CreationStartTime)
+	assert.Equal(t, controlplanev1beta1.ControlPlaneCreatingCondition, updated.Status.Phase)
+
+	updatedCluster := &clusterv1.Cluster{}
+	require.NoError(t, fakeClient.Get(context.Background(), client.ObjectKeyFromObject(cluster), updatedCluster))
+	assert.Nil(t, updatedCluster.Status.FailureMessage)
+
+	assert.Contains(t, <-recorder.Events, reasonRetryRequested)
+
+	// Without the annotation nothing changes
+	require.NoError(t, r.reconcileRetry(context.Background(), updated, cluster))
+	assert.Empty(t, recorder.Events)
+}
+
+func TestUpdateStatusInitializedControlPlaneNotTimedOut(t *testing.T) {
+	scheme := setupScheme()
+	ctx := context.Background()
+
+	// The control plane has been ready, but its template reports no cluster_version output
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "default"},
+		Status: controlplanev1beta1.CAPTControlPlaneStatus{
+			Ready:           true,
+			Initialized:     true,
+			InitializedTime: &metav1.Time{Time: time.Now().Add(-2 * time.Hour)},
+			Phase:           controlplanev1beta1.ControlPlaneReadyCondition,
+		},
+	}
+	workspaceApply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp-eks-controlplane-apply", Namespace: "default"},
+		Status: infrastructurev1beta1.WorkspaceTemplateApplyStatus{
+			Conditions: []xpv1.Condition{{Type: xpv1.TypeReady, Status: corev1.ConditionUnknown}},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(controlPlane).
+		WithStatusSubresource(controlPlane).
+		Build()
+	r := &Reconciler{Client: fakeClient, Scheme: scheme, Recorder: record.NewFakeRecorder(1)}
+
+	// The control plane goes not ready
+	_, err := r.updateStatus(ctx, controlPlane, workspaceApply, nil)
+	require.NoError(t, err)
+
+	updated := &controlplanev1beta1.CAPTControlPlane{}
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(controlPlane), updated))
+	assert.False(t, updated.Status.Ready)
+	assert.Nil(t, updated.Status.FailureReason)
+	assert.Nil(t, updated.Status.CreationStartTime)
+	assert.NotNil(t, updated.Status.InitializedTime)
+	assert.NotEqual(t, controlplanev1beta1.ControlPlaneFailedCondition, updated.Status.Phase)
+
+	// It is not timed out once it has been not ready for longer than the creation timeout
+	updated.Status.CreationStartTime = &metav1.Time{Time: time.Now().Add(-31 * time.Minute)}
+	_, err = r.updateStatus(ctx, updated, workspaceApply, nil)
+	require.NoError(t, err)
+	require.NoError(t, fakeClient.Get(ctx, client.ObjectKeyFromObject(controlPlane), updated))
+	assert.Nil(t, updated.Status.FailureReason)
+}
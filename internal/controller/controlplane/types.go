@@ -3,6 +3,7 @@ package controlplane
 import (
 	"time"
 
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -24,4 +25,9 @@ type Reconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// TokenGenerator mints the bearer token of the generated kubeconfigs of clusters without a
+	// CAPTClusterIdentity. Without it the kubeconfigs authenticate with the aws eks get-token
+	// exec plugin.
+	TokenGenerator kubeconfig.TokenGenerator
 }
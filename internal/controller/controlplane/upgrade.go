@@ -0,0 +1,102 @@
+package controlplane
+
+import (
+	"context"
+	"fmt"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/outputs"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// clusterVersionOutput is the workspace output reporting the Kubernetes version of the EKS control plane
+	clusterVersionOutput = "cluster_version"
+)
+
+// eksVersion returns the major.minor form of a Kubernetes version used by EKS, e.g. 1.31 for v1.31.0.
+// Versions that cannot be parsed are returned unchanged.
+func eksVersion(v string) string {
+	parsed, err := version.ParseGeneric(v)
+	if err != nil {
+		return v
+	}
+	return fmt.Sprintf("%d.%d", parsed.Major(), parsed.Minor())
+}
+
+// sameMinorVersion returns true if both versions have the same major and minor version
+func sameMinorVersion(a, b string) bool {
+	return eksVersion(a) == eksVersion(b)
+}
+
+// isUpgrading returns true if the control plane runs a different minor version than desired
+func isUpgrading(controlPlane *controlplanev1beta1.CAPTControlPlane) bool {
+	return controlPlane.Status.Version != "" && !sameMinorVersion(controlPlane.Status.Version, controlPlane.Spec.Version)
+}
+
+// reconcileVersion records the Kubernetes version reported by the control plane workspace in
+// status.version and sets the Upgrading condition. It returns true while an upgrade is in progress.
+// Without a cluster_version output the running version is unknown, so an upgrade in progress is
+// never reported as completed.
+func (r *Reconciler) reconcileVersion(
+	ctx context.Context,
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	workspaceApply *infrastructurev1beta1.WorkspaceTemplateApply,
+) bool {
+	logger := log.FromContext(ctx)
+
+	reported, found, err := outputs.FromApply[string](ctx, r.Client, workspaceApply, clusterVersionOutput)
+	if err != nil {
+		logger.Error(err, "Failed to get cluster version output")
+		found = false
+	}
+	if !found {
+		if isUpgrading(controlPlane) {
+			markUpgrading(controlPlane)
+			return true
+		}
+		if controlPlane.Status.Version == "" {
+			setUpgradingCondition(controlPlane, metav1.ConditionUnknown, controlplanev1beta1.ReasonVersionUnknown,
+				fmt.Sprintf("Workspace does not report the %s output", clusterVersionOutput))
+		}
+		return false
+	}
+
+	if sameMinorVersion(reported, controlPlane.Spec.Version) {
+		if isUpgrading(controlPlane) {
+			logger.Info("Control plane upgrade completed", "version", controlPlane.Spec.Version)
+		}
+		controlPlane.Status.Version = controlPlane.Spec.Version
+		setUpgradingCondition(controlPlane, metav1.ConditionFalse, controlplanev1beta1.ReasonUpgradeCompleted,
+			fmt.Sprintf("Control plane runs Kubernetes %s", controlPlane.Spec.Version))
+		return false
+	}
+
+	// The workspace still reports the previous version
+	if controlPlane.Status.Version == "" {
+		controlPlane.Status.Version = reported
+	}
+	markUpgrading(controlPlane)
+	return true
+}
+
+// markUpgrading sets the Upgrading condition for an upgrade from status.version to spec.version
+func markUpgrading(controlPlane *controlplanev1beta1.CAPTControlPlane) {
+	setUpgradingCondition(controlPlane, metav1.ConditionTrue, controlplanev1beta1.ReasonUpgrading,
+		fmt.Sprintf("Upgrading control plane from Kubernetes %s to %s", controlPlane.Status.Version, controlPlane.Spec.Version))
+}
+
+// setUpgradingCondition sets the Upgrading condition of the control plane
+func setUpgradingCondition(controlPlane *controlplanev1beta1.CAPTControlPlane, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&controlPlane.Status.Conditions, metav1.Condition{
+		Type:               controlplanev1beta1.ControlPlaneUpgradingCondition,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	})
+}
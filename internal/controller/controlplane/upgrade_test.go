@@ -0,0 +1,120 @@
+package controlplane
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestEKSVersion(t *testing.T) {
+	tests := map[string]string{
+		"v1.31.0": "1.31",
+		"1.31":    "1.31",
+		"v1.32":   "1.32",
+		"latest":  "latest",
+	}
+	for in, want := range tests {
+		assert.Equal(t, want, eksVersion(in), in)
+	}
+}
+
+func TestReconcileVersion(t *testing.T) {
+	applyWithVersion := func(version string) *infrastructurev1beta1.WorkspaceTemplateApply {
+		apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-apply", Namespace: "default"},
+		}
+		if version != "" {
+			apply.Status.Outputs = map[string]apiextensionsv1.JSON{
+				clusterVersionOutput: {Raw: []byte(`"` + version + `"`)},
+			}
+		}
+		return apply
+	}
+
+	tests := []struct {
+		name            string
+		specVersion     string
+		statusVersion   string
+		reportedVersion string
+		wantUpgrading   bool
+		wantVersion     string
+		wantCondition   metav1.ConditionStatus
+	}{
+		{
+			name:            "initial creation",
+			specVersion:     "v1.31.0",
+			reportedVersion: "1.31",
+			wantVersion:     "v1.31.0",
+			wantCondition:   metav1.ConditionFalse,
+		},
+		{
+			name:            "upgrade in progress",
+			specVersion:     "v1.32.0",
+			statusVersion:   "v1.31.0",
+			reportedVersion: "1.31",
+			wantUpgrading:   true,
+			wantVersion:     "v1.31.0",
+			wantCondition:   metav1.ConditionTrue,
+		},
+		{
+			name:            "upgrade completed",
+			specVersion:     "v1.32.0",
+			statusVersion:   "v1.31.0",
+			reportedVersion: "1.32",
+			wantVersion:     "v1.32.0",
+			wantCondition:   metav1.ConditionFalse,
+		},
+		{
+			name:          "patch version change",
+			specVersion:   "v1.31.2",
+			statusVersion: "v1.31.0",
+			// EKS only reports the minor version
+			reportedVersion: "1.31",
+			wantVersion:     "v1.31.2",
+			wantCondition:   metav1.ConditionFalse,
+		},
+		{
+			name:          "upgrade without version output",
+			specVersion:   "v1.32.0",
+			statusVersion: "v1.31.0",
+			wantUpgrading: true,
+			wantVersion:   "v1.31.0",
+			wantCondition: metav1.ConditionTrue,
+		},
+		{
+			name:          "template without version output",
+			specVersion:   "v1.32.0",
+			wantVersion:   "",
+			wantCondition: metav1.ConditionUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Reconciler{Client: fake.NewClientBuilder().WithScheme(setupScheme()).Build()}
+			controlPlane := &controlplanev1beta1.CAPTControlPlane{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "default"},
+				Spec:       controlplanev1beta1.CAPTControlPlaneSpec{Version: tt.specVersion},
+				Status:     controlplanev1beta1.CAPTControlPlaneStatus{Version: tt.statusVersion},
+			}
+
+			upgrading := r.reconcileVersion(context.Background(), controlPlane, applyWithVersion(tt.reportedVersion))
+
+			assert.Equal(t, tt.wantUpgrading, upgrading)
+			assert.Equal(t, tt.wantVersion, controlPlane.Status.Version)
+			condition := meta.FindStatusCondition(controlPlane.Status.Conditions, controlplanev1beta1.ControlPlaneUpgradingCondition)
+			if assert.NotNil(t, condition) {
+				assert.Equal(t, tt.wantCondition, condition.Status)
+			}
+			assert.Equal(t, tt.wantUpgrading, isUpgrading(controlPlane))
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
 	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -23,9 +24,10 @@ func (r *Reconciler) reconcileWorkspace(
 ) (ctrl.Result, error) {
 	// Get the referenced WorkspaceTemplate
 	workspaceTemplate := &infrastructurev1beta1.WorkspaceTemplate{}
+	ref := templateRef(controlPlane, &controlPlane.Spec.WorkspaceTemplateRef, "")
 	templateNamespacedName := types.NamespacedName{
-		Name:      controlPlane.Spec.WorkspaceTemplateRef.Name,
-		Namespace: controlPlane.Spec.WorkspaceTemplateRef.Namespace,
+		Name:      ref.Name,
+		Namespace: ref.Namespace,
 	}
 	if err := r.Get(ctx, templateNamespacedName, workspaceTemplate); err != nil {
 		return ctrl.Result{}, fmt.Errorf("failed to get WorkspaceTemplate: %v", err)
@@ -50,7 +52,8 @@ func (r *Reconciler) getOrCreateWorkspaceTemplateApply(
 	// Determine the name for WorkspaceTemplateApply
 	applyName := controlPlane.Spec.WorkspaceTemplateApplyName
 	if applyName == "" {
-		applyName = fmt.Sprintf("%s-eks-controlplane-apply", controlPlane.Name)
+		// The defaulting webhook sets the name on admission; fall back for objects created without it
+		applyName = controlPlane.GetWorkspaceTemplateApplyName()
 		// Update WorkspaceTemplateApplyName in Spec first
 		controlPlaneCopy := controlPlane.DeepCopy()
 		controlPlaneCopy.Spec.WorkspaceTemplateApplyName = applyName
@@ -66,7 +69,11 @@ func (r *Reconciler) getOrCreateWorkspaceTemplateApply(
 	err := r.Get(ctx, types.NamespacedName{Name: applyName, Namespace: controlPlane.Namespace}, workspaceApply)
 	if err == nil {
 		// Update existing WorkspaceTemplateApply
-		workspaceApply.Spec = r.generateWorkspaceTemplateApplySpec(controlPlane)
+		spec, err := r.generateWorkspaceTemplateApplySpec(controlPlane)
+		if err != nil {
+			return nil, err
+		}
+		workspaceApply.Spec = spec
 		if err := r.Update(ctx, workspaceApply); err != nil {
 			return nil, fmt.Errorf("failed to update WorkspaceTemplateApply: %v", err)
 		}
@@ -78,12 +85,16 @@ func (r *Reconciler) getOrCreateWorkspaceTemplateApply(
 	}
 
 	// Create new WorkspaceTemplateApply
+	spec, err := r.generateWorkspaceTemplateApplySpec(controlPlane)
+	if err != nil {
+		return nil, err
+	}
 	workspaceApply = &infrastructurev1beta1.WorkspaceTemplateApply{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      applyName,
 			Namespace: controlPlane.Namespace,
 		},
-		Spec: r.generateWorkspaceTemplateApplySpec(controlPlane),
+		Spec: spec,
 	}
 
 	// Set owner reference
@@ -99,15 +110,12 @@ func (r *Reconciler) getOrCreateWorkspaceTemplateApply(
 }
 
 // generateWorkspaceTemplateApplySpec generates the spec for a WorkspaceTemplateApply
-func (r *Reconciler) generateWorkspaceTemplateApplySpec(controlPlane *controlplanev1beta1.CAPTControlPlane) infrastructurev1beta1.WorkspaceTemplateApplySpec {
+func (r *Reconciler) generateWorkspaceTemplateApplySpec(controlPlane *controlplanev1beta1.CAPTControlPlane) (infrastructurev1beta1.WorkspaceTemplateApplySpec, error) {
 	spec := infrastructurev1beta1.WorkspaceTemplateApplySpec{
-		TemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{
-			Name:      controlPlane.Spec.WorkspaceTemplateRef.Name,
-			Namespace: controlPlane.Spec.WorkspaceTemplateRef.Namespace,
-		},
+		TemplateRef: templateRef(controlPlane, &controlPlane.Spec.WorkspaceTemplateRef, ""),
 		Variables: map[string]string{
 			"cluster_name":       controlPlane.Name,
-			"kubernetes_version": controlPlane.Spec.Version,
+			"kubernetes_version": eksVersion(controlPlane.Spec.Version),
 		},
 		WriteConnectionSecretToRef: &xpv1.SecretReference{
 			Name:      fmt.Sprintf("%s-eks-connection", controlPlane.Name),
@@ -124,30 +132,95 @@ func (r *Reconciler) generateWorkspaceTemplateApplySpec(controlPlane *controlpla
 	if controlPlane.Spec.ControlPlaneConfig != nil && controlPlane.Spec.ControlPlaneConfig.EndpointAccess != nil {
 		spec.Variables["endpoint_public_access"] = fmt.Sprintf("%v", controlPlane.Spec.ControlPlaneConfig.EndpointAccess.Public)
 		spec.Variables["endpoint_private_access"] = fmt.Sprintf("%v", controlPlane.Spec.ControlPlaneConfig.EndpointAccess.Private)
+
+		// Restrict the public endpoint to the allowed CIDR blocks
+		if access := controlPlane.Spec.ControlPlaneConfig.EndpointAccess; access.Public && len(access.PublicCIDRs) > 0 {
+			if err := spec.SetStructuredVariable(endpointPublicAccessCIDRsVariable, access.PublicCIDRs); err != nil {
+				return spec, fmt.Errorf("failed to set public access CIDRs variable: %v", err)
+			}
+		}
+	}
+
+	// Add EKS addons if specified
+	if controlPlane.Spec.ControlPlaneConfig != nil && len(controlPlane.Spec.ControlPlaneConfig.Addons) > 0 {
+		if err := spec.SetStructuredVariable(addonsVariable, addonsVariableValue(controlPlane.Spec.ControlPlaneConfig.Addons)); err != nil {
+			return spec, fmt.Errorf("failed to set addons variable: %v", err)
+		}
 	}
 
 	// Add additional tags if specified
 	if len(controlPlane.Spec.AdditionalTags) > 0 {
+		if err := spec.SetStructuredVariable("tags", controlPlane.Spec.AdditionalTags); err != nil {
+			return spec, fmt.Errorf("failed to set tags variable: %v", err)
+		}
+		// Deprecated: templates written before the tags variable read each tag from
+		// ${tags_<key>}. These variables are still rendered for one release.
 		for k, v := range controlPlane.Spec.AdditionalTags {
 			spec.Variables[fmt.Sprintf("tags_%s", k)] = v
 		}
 	}
 
+	// Use the identity of the cluster
+	identityRef, err := identity.ForCluster(context.Background(), r.Client, controlPlane.Namespace, controlPlane.Name)
+	if err != nil {
+		return spec, err
+	}
+	spec.IdentityRef = identityRef
+
 	// Add VPC workspace dependency
 	vpcWorkspaceApplyName := fmt.Sprintf("%s-vpc", controlPlane.Name)
 	vpcWorkspaceApply := &infrastructurev1beta1.WorkspaceTemplateApply{}
-	err := r.Get(context.Background(), types.NamespacedName{
+	err = r.Get(context.Background(), types.NamespacedName{
 		Name:      vpcWorkspaceApplyName,
 		Namespace: controlPlane.Namespace,
 	}, vpcWorkspaceApply)
 	if err == nil {
-		spec.WaitForWorkspaces = []infrastructurev1beta1.WorkspaceReference{
+		spec.DependsOn = []infrastructurev1beta1.WorkspaceTemplateApplyReference{
 			{
 				Name:      vpcWorkspaceApplyName,
 				Namespace: controlPlane.Namespace,
 			},
 		}
+
+		// Make the VPC outputs available to the template as ${vpc_id}, ${private_subnets} and ${public_subnets}
+		for _, output := range []string{"vpc_id", "private_subnets", "public_subnets"} {
+			spec.VariablesFrom = append(spec.VariablesFrom, infrastructurev1beta1.VariableFrom{
+				Name: output,
+				ValueFrom: infrastructurev1beta1.VariableSource{
+					OutputRef: &infrastructurev1beta1.OutputReference{
+						Name:      vpcWorkspaceApplyName,
+						Namespace: controlPlane.Namespace,
+						Output:    output,
+					},
+					Optional: true,
+				},
+			})
+		}
 	}
 
-	return spec
+	return spec, nil
+}
+
+// templateRef resolves a WorkspaceTemplate reference of the control plane. An unset reference
+// falls back to defaultName, and an unset namespace to the namespace of the control plane, so
+// control planes in different namespaces never share templates by accident.
+func templateRef(
+	controlPlane *controlplanev1beta1.CAPTControlPlane,
+	ref *controlplanev1beta1.WorkspaceTemplateReference,
+	defaultName string,
+) infrastructurev1beta1.WorkspaceTemplateReference {
+	resolved := infrastructurev1beta1.WorkspaceTemplateReference{
+		Name:      defaultName,
+		Namespace: controlPlane.Namespace,
+	}
+	if ref == nil {
+		return resolved
+	}
+	if ref.Name != "" {
+		resolved.Name = ref.Name
+	}
+	if ref.Namespace != "" {
+		resolved.Namespace = ref.Namespace
+	}
+	return resolved
 }
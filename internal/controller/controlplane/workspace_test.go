@@ -72,7 +72,7 @@ func TestReconcileWorkspace(t *testing.T) {
 				}, workspaceApply)
 				assert.NoError(t, err)
 				assert.Equal(t, "test-template", workspaceApply.Spec.TemplateRef.Name)
-				assert.Empty(t, workspaceApply.Spec.WaitForWorkspaces, "Should not have VPC dependency")
+				assert.Empty(t, workspaceApply.Spec.DependsOn, "Should not have VPC dependency")
 				assert.NotNil(t, workspaceApply.Spec.WriteConnectionSecretToRef, "Should have connection secret ref")
 				assert.Equal(t, "test-controlplane-eks-connection", workspaceApply.Spec.WriteConnectionSecretToRef.Name)
 			},
@@ -118,8 +118,8 @@ func TestReconcileWorkspace(t *testing.T) {
 				}, workspaceApply)
 				assert.NoError(t, err)
 				assert.Equal(t, "test-template", workspaceApply.Spec.TemplateRef.Name)
-				assert.Len(t, workspaceApply.Spec.WaitForWorkspaces, 1, "Should have VPC dependency")
-				assert.Equal(t, "test-controlplane-vpc", workspaceApply.Spec.WaitForWorkspaces[0].Name)
+				assert.Len(t, workspaceApply.Spec.DependsOn, 1, "Should have VPC dependency")
+				assert.Equal(t, "test-controlplane-vpc", workspaceApply.Spec.DependsOn[0].Name)
 			},
 		},
 		{
@@ -230,7 +230,7 @@ func TestGetOrCreateWorkspaceTemplateApply(t *testing.T) {
 				assert.Equal(t, "default", workspaceApply.Namespace)
 				assert.Equal(t, "test-template", workspaceApply.Spec.TemplateRef.Name)
 				assert.Equal(t, "1.21", workspaceApply.Spec.Variables["kubernetes_version"])
-				assert.Empty(t, workspaceApply.Spec.WaitForWorkspaces, "Should not have VPC dependency")
+				assert.Empty(t, workspaceApply.Spec.DependsOn, "Should not have VPC dependency")
 				assert.NotNil(t, workspaceApply.Spec.WriteConnectionSecretToRef)
 			},
 		},
@@ -268,8 +268,11 @@ func TestGetOrCreateWorkspaceTemplateApply(t *testing.T) {
 				assert.Equal(t, "default", workspaceApply.Namespace)
 				assert.Equal(t, "test-template", workspaceApply.Spec.TemplateRef.Name)
 				assert.Equal(t, "1.21", workspaceApply.Spec.Variables["kubernetes_version"])
-				assert.Len(t, workspaceApply.Spec.WaitForWorkspaces, 1, "Should have VPC dependency")
-				assert.Equal(t, "test-controlplane-vpc", workspaceApply.Spec.WaitForWorkspaces[0].Name)
+				assert.Len(t, workspaceApply.Spec.DependsOn, 1, "Should have VPC dependency")
+				assert.Equal(t, "test-controlplane-vpc", workspaceApply.Spec.DependsOn[0].Name)
+				assert.Len(t, workspaceApply.Spec.VariablesFrom, 3, "Should consume VPC outputs")
+				assert.Equal(t, "test-controlplane-vpc", workspaceApply.Spec.VariablesFrom[0].ValueFrom.OutputRef.Name)
+				assert.Equal(t, "vpc_id", workspaceApply.Spec.VariablesFrom[0].ValueFrom.OutputRef.Output)
 				assert.NotNil(t, workspaceApply.Spec.WriteConnectionSecretToRef)
 			},
 		},
@@ -352,6 +355,7 @@ func TestGenerateWorkspaceTemplateApplySpec(t *testing.T) {
 		name         string
 		controlPlane *controlplanev1beta1.CAPTControlPlane
 		expectedVars map[string]string
+		expectedTags string
 	}{
 		{
 			name: "Generate spec with basic configuration",
@@ -397,6 +401,32 @@ func TestGenerateWorkspaceTemplateApplySpec(t *testing.T) {
 				"endpoint_private_access": "false",
 			},
 		},
+		{
+			name: "Generate spec with additional tags",
+			controlPlane: &controlplanev1beta1.CAPTControlPlane{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test-controlplane",
+				},
+				Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+					Version: "1.21",
+					WorkspaceTemplateRef: controlplanev1beta1.WorkspaceTemplateReference{
+						Name: "test-template",
+					},
+					AdditionalTags: map[string]string{
+						"Environment":           "dev",
+						"kubernetes.io/cluster": "owned",
+					},
+				},
+			},
+			expectedVars: map[string]string{
+				"cluster_name":       "test-controlplane",
+				"kubernetes_version": "1.21",
+				// Deprecated per-tag variables are still rendered
+				"tags_Environment":           "dev",
+				"tags_kubernetes.io/cluster": "owned",
+			},
+			expectedTags: `{"Environment":"dev","kubernetes.io/cluster":"owned"}`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -410,12 +440,18 @@ func TestGenerateWorkspaceTemplateApplySpec(t *testing.T) {
 				Scheme: scheme,
 			}
 
-			spec := r.generateWorkspaceTemplateApplySpec(tt.controlPlane)
+			spec, err := r.generateWorkspaceTemplateApplySpec(tt.controlPlane)
+			assert.NoError(t, err)
 
 			assert.Equal(t, tt.controlPlane.Spec.WorkspaceTemplateRef.Name, spec.TemplateRef.Name)
 			for k, v := range tt.expectedVars {
 				assert.Equal(t, v, spec.Variables[k])
 			}
+			if tt.expectedTags != "" {
+				assert.JSONEq(t, tt.expectedTags, string(spec.StructuredVariables["tags"].Raw))
+			} else {
+				assert.NotContains(t, spec.StructuredVariables, "tags")
+			}
 			assert.NotNil(t, spec.WriteConnectionSecretToRef, "Should have connection secret ref")
 			assert.Equal(t, fmt.Sprintf("%s-eks-connection", tt.controlPlane.Name), spec.WriteConnectionSecretToRef.Name)
 		})
@@ -0,0 +1,154 @@
+// Package identity resolves CAPTClusterIdentities: the ProviderConfig they are backed by,
+// the namespaces allowed to use them and the identity a cluster inherits.
+package identity
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
+)
+
+// RegionEnv is the environment variable the aws provider reads its region from
+const RegionEnv = "AWS_REGION"
+
+// Validate checks that exactly one source of credentials is configured
+func Validate(identity *infrastructurev1beta1.CAPTClusterIdentity) error {
+	hasSecret := identity.Spec.SecretRef != nil
+	hasRole := identity.Spec.RoleARN != ""
+	if hasSecret == hasRole {
+		return fmt.Errorf("exactly one of secretRef and roleARN must be set")
+	}
+	return nil
+}
+
+// ProviderConfigSpec returns the spec of the ProviderConfig backing the identity. The aws
+// provider is configured with the credentials of the identity; its region is left to the
+// AWS_REGION environment variable of each workspace.
+func ProviderConfigSpec(identity *infrastructurev1beta1.CAPTClusterIdentity) tfv1beta1.ProviderConfigSpec {
+	var provider strings.Builder
+	credentials := []tfv1beta1.ProviderCredentials{}
+	provider.WriteString("provider \"aws\" {\n")
+	if identity.Spec.SecretRef != nil {
+		credentials = append(credentials, tfv1beta1.ProviderCredentials{
+			Filename: infrastructurev1beta1.IdentityCredentialsFile,
+			Source:   xpv1.CredentialsSourceSecret,
+			CommonCredentialSelectors: xpv1.CommonCredentialSelectors{
+				SecretRef: identity.Spec.SecretRef.DeepCopy(),
+			},
+		})
+		fmt.Fprintf(&provider, "  shared_credentials_files = [\"${path.module}/%s\"]\n", infrastructurev1beta1.IdentityCredentialsFile)
+	} else {
+		provider.WriteString("  assume_role_with_web_identity {\n")
+		fmt.Fprintf(&provider, "    role_arn                = %q\n", identity.Spec.RoleARN)
+		fmt.Fprintf(&provider, "    web_identity_token_file = %q\n", infrastructurev1beta1.IdentityWebIdentityTokenFile)
+		fmt.Fprintf(&provider, "    session_name            = %q\n", identity.Name)
+		provider.WriteString("  }\n")
+	}
+	provider.WriteString("}\n")
+
+	configuration := provider.String()
+	if identity.Spec.Configuration != "" {
+		configuration = strings.TrimRight(identity.Spec.Configuration, "\n") + "\n" + configuration
+	}
+	return tfv1beta1.ProviderConfigSpec{
+		Credentials:   credentials,
+		Configuration: &configuration,
+	}
+}
+
+// Allowed reports whether the identity may be used from the namespace. Identities without
+// allowed namespaces may not be used at all, while an empty object allows every namespace.
+func Allowed(ctx context.Context, c client.Reader, identity *infrastructurev1beta1.CAPTClusterIdentity, namespace string) (bool, error) {
+	allowed := identity.Spec.AllowedNamespaces
+	if allowed == nil {
+		return false, nil
+	}
+	if len(allowed.List) == 0 && allowed.Selector == nil {
+		return true, nil
+	}
+	if slices.Contains(allowed.List, namespace) {
+		return true, nil
+	}
+	if allowed.Selector == nil {
+		return false, nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(allowed.Selector)
+	if err != nil {
+		return false, fmt.Errorf("invalid namespace selector of CAPTClusterIdentity %s: %w", identity.Name, err)
+	}
+	ns := &corev1.Namespace{}
+	if err := c.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		return false, fmt.Errorf("failed to get namespace %s: %w", namespace, err)
+	}
+	return selector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// ForCluster returns the identityRef of the CAPTCluster backing the named Cluster, which the
+// control plane and machines of the cluster inherit. It returns nil if the Cluster or its
+// CAPTCluster does not exist (yet) or does not reference an identity.
+func ForCluster(ctx context.Context, c client.Reader, namespace, clusterName string) (*infrastructurev1beta1.IdentityReference, error) {
+	if clusterName == "" {
+		return nil, nil
+	}
+	cluster := &clusterv1.Cluster{}
+	if err := c.Get(ctx, types.NamespacedName{Name: clusterName, Namespace: namespace}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get Cluster %s/%s: %w", namespace, clusterName, err)
+	}
+	ref := cluster.Spec.InfrastructureRef
+	if ref == nil || ref.Kind != "CAPTCluster" {
+		return nil, nil
+	}
+
+	captCluster := &infrastructurev1beta1.CAPTCluster{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, captCluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get CAPTCluster %s/%s: %w", namespace, ref.Name, err)
+	}
+	return captCluster.Spec.IdentityRef.DeepCopy(), nil
+}
+
+// Credentials returns the AWS credentials of the named identity for calls made by the manager
+// itself. It returns nil for roleARN identities, whose web identity only provider-terraform
+// holds, and fails if the identity does not allow the namespace.
+func Credentials(ctx context.Context, c client.Reader, name, namespace string) (kubeconfig.CredentialsProvider, error) {
+	identity := &infrastructurev1beta1.CAPTClusterIdentity{}
+	if err := c.Get(ctx, types.NamespacedName{Name: name}, identity); err != nil {
+		return nil, fmt.Errorf("failed to get CAPTClusterIdentity %s: %w", name, err)
+	}
+	allowed, err := Allowed(ctx, c, identity, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, fmt.Errorf("CAPTClusterIdentity %s does not allow namespace %s", name, namespace)
+	}
+	secretRef := identity.Spec.SecretRef
+	if secretRef == nil {
+		return nil, nil
+	}
+	return &kubeconfig.SecretCredentials{
+		Client: c,
+		Secret: types.NamespacedName{Namespace: secretRef.Namespace, Name: secretRef.Name},
+		Key:    secretRef.Key,
+	}, nil
+}
@@ -0,0 +1,155 @@
+package identity
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = infrastructurev1beta1.AddToScheme(scheme)
+	_ = clusterv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	return scheme
+}
+
+func TestValidate(t *testing.T) {
+	identity := &infrastructurev1beta1.CAPTClusterIdentity{}
+	assert.Error(t, Validate(identity))
+
+	identity.Spec.RoleARN = "arn:aws:iam::123456789012:role/capt"
+	assert.NoError(t, Validate(identity))
+
+	identity.Spec.SecretRef = &xpv1.SecretKeySelector{Key: "credentials"}
+	assert.Error(t, Validate(identity))
+}
+
+func TestProviderConfigSpec(t *testing.T) {
+	t.Run("secret", func(t *testing.T) {
+		identity := &infrastructurev1beta1.CAPTClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"},
+			Spec: infrastructurev1beta1.CAPTClusterIdentitySpec{
+				SecretRef: &xpv1.SecretKeySelector{
+					SecretReference: xpv1.SecretReference{Name: "tenant-a-creds", Namespace: "crossplane-system"},
+					Key:             "credentials",
+				},
+				Configuration: "terraform {\n  backend \"kubernetes\" {}\n}\n",
+			},
+		}
+
+		spec := ProviderConfigSpec(identity)
+		require.Len(t, spec.Credentials, 1)
+		assert.Equal(t, "aws-creds.ini", spec.Credentials[0].Filename)
+		assert.Equal(t, xpv1.CredentialsSourceSecret, spec.Credentials[0].Source)
+		assert.Equal(t, "tenant-a-creds", spec.Credentials[0].SecretRef.Name)
+		assert.Equal(t, `terraform {
+  backend "kubernetes" {}
+}
+provider "aws" {
+  shared_credentials_files = ["${path.module}/aws-creds.ini"]
+}
+`, *spec.Configuration)
+	})
+
+	t.Run("role", func(t *testing.T) {
+		identity := &infrastructurev1beta1.CAPTClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "tenant-b"},
+			Spec: infrastructurev1beta1.CAPTClusterIdentitySpec{
+				RoleARN: "arn:aws:iam::123456789012:role/tenant-b",
+			},
+		}
+
+		spec := ProviderConfigSpec(identity)
+		assert.Empty(t, spec.Credentials)
+		assert.Equal(t, `provider "aws" {
+  assume_role_with_web_identity {
+    role_arn                = "arn:aws:iam::123456789012:role/tenant-b"
+    web_identity_token_file = "/var/run/secrets/eks.amazonaws.com/serviceaccount/token"
+    session_name            = "tenant-b"
+  }
+}
+`, *spec.Configuration)
+	})
+}
+
+func TestAllowed(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"tenant": "a"}}}
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(namespace).Build()
+
+	tests := []struct {
+		name     string
+		allowed  *infrastructurev1beta1.AllowedNamespaces
+		expected bool
+	}{
+		{name: "unset allows nothing"},
+		{name: "empty allows everything", allowed: &infrastructurev1beta1.AllowedNamespaces{}, expected: true},
+		{name: "listed", allowed: &infrastructurev1beta1.AllowedNamespaces{List: []string{"team-a"}}, expected: true},
+		{name: "not listed", allowed: &infrastructurev1beta1.AllowedNamespaces{List: []string{"team-b"}}},
+		{
+			name: "matching selector",
+			allowed: &infrastructurev1beta1.AllowedNamespaces{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+			},
+			expected: true,
+		},
+		{
+			name: "other selector",
+			allowed: &infrastructurev1beta1.AllowedNamespaces{
+				List:     []string{"team-b"},
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity := &infrastructurev1beta1.CAPTClusterIdentity{
+				ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"},
+				Spec:       infrastructurev1beta1.CAPTClusterIdentitySpec{AllowedNamespaces: tt.allowed},
+			}
+			allowed, err := Allowed(context.Background(), c, identity, "team-a")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, allowed)
+		})
+	}
+}
+
+func TestForCluster(t *testing.T) {
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo", Namespace: "team-a"},
+		Spec: clusterv1.ClusterSpec{
+			InfrastructureRef: &corev1.ObjectReference{Kind: "CAPTCluster", Name: "demo-infra"},
+		},
+	}
+	captCluster := &infrastructurev1beta1.CAPTCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-infra", Namespace: "team-a"},
+		Spec: infrastructurev1beta1.CAPTClusterSpec{
+			Region:      "ap-northeast-1",
+			IdentityRef: &infrastructurev1beta1.IdentityReference{Name: "tenant-a"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(cluster, captCluster).Build()
+
+	ref, err := ForCluster(context.Background(), c, "team-a", "demo")
+	require.NoError(t, err)
+	assert.Equal(t, &infrastructurev1beta1.IdentityReference{Name: "tenant-a"}, ref)
+
+	ref, err = ForCluster(context.Background(), c, "team-a", "missing")
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+
+	ref, err = ForCluster(context.Background(), c, "team-a", "")
+	require.NoError(t, err)
+	assert.Nil(t, ref)
+}
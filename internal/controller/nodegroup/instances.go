@@ -0,0 +1,171 @@
+// Package nodegroup lists the EC2 instances of EKS managed node groups with presigned EC2
+// DescribeInstances requests, so that node group membership can be followed between applies.
+package nodegroup
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
+)
+
+const (
+	// ec2APIVersion is the version of the EC2 Query API
+	ec2APIVersion = "2016-11-15"
+
+	// presignExpiration is the X-Amz-Expires of the presigned requests
+	presignExpiration = 60 * time.Second
+
+	// maxResults is the page size of DescribeInstances
+	maxResults = 1000
+)
+
+// Instance is an instance of a node group
+type Instance struct {
+	ID               string
+	AvailabilityZone string
+}
+
+// Lister lists the pending and running instances of EKS managed node groups
+type Lister interface {
+	ListInstances(ctx context.Context, credentials kubeconfig.CredentialsProvider, region, clusterName, nodeGroupName string) ([]Instance, error)
+}
+
+// EC2Lister lists node group instances by the eks:cluster-name and eks:nodegroup-name tags EKS
+// puts on them
+type EC2Lister struct {
+	// HTTPClient sends the requests, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Endpoint returns the EC2 endpoint of a region, the regional endpoint if nil
+	Endpoint func(region string) string
+	// Now returns the signing time, time.Now if nil
+	Now func() time.Time
+}
+
+// ListInstances implements Lister
+func (l *EC2Lister) ListInstances(ctx context.Context, credentials kubeconfig.CredentialsProvider, region, clusterName, nodeGroupName string) ([]Instance, error) {
+	signer := kubeconfig.NewSigV4Signer(credentials)
+	var instances []Instance
+	nextToken := ""
+	for {
+		page, err := l.describeInstances(ctx, signer, region, clusterName, nodeGroupName, nextToken)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				instances = append(instances, Instance{ID: instance.ID, AvailabilityZone: instance.AvailabilityZone})
+			}
+		}
+		if page.NextToken == "" {
+			return instances, nil
+		}
+		nextToken = page.NextToken
+	}
+}
+
+// describeInstancesResponse is the part of the DescribeInstances response that is used
+type describeInstancesResponse struct {
+	Reservations []struct {
+		Instances []struct {
+			ID               string `xml:"instanceId"`
+			AvailabilityZone string `xml:"placement>availabilityZone"`
+		} `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+// errorResponse is the error response of the EC2 Query API
+type errorResponse struct {
+	Errors []struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Errors>Error"`
+}
+
+// describeInstances requests a page of the instances of the node group
+func (l *EC2Lister) describeInstances(ctx context.Context, signer kubeconfig.Signer, region, clusterName, nodeGroupName, nextToken string) (*describeInstancesResponse, error) {
+	query := url.Values{}
+	query.Set("Action", "DescribeInstances")
+	query.Set("Version", ec2APIVersion)
+	query.Set("MaxResults", strconv.Itoa(maxResults))
+	for i, filter := range []struct {
+		name   string
+		values []string
+	}{
+		{name: "tag:eks:cluster-name", values: []string{clusterName}},
+		{name: "tag:eks:nodegroup-name", values: []string{nodeGroupName}},
+		{name: "instance-state-name", values: []string{"pending", "running"}},
+	} {
+		prefix := fmt.Sprintf("Filter.%d.", i+1)
+		query.Set(prefix+"Name", filter.name)
+		for j, value := range filter.values {
+			query.Set(fmt.Sprintf("%sValue.%d", prefix, j+1), value)
+		}
+	}
+	if nextToken != "" {
+		query.Set("NextToken", nextToken)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, l.endpoint(region)+"/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DescribeInstances request: %w", err)
+	}
+	now := time.Now()
+	if l.Now != nil {
+		now = l.Now()
+	}
+	presigned, err := signer.Presign(ctx, req, "ec2", region, presignExpiration, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign DescribeInstances request: %w", err)
+	}
+	req, err = http.NewRequestWithContext(ctx, http.MethodGet, presigned, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DescribeInstances request: %w", err)
+	}
+
+	httpClient := l.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DescribeInstances failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DescribeInstances response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr errorResponse
+		if xml.Unmarshal(body, &apiErr) == nil && len(apiErr.Errors) > 0 {
+			return nil, fmt.Errorf("DescribeInstances failed: %s: %s", apiErr.Errors[0].Code, apiErr.Errors[0].Message)
+		}
+		return nil, fmt.Errorf("DescribeInstances failed with status %d", resp.StatusCode)
+	}
+	page := &describeInstancesResponse{}
+	if err := xml.Unmarshal(body, page); err != nil {
+		return nil, fmt.Errorf("invalid DescribeInstances response: %w", err)
+	}
+	return page, nil
+}
+
+// endpoint returns the EC2 endpoint of the region
+func (l *EC2Lister) endpoint(region string) string {
+	if l.Endpoint != nil {
+		return l.Endpoint(region)
+	}
+	if strings.HasPrefix(region, "cn-") {
+		return fmt.Sprintf("https://ec2.%s.amazonaws.com.cn", region)
+	}
+	return fmt.Sprintf("https://ec2.%s.amazonaws.com", region)
+}
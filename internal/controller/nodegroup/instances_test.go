@@ -0,0 +1,93 @@
+package nodegroup
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/appthrust/capt/internal/controller/controlplane/kubeconfig"
+)
+
+// staticCredentials stands in for the credentials of the manager or an identity
+type staticCredentials struct{}
+
+func (staticCredentials) Retrieve(_ context.Context) (kubeconfig.Credentials, error) {
+	return kubeconfig.Credentials{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}, nil
+}
+
+const firstPage = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>i-0aaa</instanceId>
+          <placement><availabilityZone>ap-northeast-1a</availabilityZone></placement>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+  <nextToken>page-2</nextToken>
+</DescribeInstancesResponse>`
+
+const secondPage = `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <reservationSet>
+    <item>
+      <instancesSet>
+        <item>
+          <instanceId>i-0bbb</instanceId>
+          <placement><availabilityZone>ap-northeast-1c</availabilityZone></placement>
+        </item>
+      </instancesSet>
+    </item>
+  </reservationSet>
+</DescribeInstancesResponse>`
+
+func TestEC2ListerListInstances(t *testing.T) {
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		queries = append(queries, query)
+		if query.Get("NextToken") == "page-2" {
+			_, _ = w.Write([]byte(secondPage))
+			return
+		}
+		_, _ = w.Write([]byte(firstPage))
+	}))
+	defer server.Close()
+
+	lister := &EC2Lister{HTTPClient: server.Client(), Endpoint: func(string) string { return server.URL }}
+	instances, err := lister.ListInstances(context.Background(), staticCredentials{}, "ap-northeast-1", "demo-cp", "pool-0")
+	require.NoError(t, err)
+	assert.Equal(t, []Instance{
+		{ID: "i-0aaa", AvailabilityZone: "ap-northeast-1a"},
+		{ID: "i-0bbb", AvailabilityZone: "ap-northeast-1c"},
+	}, instances)
+
+	require.Len(t, queries, 2)
+	query := queries[0]
+	assert.Equal(t, []string{"DescribeInstances"}, query["Action"])
+	assert.Equal(t, []string{"tag:eks:cluster-name"}, query["Filter.1.Name"])
+	assert.Equal(t, []string{"demo-cp"}, query["Filter.1.Value.1"])
+	assert.Equal(t, []string{"tag:eks:nodegroup-name"}, query["Filter.2.Name"])
+	assert.Equal(t, []string{"pool-0"}, query["Filter.2.Value.1"])
+	assert.Contains(t, query["X-Amz-Credential"][0], "AKIAEXAMPLE/")
+	assert.NotEmpty(t, query["X-Amz-Signature"])
+}
+
+func TestEC2ListerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<Response><Errors><Error><Code>UnauthorizedOperation</Code><Message>not allowed</Message></Error></Errors></Response>`))
+	}))
+	defer server.Close()
+
+	lister := &EC2Lister{HTTPClient: server.Client(), Endpoint: func(string) string { return server.URL }}
+	_, err := lister.ListInstances(context.Background(), staticCredentials{}, "ap-northeast-1", "demo-cp", "pool-0")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "UnauthorizedOperation: not allowed")
+}
@@ -0,0 +1,118 @@
+// Package outputs provides typed access to the Terraform outputs of Workspaces
+// and WorkspaceTemplateApplies.
+package outputs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// Get decodes the named output into a value of type T.
+// The boolean result reports whether the output exists.
+func Get[T any](outputs map[string]apiextensionsv1.JSON, name string) (T, bool, error) {
+	var value T
+	raw, ok := outputs[name]
+	if !ok {
+		return value, false, nil
+	}
+	if err := json.Unmarshal(raw.Raw, &value); err != nil {
+		return value, true, fmt.Errorf("failed to decode output %s: %w", name, err)
+	}
+	return value, true, nil
+}
+
+// FromApply looks up an output of a WorkspaceTemplateApply. Non-sensitive outputs are read
+// from its status, sensitive outputs from the Secret they are stored in.
+func FromApply[T any](ctx context.Context, c client.Reader, apply *infrastructurev1beta1.WorkspaceTemplateApply, name string) (T, bool, error) {
+	if value, found, err := Get[T](apply.Status.Outputs, name); found || err != nil {
+		return value, found, err
+	}
+
+	for _, sensitive := range apply.Status.SensitiveOutputs {
+		if sensitive.Name == name {
+			return fromSecret[T](ctx, c, sensitive.SecretKeyRef)
+		}
+	}
+
+	var value T
+	return value, false, nil
+}
+
+// FromWorkspace looks up an output of a Workspace. Outputs missing from the Workspace status,
+// such as sensitive ones, are read from its connection secret if it has one.
+func FromWorkspace[T any](ctx context.Context, c client.Reader, workspace *tfv1beta1.Workspace, name string) (T, bool, error) {
+	if value, found, err := Get[T](workspace.Status.AtProvider.Outputs, name); found || err != nil {
+		return value, found, err
+	}
+
+	ref := workspace.Spec.WriteConnectionSecretToReference
+	if ref == nil {
+		var value T
+		return value, false, nil
+	}
+	return fromSecret[T](ctx, c, xpv1.SecretKeySelector{SecretReference: *ref, Key: name})
+}
+
+// fromSecret reads an output from a Secret key. Terraform string outputs are stored
+// as they are; any other output type is stored as JSON.
+func fromSecret[T any](ctx context.Context, c client.Reader, ref xpv1.SecretKeySelector) (T, bool, error) {
+	var value T
+
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return value, false, nil
+		}
+		return value, false, fmt.Errorf("failed to get secret %s/%s: %w", ref.Namespace, ref.Name, err)
+	}
+
+	data, ok := secret.Data[ref.Key]
+	if !ok {
+		return value, false, nil
+	}
+
+	if str, ok := any(&value).(*string); ok {
+		*str = string(data)
+		return value, true, nil
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, true, fmt.Errorf("failed to decode output %s: %w", ref.Key, err)
+	}
+	return value, true, nil
+}
+
+// Sensitive returns references to the outputs published in the connection secret of a
+// Workspace that are not exposed in its status, which are the sensitive ones.
+func Sensitive(workspace *tfv1beta1.Workspace, secret *corev1.Secret) []infrastructurev1beta1.SensitiveOutput {
+	if secret == nil {
+		return nil
+	}
+
+	var sensitive []infrastructurev1beta1.SensitiveOutput
+	for key := range secret.Data {
+		if _, ok := workspace.Status.AtProvider.Outputs[key]; ok {
+			continue
+		}
+		sensitive = append(sensitive, infrastructurev1beta1.SensitiveOutput{
+			Name: key,
+			SecretKeyRef: xpv1.SecretKeySelector{
+				SecretReference: xpv1.SecretReference{Name: secret.Name, Namespace: secret.Namespace},
+				Key:             key,
+			},
+		})
+	}
+	sort.Slice(sensitive, func(i, j int) bool { return sensitive[i].Name < sensitive[j].Name })
+	return sensitive
+}
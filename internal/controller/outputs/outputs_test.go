@@ -0,0 +1,131 @@
+package outputs
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func testOutputs() map[string]apiextensionsv1.JSON {
+	return map[string]apiextensionsv1.JSON{
+		"vpc_id":          {Raw: []byte(`"vpc-123"`)},
+		"private_subnets": {Raw: []byte(`["subnet-a","subnet-b"]`)},
+		"role_exists":     {Raw: []byte(`true`)},
+		"desired_size":    {Raw: []byte(`3`)},
+	}
+}
+
+func TestGet(t *testing.T) {
+	vpcID, found, err := Get[string](testOutputs(), "vpc_id")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "vpc-123", vpcID)
+
+	subnets, found, err := Get[[]string](testOutputs(), "private_subnets")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"subnet-a", "subnet-b"}, subnets)
+
+	roleExists, found, err := Get[bool](testOutputs(), "role_exists")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, roleExists)
+
+	size, found, err := Get[int](testOutputs(), "desired_size")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 3, size)
+
+	_, found, err = Get[string](testOutputs(), "missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	_, found, err = Get[string](testOutputs(), "private_subnets")
+	assert.Error(t, err, "a list output cannot be read as a string")
+	assert.True(t, found)
+
+	_, found, err = Get[string](nil, "vpc_id")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestFromApplyAndWorkspace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-eks-connection", Namespace: "default"},
+		Data: map[string][]byte{
+			"vpc_id":     []byte("vpc-123"),
+			"kubeconfig": []byte("apiVersion: v1\nkind: Config\n"),
+			"node_roles": []byte(`["role-a","role-b"]`),
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(secret).Build()
+
+	workspace := &tfv1beta1.Workspace{
+		Spec: tfv1beta1.WorkspaceSpec{
+			ResourceSpec: xpv1.ResourceSpec{
+				WriteConnectionSecretToReference: &xpv1.SecretReference{Name: "demo-eks-connection", Namespace: "default"},
+			},
+		},
+		Status: tfv1beta1.WorkspaceStatus{
+			AtProvider: tfv1beta1.WorkspaceObservation{
+				Outputs: map[string]apiextensionsv1.JSON{"vpc_id": {Raw: []byte(`"vpc-123"`)}},
+			},
+		},
+	}
+
+	sensitive := Sensitive(workspace, secret)
+	assert.Len(t, sensitive, 2)
+	assert.Equal(t, "kubeconfig", sensitive[0].Name)
+	assert.Equal(t, "demo-eks-connection", sensitive[0].SecretKeyRef.Name)
+	assert.Equal(t, "kubeconfig", sensitive[0].SecretKeyRef.Key)
+	assert.Equal(t, "node_roles", sensitive[1].Name)
+
+	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		Status: infrastructurev1beta1.WorkspaceTemplateApplyStatus{
+			Outputs:          workspace.Status.AtProvider.Outputs,
+			SensitiveOutputs: sensitive,
+		},
+	}
+
+	vpcID, found, err := FromApply[string](context.Background(), c, apply, "vpc_id")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "vpc-123", vpcID)
+
+	kubeconfig, found, err := FromApply[string](context.Background(), c, apply, "kubeconfig")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "apiVersion: v1\nkind: Config\n", kubeconfig)
+
+	roles, found, err := FromApply[[]string](context.Background(), c, apply, "node_roles")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []string{"role-a", "role-b"}, roles)
+
+	_, found, err = FromApply[string](context.Background(), c, apply, "missing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	kubeconfig, found, err = FromWorkspace[string](context.Background(), c, workspace, "kubeconfig")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "apiVersion: v1\nkind: Config\n", kubeconfig)
+
+	workspace.Spec.WriteConnectionSecretToReference = nil
+	_, found, err = FromWorkspace[string](context.Background(), c, workspace, "kubeconfig")
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
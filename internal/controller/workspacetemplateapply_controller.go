@@ -18,7 +18,10 @@ package controller
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -33,11 +36,15 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	"github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/outputs"
 )
 
 const (
@@ -48,13 +55,18 @@ const (
 	errGetCreds                  = "cannot get credentials"
 	errGetTemplate               = "cannot get WorkspaceTemplate"
 	errCreateWorkspace           = "cannot create Workspace"
+	errUpdateWorkspace           = "cannot update Workspace"
+	errRenderWorkspace           = "cannot render Workspace spec"
 	errWaitingForSecrets         = "waiting for required secrets"
 	errGetWorkspace              = "cannot get Workspace"
 	errWaitingForWorkspace       = "waiting for required workspace"
 	errDeleteWorkspace           = "cannot delete Workspace"
+	errUnresolvedVariables       = "template references unresolved variables"
+	errGetConnectionSecret       = "cannot get Workspace connection secret"
 
 	// Event reasons
 	reasonCreatedWorkspace    = "CreatedWorkspace"
+	reasonUpdatedWorkspace    = "UpdatedWorkspace"
 	reasonRetainedWorkspace   = "RetainedWorkspace"
 	reasonDeletedWorkspace    = "DeletedWorkspace"
 	reasonWaitingForSecrets   = "WaitingForSecrets"
@@ -63,6 +75,11 @@ const (
 	reasonWaitingForReady     = "WaitingForReady"
 	reasonWorkspaceReady      = "WorkspaceReady"
 
+	reasonWaitingForDependencies = "WaitingForDependencies"
+	reasonBlockedByDependents    = "BlockedByDependents"
+	reasonPlannedWorkspace       = "PlannedWorkspace"
+	reasonAwaitingApproval       = "AwaitingApproval"
+
 	// Controller name
 	controllerName = "workspacetemplateapply.infrastructure.cluster.x-k8s.io"
 
@@ -71,13 +88,19 @@ const (
 	requeueAfterStatus = 10 * time.Second
 
 	// Variables
-	workspaceNameVar = "${WORKSPACE_NAME}"
+	workspaceNameVar = "WORKSPACE_NAME"
 
 	// Finalizer
 	workspaceTemplateApplyFinalizer = "infrastructure.cluster.x-k8s.io/finalizer"
 
 	// Suffixes
 	applySuffix = "-apply"
+
+	// maxWorkspaceNameLength leaves room for the plan and drift suffixes in Workspace names
+	maxWorkspaceNameLength = validation.DNS1123SubdomainMaxLength - len(driftWorkspaceSuffix)
+
+	// revisionHashLength is the number of hex characters kept from the rendered spec hash
+	revisionHashLength = 16
 )
 
 // WorkspaceTemplateApplyGroupKind is the group and kind of the WorkspaceTemplateApply resource
@@ -96,11 +119,27 @@ func FindStatusCondition(conditions []xpv1.Condition, conditionType xpv1.Conditi
 	return nil
 }
 
-// generateWorkspaceName generates a consistent workspace name from a WorkspaceTemplateApply name
-func generateWorkspaceName(applyName string) string {
+// generateWorkspaceName generates a consistent workspace name from the namespace and name of a
+// WorkspaceTemplateApply. Workspaces are cluster-scoped, so the namespace is part of the name to
+// keep applies of the same name in different namespaces apart.
+func generateWorkspaceName(namespace, applyName string) string {
 	// Remove "-apply" suffix if present
-	name := strings.TrimSuffix(applyName, applySuffix)
-	return name
+	name := fmt.Sprintf("%s-%s", namespace, strings.TrimSuffix(applyName, applySuffix))
+	if len(name) <= maxWorkspaceNameLength {
+		return name
+	}
+	// Long names are shortened and kept unique with a hash of the full name
+	sum := sha256.Sum256([]byte(name))
+	suffix := "-" + hex.EncodeToString(sum[:])[:8]
+	return strings.TrimRight(name[:maxWorkspaceNameLength-len(suffix)], ".-") + suffix
+}
+
+// workspaceName returns the name of the Workspace of the WorkspaceTemplateApply
+func workspaceName(cr *v1beta1.WorkspaceTemplateApply) string {
+	if cr.Status.WorkspaceName != "" {
+		return cr.Status.WorkspaceName
+	}
+	return generateWorkspaceName(cr.Namespace, cr.Name)
 }
 
 // waitForDependentWorkspaces checks if all dependent workspaces are ready
@@ -167,35 +206,168 @@ func (r *workspaceTemplateApplyReconciler) waitForRequiredSecrets(ctx context.Co
 	return nil
 }
 
-// replaceTemplateVariables replaces template variables with their values
-func replaceTemplateVariables(template *v1beta1.WorkspaceTemplate, cr *v1beta1.WorkspaceTemplateApply) (*v1beta1.WorkspaceTemplate, error) {
+// templateVariables returns the values available to the template: the variables and
+// structured variables of the WorkspaceTemplateApply plus the built-in WORKSPACE_NAME,
+// which cannot be overridden
+func templateVariables(cr *v1beta1.WorkspaceTemplateApply) (map[string]string, error) {
+	values := make(map[string]string, len(cr.Spec.Variables)+len(cr.Spec.StructuredVariables)+1)
+	for key, value := range cr.Spec.Variables {
+		values[key] = value
+	}
+	for key, raw := range cr.Spec.StructuredVariables {
+		value, err := structuredVariableValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode structured variable %q: %w", key, err)
+		}
+		values[key] = value
+	}
+	// WORKSPACE_NAME names namespaced objects such as connection Secrets, so it stays the
+	// namespace-local name of the apply and existing Secrets keep their names
+	values[workspaceNameVar] = strings.TrimSuffix(cr.Name, applySuffix)
+	return values, nil
+}
+
+// replaceTemplateVariables replaces template variables with their values.
+// It returns the rendered template and the names of the variables that could not be resolved.
+func replaceTemplateVariables(template *v1beta1.WorkspaceTemplate, cr *v1beta1.WorkspaceTemplateApply) (*v1beta1.WorkspaceTemplate, []string, error) {
 	// Create a deep copy of the template to avoid modifying the original
 	templateCopy := template.DeepCopy()
 
-	// Convert the template spec to JSON for easier manipulation
 	specJSON, err := json.Marshal(templateCopy.Spec.Template.Spec)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal template spec: %w", err)
+		return nil, nil, fmt.Errorf("failed to marshal template spec: %w", err)
 	}
 
-	// Generate workspace name
-	workspaceName := generateWorkspaceName(cr.Name)
+	values, err := templateVariables(cr)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Replace workspace name variable with the generated name
-	specStr := string(specJSON)
-	specStr = strings.ReplaceAll(specStr, workspaceNameVar, workspaceName)
+	substitution := newVariableSubstitution(values)
+	rendered, err := substitution.SubstituteJSON(specJSON)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	// Replace other variables from cr.Spec.Variables
-	for key, value := range cr.Spec.Variables {
-		specStr = strings.ReplaceAll(specStr, fmt.Sprintf("${%s}", key), value)
+	// Reset the spec so fields dropped by the substitution do not survive the unmarshal
+	templateCopy.Spec.Template.Spec = tfv1beta1.WorkspaceSpec{}
+	if err := json.Unmarshal(rendered, &templateCopy.Spec.Template.Spec); err != nil {
+		return nil, nil, fmt.Errorf("failed to unmarshal template spec: %w", err)
+	}
+
+	return templateCopy, substitution.Unresolved(), nil
+}
+
+// templateNamespace returns the namespace of the referenced WorkspaceTemplate,
+// defaulting to the namespace of the WorkspaceTemplateApply
+func templateNamespace(cr *v1beta1.WorkspaceTemplateApply) string {
+	if cr.Spec.TemplateRef.Namespace != "" {
+		return cr.Spec.TemplateRef.Namespace
+	}
+	return cr.Namespace
+}
+
+// renderWorkspaceSpec renders the Workspace spec for the given template and WorkspaceTemplateApply
+func renderWorkspaceSpec(template *v1beta1.WorkspaceTemplate, cr *v1beta1.WorkspaceTemplateApply) (tfv1beta1.WorkspaceSpec, []string, error) {
+	if err := cr.Spec.ValidateConfiguration(); err != nil {
+		return tfv1beta1.WorkspaceSpec{}, nil, err
 	}
 
-	// Unmarshal back to the template spec
-	if err := json.Unmarshal([]byte(specStr), &templateCopy.Spec.Template.Spec); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal template spec: %w", err)
+	rendered, unresolved, err := replaceTemplateVariables(template, cr)
+	if err != nil {
+		return tfv1beta1.WorkspaceSpec{}, nil, err
+	}
+
+	spec := rendered.Spec.Template.Spec
+
+	// Pass structured variables with their original types through the varmap
+	spec.ForProvider.VarMap, err = mergeVarMap(spec.ForProvider.VarMap, cr.Spec.StructuredVariables)
+	if err != nil {
+		return tfv1beta1.WorkspaceSpec{}, nil, err
+	}
+
+	// Set connection secret if specified
+	if cr.Spec.WriteConnectionSecretToRef != nil {
+		spec.WriteConnectionSecretToReference = cr.Spec.WriteConnectionSecretToRef
+	}
+
+	return spec, unresolved, nil
+}
+
+// variablesResolvedCondition returns the VariablesResolved condition for the given unresolved variables
+func variablesResolvedCondition(unresolved []string) xpv1.Condition {
+	if len(unresolved) > 0 {
+		return xpv1.Condition{
+			Type:               v1beta1.VariablesResolvedCondition,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             v1beta1.ReasonUnresolvedVariables,
+			Message:            fmt.Sprintf("Unresolved variables: %s", strings.Join(unresolved, ", ")),
+		}
+	}
+	return xpv1.Condition{
+		Type:               v1beta1.VariablesResolvedCondition,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             v1beta1.ReasonVariablesResolved,
+	}
+}
+
+// variableSourcesUnavailableCondition returns the VariablesResolved condition for variable
+// sources that are not available yet
+func variableSourcesUnavailableCondition(unavailable []string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               v1beta1.VariablesResolvedCondition,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             v1beta1.ReasonVariableSourcesUnavailable,
+		Message:            fmt.Sprintf("Waiting for variable sources: %s", strings.Join(unavailable, ", ")),
+	}
+}
+
+// setConditions sets the given conditions on the WorkspaceTemplateApply status,
+// replacing existing conditions of the same type
+func setConditions(cr *v1beta1.WorkspaceTemplateApply, conditions ...xpv1.Condition) {
+	status := xpv1.ConditionedStatus{Conditions: cr.Status.Conditions}
+	status.SetConditions(conditions...)
+	cr.Status.Conditions = status.Conditions
+}
+
+// computeRevision returns a stable hash of the rendered Workspace spec and the values of
+// the Secret sources, which only reach the spec through the var file of the revision.
+// Any change to the template, to the variables or to a Secret value results in a different
+// revision.
+func computeRevision(spec tfv1beta1.WorkspaceSpec, secretVariables map[string]string) (string, error) {
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal workspace spec: %w", err)
+	}
+	hash := sha256.New()
+	hash.Write(specJSON)
+	if len(secretVariables) > 0 {
+		valuesJSON, err := json.Marshal(secretVariables)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal secret variables: %w", err)
+		}
+		hash.Write(valuesJSON)
 	}
+	return hex.EncodeToString(hash.Sum(nil))[:revisionHashLength], nil
+}
 
-	return templateCopy, nil
+// recordAppliedRevision records the applied revision on the WorkspaceTemplateApply status
+func recordAppliedRevision(cr *v1beta1.WorkspaceTemplateApply, desired *rendering) {
+	cr.Status.Applied = true
+	cr.Status.LastAppliedRevision = desired.revision
+	cr.Status.ObservedTemplateGeneration = desired.templateGeneration
+	now := metav1.Now()
+	cr.Status.LastAppliedTime = &now
+
+	// An applied revision is no longer planned
+	cr.Status.Plan = nil
+	if cr.Spec.ApplyPolicy != v1beta1.ApplyPolicyAuto && cr.Spec.ApplyPolicy != "" ||
+		FindStatusCondition(cr.Status.Conditions, v1beta1.ApprovedCondition) != nil {
+		setConditions(cr, approvalCondition(cr))
+	}
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=workspacetemplateapplies,verbs=get;list;watch;create;update;patch;delete
@@ -204,18 +376,53 @@ func replaceTemplateVariables(template *v1beta1.WorkspaceTemplate, cr *v1beta1.W
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=workspacetemplates,verbs=get;list;watch
 //+kubebuilder:rbac:groups=tf.upbound.io,resources=workspaces;workspaces/status,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
-//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=controllerrevisions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=captclusteridentities,verbs=get;list;watch
+//+kubebuilder:rbac:groups=tf.upbound.io,resources=providerconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 
 // SetupWorkspaceTemplateApply adds a controller that reconciles WorkspaceTemplateApplies.
 func SetupWorkspaceTemplateApply(mgr ctrl.Manager, l logging.Logger) error {
+	r := &workspaceTemplateApplyReconciler{
+		client: mgr.GetClient(),
+		log:    l,
+		record: event.NewAPIRecorder(mgr.GetEventRecorderFor(controllerName)),
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		Named(controllerName).
 		For(&v1beta1.WorkspaceTemplateApply{}).
-		Complete(&workspaceTemplateApplyReconciler{
-			client: mgr.GetClient(),
-			log:    l,
-			record: event.NewAPIRecorder(mgr.GetEventRecorderFor(controllerName)),
-		})
+		// Wake up dependents and dependencies when an apply of the dependency graph changes
+		Watches(
+			&v1beta1.WorkspaceTemplateApply{},
+			handler.EnqueueRequestsFromMapFunc(r.findAppliesForDependency),
+		).
+		// Re-render applies when the WorkspaceTemplate they reference changes
+		Watches(
+			&v1beta1.WorkspaceTemplate{},
+			handler.EnqueueRequestsFromMapFunc(r.findAppliesForTemplate),
+		).
+		// Re-render applies when one of their variable sources changes
+		Watches(
+			&corev1.Secret{},
+			handler.EnqueueRequestsFromMapFunc(r.findAppliesForSecret),
+		).
+		Watches(
+			&corev1.ConfigMap{},
+			handler.EnqueueRequestsFromMapFunc(r.findAppliesForConfigMap),
+		).
+		Watches(
+			&tfv1beta1.Workspace{},
+			handler.EnqueueRequestsFromMapFunc(r.findAppliesForWorkspaceOutputs),
+		).
+		// Re-render applies when the identity they use changes
+		Watches(
+			&v1beta1.CAPTClusterIdentity{},
+			handler.EnqueueRequestsFromMapFunc(r.findAppliesForIdentity),
+		).
+		Complete(r)
 }
 
 type workspaceTemplateApplyReconciler struct {
@@ -250,18 +457,52 @@ func (r *workspaceTemplateApplyReconciler) Reconcile(ctx context.Context, req ct
 		return ctrl.Result{RequeueAfter: requeueAfterSecret}, nil
 	}
 
-	// Get the referenced WorkspaceTemplate
-	template := &v1beta1.WorkspaceTemplate{}
-	if err := r.client.Get(ctx, types.NamespacedName{
-		Name:      cr.Spec.TemplateRef.Name,
-		Namespace: cr.Spec.TemplateRef.Namespace,
-	}, template); err != nil {
-		log.Debug(errGetTemplate, "error", err)
-		return ctrl.Result{}, err
+	// Check the dependency graph. Broken graphs block any change, while dependencies that
+	// are not ready only hold off the initial apply.
+	if len(cr.Spec.DependsOn) > 0 || FindStatusCondition(cr.Status.Conditions, v1beta1.DependenciesReadyCondition) != nil {
+		condition, err := r.dependenciesCondition(ctx, cr)
+		if err != nil {
+			log.Debug(errListApplies, "error", err)
+			return ctrl.Result{}, err
+		}
+		if condition.Status != corev1.ConditionTrue &&
+			(condition.Reason != v1beta1.ReasonWaitingForDependencies || !cr.Status.Applied) {
+			return r.waitForDependencies(ctx, cr, condition)
+		}
+		setConditions(cr, condition)
 	}
 
-	// If already applied, check workspace status
-	if cr.Status.Applied {
+	// Render the desired workspace spec, or take it from the revision history on rollback
+	var desired *rendering
+	var result ctrl.Result
+	var err error
+	if cr.Spec.RollbackTo != "" {
+		desired, result, err = r.rollbackRendering(ctx, cr)
+	} else {
+		desired, result, err = r.renderApply(ctx, cr)
+	}
+	if desired == nil {
+		return result, err
+	}
+
+	// Only plan the revision if the apply policy does not allow applying it yet
+	if planOnly(cr, desired.revision) {
+		return r.reconcilePlan(ctx, cr, desired)
+	}
+
+	// The plan of a revision is no longer needed once it is applied
+	if cr.Status.Plan != nil {
+		if err := r.deletePlanWorkspace(ctx, cr, planWorkspaceName(cr)); err != nil {
+			log.Debug(errPlanWorkspace, "error", err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// If the workspace exists, propagate changes and check workspace status
+	if cr.Status.WorkspaceName != "" {
+		if !workspaceCurrent(cr, desired.revision) {
+			return r.updateWorkspace(ctx, cr, desired)
+		}
 		return r.reconcileWorkspaceStatus(ctx, cr)
 	}
 
@@ -272,28 +513,23 @@ func (r *workspaceTemplateApplyReconciler) Reconcile(ctx context.Context, req ct
 		}
 	}
 
-	// Generate workspace name
-	workspaceName := generateWorkspaceName(cr.Name)
-
-	// Replace template variables
-	template, err := replaceTemplateVariables(template, cr)
-	if err != nil {
-		log.Debug("Failed to replace template variables", "error", err)
+	// Record the revision before it is applied
+	if err := r.writeVariablesSecret(ctx, cr, desired); err != nil {
+		log.Debug(errWriteVariablesSecret, "error", err)
+		return ctrl.Result{}, err
+	}
+	if err := r.recordRevision(ctx, cr, desired); err != nil {
+		log.Debug(errRecordRevision, "error", err)
 		return ctrl.Result{}, err
 	}
 
 	// Create Workspace from template
 	workspace := &tfv1beta1.Workspace{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      workspaceName,
+			Name:      generateWorkspaceName(cr.Namespace, cr.Name),
 			Namespace: cr.Namespace,
 		},
-		Spec: template.Spec.Template.Spec,
-	}
-
-	// Set connection secret if specified
-	if cr.Spec.WriteConnectionSecretToRef != nil {
-		workspace.Spec.WriteConnectionSecretToReference = cr.Spec.WriteConnectionSecretToRef
+		Spec: desired.spec,
 	}
 
 	if err := r.client.Create(ctx, workspace); err != nil {
@@ -303,9 +539,7 @@ func (r *workspaceTemplateApplyReconciler) Reconcile(ctx context.Context, req ct
 
 	// Update status
 	cr.Status.WorkspaceName = workspace.GetName()
-	cr.Status.Applied = true
-	now := metav1.Now()
-	cr.Status.LastAppliedTime = &now
+	recordAppliedRevision(cr, desired)
 
 	if err := r.client.Status().Update(ctx, cr); err != nil {
 		return ctrl.Result{}, err
@@ -315,10 +549,188 @@ func (r *workspaceTemplateApplyReconciler) Reconcile(ctx context.Context, req ct
 	return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
 }
 
+// renderApply renders the Workspace spec from the referenced WorkspaceTemplate and the
+// variables of the WorkspaceTemplateApply. A nil rendering means the template cannot be
+// rendered yet and the returned result and error should be returned from Reconcile.
+func (r *workspaceTemplateApplyReconciler) renderApply(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (*rendering, ctrl.Result, error) {
+	log := r.log.WithValues("request", cr.Name)
+
+	// Get the referenced WorkspaceTemplate
+	template := &v1beta1.WorkspaceTemplate{}
+	if err := r.client.Get(ctx, types.NamespacedName{
+		Name:      cr.Spec.TemplateRef.Name,
+		Namespace: templateNamespace(cr),
+	}, template); err != nil {
+		log.Debug(errGetTemplate, "error", err)
+		return nil, ctrl.Result{}, err
+	}
+
+	// Resolve variables sourced from other resources
+	resolved, secretVariables, unavailable, err := r.resolveVariableSources(ctx, cr)
+	if err != nil {
+		log.Debug(errResolveVariableSource, "error", err)
+		return nil, ctrl.Result{}, err
+	}
+	if len(unavailable) > 0 {
+		result, err := r.waitForVariables(ctx, cr, variableSourcesUnavailableCondition(unavailable))
+		return nil, result, err
+	}
+
+	// Render the workspace spec and compute its revision
+	workspaceSpec, unresolved, err := renderWorkspaceSpec(template, resolved)
+	if err != nil {
+		log.Debug(errRenderWorkspace, "error", err)
+		return nil, ctrl.Result{}, err
+	}
+	if len(unresolved) > 0 {
+		result, err := r.waitForVariables(ctx, cr, variablesResolvedCondition(secretVariableReferences(cr, unresolved)))
+		return nil, result, err
+	}
+	setConditions(cr, variablesResolvedCondition(nil))
+
+	// ProviderConfigs of identities are only used through identityRef, which checks the allowed namespaces
+	if cr.Spec.IdentityRef == nil {
+		if condition, ok := identityProviderConfigCondition(workspaceSpec); !ok {
+			result, err := r.waitForIdentity(ctx, cr, condition)
+			return nil, result, err
+		}
+	}
+
+	// Use the ProviderConfig of the identity instead of the one of the template
+	if cr.Spec.IdentityRef != nil {
+		providerConfig, condition, err := r.identityCondition(ctx, cr)
+		if err != nil {
+			log.Debug(errGetIdentity, "error", err)
+			return nil, ctrl.Result{}, err
+		}
+		if condition.Status != corev1.ConditionTrue {
+			result, err := r.waitForIdentity(ctx, cr, condition)
+			return nil, result, err
+		}
+		setConditions(cr, condition)
+		applyIdentity(&workspaceSpec, providerConfig, resolved.Spec.Variables["region"])
+	}
+
+	revision, err := computeRevision(workspaceSpec, secretVariables)
+	if err != nil {
+		log.Debug(errRenderWorkspace, "error", err)
+		return nil, ctrl.Result{}, err
+	}
+
+	// Values of Secrets reach Terraform through a var file instead of the Workspace spec. Each
+	// revision has its own var file Secret, which is only written once the revision is planned
+	// or applied, so that a changed Secret goes through the apply policy like any other change.
+	if len(secretVariables) > 0 {
+		workspaceSpec.ForProvider.VarFiles = append(workspaceSpec.ForProvider.VarFiles, variablesVarFile(cr, revision))
+	}
+
+	// The workspace follows the template again once rollbackTo is cleared
+	if FindStatusCondition(cr.Status.Conditions, v1beta1.RolledBackCondition) != nil {
+		setConditions(cr, followingTemplateCondition())
+	}
+
+	return &rendering{
+		spec:                workspaceSpec,
+		revision:            revision,
+		templateGeneration:  template.Generation,
+		variables:           cr.Spec.Variables,
+		structuredVariables: cr.Spec.StructuredVariables,
+		variablesFrom:       cr.Spec.VariablesFrom,
+		secretVariables:     secretVariables,
+	}, ctrl.Result{}, nil
+}
+
+// waitForVariables records variables that cannot be resolved yet and holds off applying the template
+func (r *workspaceTemplateApplyReconciler) waitForVariables(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, condition xpv1.Condition) (ctrl.Result, error) {
+	setConditions(cr, condition)
+	r.log.Debug(errUnresolvedVariables, "request", cr.Name, "reason", condition.Reason, "message", condition.Message)
+	r.record.Event(cr, event.Warning(event.Reason(condition.Reason), errors.New(condition.Message)))
+
+	if err := r.client.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfterSecret}, nil
+}
+
+// updateWorkspace updates an existing Workspace in place with a newly rendered spec to apply it
+func (r *workspaceTemplateApplyReconciler) updateWorkspace(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, desired *rendering) (ctrl.Result, error) {
+	log := r.log.WithValues("request", cr.Name)
+	revision := desired.revision
+
+	// Record the revision before it is applied
+	if err := r.writeVariablesSecret(ctx, cr, desired); err != nil {
+		log.Debug(errWriteVariablesSecret, "error", err)
+		return ctrl.Result{}, err
+	}
+	if err := r.recordRevision(ctx, cr, desired); err != nil {
+		log.Debug(errRecordRevision, "error", err)
+		return ctrl.Result{}, err
+	}
+
+	workspace := &tfv1beta1.Workspace{}
+	if err := r.client.Get(ctx, types.NamespacedName{
+		Name:      cr.Status.WorkspaceName,
+		Namespace: cr.Namespace,
+	}, workspace); err != nil {
+		log.Debug(errGetWorkspace, "error", err)
+		return ctrl.Result{}, err
+	}
+
+	workspace.Spec = desired.spec
+	if err := r.client.Update(ctx, workspace); err != nil {
+		log.Debug(errUpdateWorkspace, "error", err)
+		return ctrl.Result{}, fmt.Errorf("%s: %w", errUpdateWorkspace, err)
+	}
+
+	previous := cr.Status.LastAppliedRevision
+	recordAppliedRevision(cr, desired)
+	if err := r.client.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Updated workspace with new revision", "workspaceName", workspace.Name,
+		"previousRevision", previous, "revision", revision)
+	r.record.Event(cr, event.Normal(reasonUpdatedWorkspace,
+		fmt.Sprintf("Updated workspace %s to revision %s", workspace.Name, revision)))
+	return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
+}
+
+// findAppliesForTemplate maps a WorkspaceTemplate to the WorkspaceTemplateApplies referencing it
+func (r *workspaceTemplateApplyReconciler) findAppliesForTemplate(ctx context.Context, obj client.Object) []reconcile.Request {
+	applies := &v1beta1.WorkspaceTemplateApplyList{}
+	if err := r.client.List(ctx, applies); err != nil {
+		r.log.Debug("Failed to list WorkspaceTemplateApplies", "error", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range applies.Items {
+		apply := &applies.Items[i]
+		if apply.Spec.TemplateRef.Name != obj.GetName() || templateNamespace(apply) != obj.GetNamespace() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{
+				Name:      apply.Name,
+				Namespace: apply.Namespace,
+			},
+		})
+	}
+	return requests
+}
+
 func (r *workspaceTemplateApplyReconciler) reconcileDelete(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (ctrl.Result, error) {
 	log := r.log.WithValues("request", cr.Name)
 	log.Debug("Reconciling deletion")
 
+	// Plans and drift checks never change the infrastructure and are removed first
+	for _, name := range []string{planWorkspaceName(cr), driftWorkspaceName(cr)} {
+		if err := r.deletePlanWorkspace(ctx, cr, name); err != nil {
+			log.Debug(errPlanWorkspace, "error", err)
+			return ctrl.Result{}, err
+		}
+	}
+
 	// If RetainWorkspaceOnDelete is true, remove finalizer and skip workspace deletion
 	if cr.Spec.RetainWorkspaceOnDelete {
 		log.Info("RetainWorkspaceOnDelete is true, skipping workspace deletion",
@@ -332,6 +744,25 @@ func (r *workspaceTemplateApplyReconciler) reconcileDelete(ctx context.Context,
 		return ctrl.Result{}, nil
 	}
 
+	// Keep the workspace while other applies still depend on it. The WorkspaceTemplateApply
+	// watch wakes us once a dependent is gone.
+	if cr.Status.WorkspaceName != "" {
+		dependents, err := r.blockingDependents(ctx, cr)
+		if err != nil {
+			log.Debug(errListApplies, "error", err)
+			return ctrl.Result{}, err
+		}
+		if len(dependents) > 0 {
+			return r.blockDeletion(ctx, cr, blockedByDependentsCondition(dependents))
+		}
+		if FindStatusCondition(cr.Status.Conditions, v1beta1.BlockedByDependentsCondition) != nil {
+			setConditions(cr, blockedByDependentsCondition(nil))
+			if err := r.client.Status().Update(ctx, cr); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
 	// Delete associated workspace if it exists
 	if cr.Status.WorkspaceName != "" {
 		workspace := &tfv1beta1.Workspace{}
@@ -372,18 +803,75 @@ func (r *workspaceTemplateApplyReconciler) reconcileDelete(ctx context.Context,
 	return ctrl.Result{}, nil
 }
 
-func (r *workspaceTemplateApplyReconciler) reconcileWorkspaceStatus(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (ctrl.Result, error) {
+// blockDeletion records the dependents blocking the deletion of the WorkspaceTemplateApply
+func (r *workspaceTemplateApplyReconciler) blockDeletion(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, condition xpv1.Condition) (ctrl.Result, error) {
+	setConditions(cr, condition)
+	r.log.Info("Deletion blocked by dependents", "request", cr.Name, "message", condition.Message)
+	r.record.Event(cr, event.Warning(reasonBlockedByDependents, errors.New(condition.Message)))
+
+	if err := r.client.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfterSecret}, nil
+}
+
+// recordOutputs copies the non-sensitive outputs of the workspace into the status and
+// records references to the sensitive outputs stored in its connection secret
+func (r *workspaceTemplateApplyReconciler) recordOutputs(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, workspace *tfv1beta1.Workspace) error {
+	cr.Status.Outputs = workspace.Status.AtProvider.Outputs
+	cr.Status.SensitiveOutputs = nil
+
+	ref := workspace.Spec.WriteConnectionSecretToReference
+	if ref == nil {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			// The secret is written once the workspace has been applied
+			return nil
+		}
+		return fmt.Errorf("%s: %w", errGetConnectionSecret, err)
+	}
+	cr.Status.SensitiveOutputs = outputs.Sensitive(workspace, secret)
+	return nil
+}
+
+// observeWorkspace copies the conditions and outputs of the applied Workspace to the
+// WorkspaceTemplateApply status and returns the Workspace
+func (r *workspaceTemplateApplyReconciler) observeWorkspace(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (*tfv1beta1.Workspace, error) {
 	workspace := &tfv1beta1.Workspace{}
 	if err := r.client.Get(ctx, types.NamespacedName{
 		Name:      cr.Status.WorkspaceName,
 		Namespace: cr.Namespace,
 	}, workspace); err != nil {
+		return nil, err
+	}
+
+	// Copy conditions from workspace to WorkspaceTemplateApply
+	setConditions(cr, workspace.Status.Conditions...)
+
+	// Expose outputs; sensitive ones only by reference to the connection secret
+	if err := r.recordOutputs(ctx, cr, workspace); err != nil {
+		return nil, err
+	}
+	return workspace, nil
+}
+
+func (r *workspaceTemplateApplyReconciler) reconcileWorkspaceStatus(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (ctrl.Result, error) {
+	workspace, err := r.observeWorkspace(ctx, cr)
+	if err != nil {
 		r.log.Debug(errGetWorkspace, "error", err)
 		return ctrl.Result{}, err
 	}
 
-	// Copy conditions from workspace to WorkspaceTemplateApply
-	cr.Status.Conditions = workspace.Status.Conditions
+	// Check the applied workspace for drift
+	driftRequeue, err := r.reconcileDrift(ctx, cr, workspace)
+	if err != nil {
+		r.log.Debug(errDetectDrift, "error", err)
+		return ctrl.Result{}, err
+	}
 
 	// Update status
 	if err := r.client.Status().Update(ctx, cr); err != nil {
@@ -391,14 +879,14 @@ func (r *workspaceTemplateApplyReconciler) reconcileWorkspaceStatus(ctx context.
 	}
 
 	// Check if workspace is synced
-	syncedCondition := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeSynced)
+	syncedCondition := FindStatusCondition(cr.Status.Conditions, xpv1.TypeSynced)
 	if syncedCondition == nil || syncedCondition.Status != corev1.ConditionTrue {
 		r.record.Event(cr, event.Normal(reasonWaitingForSync, "Waiting for workspace to be synced"))
 		return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
 	}
 
 	// Check if workspace is ready
-	readyCondition := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeReady)
+	readyCondition := FindStatusCondition(cr.Status.Conditions, xpv1.TypeReady)
 	if readyCondition == nil || readyCondition.Status != corev1.ConditionTrue {
 		r.record.Event(cr, event.Normal(reasonWaitingForReady, "Waiting for workspace to be ready"))
 		return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
@@ -406,5 +894,5 @@ func (r *workspaceTemplateApplyReconciler) reconcileWorkspaceStatus(ctx context.
 
 	// Both synced and ready are true
 	r.record.Event(cr, event.Normal(reasonWorkspaceReady, "Workspace is synced and ready"))
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: driftRequeue}, nil
 }
@@ -2,15 +2,21 @@ package controller
 
 import (
 	"context"
+	"strings"
 	"testing"
 
 	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
 	"github.com/crossplane/crossplane-runtime/pkg/event"
 	"github.com/crossplane/crossplane-runtime/pkg/logging"
 	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
 	"github.com/appthrust/capt/api/v1beta1"
@@ -260,3 +266,265 @@ func TestWaitForDependentWorkspaces(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcilePropagatesTemplateChanges(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+	_ = tfv1beta1.SchemeBuilder.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	newTemplate := func(module string) *v1beta1.WorkspaceTemplate {
+		return &v1beta1.WorkspaceTemplate{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "vpc-template",
+				Namespace:  "default",
+				Generation: 2,
+			},
+			Spec: v1beta1.WorkspaceTemplateSpec{
+				Template: v1beta1.WorkspaceTemplateDefinition{
+					Spec: tfv1beta1.WorkspaceSpec{
+						ForProvider: tfv1beta1.WorkspaceParameters{
+							Module: module,
+							Source: tfv1beta1.ModuleSourceInline,
+						},
+					},
+				},
+			},
+		}
+	}
+
+	newApply := func(revision string) *v1beta1.WorkspaceTemplateApply {
+		return &v1beta1.WorkspaceTemplateApply{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "test-vpc",
+				Namespace:  "default",
+				Finalizers: []string{workspaceTemplateApplyFinalizer},
+			},
+			Spec: v1beta1.WorkspaceTemplateApplySpec{
+				TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+				Variables:   map[string]string{"name": "demo"},
+			},
+			Status: v1beta1.WorkspaceTemplateApplyStatus{
+				WorkspaceName:       "test-vpc",
+				Applied:             true,
+				LastAppliedRevision: revision,
+			},
+		}
+	}
+
+	template := newTemplate(`name = "${name}-v2"`)
+	current := newApply("")
+	currentSpec, _, err := renderWorkspaceSpec(template, current)
+	if err != nil {
+		t.Fatalf("renderWorkspaceSpec() error = %v", err)
+	}
+	currentRevision, err := computeRevision(currentSpec, nil)
+	if err != nil {
+		t.Fatalf("computeRevision() error = %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		cr             *v1beta1.WorkspaceTemplateApply
+		expectedModule string
+	}{
+		{
+			name:           "changed template is propagated to the workspace",
+			cr:             newApply("outdated"),
+			expectedModule: `name = "demo-v2"`,
+		},
+		{
+			name:           "unchanged revision leaves the workspace untouched",
+			cr:             newApply(currentRevision),
+			expectedModule: `name = "demo-v1"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workspace := &tfv1beta1.Workspace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "test-vpc",
+					Namespace: "default",
+				},
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{
+						Module: `name = "demo-v1"`,
+						Source: tfv1beta1.ModuleSourceInline,
+					},
+				},
+			}
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tt.cr, newTemplate(`name = "${name}-v2"`), workspace).
+				WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+				Build()
+
+			r := &workspaceTemplateApplyReconciler{
+				client: client,
+				log:    logging.NewNopLogger(),
+				record: event.NewNopRecorder(),
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-vpc", Namespace: "default"}}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			got := &tfv1beta1.Workspace{}
+			if err := client.Get(context.Background(), types.NamespacedName{Name: "test-vpc", Namespace: "default"}, got); err != nil {
+				t.Fatalf("failed to get workspace: %v", err)
+			}
+			if got.Spec.ForProvider.Module != tt.expectedModule {
+				t.Errorf("workspace module = %q, expected %q", got.Spec.ForProvider.Module, tt.expectedModule)
+			}
+
+			apply := &v1beta1.WorkspaceTemplateApply{}
+			if err := client.Get(context.Background(), req.NamespacedName, apply); err != nil {
+				t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+			}
+			if apply.Status.LastAppliedRevision != currentRevision {
+				t.Errorf("LastAppliedRevision = %q, expected %q", apply.Status.LastAppliedRevision, currentRevision)
+			}
+		})
+	}
+}
+
+func TestReconcileWorkspaceStatusRecordsOutputs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+	_ = tfv1beta1.SchemeBuilder.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-eks-apply", Namespace: "default"},
+		Status:     v1beta1.WorkspaceTemplateApplyStatus{WorkspaceName: "demo-eks", Applied: true},
+	}
+	workspace := &tfv1beta1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-eks", Namespace: "default"},
+		Spec: tfv1beta1.WorkspaceSpec{
+			ResourceSpec: xpv1.ResourceSpec{
+				WriteConnectionSecretToReference: &xpv1.SecretReference{Name: "demo-eks-connection", Namespace: "default"},
+			},
+		},
+		Status: tfv1beta1.WorkspaceStatus{
+			AtProvider: tfv1beta1.WorkspaceObservation{
+				Outputs: map[string]apiextensionsv1.JSON{
+					"cluster_endpoint": {Raw: []byte(`"https://example.eks.amazonaws.com"`)},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-eks-connection", Namespace: "default"},
+		Data: map[string][]byte{
+			"cluster_endpoint": []byte("https://example.eks.amazonaws.com"),
+			"kubeconfig":       []byte("apiVersion: v1"),
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(cr, workspace, secret).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+
+	if _, err := r.reconcileWorkspaceStatus(context.Background(), cr); err != nil {
+		t.Fatalf("reconcileWorkspaceStatus() error = %v", err)
+	}
+
+	got := &v1beta1.WorkspaceTemplateApply{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: cr.Name, Namespace: cr.Namespace}, got); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	if string(got.Status.Outputs["cluster_endpoint"].Raw) != `"https://example.eks.amazonaws.com"` {
+		t.Errorf("outputs = %v, expected cluster_endpoint", got.Status.Outputs)
+	}
+	if len(got.Status.SensitiveOutputs) != 1 || got.Status.SensitiveOutputs[0].Name != "kubeconfig" {
+		t.Fatalf("sensitiveOutputs = %+v, expected kubeconfig", got.Status.SensitiveOutputs)
+	}
+	if ref := got.Status.SensitiveOutputs[0].SecretKeyRef; ref.Name != "demo-eks-connection" || ref.Key != "kubeconfig" {
+		t.Errorf("secretKeyRef = %+v, expected demo-eks-connection/kubeconfig", ref)
+	}
+}
+
+func TestReconcileNamesWorkspacesPerNamespace(t *testing.T) {
+	ctx := context.Background()
+	objs := []client.Object{}
+	for _, namespace := range []string{"team-a", "team-b"} {
+		objs = append(objs,
+			&v1beta1.WorkspaceTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "eks-template", Namespace: namespace},
+				Spec: v1beta1.WorkspaceTemplateSpec{
+					Template: v1beta1.WorkspaceTemplateDefinition{
+						Spec: tfv1beta1.WorkspaceSpec{
+							ForProvider: tfv1beta1.WorkspaceParameters{Module: "# eks", Source: tfv1beta1.ModuleSourceInline},
+						},
+					},
+				},
+			},
+			&v1beta1.WorkspaceTemplateApply{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       "demo-eks-controlplane-apply",
+					Namespace:  namespace,
+					Finalizers: []string{workspaceTemplateApplyFinalizer},
+				},
+				Spec: v1beta1.WorkspaceTemplateApplySpec{
+					TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "eks-template"},
+				},
+			},
+		)
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(objs...).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+
+	// Workspaces are cluster-scoped, so the clusters of both namespaces need their own names
+	names := map[string]bool{}
+	for _, namespace := range []string{"team-a", "team-b"} {
+		key := types.NamespacedName{Name: "demo-eks-controlplane-apply", Namespace: namespace}
+		if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		got := &v1beta1.WorkspaceTemplateApply{}
+		if err := c.Get(ctx, key, got); err != nil {
+			t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+		}
+		if expected := namespace + "-demo-eks-controlplane"; got.Status.WorkspaceName != expected {
+			t.Errorf("workspaceName = %q, expected %q", got.Status.WorkspaceName, expected)
+		}
+		names[got.Status.WorkspaceName] = true
+	}
+	if len(names) != 2 {
+		t.Errorf("workspace names = %v, expected one per namespace", names)
+	}
+}
+
+func TestGenerateWorkspaceName(t *testing.T) {
+	if name := generateWorkspaceName("default", "demo-apply"); name != "default-demo" {
+		t.Errorf("generateWorkspaceName() = %q, expected default-demo", name)
+	}
+
+	long := strings.Repeat("a", 250) + "-apply"
+	name := generateWorkspaceName("default", long)
+	if len(name) != maxWorkspaceNameLength {
+		t.Errorf("len(generateWorkspaceName()) = %d, expected %d", len(name), maxWorkspaceNameLength)
+	}
+	if other := generateWorkspaceName("team-a", long); other == name {
+		t.Errorf("expected shortened names of different namespaces to differ, got %q", name)
+	}
+}
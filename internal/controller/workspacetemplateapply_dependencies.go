@@ -0,0 +1,350 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+const (
+	errListApplies = "cannot list WorkspaceTemplateApplies"
+)
+
+// dependencyKey returns the namespaced name of a dependency of the WorkspaceTemplateApply
+func dependencyKey(cr *v1beta1.WorkspaceTemplateApply, ref v1beta1.WorkspaceTemplateApplyReference) types.NamespacedName {
+	return types.NamespacedName{Name: ref.Name, Namespace: sourceNamespace(cr, ref.Namespace)}
+}
+
+// dependencyGraph is the graph of WorkspaceTemplateApplies and the applies they depend on,
+// either through dependsOn or by waiting for the workspace another apply created
+type dependencyGraph struct {
+	nodes map[types.NamespacedName]*v1beta1.WorkspaceTemplateApply
+	edges map[types.NamespacedName][]types.NamespacedName
+}
+
+// newDependencyGraph builds the dependency graph of the given WorkspaceTemplateApplies
+func newDependencyGraph(applies []v1beta1.WorkspaceTemplateApply) *dependencyGraph {
+	g := &dependencyGraph{
+		nodes: make(map[types.NamespacedName]*v1beta1.WorkspaceTemplateApply, len(applies)),
+		edges: make(map[types.NamespacedName][]types.NamespacedName, len(applies)),
+	}
+
+	producers := make(map[types.NamespacedName]types.NamespacedName, len(applies))
+	for i := range applies {
+		apply := &applies[i]
+		key := client.ObjectKeyFromObject(apply)
+		g.nodes[key] = apply
+		if apply.Status.WorkspaceName != "" {
+			producers[types.NamespacedName{Name: apply.Status.WorkspaceName, Namespace: apply.Namespace}] = key
+		}
+	}
+
+	for key, apply := range g.nodes {
+		seen := map[types.NamespacedName]bool{}
+		add := func(dep types.NamespacedName) {
+			if !seen[dep] {
+				seen[dep] = true
+				g.edges[key] = append(g.edges[key], dep)
+			}
+		}
+		for _, ref := range apply.Spec.DependsOn {
+			add(dependencyKey(apply, ref))
+		}
+		for _, ref := range apply.Spec.WaitForWorkspaces {
+			workspace := types.NamespacedName{Name: ref.Name, Namespace: sourceNamespace(apply, ref.Namespace)}
+			if producer, ok := producers[workspace]; ok && producer != key {
+				add(producer)
+			}
+		}
+	}
+	return g
+}
+
+// missing returns the dependencies of the given node that do not exist
+func (g *dependencyGraph) missing(node types.NamespacedName) []types.NamespacedName {
+	var missing []types.NamespacedName
+	for _, dep := range g.edges[node] {
+		if _, ok := g.nodes[dep]; !ok {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+// findCycle returns a cycle reachable from the given node as a path starting and ending
+// with the same node, or nil if there is none
+func (g *dependencyGraph) findCycle(start types.NamespacedName) []types.NamespacedName {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := map[types.NamespacedName]int{}
+	var path []types.NamespacedName
+
+	var visit func(node types.NamespacedName) []types.NamespacedName
+	visit = func(node types.NamespacedName) []types.NamespacedName {
+		state[node] = visiting
+		path = append(path, node)
+		for _, dep := range g.edges[node] {
+			switch state[dep] {
+			case visiting:
+				// Cut the path down to the cycle itself
+				for i, n := range path {
+					if n == dep {
+						cycle := append([]types.NamespacedName{}, path[i:]...)
+						return append(cycle, dep)
+					}
+				}
+			case unvisited:
+				if cycle := visit(dep); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = done
+		return nil
+	}
+	return visit(start)
+}
+
+// reaches returns true if the given node transitively depends on the target
+func (g *dependencyGraph) reaches(node, target types.NamespacedName) bool {
+	visited := map[types.NamespacedName]bool{}
+	queue := []types.NamespacedName{node}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dep := range g.edges[current] {
+			if dep == target {
+				return true
+			}
+			if !visited[dep] {
+				visited[dep] = true
+				queue = append(queue, dep)
+			}
+		}
+	}
+	return false
+}
+
+// dependents returns the nodes that directly depend on the given node, sorted by name
+func (g *dependencyGraph) dependents(node types.NamespacedName) []types.NamespacedName {
+	var dependents []types.NamespacedName
+	for key, deps := range g.edges {
+		for _, dep := range deps {
+			if dep == node {
+				dependents = append(dependents, key)
+				break
+			}
+		}
+	}
+	sort.Slice(dependents, func(i, j int) bool {
+		return dependents[i].String() < dependents[j].String()
+	})
+	return dependents
+}
+
+// joinNames formats namespaced names for condition and event messages
+func joinNames(names []types.NamespacedName, sep string) string {
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = name.String()
+	}
+	return strings.Join(formatted, sep)
+}
+
+// applyReady returns true if the WorkspaceTemplateApply has been applied and its workspace is ready
+func applyReady(apply *v1beta1.WorkspaceTemplateApply) bool {
+	if !apply.Status.Applied || apply.DeletionTimestamp != nil {
+		return false
+	}
+	ready := FindStatusCondition(apply.Status.Conditions, xpv1.TypeReady)
+	return ready != nil && ready.Status == corev1.ConditionTrue
+}
+
+// dependencyGraphFor lists the WorkspaceTemplateApplies of a namespace and builds their
+// dependency graph. Dependencies never cross namespaces.
+func (r *workspaceTemplateApplyReconciler) dependencyGraphFor(ctx context.Context, namespace string) (*dependencyGraph, error) {
+	applies := &v1beta1.WorkspaceTemplateApplyList{}
+	if err := r.client.List(ctx, applies, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("%s: %w", errListApplies, err)
+	}
+	return newDependencyGraph(applies.Items), nil
+}
+
+// dependenciesCondition evaluates the dependencies of the WorkspaceTemplateApply and
+// returns the resulting DependenciesReady condition
+func (r *workspaceTemplateApplyReconciler) dependenciesCondition(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (xpv1.Condition, error) {
+	condition := xpv1.Condition{
+		Type:               v1beta1.DependenciesReadyCondition,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+	}
+	if err := cr.Spec.ValidateDependencyNamespaces(cr.Namespace); err != nil {
+		condition.Reason = v1beta1.ReasonDependencyNamespaceNotAllowed
+		condition.Message = err.Error()
+		return condition, nil
+	}
+
+	graph, err := r.dependencyGraphFor(ctx, cr.Namespace)
+	if err != nil {
+		return xpv1.Condition{}, err
+	}
+
+	key := client.ObjectKeyFromObject(cr)
+	if missing := graph.missing(key); len(missing) > 0 {
+		condition.Reason = v1beta1.ReasonDependencyNotFound
+		condition.Message = fmt.Sprintf("Dependencies not found: %s", joinNames(missing, ", "))
+		return condition, nil
+	}
+	if cycle := graph.findCycle(key); cycle != nil {
+		condition.Reason = v1beta1.ReasonDependencyCycle
+		condition.Message = fmt.Sprintf("Dependency cycle detected: %s", joinNames(cycle, " -> "))
+		return condition, nil
+	}
+
+	var pending []types.NamespacedName
+	for _, ref := range cr.Spec.DependsOn {
+		dep := dependencyKey(cr, ref)
+		if !applyReady(graph.nodes[dep]) {
+			pending = append(pending, dep)
+		}
+	}
+	if len(pending) > 0 {
+		condition.Reason = v1beta1.ReasonWaitingForDependencies
+		condition.Message = fmt.Sprintf("Waiting for dependencies: %s", joinNames(pending, ", "))
+		return condition, nil
+	}
+
+	condition.Status = corev1.ConditionTrue
+	condition.Reason = v1beta1.ReasonDependenciesReady
+	return condition, nil
+}
+
+// waitForDependencies records dependencies that are not satisfied and holds off applying the template.
+// Dependents are woken up by the WorkspaceTemplateApply watch once a dependency changes, so
+// only broken graphs, which may be fixed by editing any apply in the graph, are polled.
+func (r *workspaceTemplateApplyReconciler) waitForDependencies(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, condition xpv1.Condition) (ctrl.Result, error) {
+	setConditions(cr, condition)
+	r.log.Debug("Waiting for dependencies", "request", cr.Name, "reason", condition.Reason, "message", condition.Message)
+
+	result := ctrl.Result{}
+	if condition.Reason == v1beta1.ReasonWaitingForDependencies {
+		r.record.Event(cr, event.Normal(reasonWaitingForDependencies, condition.Message))
+	} else {
+		r.record.Event(cr, event.Warning(event.Reason(condition.Reason), errors.New(condition.Message)))
+		result.RequeueAfter = requeueAfterSecret
+	}
+
+	if err := r.client.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// blockingDependents returns the live WorkspaceTemplateApplies that still depend on the
+// WorkspaceTemplateApply, through dependsOn or waitForWorkspaces. Its workspace must not be
+// destroyed before they are gone, so that a graph is torn down in reverse topological order.
+func (r *workspaceTemplateApplyReconciler) blockingDependents(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) ([]types.NamespacedName, error) {
+	graph, err := r.dependencyGraphFor(ctx, cr.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	key := client.ObjectKeyFromObject(cr)
+	var blocking []types.NamespacedName
+	for _, dependent := range graph.dependents(key) {
+		// Applies being deleted along with us on a cycle have no valid order;
+		// waiting for them would block the deletion forever
+		if graph.nodes[dependent].DeletionTimestamp != nil && graph.reaches(key, dependent) {
+			continue
+		}
+		blocking = append(blocking, dependent)
+	}
+	return blocking, nil
+}
+
+// blockedByDependentsCondition returns the BlockedByDependents condition for the given dependents
+func blockedByDependentsCondition(dependents []types.NamespacedName) xpv1.Condition {
+	if len(dependents) > 0 {
+		return xpv1.Condition{
+			Type:               v1beta1.BlockedByDependentsCondition,
+			Status:             corev1.ConditionTrue,
+			LastTransitionTime: metav1.Now(),
+			Reason:             v1beta1.ReasonDependentsExist,
+			Message:            fmt.Sprintf("Deletion is blocked by dependents: %s", joinNames(dependents, ", ")),
+		}
+	}
+	return xpv1.Condition{
+		Type:               v1beta1.BlockedByDependentsCondition,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             v1beta1.ReasonNoDependents,
+	}
+}
+
+// findAppliesForDependency maps a WorkspaceTemplateApply to the applies related to it in the
+// dependency graph: its dependents, which may be waiting for it to become ready, and its
+// dependencies, whose deletion may be blocked by it
+func (r *workspaceTemplateApplyReconciler) findAppliesForDependency(ctx context.Context, obj client.Object) []reconcile.Request {
+	apply, ok := obj.(*v1beta1.WorkspaceTemplateApply)
+	if !ok {
+		return nil
+	}
+
+	applies := &v1beta1.WorkspaceTemplateApplyList{}
+	if err := r.client.List(ctx, applies, client.InNamespace(apply.Namespace)); err != nil {
+		r.log.Debug(errListApplies, "error", err)
+		return nil
+	}
+
+	// The apply may already be gone from the list; add it to the graph as it was last seen
+	items := []v1beta1.WorkspaceTemplateApply{*apply}
+	for _, item := range applies.Items {
+		if client.ObjectKeyFromObject(&item) != client.ObjectKeyFromObject(apply) {
+			items = append(items, item)
+		}
+	}
+	graph := newDependencyGraph(items)
+
+	key := client.ObjectKeyFromObject(apply)
+	var requests []reconcile.Request
+	for _, dependent := range graph.dependents(key) {
+		requests = append(requests, reconcile.Request{NamespacedName: dependent})
+	}
+	for _, dep := range graph.edges[key] {
+		requests = append(requests, reconcile.Request{NamespacedName: dep})
+	}
+	return requests
+}
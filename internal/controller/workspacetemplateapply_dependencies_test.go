@@ -0,0 +1,274 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func newDependentApply(name string, dependsOn ...string) *v1beta1.WorkspaceTemplateApply {
+	apply := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       name,
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "test-template"},
+		},
+	}
+	for _, dep := range dependsOn {
+		apply.Spec.DependsOn = append(apply.Spec.DependsOn, v1beta1.WorkspaceTemplateApplyReference{Name: dep})
+	}
+	return apply
+}
+
+func newCrossNamespaceDependentApply(name, namespace, dependsOn string) *v1beta1.WorkspaceTemplateApply {
+	apply := newDependentApply(name)
+	apply.Spec.DependsOn = []v1beta1.WorkspaceTemplateApplyReference{{Name: dependsOn, Namespace: namespace}}
+	return apply
+}
+
+func inNamespace(apply *v1beta1.WorkspaceTemplateApply, namespace string) *v1beta1.WorkspaceTemplateApply {
+	apply.Namespace = namespace
+	return apply
+}
+
+func markReady(apply *v1beta1.WorkspaceTemplateApply) *v1beta1.WorkspaceTemplateApply {
+	apply.Status.Applied = true
+	apply.Status.WorkspaceName = generateWorkspaceName(apply.Namespace, apply.Name)
+	apply.Status.Conditions = []xpv1.Condition{xpv1.Available()}
+	return apply
+}
+
+func TestDependencyGraph(t *testing.T) {
+	key := func(name string) types.NamespacedName {
+		return types.NamespacedName{Name: name, Namespace: "default"}
+	}
+	graph := newDependencyGraph([]v1beta1.WorkspaceTemplateApply{
+		*newDependentApply("vpc"),
+		*newDependentApply("eks", "vpc"),
+		*newDependentApply("addons", "eks", "dns"),
+		*newDependentApply("a", "b"),
+		*newDependentApply("b", "c"),
+		*newDependentApply("c", "a"),
+		*newDependentApply("d", "b"),
+	})
+
+	if cycle := graph.findCycle(key("addons")); cycle != nil {
+		t.Errorf("findCycle(addons) = %v, expected none", cycle)
+	}
+	if got, expected := joinNames(graph.findCycle(key("d")), " -> "), "default/b -> default/c -> default/a -> default/b"; got != expected {
+		t.Errorf("findCycle(d) = %q, expected %q", got, expected)
+	}
+	if got, expected := joinNames(graph.missing(key("addons")), ", "), "default/dns"; got != expected {
+		t.Errorf("missing(addons) = %q, expected %q", got, expected)
+	}
+	if got, expected := joinNames(graph.dependents(key("b")), ", "), "default/a, default/d"; got != expected {
+		t.Errorf("dependents(b) = %q, expected %q", got, expected)
+	}
+}
+
+func TestReconcileDependencies(t *testing.T) {
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{Module: "# empty", Source: tfv1beta1.ModuleSourceInline},
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		applies         []client.Object
+		expectedReason  xpv1.ConditionReason
+		expectWorkspace bool
+	}{
+		{
+			name:           "missing dependency",
+			applies:        []client.Object{newDependentApply("eks-apply", "vpc-apply")},
+			expectedReason: v1beta1.ReasonDependencyNotFound,
+		},
+		{
+			name: "dependency cycle",
+			applies: []client.Object{
+				newDependentApply("eks-apply", "vpc-apply"),
+				markReady(newDependentApply("vpc-apply", "eks-apply")),
+			},
+			expectedReason: v1beta1.ReasonDependencyCycle,
+		},
+		{
+			name: "dependency not ready",
+			applies: []client.Object{
+				newDependentApply("eks-apply", "vpc-apply"),
+				newDependentApply("vpc-apply"),
+			},
+			expectedReason: v1beta1.ReasonWaitingForDependencies,
+		},
+		{
+			name: "dependency ready",
+			applies: []client.Object{
+				newDependentApply("eks-apply", "vpc-apply"),
+				markReady(newDependentApply("vpc-apply")),
+			},
+			expectedReason:  v1beta1.ReasonDependenciesReady,
+			expectWorkspace: true,
+		},
+		{
+			name: "dependency in another namespace",
+			applies: []client.Object{
+				newCrossNamespaceDependentApply("eks-apply", "team-b", "vpc-apply"),
+				markReady(inNamespace(newDependentApply("vpc-apply"), "team-b")),
+			},
+			expectedReason: v1beta1.ReasonDependencyNamespaceNotAllowed,
+		},
+		{
+			name: "same name in another namespace",
+			applies: []client.Object{
+				newDependentApply("eks-apply", "vpc-apply"),
+				markReady(inNamespace(newDependentApply("vpc-apply"), "team-b")),
+			},
+			expectedReason: v1beta1.ReasonDependencyNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(newSourcesScheme()).
+				WithObjects(append(tt.applies, template)...).
+				WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+				Build()
+			r := &workspaceTemplateApplyReconciler{
+				client: c,
+				log:    logging.NewNopLogger(),
+				record: event.NewNopRecorder(),
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "eks-apply", Namespace: "default"}}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			got := &v1beta1.WorkspaceTemplateApply{}
+			if err := c.Get(context.Background(), req.NamespacedName, got); err != nil {
+				t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+			}
+			condition := FindStatusCondition(got.Status.Conditions, v1beta1.DependenciesReadyCondition)
+			if condition == nil || condition.Reason != tt.expectedReason {
+				t.Fatalf("DependenciesReady condition = %v, expected reason %s", condition, tt.expectedReason)
+			}
+			if expected := tt.expectedReason == v1beta1.ReasonDependenciesReady; (condition.Status == corev1.ConditionTrue) != expected {
+				t.Errorf("DependenciesReady status = %s, expected ready %v", condition.Status, expected)
+			}
+
+			err := c.Get(context.Background(), types.NamespacedName{Name: "default-eks", Namespace: "default"}, &tfv1beta1.Workspace{})
+			if tt.expectWorkspace && err != nil {
+				t.Errorf("expected workspace to be created: %v", err)
+			}
+			if !tt.expectWorkspace && !apierrors.IsNotFound(err) {
+				t.Errorf("expected no workspace, got error %v", err)
+			}
+		})
+	}
+}
+
+func TestReconcileDeleteBlockedByDependents(t *testing.T) {
+	vpc := markReady(newDependentApply("vpc-apply"))
+	eks := markReady(newDependentApply("eks-apply", "vpc-apply"))
+	kubeconfig := markReady(newDependentApply("kubeconfig-apply"))
+	kubeconfig.Spec.WaitForWorkspaces = []v1beta1.WorkspaceReference{{Name: "default-eks"}}
+	vpcWorkspace := &tfv1beta1.Workspace{ObjectMeta: metav1.ObjectMeta{Name: "default-vpc", Namespace: "default"}}
+	eksWorkspace := &tfv1beta1.Workspace{ObjectMeta: metav1.ObjectMeta{Name: "default-eks", Namespace: "default"}}
+
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(vpc, eks, kubeconfig, vpcWorkspace, eksWorkspace).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+	ctx := context.Background()
+
+	// deleteApply deletes a WorkspaceTemplateApply and reconciles until it is gone or blocked
+	deleteApply := func(apply *v1beta1.WorkspaceTemplateApply) *v1beta1.WorkspaceTemplateApply {
+		t.Helper()
+		if err := c.Delete(ctx, apply); err != nil {
+			t.Fatalf("failed to delete %s: %v", apply.Name, err)
+		}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apply)}
+		for i := 0; i < 2; i++ {
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+		}
+		got := &v1beta1.WorkspaceTemplateApply{}
+		if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			t.Fatalf("failed to get %s: %v", apply.Name, err)
+		}
+		return got
+	}
+
+	// The VPC is kept while the EKS apply depends on it
+	got := deleteApply(vpc)
+	if got == nil {
+		t.Fatalf("expected vpc-apply deletion to be blocked")
+	}
+	condition := FindStatusCondition(got.Status.Conditions, v1beta1.BlockedByDependentsCondition)
+	if condition == nil || condition.Status != corev1.ConditionTrue || condition.Message != "Deletion is blocked by dependents: default/eks-apply" {
+		t.Errorf("BlockedByDependents condition = %v", condition)
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(vpcWorkspace), &tfv1beta1.Workspace{}); err != nil {
+		t.Fatalf("expected vpc workspace to be kept: %v", err)
+	}
+
+	// The EKS apply is kept while the kubeconfig apply waits for its workspace
+	if got := deleteApply(eks); got == nil {
+		t.Fatalf("expected eks-apply deletion to be blocked by waitForWorkspaces")
+	}
+
+	// Deleting the kubeconfig apply wakes up the EKS apply, which in turn unblocks the VPC
+	if got := deleteApply(kubeconfig); got != nil {
+		t.Fatalf("expected kubeconfig-apply to be deleted")
+	}
+	requests := r.findAppliesForDependency(ctx, kubeconfig)
+	if len(requests) != 1 || requests[0].NamespacedName != client.ObjectKeyFromObject(eks) {
+		t.Fatalf("findAppliesForDependency() = %v, expected eks-apply", requests)
+	}
+	for _, apply := range []*v1beta1.WorkspaceTemplateApply{eks, vpc} {
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apply)}
+		for i := 0; i < 2; i++ {
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+		}
+		if err := c.Get(ctx, req.NamespacedName, &v1beta1.WorkspaceTemplateApply{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected %s to be deleted, got %v", apply.Name, err)
+		}
+	}
+	if err := c.Get(ctx, client.ObjectKeyFromObject(vpcWorkspace), &tfv1beta1.Workspace{}); !apierrors.IsNotFound(err) {
+		t.Errorf("expected vpc workspace to be deleted, got %v", err)
+	}
+}
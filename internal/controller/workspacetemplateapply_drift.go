@@ -0,0 +1,318 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+const (
+	errDetectDrift    = "cannot detect drift"
+	errRemediateDrift = "cannot request drift remediation"
+
+	// driftWorkspaceSuffix is appended to the Workspace name to name the Workspace
+	// checking the applied revision for drift
+	driftWorkspaceSuffix = "-drift"
+
+	// driftRevisionAnnotation records the applied revision checked by a drift Workspace
+	driftRevisionAnnotation = "infrastructure.cluster.x-k8s.io/drift-check-revision"
+
+	// remediateDriftAnnotation is set on the applied Workspace to have provider-terraform
+	// reconcile it right away instead of at its next poll
+	remediateDriftAnnotation = "infrastructure.cluster.x-k8s.io/remediate-drift"
+
+	// defaultDriftCheckInterval is the drift check interval used when none is configured
+	defaultDriftCheckInterval = 10 * time.Minute
+
+	// remediationCheckDelay is the time between requesting a remediation and the drift check
+	// verifying it, and between verification attempts whose plan could not complete
+	remediationCheckDelay = time.Minute
+
+	reasonDriftDetected          = "DriftDetected"
+	reasonDriftResolved          = "DriftResolved"
+	reasonRemediatingDrift       = "RemediatingDrift"
+	reasonRemediatedDrift        = "RemediatedDrift"
+	reasonDriftRemediationFailed = "DriftRemediationFailed"
+)
+
+// planSummary matches the summary line of a Terraform plan
+var planSummary = regexp.MustCompile(`Plan: (\d+) to add, (\d+) to change, (\d+) to destroy`)
+
+// driftCheckInterval returns the drift check interval of the WorkspaceTemplateApply
+func driftCheckInterval(cr *v1beta1.WorkspaceTemplateApply) time.Duration {
+	if cr.Spec.DriftDetection.Interval != nil && cr.Spec.DriftDetection.Interval.Duration > 0 {
+		return cr.Spec.DriftDetection.Interval.Duration
+	}
+	return defaultDriftCheckInterval
+}
+
+// driftWorkspaceName returns the name of the Workspace checking the WorkspaceTemplateApply for drift
+func driftWorkspaceName(cr *v1beta1.WorkspaceTemplateApply) string {
+	return workspaceName(cr) + driftWorkspaceSuffix
+}
+
+// updatesAllowed returns true if the management policies of the Workspace let
+// provider-terraform apply changes
+func updatesAllowed(workspace *tfv1beta1.Workspace) bool {
+	policies := workspace.Spec.ManagementPolicies
+	if len(policies) == 0 {
+		return true
+	}
+	for _, policy := range policies {
+		if policy == xpv1.ManagementActionAll || policy == xpv1.ManagementActionUpdate {
+			return true
+		}
+	}
+	return false
+}
+
+// changedResources returns the number of resources with changes reported by a Terraform
+// plan summary in the Workspace conditions. provider-terraform does not report plans in
+// the Workspace status, so this is only known when a condition message carries one.
+func changedResources(workspace *tfv1beta1.Workspace) *int32 {
+	for _, condition := range workspace.Status.Conditions {
+		match := planSummary.FindStringSubmatch(condition.Message)
+		if match == nil {
+			continue
+		}
+		var total int32
+		for _, n := range match[1:] {
+			count, err := strconv.ParseInt(n, 10, 32)
+			if err != nil {
+				return nil
+			}
+			total += int32(count)
+		}
+		return &total
+	}
+	return nil
+}
+
+// remediatingDrift returns true if a remediation of the WorkspaceTemplateApply is waiting
+// to be verified by a drift check
+func remediatingDrift(cr *v1beta1.WorkspaceTemplateApply) bool {
+	drifted := FindStatusCondition(cr.Status.Conditions, v1beta1.DriftedCondition)
+	return drifted != nil && drifted.Status == corev1.ConditionTrue && drifted.Reason == v1beta1.ReasonRemediatingDrift &&
+		cr.Status.Drift != nil && cr.Status.Drift.LastRemediationTime != nil
+}
+
+// driftCondition returns the Drifted condition with the given status and reason
+func driftCondition(status corev1.ConditionStatus, reason xpv1.ConditionReason, message string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               v1beta1.DriftedCondition,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// reconcileDrift runs the drift checks of an applied Workspace and returns when to check again.
+//
+// Each check plans the spec of the applied Workspace in a separate Observe-only Workspace,
+// the same way revisions awaiting approval are planned. provider-terraform marks that
+// Workspace available only when the plan has no changes, i.e. when the infrastructure still
+// matches the applied revision. The applied Workspace is left untouched: provider-terraform
+// keeps applying it according to its management policies.
+func (r *workspaceTemplateApplyReconciler) reconcileDrift(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, applied *tfv1beta1.Workspace) (time.Duration, error) {
+	name := driftWorkspaceName(cr)
+	if cr.Spec.DriftDetection == nil {
+		cr.Status.Drift = nil
+		return 0, r.deletePlanWorkspace(ctx, cr, name)
+	}
+
+	if cr.Status.Drift == nil {
+		cr.Status.Drift = &v1beta1.DriftStatus{}
+	}
+	drift := cr.Status.Drift
+	interval := driftCheckInterval(cr)
+
+	workspace := &tfv1beta1.Workspace{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: cr.Namespace}, workspace)
+	switch {
+	case apierrors.IsNotFound(err):
+		return r.startDriftCheck(ctx, cr, applied, interval)
+
+	case err != nil:
+		return 0, fmt.Errorf("%s: %w", errDetectDrift, err)
+
+	case !workspace.DeletionTimestamp.IsZero():
+		return requeueAfterStatus, nil
+
+	case workspace.Annotations[driftRevisionAnnotation] != cr.Status.LastAppliedRevision:
+		// The check was started for a revision that is no longer applied
+		return requeueAfterStatus, r.deletePlanWorkspace(ctx, cr, name)
+	}
+
+	synced := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeSynced)
+	if synced == nil {
+		// Wait for provider-terraform to plan the Workspace
+		return requeueAfterStatus, nil
+	}
+	if err := r.recordDriftCheck(ctx, cr, applied, workspace); err != nil {
+		return 0, err
+	}
+
+	// The check is complete; the next one plans in a new Workspace
+	if err := r.deletePlanWorkspace(ctx, cr, name); err != nil {
+		return 0, err
+	}
+	if remediatingDrift(cr) {
+		return remediationCheckDelay, nil
+	}
+	if elapsed := time.Since(drift.LastCheckTime.Time); elapsed < interval {
+		return interval - elapsed, nil
+	}
+	return requeueAfterStatus, nil
+}
+
+// startDriftCheck creates the Workspace planning the applied revision once the interval has
+// elapsed since the last check or a new revision has been applied since. A remediation is
+// verified by a check started shortly after it was requested.
+func (r *workspaceTemplateApplyReconciler) startDriftCheck(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, applied *tfv1beta1.Workspace, interval time.Duration) (time.Duration, error) {
+	drift := cr.Status.Drift
+	if remediatingDrift(cr) {
+		// provider-terraform reports a failed apply on the applied Workspace
+		synced := FindStatusCondition(applied.Status.Conditions, xpv1.TypeSynced)
+		if synced != nil && synced.Status != corev1.ConditionTrue {
+			r.remediationFailed(cr, fmt.Sprintf("Re-applying revision %s failed: %s", cr.Status.LastAppliedRevision, synced.Message))
+		}
+	}
+
+	if drift.LastCheckTime != nil && (cr.Status.LastAppliedTime == nil || !drift.LastCheckTime.Before(cr.Status.LastAppliedTime)) {
+		due, since := interval, drift.LastCheckTime.Time
+		if remediatingDrift(cr) {
+			due = remediationCheckDelay
+			if drift.LastRemediationTime.After(since) {
+				since = drift.LastRemediationTime.Time
+			}
+		}
+		if elapsed := time.Since(since); elapsed < due {
+			return due - elapsed, nil
+		}
+	}
+
+	// Changes planned before the applied revision is up to date are not drift
+	ready := FindStatusCondition(applied.Status.Conditions, xpv1.TypeReady)
+	if ready == nil || ready.Status != corev1.ConditionTrue {
+		return requeueAfterStatus, nil
+	}
+
+	workspace := newPlanWorkspace(cr, driftWorkspaceName(cr), applied.Spec)
+	workspace.Annotations[driftRevisionAnnotation] = cr.Status.LastAppliedRevision
+	if err := r.client.Create(ctx, workspace); err != nil {
+		return 0, fmt.Errorf("%s: %w", errDetectDrift, err)
+	}
+	now := metav1.Now()
+	drift.LastCheckTime = &now
+	return requeueAfterStatus, nil
+}
+
+// recordDriftCheck reports the result of a completed drift check on the WorkspaceTemplateApply
+func (r *workspaceTemplateApplyReconciler) recordDriftCheck(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, applied, workspace *tfv1beta1.Workspace) error {
+	synced := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeSynced)
+	ready := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeReady)
+	drifted := FindStatusCondition(cr.Status.Conditions, v1beta1.DriftedCondition)
+	wasDrifted := drifted != nil && drifted.Status == corev1.ConditionTrue
+
+	switch {
+	case synced.Status != corev1.ConditionTrue && strings.Contains(synced.Message, "external resource does not exist"):
+		setConditions(cr, driftCondition(corev1.ConditionUnknown, v1beta1.ReasonDriftCheckFailed,
+			"Terraform state of the applied Workspace is not visible to the drift check; drift detection requires a remote state backend"))
+		return nil
+
+	case synced.Status != corev1.ConditionTrue && remediatingDrift(cr) && time.Since(cr.Status.Drift.LastRemediationTime.Time) < driftCheckInterval(cr):
+		// The plan may conflict with the re-apply it verifies; try again shortly
+		return nil
+
+	case synced.Status != corev1.ConditionTrue:
+		setConditions(cr, driftCondition(corev1.ConditionUnknown, v1beta1.ReasonDriftCheckFailed,
+			fmt.Sprintf("Terraform plan did not complete: %s", synced.Message)))
+		return nil
+
+	case ready != nil && ready.Status == corev1.ConditionTrue:
+		switch {
+		case wasDrifted && drifted.Reason == v1beta1.ReasonRemediatingDrift:
+			r.record.Event(cr, event.Normal(reasonRemediatedDrift, "Drift has been remediated"))
+		case wasDrifted:
+			r.record.Event(cr, event.Normal(reasonDriftResolved, "Workspace matches the applied revision again"))
+		}
+		cr.Status.Drift.ChangedResources = nil
+		setConditions(cr, driftCondition(corev1.ConditionFalse, v1beta1.ReasonNoDrift, ""))
+		return nil
+	}
+
+	now := metav1.Now()
+	cr.Status.Drift.LastDetectedTime = &now
+	cr.Status.Drift.ChangedResources = changedResources(workspace)
+	if wasDrifted && drifted.Reason == v1beta1.ReasonRemediatingDrift {
+		// Remediation is retried at the next check rather than in a loop
+		r.remediationFailed(cr, fmt.Sprintf("Terraform plan still has changes after re-applying revision %s", cr.Status.LastAppliedRevision))
+		return nil
+	}
+
+	message := "Terraform plan of the applied revision has changes"
+	if !wasDrifted {
+		r.record.Event(cr, event.Warning(reasonDriftDetected, errors.New(message)))
+	}
+
+	if !cr.Spec.DriftDetection.AutoRemediate {
+		setConditions(cr, driftCondition(corev1.ConditionTrue, v1beta1.ReasonDriftDetected, message))
+		return nil
+	}
+	if !updatesAllowed(applied) {
+		setConditions(cr, driftCondition(corev1.ConditionTrue, v1beta1.ReasonDriftDetected,
+			message+"; the management policies of the Workspace do not allow updates to remediate it"))
+		return nil
+	}
+
+	// Have provider-terraform re-apply the revision without waiting for its next poll
+	if applied.Annotations == nil {
+		applied.Annotations = map[string]string{}
+	}
+	applied.Annotations[remediateDriftAnnotation] = now.UTC().Format(time.RFC3339)
+	if err := r.client.Update(ctx, applied); err != nil {
+		return fmt.Errorf("%s: %w", errRemediateDrift, err)
+	}
+	cr.Status.Drift.LastRemediationTime = &now
+	r.record.Event(cr, event.Normal(reasonRemediatingDrift,
+		fmt.Sprintf("Re-applying revision %s to remediate drift", cr.Status.LastAppliedRevision)))
+	setConditions(cr, driftCondition(corev1.ConditionTrue, v1beta1.ReasonRemediatingDrift, message))
+	return nil
+}
+
+// remediationFailed reports that re-applying the applied revision did not remove the drift
+func (r *workspaceTemplateApplyReconciler) remediationFailed(cr *v1beta1.WorkspaceTemplateApply, message string) {
+	r.record.Event(cr, event.Warning(reasonDriftRemediationFailed, errors.New(message)))
+	setConditions(cr, driftCondition(corev1.ConditionTrue, v1beta1.ReasonDriftRemediationFailed, message))
+}
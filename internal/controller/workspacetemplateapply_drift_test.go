@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestChangedResources(t *testing.T) {
+	workspace := &tfv1beta1.Workspace{}
+	if got := changedResources(workspace); got != nil {
+		t.Errorf("changedResources() = %d, expected unknown", *got)
+	}
+
+	workspace.Status.SetConditions(xpv1.Unavailable().WithMessage("Plan: 1 to add, 2 to change, 0 to destroy."))
+	if got := changedResources(workspace); got == nil || *got != 3 {
+		t.Errorf("changedResources() = %v, expected 3", got)
+	}
+}
+
+func TestReconcileDriftDetection(t *testing.T) {
+	ctx := context.Background()
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{Module: "# empty", Source: tfv1beta1.ModuleSourceInline},
+				},
+			},
+		},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "demo-apply",
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef:    v1beta1.WorkspaceTemplateReference{Name: "test-template"},
+			DriftDetection: &v1beta1.DriftDetection{Interval: &metav1.Duration{Duration: time.Minute}},
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(template, cr).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}, &tfv1beta1.Workspace{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cr)}
+
+	reconcile := func() *v1beta1.WorkspaceTemplateApply {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		got := &v1beta1.WorkspaceTemplateApply{}
+		if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+			t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+		}
+		return got
+	}
+	getWorkspace := func(name string) *tfv1beta1.Workspace {
+		t.Helper()
+		workspace := &tfv1beta1.Workspace{}
+		if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, workspace); err != nil {
+			t.Fatalf("failed to get workspace %s: %v", name, err)
+		}
+		return workspace
+	}
+	driftWorkspaceExists := func() bool {
+		t.Helper()
+		err := c.Get(ctx, types.NamespacedName{Name: "default-demo-drift", Namespace: "default"}, &tfv1beta1.Workspace{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Fatalf("failed to get drift workspace: %v", err)
+		}
+		return err == nil
+	}
+	// observe simulates provider-terraform observing a workspace
+	observe := func(name string, conditions ...xpv1.Condition) {
+		t.Helper()
+		workspace := getWorkspace(name)
+		workspace.Status.SetConditions(conditions...)
+		if err := c.Status().Update(ctx, workspace); err != nil {
+			t.Fatalf("failed to update workspace status: %v", err)
+		}
+	}
+	// elapse moves the last apply, drift check and remediation beyond the interval
+	elapse := func() {
+		t.Helper()
+		got := &v1beta1.WorkspaceTemplateApply{}
+		if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+			t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+		}
+		applied := metav1.NewTime(got.Status.LastAppliedTime.Add(-2 * time.Minute))
+		checked := metav1.NewTime(got.Status.Drift.LastCheckTime.Add(-2 * time.Minute))
+		got.Status.LastAppliedTime = &applied
+		got.Status.Drift.LastCheckTime = &checked
+		if got.Status.Drift.LastRemediationTime != nil {
+			remediated := metav1.NewTime(got.Status.Drift.LastRemediationTime.Add(-2 * time.Minute))
+			got.Status.Drift.LastRemediationTime = &remediated
+		}
+		if err := c.Status().Update(ctx, got); err != nil {
+			t.Fatalf("failed to update WorkspaceTemplateApply status: %v", err)
+		}
+	}
+	// check runs a drift check whose plan reports the given conditions
+	check := func(conditions ...xpv1.Condition) *v1beta1.WorkspaceTemplateApply {
+		t.Helper()
+		elapse()
+		reconcile()
+		observe("default-demo-drift", conditions...)
+		got := reconcile()
+		if driftWorkspaceExists() {
+			t.Fatalf("expected the drift workspace to be removed once the check is complete")
+		}
+		return got
+	}
+	expectDrifted := func(got *v1beta1.WorkspaceTemplateApply, status corev1.ConditionStatus, reason xpv1.ConditionReason) {
+		t.Helper()
+		condition := FindStatusCondition(got.Status.Conditions, v1beta1.DriftedCondition)
+		if condition == nil || condition.Status != status || condition.Reason != reason {
+			t.Fatalf("Drifted condition = %v, expected %s with reason %s", condition, status, reason)
+		}
+	}
+	expectAppliedUntouched := func() {
+		t.Helper()
+		applied := getWorkspace("default-demo")
+		if len(applied.Spec.ManagementPolicies) != 0 {
+			t.Errorf("workspace management policies = %v, expected the defaults", applied.Spec.ManagementPolicies)
+		}
+		if ready := FindStatusCondition(applied.Status.Conditions, xpv1.TypeReady); ready == nil || ready.Status != corev1.ConditionTrue {
+			t.Errorf("workspace Ready condition = %v, expected provider-terraform's", ready)
+		}
+	}
+
+	reconcile()
+	observe("default-demo", xpv1.ReconcileSuccess(), xpv1.Available())
+
+	// The first check plans the applied spec in an Observe-only workspace
+	got := reconcile()
+	if got.Status.Drift == nil || got.Status.Drift.LastCheckTime == nil {
+		t.Fatalf("expected a drift check to be started, got %+v", got.Status.Drift)
+	}
+	drift := getWorkspace("default-demo-drift")
+	if policies := drift.Spec.ManagementPolicies; len(policies) != 1 || policies[0] != xpv1.ManagementActionObserve {
+		t.Errorf("drift workspace management policies = %v, expected Observe only", policies)
+	}
+	if drift.Annotations[meta.AnnotationKeyExternalName] != "default-demo" || drift.Spec.ForProvider.Module != "# empty" {
+		t.Errorf("expected the drift workspace to plan the applied workspace, got %v", drift)
+	}
+	if drift.Annotations[driftRevisionAnnotation] != got.Status.LastAppliedRevision {
+		t.Errorf("drift workspace revision = %q, expected %q", drift.Annotations[driftRevisionAnnotation], got.Status.LastAppliedRevision)
+	}
+	expectAppliedUntouched()
+
+	observe("default-demo-drift", xpv1.ReconcileSuccess(), xpv1.Available())
+	got = reconcile()
+	expectDrifted(got, corev1.ConditionFalse, v1beta1.ReasonNoDrift)
+	if driftWorkspaceExists() {
+		t.Fatalf("expected the drift workspace to be removed once the check is complete")
+	}
+
+	// No check is started before the interval has elapsed
+	reconcile()
+	if driftWorkspaceExists() {
+		t.Fatalf("expected no drift check before the interval has elapsed")
+	}
+
+	// A plan with changes reports drift without touching the applied workspace
+	got = check(xpv1.ReconcileSuccess(), xpv1.Unavailable().WithMessage("Plan: 1 to add, 2 to change, 0 to destroy."))
+	expectDrifted(got, corev1.ConditionTrue, v1beta1.ReasonDriftDetected)
+	if got.Status.Drift.LastDetectedTime == nil || got.Status.Drift.ChangedResources == nil || *got.Status.Drift.ChangedResources != 3 {
+		t.Errorf("drift status = %+v, expected the detection time and 3 changed resources", got.Status.Drift)
+	}
+	expectAppliedUntouched()
+
+	// Auto-remediation has provider-terraform reconcile the applied workspace right away
+	got.Spec.DriftDetection.AutoRemediate = true
+	if err := c.Update(ctx, got); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	got = check(xpv1.ReconcileSuccess())
+	expectDrifted(got, corev1.ConditionTrue, v1beta1.ReasonRemediatingDrift)
+	if got.Status.Drift.LastRemediationTime == nil || got.Status.Drift.ChangedResources != nil {
+		t.Errorf("drift status = %+v, expected the remediation time and no changed resources", got.Status.Drift)
+	}
+	if _, ok := getWorkspace("default-demo").Annotations[remediateDriftAnnotation]; !ok {
+		t.Errorf("expected the applied workspace to be annotated for remediation")
+	}
+	expectAppliedUntouched()
+
+	// The remediation is verified shortly after it was requested, not at the next interval
+	reconcile()
+	if driftWorkspaceExists() {
+		t.Fatalf("expected no verification before the remediation had time to apply")
+	}
+
+	// Drift that persists after the re-apply is reported instead of remediated in a loop
+	expectDrifted(check(xpv1.ReconcileSuccess()), corev1.ConditionTrue, v1beta1.ReasonDriftRemediationFailed)
+	expectDrifted(check(xpv1.ReconcileSuccess()), corev1.ConditionTrue, v1beta1.ReasonRemediatingDrift)
+	expectDrifted(check(xpv1.ReconcileSuccess(), xpv1.Available()), corev1.ConditionFalse, v1beta1.ReasonNoDrift)
+
+	// A re-apply that provider-terraform could not complete is reported as failed
+	expectDrifted(check(xpv1.ReconcileSuccess()), corev1.ConditionTrue, v1beta1.ReasonRemediatingDrift)
+	observe("default-demo", xpv1.ReconcileError(errors.New("apply failed")), xpv1.Available())
+	elapse()
+	got = reconcile()
+	expectDrifted(got, corev1.ConditionTrue, v1beta1.ReasonDriftRemediationFailed)
+	if condition := FindStatusCondition(got.Status.Conditions, v1beta1.DriftedCondition); !strings.Contains(condition.Message, "apply failed") {
+		t.Errorf("Drifted condition message = %q, expected the apply error", condition.Message)
+	}
+	observe("default-demo", xpv1.ReconcileSuccess(), xpv1.Available())
+	observe("default-demo-drift", xpv1.ReconcileSuccess(), xpv1.Available())
+	expectDrifted(reconcile(), corev1.ConditionFalse, v1beta1.ReasonNoDrift)
+
+	// Checks that cannot plan the applied revision do not report drift
+	expectDrifted(check(xpv1.ReconcileError(errors.New("external resource does not exist"))),
+		corev1.ConditionUnknown, v1beta1.ReasonDriftCheckFailed)
+
+	// Disabling drift detection removes a pending check
+	elapse()
+	reconcile()
+	if !driftWorkspaceExists() {
+		t.Fatalf("expected a drift check to be pending")
+	}
+	got = reconcile()
+	got.Spec.DriftDetection = nil
+	if err := c.Update(ctx, got); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	if got = reconcile(); got.Status.Drift != nil || driftWorkspaceExists() {
+		t.Errorf("expected drift detection to be disabled, got %+v", got.Status.Drift)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
+)
+
+const (
+	errGetIdentity     = "cannot get CAPTClusterIdentity"
+	errIdentityNotUsed = "identity cannot be used"
+)
+
+// identityCondition resolves the identityRef of the WorkspaceTemplateApply. It returns the
+// name of the ProviderConfig of the identity and the IdentityReady condition, which is only
+// true if the identity allows the namespace of the apply and its ProviderConfig exists.
+func (r *workspaceTemplateApplyReconciler) identityCondition(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (string, xpv1.Condition, error) {
+	name := cr.Spec.IdentityRef.Name
+	clusterIdentity := &v1beta1.CAPTClusterIdentity{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: name}, clusterIdentity); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", identityReadyCondition(corev1.ConditionFalse, v1beta1.ReasonIdentityNotFound,
+				fmt.Sprintf("CAPTClusterIdentity %s not found", name)), nil
+		}
+		return "", xpv1.Condition{}, fmt.Errorf("%s: %w", errGetIdentity, err)
+	}
+
+	allowed, err := identity.Allowed(ctx, r.client, clusterIdentity, cr.Namespace)
+	if err != nil {
+		return "", xpv1.Condition{}, err
+	}
+	if !allowed {
+		return "", identityReadyCondition(corev1.ConditionFalse, v1beta1.ReasonNamespaceNotAllowed,
+			fmt.Sprintf("CAPTClusterIdentity %s does not allow namespace %s", name, cr.Namespace)), nil
+	}
+
+	providerConfig := clusterIdentity.Status.ProviderConfigName
+	if providerConfig == "" {
+		return "", identityReadyCondition(corev1.ConditionFalse, v1beta1.ReasonProviderConfigNotReady,
+			fmt.Sprintf("Waiting for the ProviderConfig of CAPTClusterIdentity %s", name)), nil
+	}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: providerConfig}, &tfv1beta1.ProviderConfig{}); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", identityReadyCondition(corev1.ConditionFalse, v1beta1.ReasonProviderConfigNotReady,
+				fmt.Sprintf("ProviderConfig %s of CAPTClusterIdentity %s not found", providerConfig, name)), nil
+		}
+		return "", xpv1.Condition{}, fmt.Errorf("%s: %w", errGetPC, err)
+	}
+
+	return providerConfig, identityReadyCondition(corev1.ConditionTrue, v1beta1.ReasonIdentityReady,
+		fmt.Sprintf("Using ProviderConfig %s of CAPTClusterIdentity %s", providerConfig, name)), nil
+}
+
+// identityProviderConfigCondition checks that a workspace without an identityRef does not name the
+// ProviderConfig of an identity, which would bypass the allowed namespaces of the identity. It
+// returns false and the IdentityReady condition to report if it does.
+func identityProviderConfigCondition(spec tfv1beta1.WorkspaceSpec) (xpv1.Condition, bool) {
+	ref := spec.ProviderConfigReference
+	if ref == nil || !strings.HasPrefix(ref.Name, v1beta1.IdentityProviderConfigPrefix) {
+		return xpv1.Condition{}, true
+	}
+	return identityReadyCondition(corev1.ConditionFalse, v1beta1.ReasonProviderConfigNotAllowed,
+		fmt.Sprintf("ProviderConfig %s belongs to a CAPTClusterIdentity and may only be used through identityRef", ref.Name)), false
+}
+
+// identityReadyCondition returns the IdentityReady condition
+func identityReadyCondition(status corev1.ConditionStatus, reason xpv1.ConditionReason, message string) xpv1.Condition {
+	return xpv1.Condition{
+		Type:               v1beta1.IdentityReadyCondition,
+		Status:             status,
+		LastTransitionTime: metav1.Now(),
+		Reason:             reason,
+		Message:            message,
+	}
+}
+
+// applyIdentity makes the workspace use the ProviderConfig of the identity and passes the
+// region variable, if any, as AWS_REGION to the aws provider the ProviderConfig declares
+func applyIdentity(spec *tfv1beta1.WorkspaceSpec, providerConfig, region string) {
+	spec.ProviderConfigReference = &xpv1.Reference{Name: providerConfig}
+	if region == "" {
+		return
+	}
+	for i := range spec.ForProvider.Env {
+		if spec.ForProvider.Env[i].Name == identity.RegionEnv {
+			spec.ForProvider.Env[i] = tfv1beta1.EnvVar{Name: identity.RegionEnv, Value: region}
+			return
+		}
+	}
+	spec.ForProvider.Env = append(spec.ForProvider.Env, tfv1beta1.EnvVar{Name: identity.RegionEnv, Value: region})
+}
+
+// waitForIdentity records an identity that cannot be used and holds off applying the template
+func (r *workspaceTemplateApplyReconciler) waitForIdentity(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, condition xpv1.Condition) (ctrl.Result, error) {
+	setConditions(cr, condition)
+	r.log.Debug(errIdentityNotUsed, "request", cr.Name, "reason", condition.Reason, "message", condition.Message)
+	r.record.Event(cr, event.Warning(event.Reason(condition.Reason), errors.New(condition.Message)))
+
+	if err := r.client.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: requeueAfterSecret}, nil
+}
+
+// findAppliesForIdentity maps a CAPTClusterIdentity to the WorkspaceTemplateApplies referencing it
+func (r *workspaceTemplateApplyReconciler) findAppliesForIdentity(ctx context.Context, obj client.Object) []reconcile.Request {
+	applies := &v1beta1.WorkspaceTemplateApplyList{}
+	if err := r.client.List(ctx, applies); err != nil {
+		r.log.Debug(errListApplies, "error", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range applies.Items {
+		apply := &applies.Items[i]
+		if apply.Spec.IdentityRef == nil || apply.Spec.IdentityRef.Name != obj.GetName() {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: apply.Name, Namespace: apply.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestReconcileIdentity(t *testing.T) {
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ResourceSpec: xpv1.ResourceSpec{
+						ProviderConfigReference: &xpv1.Reference{Name: "aws-provider-config"},
+					},
+					ForProvider: tfv1beta1.WorkspaceParameters{Module: "# empty", Source: tfv1beta1.ModuleSourceInline},
+				},
+			},
+		},
+	}
+	newIdentity := func(allowed *v1beta1.AllowedNamespaces, providerConfig string) *v1beta1.CAPTClusterIdentity {
+		return &v1beta1.CAPTClusterIdentity{
+			ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"},
+			Spec: v1beta1.CAPTClusterIdentitySpec{
+				AllowedNamespaces: allowed,
+				RoleARN:           "arn:aws:iam::123456789012:role/tenant-a",
+			},
+			Status: v1beta1.CAPTClusterIdentityStatus{ProviderConfigName: providerConfig},
+		}
+	}
+	providerConfig := &tfv1beta1.ProviderConfig{ObjectMeta: metav1.ObjectMeta{Name: "capt-identity-tenant-a"}}
+
+	tests := []struct {
+		name            string
+		objects         []client.Object
+		expectedReason  xpv1.ConditionReason
+		expectWorkspace bool
+	}{
+		{
+			name:           "identity not found",
+			expectedReason: v1beta1.ReasonIdentityNotFound,
+		},
+		{
+			name:           "no allowed namespaces",
+			objects:        []client.Object{newIdentity(nil, providerConfig.Name), providerConfig},
+			expectedReason: v1beta1.ReasonNamespaceNotAllowed,
+		},
+		{
+			name: "namespace not in list",
+			objects: []client.Object{
+				newIdentity(&v1beta1.AllowedNamespaces{List: []string{"tenant-a"}}, providerConfig.Name),
+				providerConfig,
+			},
+			expectedReason: v1beta1.ReasonNamespaceNotAllowed,
+		},
+		{
+			name:           "provider config not created yet",
+			objects:        []client.Object{newIdentity(&v1beta1.AllowedNamespaces{}, "")},
+			expectedReason: v1beta1.ReasonProviderConfigNotReady,
+		},
+		{
+			name: "namespace allowed by selector",
+			objects: []client.Object{
+				newIdentity(&v1beta1.AllowedNamespaces{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"tenant": "a"}},
+				}, providerConfig.Name),
+				providerConfig,
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"tenant": "a"}}},
+			},
+			expectedReason:  v1beta1.ReasonIdentityReady,
+			expectWorkspace: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apply := newDependentApply("vpc-apply")
+			apply.Spec.IdentityRef = &v1beta1.IdentityReference{Name: "tenant-a"}
+			apply.Spec.Variables = map[string]string{"region": "ap-northeast-1"}
+			c := fake.NewClientBuilder().
+				WithScheme(newSourcesScheme()).
+				WithObjects(append(tt.objects, template, apply)...).
+				WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+				Build()
+			r := &workspaceTemplateApplyReconciler{
+				client: c,
+				log:    logging.NewNopLogger(),
+				record: event.NewNopRecorder(),
+			}
+
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "vpc-apply", Namespace: "default"}}
+			if _, err := r.Reconcile(context.Background(), req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			got := &v1beta1.WorkspaceTemplateApply{}
+			if err := c.Get(context.Background(), req.NamespacedName, got); err != nil {
+				t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+			}
+			condition := FindStatusCondition(got.Status.Conditions, v1beta1.IdentityReadyCondition)
+			if condition == nil || condition.Reason != tt.expectedReason {
+				t.Fatalf("IdentityReady condition = %v, expected reason %s", condition, tt.expectedReason)
+			}
+
+			workspace := &tfv1beta1.Workspace{}
+			err := c.Get(context.Background(), types.NamespacedName{Name: "default-vpc", Namespace: "default"}, workspace)
+			if !tt.expectWorkspace {
+				if !apierrors.IsNotFound(err) {
+					t.Errorf("expected no workspace, got error %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected workspace to be created: %v", err)
+			}
+			if ref := workspace.Spec.ProviderConfigReference; ref == nil || ref.Name != providerConfig.Name {
+				t.Errorf("providerConfigRef = %v, expected %s", ref, providerConfig.Name)
+			}
+			if env := workspace.Spec.ForProvider.Env; len(env) != 1 || env[0].Name != "AWS_REGION" || env[0].Value != "ap-northeast-1" {
+				t.Errorf("env = %v, expected AWS_REGION=ap-northeast-1", env)
+			}
+		})
+	}
+}
+
+func TestReconcileRejectsIdentityProviderConfigWithoutIdentityRef(t *testing.T) {
+	// The template names the ProviderConfig of an identity that does not allow the namespace
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ResourceSpec: xpv1.ResourceSpec{
+						ProviderConfigReference: &xpv1.Reference{Name: "${provider_config}"},
+					},
+					ForProvider: tfv1beta1.WorkspaceParameters{Module: "# empty", Source: tfv1beta1.ModuleSourceInline},
+				},
+			},
+		},
+	}
+	apply := newDependentApply("vpc-apply")
+	apply.Spec.Variables = map[string]string{"provider_config": "capt-identity-tenant-a"}
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(template, apply).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "vpc-apply", Namespace: "default"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	got := &v1beta1.WorkspaceTemplateApply{}
+	if err := c.Get(context.Background(), req.NamespacedName, got); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	condition := FindStatusCondition(got.Status.Conditions, v1beta1.IdentityReadyCondition)
+	if condition == nil || condition.Reason != v1beta1.ReasonProviderConfigNotAllowed {
+		t.Fatalf("IdentityReady condition = %v, expected reason %s", condition, v1beta1.ReasonProviderConfigNotAllowed)
+	}
+	err := c.Get(context.Background(), types.NamespacedName{Name: "default-vpc", Namespace: "default"}, &tfv1beta1.Workspace{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected no workspace, got error %v", err)
+	}
+}
+
+func TestApplyIdentity(t *testing.T) {
+	spec := tfv1beta1.WorkspaceSpec{
+		ForProvider: tfv1beta1.WorkspaceParameters{
+			Env: []tfv1beta1.EnvVar{{Name: "TF_LOG", Value: "INFO"}, {Name: "AWS_REGION", Value: "us-east-1"}},
+		},
+	}
+
+	applyIdentity(&spec, "capt-identity-tenant-a", "ap-northeast-1")
+
+	if spec.ProviderConfigReference == nil || spec.ProviderConfigReference.Name != "capt-identity-tenant-a" {
+		t.Errorf("providerConfigRef = %v, expected capt-identity-tenant-a", spec.ProviderConfigReference)
+	}
+	expected := []tfv1beta1.EnvVar{{Name: "TF_LOG", Value: "INFO"}, {Name: "AWS_REGION", Value: "ap-northeast-1"}}
+	if len(spec.ForProvider.Env) != len(expected) || spec.ForProvider.Env[0] != expected[0] || spec.ForProvider.Env[1] != expected[1] {
+		t.Errorf("env = %v, expected %v", spec.ForProvider.Env, expected)
+	}
+}
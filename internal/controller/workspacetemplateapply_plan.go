@@ -0,0 +1,323 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+const (
+	errPlanWorkspace = "cannot reconcile plan Workspace"
+
+	// planWorkspaceSuffix is appended to the Workspace name to name the Workspace planning
+	// revisions that are not applied yet
+	planWorkspaceSuffix = "-plan"
+)
+
+// planOnly returns true if the given revision must only be planned because of the apply policy.
+// A revision that is already applied stays applied under ManualApproval.
+func planOnly(cr *v1beta1.WorkspaceTemplateApply, revision string) bool {
+	switch cr.Spec.ApplyPolicy {
+	case v1beta1.ApplyPolicyPlanOnly:
+		return true
+	case v1beta1.ApplyPolicyManualApproval:
+		if cr.Annotations[v1beta1.ApprovedRevisionAnnotation] == revision {
+			return false
+		}
+		return cr.Status.Plan != nil || cr.Status.LastAppliedRevision != revision
+	default:
+		return false
+	}
+}
+
+// planWorkspaceName returns the name of the Workspace planning revisions of the WorkspaceTemplateApply
+func planWorkspaceName(cr *v1beta1.WorkspaceTemplateApply) string {
+	return workspaceName(cr) + planWorkspaceSuffix
+}
+
+// newPlanWorkspace returns a throwaway Workspace that only plans the given spec.
+// With the Observe-only management policy, provider-terraform runs terraform plan but never
+// applies nor destroys. The external name selects the Terraform workspace of the applied
+// Workspace, so that the plan is made against its state when the ProviderConfig stores the
+// state in a remote backend. The plan Workspace does not publish connection details.
+func newPlanWorkspace(cr *v1beta1.WorkspaceTemplateApply, name string, spec tfv1beta1.WorkspaceSpec) *tfv1beta1.Workspace {
+	spec.ManagementPolicies = xpv1.ManagementPolicies{xpv1.ManagementActionObserve}
+	spec.DeletionPolicy = xpv1.DeletionOrphan
+	spec.WriteConnectionSecretToReference = nil
+	spec.PublishConnectionDetailsTo = nil
+	return &tfv1beta1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   cr.Namespace,
+			Labels:      map[string]string{revisionApplyLabel: cr.Name},
+			Annotations: map[string]string{meta.AnnotationKeyExternalName: workspaceName(cr)},
+		},
+		Spec: spec,
+	}
+}
+
+// workspaceCurrent returns true if the Workspace already reflects the given applied revision
+func workspaceCurrent(cr *v1beta1.WorkspaceTemplateApply, revision string) bool {
+	return cr.Status.Plan == nil && cr.Status.LastAppliedRevision == revision
+}
+
+// reconcilePlan plans a revision that may not be applied yet in a separate Workspace and
+// reports the plan in the status. The applied Workspace keeps the last applied spec and its
+// management policies, so that deleting the WorkspaceTemplateApply while a revision awaits
+// approval still destroys the infrastructure.
+func (r *workspaceTemplateApplyReconciler) reconcilePlan(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, desired *rendering) (ctrl.Result, error) {
+	log := r.log.WithValues("request", cr.Name)
+
+	// Keep reporting the applied Workspace while the revision is planned
+	var applied *tfv1beta1.Workspace
+	if cr.Status.WorkspaceName != "" {
+		workspace, err := r.observeWorkspace(ctx, cr)
+		if err != nil {
+			log.Debug(errGetWorkspace, "error", err)
+			return ctrl.Result{}, err
+		}
+		applied = workspace
+	}
+
+	name := planWorkspaceName(cr)
+	workspace := &tfv1beta1.Workspace{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: cr.Namespace}, workspace)
+	switch {
+	case apierrors.IsNotFound(err):
+		// The plan reads the Secret values of the revision from its var file
+		if err := r.writeVariablesSecret(ctx, cr, desired); err != nil {
+			log.Debug(errWriteVariablesSecret, "error", err)
+			return ctrl.Result{}, err
+		}
+		workspace = newPlanWorkspace(cr, name, desired.spec)
+		if err := r.client.Create(ctx, workspace); err != nil {
+			log.Debug(errPlanWorkspace, "error", err)
+			return ctrl.Result{}, fmt.Errorf("%s: %w", errPlanWorkspace, err)
+		}
+		var changes []string
+		if applied != nil {
+			changes = changedInputs(applied.Spec, desired.spec)
+		}
+		recordPlannedRevision(cr, desired.revision, changes)
+		if err := r.client.Status().Update(ctx, cr); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.record.Event(cr, event.Normal(reasonPlannedWorkspace,
+			fmt.Sprintf("Created workspace %s to plan revision %s", name, desired.revision)))
+		return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
+
+	case err != nil:
+		log.Debug(errPlanWorkspace, "error", err)
+		return ctrl.Result{}, fmt.Errorf("%s: %w", errPlanWorkspace, err)
+
+	case workspace.DeletionTimestamp != nil:
+		// Wait for the plan of the previous revision to be removed
+		return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
+
+	case cr.Status.Plan == nil || cr.Status.Plan.Revision != desired.revision:
+		// The conditions of the plan Workspace belong to another revision, so it is replaced
+		if err := r.deletePlanWorkspace(ctx, cr, name); err != nil {
+			log.Debug(errPlanWorkspace, "error", err)
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: requeueAfterStatus}, nil
+	}
+
+	recordPlan(cr, workspace)
+	setConditions(cr, approvalCondition(cr))
+	if err := r.client.Status().Update(ctx, cr); err != nil {
+		return ctrl.Result{}, err
+	}
+	if cr.Spec.ApplyPolicy == v1beta1.ApplyPolicyManualApproval {
+		r.record.Event(cr, event.Normal(reasonAwaitingApproval, cr.Status.Plan.Summary))
+	}
+	return ctrl.Result{RequeueAfter: requeueAfterSecret}, nil
+}
+
+// deletePlanWorkspace deletes a Workspace that only plans revisions of the WorkspaceTemplateApply.
+// Its Observe-only management policy leaves the infrastructure untouched.
+func (r *workspaceTemplateApplyReconciler) deletePlanWorkspace(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, name string) error {
+	workspace := &tfv1beta1.Workspace{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: cr.Namespace}, workspace); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if !workspace.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	if err := r.client.Delete(ctx, workspace); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("%s: %w", errDeleteWorkspace, err)
+	}
+	return nil
+}
+
+// recordPlannedRevision records a revision submitted for planning on the WorkspaceTemplateApply
+// status together with the inputs it changes
+func recordPlannedRevision(cr *v1beta1.WorkspaceTemplateApply, revision string, changes []string) {
+	now := metav1.Now()
+	cr.Status.Plan = &v1beta1.PlanStatus{
+		Revision:        revision,
+		ChangedInputs:   changes,
+		Summary:         "Waiting for Terraform plan",
+		LastPlannedTime: &now,
+	}
+	setConditions(cr, approvalCondition(cr))
+}
+
+// recordPlan updates the plan summary from the conditions of the plan Workspace.
+// provider-terraform marks the Workspace available when the plan has no changes and
+// reports failures through the Synced condition. An Observe-only Workspace whose
+// Terraform state has no resources is reported as not existing.
+func recordPlan(cr *v1beta1.WorkspaceTemplateApply, workspace *tfv1beta1.Workspace) {
+	synced := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeSynced)
+	ready := FindStatusCondition(workspace.Status.Conditions, xpv1.TypeReady)
+
+	plan := cr.Status.Plan
+	hasChanges := true
+	switch {
+	case synced == nil:
+		plan.HasChanges = nil
+		plan.Summary = "Waiting for Terraform plan"
+	case synced.Status != corev1.ConditionTrue && strings.Contains(synced.Message, "external resource does not exist"):
+		plan.HasChanges = &hasChanges
+		plan.Summary = "Nothing is deployed yet; applying the revision creates the infrastructure"
+	case synced.Status != corev1.ConditionTrue:
+		plan.HasChanges = nil
+		plan.Summary = fmt.Sprintf("Terraform plan did not complete: %s", synced.Message)
+	case ready != nil && ready.Status == corev1.ConditionTrue:
+		hasChanges = false
+		plan.HasChanges = &hasChanges
+		plan.Summary = "No changes. Infrastructure matches the configuration."
+	default:
+		plan.HasChanges = &hasChanges
+		plan.Summary = "Terraform plan has changes to apply"
+		if len(plan.ChangedInputs) > 0 {
+			plan.Summary += fmt.Sprintf("; changed inputs: %s", strings.Join(plan.ChangedInputs, ", "))
+		}
+	}
+}
+
+// changedInputs lists the inputs that differ between the applied and the planned Workspace
+// spec: the module, variables and environment variables by name, and the other parameters
+// by field. Values are left out as they may be sensitive.
+func changedInputs(applied, planned tfv1beta1.WorkspaceSpec) []string {
+	var changes []string
+	a, p := applied.ForProvider, planned.ForProvider
+	if a.Module != p.Module || a.Source != p.Source || a.Entrypoint != p.Entrypoint || a.InlineFormat != p.InlineFormat {
+		changes = append(changes, "module")
+	}
+	changes = append(changes, changedKeys("var.", workspaceVariables(a), workspaceVariables(p))...)
+	changes = append(changes, changedKeys("env.", environmentVariables(a.Env), environmentVariables(p.Env))...)
+	if !reflect.DeepEqual(a.VarFiles, p.VarFiles) {
+		changes = append(changes, "varFiles")
+	}
+	if !reflect.DeepEqual(a.InitArgs, p.InitArgs) || !reflect.DeepEqual(a.PlanArgs, p.PlanArgs) ||
+		!reflect.DeepEqual(a.ApplyArgs, p.ApplyArgs) || !reflect.DeepEqual(a.DestroyArgs, p.DestroyArgs) {
+		changes = append(changes, "args")
+	}
+	if !reflect.DeepEqual(applied.ProviderConfigReference, planned.ProviderConfigReference) {
+		changes = append(changes, "providerConfigRef")
+	}
+	return changes
+}
+
+// workspaceVariables returns the variables of the Workspace parameters, from both the vars
+// and the varmap, encoded as strings for comparison
+func workspaceVariables(params tfv1beta1.WorkspaceParameters) map[string]string {
+	values := make(map[string]string, len(params.Vars))
+	for _, v := range params.Vars {
+		values[v.Key] = v.Value
+	}
+	if params.VarMap != nil {
+		varMap := map[string]json.RawMessage{}
+		if err := json.Unmarshal(params.VarMap.Raw, &varMap); err == nil {
+			for key, raw := range varMap {
+				values[key] = string(raw)
+			}
+		}
+	}
+	return values
+}
+
+// environmentVariables returns the environment variables of the Workspace encoded as
+// strings for comparison
+func environmentVariables(env []tfv1beta1.EnvVar) map[string]string {
+	values := make(map[string]string, len(env))
+	for _, e := range env {
+		encoded, _ := json.Marshal(e)
+		values[e.Name] = string(encoded)
+	}
+	return values
+}
+
+// changedKeys returns the sorted keys that are added, removed or changed between two maps
+func changedKeys(prefix string, applied, planned map[string]string) []string {
+	var keys []string
+	for key, value := range planned {
+		if previous, ok := applied[key]; !ok || previous != value {
+			keys = append(keys, prefix+key)
+		}
+	}
+	for key := range applied {
+		if _, ok := planned[key]; !ok {
+			keys = append(keys, prefix+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// approvalCondition returns the Approved condition for the current revision of the WorkspaceTemplateApply
+func approvalCondition(cr *v1beta1.WorkspaceTemplateApply) xpv1.Condition {
+	condition := xpv1.Condition{
+		Type:               v1beta1.ApprovedCondition,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             v1beta1.ReasonApproved,
+	}
+	if cr.Status.Plan == nil {
+		return condition
+	}
+
+	condition.Status = corev1.ConditionFalse
+	if cr.Spec.ApplyPolicy == v1beta1.ApplyPolicyManualApproval {
+		condition.Reason = v1beta1.ReasonAwaitingApproval
+		condition.Message = fmt.Sprintf("Annotate with %s=%s to apply revision %s",
+			v1beta1.ApprovedRevisionAnnotation, cr.Status.Plan.Revision, cr.Status.Plan.Revision)
+		return condition
+	}
+	condition.Reason = v1beta1.ReasonPlanOnly
+	condition.Message = fmt.Sprintf("Revision %s is only planned", cr.Status.Plan.Revision)
+	return condition
+}
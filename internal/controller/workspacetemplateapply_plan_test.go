@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	"github.com/crossplane/crossplane-runtime/pkg/meta"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestReconcileApplyPolicy(t *testing.T) {
+	ctx := context.Background()
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo-apply", Namespace: "default"}}
+	workspaceKey := types.NamespacedName{Name: "default-demo", Namespace: "default"}
+	planKey := types.NamespacedName{Name: "default-demo-plan", Namespace: "default"}
+
+	setup := func(t *testing.T, policy v1beta1.ApplyPolicy) (*workspaceTemplateApplyReconciler, func() *v1beta1.WorkspaceTemplateApply) {
+		template := &v1beta1.WorkspaceTemplate{
+			ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+			Spec: v1beta1.WorkspaceTemplateSpec{
+				Template: v1beta1.WorkspaceTemplateDefinition{
+					Spec: tfv1beta1.WorkspaceSpec{
+						ForProvider: tfv1beta1.WorkspaceParameters{Module: "# empty", Source: tfv1beta1.ModuleSourceInline},
+					},
+				},
+			},
+		}
+		cr := &v1beta1.WorkspaceTemplateApply{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       req.Name,
+				Namespace:  req.Namespace,
+				Finalizers: []string{workspaceTemplateApplyFinalizer},
+			},
+			Spec: v1beta1.WorkspaceTemplateApplySpec{
+				TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "test-template"},
+				ApplyPolicy: policy,
+			},
+		}
+		c := fake.NewClientBuilder().
+			WithScheme(newSourcesScheme()).
+			WithObjects(template, cr).
+			WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}, &tfv1beta1.Workspace{}).
+			Build()
+		r := &workspaceTemplateApplyReconciler{
+			client: c,
+			log:    logging.NewNopLogger(),
+			record: event.NewNopRecorder(),
+		}
+		get := func() *v1beta1.WorkspaceTemplateApply {
+			t.Helper()
+			if _, err := r.Reconcile(ctx, req); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+			got := &v1beta1.WorkspaceTemplateApply{}
+			if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+				t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+			}
+			return got
+		}
+		return r, get
+	}
+
+	getWorkspace := func(t *testing.T, r *workspaceTemplateApplyReconciler, key types.NamespacedName) *tfv1beta1.Workspace {
+		t.Helper()
+		workspace := &tfv1beta1.Workspace{}
+		if err := r.client.Get(ctx, key, workspace); err != nil {
+			t.Fatalf("failed to get workspace %s: %v", key.Name, err)
+		}
+		return workspace
+	}
+
+	t.Run("plan only", func(t *testing.T) {
+		r, reconcile := setup(t, v1beta1.ApplyPolicyPlanOnly)
+
+		got := reconcile()
+		if got.Status.Plan == nil || got.Status.Plan.Revision == "" {
+			t.Fatalf("expected a planned revision, got %+v", got.Status.Plan)
+		}
+		if got.Status.Applied || got.Status.LastAppliedRevision != "" {
+			t.Errorf("expected the revision not to be applied, got applied=%v revision=%q", got.Status.Applied, got.Status.LastAppliedRevision)
+		}
+		condition := FindStatusCondition(got.Status.Conditions, v1beta1.ApprovedCondition)
+		if condition == nil || condition.Reason != v1beta1.ReasonPlanOnly {
+			t.Errorf("Approved condition = %v, expected reason %s", condition, v1beta1.ReasonPlanOnly)
+		}
+
+		// Nothing is applied, the revision is planned in a separate Workspace
+		if err := r.client.Get(ctx, workspaceKey, &tfv1beta1.Workspace{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected no applied workspace, got error %v", err)
+		}
+		workspace := getWorkspace(t, r, planKey)
+		if len(workspace.Spec.ManagementPolicies) != 1 || workspace.Spec.ManagementPolicies[0] != xpv1.ManagementActionObserve {
+			t.Fatalf("workspace management policies = %v, expected Observe only", workspace.Spec.ManagementPolicies)
+		}
+		if name := meta.GetExternalName(workspace); name != "default-demo" {
+			t.Errorf("external name = %q, expected the Terraform workspace of the applied Workspace", name)
+		}
+
+		// The plan summary follows the workspace conditions
+		workspace.Status.SetConditions(xpv1.ReconcileSuccess())
+		if err := r.client.Status().Update(ctx, workspace); err != nil {
+			t.Fatalf("failed to update workspace status: %v", err)
+		}
+		got = reconcile()
+		if got.Status.Plan.HasChanges == nil || !*got.Status.Plan.HasChanges {
+			t.Errorf("expected the plan to have changes, got %+v", got.Status.Plan)
+		}
+	})
+
+	t.Run("manual approval", func(t *testing.T) {
+		r, reconcile := setup(t, v1beta1.ApplyPolicyManualApproval)
+
+		got := reconcile()
+		if got.Status.Plan == nil {
+			t.Fatalf("expected the revision to be planned before approval")
+		}
+		revision := got.Status.Plan.Revision
+		condition := FindStatusCondition(got.Status.Conditions, v1beta1.ApprovedCondition)
+		if condition == nil || condition.Reason != v1beta1.ReasonAwaitingApproval {
+			t.Errorf("Approved condition = %v, expected reason %s", condition, v1beta1.ReasonAwaitingApproval)
+		}
+
+		// Approving another revision does not apply anything
+		got.Annotations = map[string]string{v1beta1.ApprovedRevisionAnnotation: "0000000000000000"}
+		if err := r.client.Update(ctx, got); err != nil {
+			t.Fatalf("failed to annotate: %v", err)
+		}
+		if got = reconcile(); got.Status.Applied {
+			t.Fatalf("expected a mismatching approval to be ignored")
+		}
+
+		got.Annotations[v1beta1.ApprovedRevisionAnnotation] = revision
+		if err := r.client.Update(ctx, got); err != nil {
+			t.Fatalf("failed to annotate: %v", err)
+		}
+		got = reconcile()
+		if !got.Status.Applied || got.Status.LastAppliedRevision != revision || got.Status.Plan != nil {
+			t.Errorf("expected revision %s to be applied, got %+v", revision, got.Status)
+		}
+		condition = FindStatusCondition(got.Status.Conditions, v1beta1.ApprovedCondition)
+		if condition == nil || condition.Status != corev1.ConditionTrue {
+			t.Errorf("Approved condition = %v, expected True", condition)
+		}
+		if policies := getWorkspace(t, r, workspaceKey).Spec.ManagementPolicies; len(policies) != 0 {
+			t.Errorf("workspace management policies = %v, expected the default", policies)
+		}
+		if err := r.client.Get(ctx, planKey, &tfv1beta1.Workspace{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the plan workspace to be deleted, got error %v", err)
+		}
+	})
+
+	t.Run("pending approval keeps the applied workspace", func(t *testing.T) {
+		r, reconcile := setup(t, v1beta1.ApplyPolicyManualApproval)
+
+		// Approve and apply the first revision
+		got := reconcile()
+		got.Annotations = map[string]string{v1beta1.ApprovedRevisionAnnotation: got.Status.Plan.Revision}
+		if err := r.client.Update(ctx, got); err != nil {
+			t.Fatalf("failed to annotate: %v", err)
+		}
+		got = reconcile()
+		applied := getWorkspace(t, r, workspaceKey)
+
+		// A template change is planned without touching the applied workspace
+		template := &v1beta1.WorkspaceTemplate{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: "test-template", Namespace: "default"}, template); err != nil {
+			t.Fatalf("failed to get template: %v", err)
+		}
+		template.Spec.Template.Spec.ForProvider.Module = "# changed"
+		if err := r.client.Update(ctx, template); err != nil {
+			t.Fatalf("failed to update template: %v", err)
+		}
+		got = reconcile()
+		if got.Status.Plan == nil || got.Status.Plan.Revision == got.Status.LastAppliedRevision {
+			t.Fatalf("expected a new revision to be planned, got %+v", got.Status.Plan)
+		}
+		if changes := got.Status.Plan.ChangedInputs; len(changes) != 1 || changes[0] != "module" {
+			t.Errorf("changedInputs = %v, expected [module]", changes)
+		}
+		workspace := getWorkspace(t, r, workspaceKey)
+		if workspace.Spec.ForProvider.Module != applied.Spec.ForProvider.Module || len(workspace.Spec.ManagementPolicies) != 0 {
+			t.Errorf("applied workspace changed while awaiting approval: %+v", workspace.Spec)
+		}
+		if plan := getWorkspace(t, r, planKey); plan.Spec.ForProvider.Module != "# changed" {
+			t.Errorf("plan workspace module = %q, expected the planned revision", plan.Spec.ForProvider.Module)
+		}
+
+		// Deleting the apply destroys the applied infrastructure and drops the plan
+		if err := r.client.Delete(ctx, got); err != nil {
+			t.Fatalf("failed to delete: %v", err)
+		}
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		if err := r.client.Get(ctx, planKey, &tfv1beta1.Workspace{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the plan workspace to be deleted, got error %v", err)
+		}
+		if err := r.client.Get(ctx, workspaceKey, &tfv1beta1.Workspace{}); !apierrors.IsNotFound(err) {
+			t.Errorf("expected the applied workspace to be deleted, got error %v", err)
+		}
+	})
+}
+
+func TestChangedInputs(t *testing.T) {
+	applied := tfv1beta1.WorkspaceSpec{
+		ForProvider: tfv1beta1.WorkspaceParameters{
+			Module: "# module",
+			Vars:   []tfv1beta1.Var{{Key: "region", Value: "ap-northeast-1"}, {Key: "name", Value: "demo"}},
+			VarMap: &runtime.RawExtension{Raw: []byte(`{"tags":{"team":"a"}}`)},
+			Env:    []tfv1beta1.EnvVar{{Name: "AWS_REGION", Value: "ap-northeast-1"}},
+		},
+	}
+	planned := applied.DeepCopy()
+	planned.ForProvider.Vars = []tfv1beta1.Var{{Key: "region", Value: "us-west-2"}, {Key: "size", Value: "2"}}
+	planned.ForProvider.VarMap = &runtime.RawExtension{Raw: []byte(`{"tags":{"team":"b"}}`)}
+
+	expected := []string{"var.name", "var.region", "var.size", "var.tags"}
+	if got := changedInputs(applied, *planned); strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("changedInputs() = %v, expected %v", got, expected)
+	}
+	if got := changedInputs(applied, applied); len(got) != 0 {
+		t.Errorf("changedInputs() = %v, expected no changes", got)
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+const (
+	errRecordRevision = "cannot record revision"
+	errGetRevision    = "cannot get revision"
+	errPruneRevisions = "cannot prune revision history"
+
+	// revisionApplyLabel labels the revisions of a WorkspaceTemplateApply with its name
+	revisionApplyLabel = "infrastructure.cluster.x-k8s.io/workspacetemplateapply"
+
+	// defaultRevisionHistoryLimit is the number of previous revisions kept by default
+	defaultRevisionHistoryLimit = 10
+
+	reasonRolledBack = "RolledBack"
+)
+
+// rendering is a rendered Workspace spec together with what it was rendered from.
+// Variables sourced from other resources are kept as references so that values of
+// Secrets are never stored in the revision history.
+type rendering struct {
+	spec                tfv1beta1.WorkspaceSpec
+	revision            string
+	templateGeneration  int64
+	variables           map[string]string
+	structuredVariables map[string]apiextensionsv1.JSON
+	variablesFrom       []v1beta1.VariableFrom
+	// secretVariables are the values of the Secret sources, written to the var file Secret of
+	// the revision. They are empty for stored revisions, whose var file Secret already exists.
+	secretVariables map[string]string
+}
+
+// revisionData is the content of a stored revision
+type revisionData struct {
+	WorkspaceSpec       tfv1beta1.WorkspaceSpec         `json:"workspaceSpec"`
+	TemplateGeneration  int64                           `json:"templateGeneration,omitempty"`
+	Variables           map[string]string               `json:"variables,omitempty"`
+	StructuredVariables map[string]apiextensionsv1.JSON `json:"structuredVariables,omitempty"`
+	VariablesFrom       []v1beta1.VariableFrom          `json:"variablesFrom,omitempty"`
+}
+
+// revisionName returns the name of the ControllerRevision storing the given revision
+func revisionName(cr *v1beta1.WorkspaceTemplateApply, revision string) string {
+	return fmt.Sprintf("%s-%s", cr.Name, revision)
+}
+
+// listRevisions returns the revisions of the WorkspaceTemplateApply ordered from oldest to newest
+func (r *workspaceTemplateApplyReconciler) listRevisions(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) ([]appsv1.ControllerRevision, error) {
+	list := &appsv1.ControllerRevisionList{}
+	if err := r.client.List(ctx, list, client.InNamespace(cr.Namespace), client.MatchingLabels{revisionApplyLabel: cr.Name}); err != nil {
+		return nil, err
+	}
+
+	var revisions []appsv1.ControllerRevision
+	for _, revision := range list.Items {
+		// Ignore revisions left behind by a previous object with the same name
+		if metav1.IsControlledBy(&revision, cr) {
+			revisions = append(revisions, revision)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Revision < revisions[j].Revision
+	})
+	return revisions, nil
+}
+
+// recordRevision stores the desired rendering as the newest revision of the
+// WorkspaceTemplateApply and prunes the revision history. Re-applying a previous
+// revision, e.g. on rollback, moves it to the top of the history.
+func (r *workspaceTemplateApplyReconciler) recordRevision(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, desired *rendering) error {
+	revisions, err := r.listRevisions(ctx, cr)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errRecordRevision, err)
+	}
+
+	name := revisionName(cr, desired.revision)
+	next := int64(1)
+	var current *appsv1.ControllerRevision
+	for i := range revisions {
+		if revisions[i].Name == name {
+			current = &revisions[i]
+		}
+		next = revisions[i].Revision + 1
+	}
+
+	switch {
+	case current == nil:
+		data, err := json.Marshal(revisionData{
+			WorkspaceSpec:       desired.spec,
+			TemplateGeneration:  desired.templateGeneration,
+			Variables:           desired.variables,
+			StructuredVariables: desired.structuredVariables,
+			VariablesFrom:       desired.variablesFrom,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", errRecordRevision, err)
+		}
+		current = &appsv1.ControllerRevision{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: cr.Namespace,
+				Labels:    map[string]string{revisionApplyLabel: cr.Name},
+			},
+			Data:     runtime.RawExtension{Raw: data},
+			Revision: next,
+		}
+		if err := controllerutil.SetControllerReference(cr, current, r.client.Scheme()); err != nil {
+			return fmt.Errorf("%s: %w", errRecordRevision, err)
+		}
+		if err := r.client.Create(ctx, current); err != nil {
+			return fmt.Errorf("%s: %w", errRecordRevision, err)
+		}
+		revisions = append(revisions, *current)
+
+	case current.Revision != next-1:
+		current.Revision = next
+		if err := r.client.Update(ctx, current); err != nil {
+			return fmt.Errorf("%s: %w", errRecordRevision, err)
+		}
+		sort.Slice(revisions, func(i, j int) bool {
+			return revisions[i].Revision < revisions[j].Revision
+		})
+	}
+
+	return r.pruneRevisions(ctx, cr, revisions)
+}
+
+// pruneRevisions deletes the oldest revisions beyond the revision history limit.
+// The given revisions must be ordered from oldest to newest, the newest being the current one.
+func (r *workspaceTemplateApplyReconciler) pruneRevisions(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, revisions []appsv1.ControllerRevision) error {
+	limit := defaultRevisionHistoryLimit
+	if cr.Spec.RevisionHistoryLimit != nil {
+		limit = int(*cr.Spec.RevisionHistoryLimit)
+	}
+
+	excess := max(len(revisions)-1-limit, 0)
+	for i := 0; i < excess; i++ {
+		if err := r.client.Delete(ctx, &revisions[i]); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("%s: %w", errPruneRevisions, err)
+		}
+	}
+
+	// Var file Secrets are kept for the revisions that can still be rolled back to
+	keep := make(map[string]bool, len(revisions)-excess)
+	for _, revision := range revisions[excess:] {
+		keep[variablesSecretName(cr, strings.TrimPrefix(revision.Name, cr.Name+"-"))] = true
+	}
+	return r.pruneVariablesSecrets(ctx, cr, keep)
+}
+
+// rollbackRendering returns the rendering stored for the rollbackTo revision. A nil
+// rendering means the revision cannot be found and the returned result and error should
+// be returned from Reconcile.
+func (r *workspaceTemplateApplyReconciler) rollbackRendering(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (*rendering, ctrl.Result, error) {
+	stored := &appsv1.ControllerRevision{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: revisionName(cr, cr.Spec.RollbackTo), Namespace: cr.Namespace}, stored)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, ctrl.Result{}, fmt.Errorf("%s: %w", errGetRevision, err)
+	}
+	if err != nil || !metav1.IsControlledBy(stored, cr) {
+		condition := xpv1.Condition{
+			Type:               v1beta1.RolledBackCondition,
+			Status:             corev1.ConditionFalse,
+			LastTransitionTime: metav1.Now(),
+			Reason:             v1beta1.ReasonRevisionNotFound,
+			Message:            fmt.Sprintf("Revision %s is not in the revision history", cr.Spec.RollbackTo),
+		}
+		setConditions(cr, condition)
+		r.record.Event(cr, event.Warning(event.Reason(condition.Reason), errors.New(condition.Message)))
+		if err := r.client.Status().Update(ctx, cr); err != nil {
+			return nil, ctrl.Result{}, err
+		}
+		return nil, ctrl.Result{RequeueAfter: requeueAfterSecret}, nil
+	}
+
+	data := revisionData{}
+	if err := json.Unmarshal(stored.Data.Raw, &data); err != nil {
+		return nil, ctrl.Result{}, fmt.Errorf("%s %s: %w", errGetRevision, stored.Name, err)
+	}
+
+	if condition := FindStatusCondition(cr.Status.Conditions, v1beta1.RolledBackCondition); condition == nil ||
+		condition.Reason != v1beta1.ReasonRolledBack || cr.Status.LastAppliedRevision != cr.Spec.RollbackTo {
+		r.record.Event(cr, event.Normal(reasonRolledBack, fmt.Sprintf("Rolling back to revision %s", cr.Spec.RollbackTo)))
+	}
+	setConditions(cr, xpv1.Condition{
+		Type:               v1beta1.RolledBackCondition,
+		Status:             corev1.ConditionTrue,
+		LastTransitionTime: metav1.Now(),
+		Reason:             v1beta1.ReasonRolledBack,
+		Message:            fmt.Sprintf("Pinned to revision %s; clear rollbackTo to follow the template again", cr.Spec.RollbackTo),
+	})
+
+	return &rendering{
+		spec:                data.WorkspaceSpec,
+		revision:            cr.Spec.RollbackTo,
+		templateGeneration:  data.TemplateGeneration,
+		variables:           data.Variables,
+		structuredVariables: data.StructuredVariables,
+		variablesFrom:       data.VariablesFrom,
+	}, ctrl.Result{}, nil
+}
+
+// followingTemplateCondition returns the RolledBack condition once rollbackTo has been cleared
+func followingTemplateCondition() xpv1.Condition {
+	return xpv1.Condition{
+		Type:               v1beta1.RolledBackCondition,
+		Status:             corev1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             v1beta1.ReasonFollowingTemplate,
+	}
+}
@@ -0,0 +1,288 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestReconcileRevisionHistoryAndRollback(t *testing.T) {
+	ctx := context.Background()
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{Module: "# v1", Source: tfv1beta1.ModuleSourceInline},
+				},
+			},
+		},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "demo-apply",
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "test-template"},
+			Variables:   map[string]string{"region": "ap-northeast-1"},
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(template, cr).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}, &tfv1beta1.Workspace{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cr)}
+
+	reconcile := func() *v1beta1.WorkspaceTemplateApply {
+		t.Helper()
+		if _, err := r.Reconcile(ctx, req); err != nil {
+			t.Fatalf("Reconcile() error = %v", err)
+		}
+		got := &v1beta1.WorkspaceTemplateApply{}
+		if err := c.Get(ctx, req.NamespacedName, got); err != nil {
+			t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+		}
+		return got
+	}
+	setModule := func(module string) {
+		t.Helper()
+		current := &v1beta1.WorkspaceTemplate{}
+		if err := c.Get(ctx, client.ObjectKeyFromObject(template), current); err != nil {
+			t.Fatalf("failed to get template: %v", err)
+		}
+		current.Spec.Template.Spec.ForProvider.Module = module
+		if err := c.Update(ctx, current); err != nil {
+			t.Fatalf("failed to update template: %v", err)
+		}
+	}
+	updateSpec := func(mutate func(spec *v1beta1.WorkspaceTemplateApplySpec)) {
+		t.Helper()
+		current := &v1beta1.WorkspaceTemplateApply{}
+		if err := c.Get(ctx, req.NamespacedName, current); err != nil {
+			t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+		}
+		mutate(&current.Spec)
+		if err := c.Update(ctx, current); err != nil {
+			t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+		}
+	}
+	workspaceModule := func() string {
+		t.Helper()
+		workspace := &tfv1beta1.Workspace{}
+		if err := c.Get(ctx, types.NamespacedName{Name: "default-demo", Namespace: "default"}, workspace); err != nil {
+			t.Fatalf("failed to get workspace: %v", err)
+		}
+		return workspace.Spec.ForProvider.Module
+	}
+	revisions := func() map[string]int64 {
+		t.Helper()
+		list := &appsv1.ControllerRevisionList{}
+		if err := c.List(ctx, list, client.MatchingLabels{revisionApplyLabel: cr.Name}); err != nil {
+			t.Fatalf("failed to list revisions: %v", err)
+		}
+		numbers := map[string]int64{}
+		for _, revision := range list.Items {
+			numbers[revision.Name] = revision.Revision
+		}
+		return numbers
+	}
+
+	first := reconcile().Status.LastAppliedRevision
+	setModule("# v2")
+	second := reconcile().Status.LastAppliedRevision
+	if got := revisions(); len(got) != 2 || got[revisionName(cr, first)] != 1 || got[revisionName(cr, second)] != 2 {
+		t.Fatalf("revisions = %v, expected %s and %s", got, first, second)
+	}
+
+	// Older revisions beyond the history limit are pruned
+	updateSpec(func(spec *v1beta1.WorkspaceTemplateApplySpec) { spec.RevisionHistoryLimit = ptr.To[int32](1) })
+	setModule("# v3")
+	third := reconcile().Status.LastAppliedRevision
+	if got := revisions(); len(got) != 2 || got[revisionName(cr, second)] != 2 || got[revisionName(cr, third)] != 3 {
+		t.Fatalf("revisions = %v, expected %s and %s", got, second, third)
+	}
+
+	// Rolling back re-applies the stored spec and moves the revision to the top
+	updateSpec(func(spec *v1beta1.WorkspaceTemplateApplySpec) { spec.RollbackTo = second })
+	got := reconcile()
+	if got.Status.LastAppliedRevision != second || workspaceModule() != "# v2" {
+		t.Fatalf("expected rollback to %s, got revision %s with module %q", second, got.Status.LastAppliedRevision, workspaceModule())
+	}
+	condition := FindStatusCondition(got.Status.Conditions, v1beta1.RolledBackCondition)
+	if condition == nil || condition.Status != corev1.ConditionTrue {
+		t.Errorf("RolledBack condition = %v, expected True", condition)
+	}
+	if got := revisions(); got[revisionName(cr, second)] != 4 {
+		t.Errorf("revisions = %v, expected %s to be the newest", got, second)
+	}
+
+	// Template changes are ignored while pinned
+	setModule("# v4")
+	if got := reconcile(); got.Status.LastAppliedRevision != second {
+		t.Errorf("expected the workspace to stay at %s, got %s", second, got.Status.LastAppliedRevision)
+	}
+
+	// Unknown revisions are reported
+	updateSpec(func(spec *v1beta1.WorkspaceTemplateApplySpec) { spec.RollbackTo = first })
+	got = reconcile()
+	condition = FindStatusCondition(got.Status.Conditions, v1beta1.RolledBackCondition)
+	if condition == nil || condition.Reason != v1beta1.ReasonRevisionNotFound {
+		t.Errorf("RolledBack condition = %v, expected reason %s", condition, v1beta1.ReasonRevisionNotFound)
+	}
+
+	// Clearing rollbackTo follows the template again
+	updateSpec(func(spec *v1beta1.WorkspaceTemplateApplySpec) { spec.RollbackTo = "" })
+	got = reconcile()
+	if workspaceModule() != "# v4" {
+		t.Errorf("workspace module = %q, expected the current template", workspaceModule())
+	}
+	condition = FindStatusCondition(got.Status.Conditions, v1beta1.RolledBackCondition)
+	if condition == nil || condition.Reason != v1beta1.ReasonFollowingTemplate {
+		t.Errorf("RolledBack condition = %v, expected reason %s", condition, v1beta1.ReasonFollowingTemplate)
+	}
+}
+
+func TestRecordRevisionKeepsSecretValuesOut(t *testing.T) {
+	ctx := context.Background()
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{Module: `variable "password" {}`, Source: tfv1beta1.ModuleSourceInline},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-creds", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "demo-db-apply",
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "db-template"},
+			VariablesFrom: []v1beta1.VariableFrom{
+				{Name: "password", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "db-creds", Key: "password"},
+				}},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(template, secret, cr).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}, &tfv1beta1.Workspace{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+	if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(cr)}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	list := &appsv1.ControllerRevisionList{}
+	if err := c.List(ctx, list, client.MatchingLabels{revisionApplyLabel: cr.Name}); err != nil {
+		t.Fatalf("failed to list revisions: %v", err)
+	}
+	if len(list.Items) != 1 {
+		t.Fatalf("expected 1 revision, got %d", len(list.Items))
+	}
+	data := list.Items[0].Data.Raw
+	if strings.Contains(string(data), "hunter2") {
+		t.Errorf("revision contains the secret value: %s", data)
+	}
+	stored := revisionData{}
+	if err := json.Unmarshal(data, &stored); err != nil {
+		t.Fatalf("failed to unmarshal revision: %v", err)
+	}
+	if len(stored.VariablesFrom) != 1 || stored.VariablesFrom[0].ValueFrom.SecretKeyRef == nil ||
+		stored.VariablesFrom[0].ValueFrom.SecretKeyRef.Name != "db-creds" {
+		t.Errorf("variablesFrom = %v, expected the reference to the secret", stored.VariablesFrom)
+	}
+}
+
+func TestRollbackRestoresSecretValues(t *testing.T) {
+	ctx := context.Background()
+	r := newSecretSourceApply("")
+	workspaceKey := types.NamespacedName{Name: "default-demo-db", Namespace: "default"}
+	appliedVarFile := func() string {
+		t.Helper()
+		workspace := &tfv1beta1.Workspace{}
+		if err := r.client.Get(ctx, workspaceKey, workspace); err != nil {
+			t.Fatalf("failed to get workspace: %v", err)
+		}
+		return workspace.Spec.ForProvider.VarFiles[0].SecretKeyReference.Name
+	}
+
+	first := reconcileSecretSourceApply(t, r).Status.LastAppliedRevision
+
+	secret := &corev1.Secret{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: "db-creds", Namespace: "default"}, secret); err != nil {
+		t.Fatalf("failed to get secret: %v", err)
+	}
+	secret.Data["password"] = []byte("correct-horse")
+	if err := r.client.Update(ctx, secret); err != nil {
+		t.Fatalf("failed to update secret: %v", err)
+	}
+	cr := reconcileSecretSourceApply(t, r)
+	second := cr.Status.LastAppliedRevision
+	if second == first {
+		t.Fatal("expected the changed secret to create a new revision")
+	}
+	if appliedVarFile() != "demo-db-apply-variables-"+second {
+		t.Errorf("var file = %s, expected the variables secret of revision %s", appliedVarFile(), second)
+	}
+
+	// Rolling back brings the previous value back, and only the var file of the current
+	// revision is kept without history
+	cr.Spec.RollbackTo = first
+	cr.Spec.RevisionHistoryLimit = ptr.To[int32](0)
+	if err := r.client.Update(ctx, cr); err != nil {
+		t.Fatalf("failed to update WorkspaceTemplateApply: %v", err)
+	}
+	reconcileSecretSourceApply(t, r)
+	if appliedVarFile() != "demo-db-apply-variables-"+first {
+		t.Errorf("var file = %s, expected the variables secret of revision %s", appliedVarFile(), first)
+	}
+	if expected := `{"password":"hunter2"}`; varFileOf(t, r, first) != expected {
+		t.Errorf("var file = %s, expected %s", varFileOf(t, r, first), expected)
+	}
+	pruned := &corev1.Secret{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: "demo-db-apply-variables-" + second, Namespace: "default"}, pruned)
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected the variables secret of the pruned revision to be deleted, got %v", err)
+	}
+}
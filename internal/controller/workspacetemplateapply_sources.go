@@ -0,0 +1,359 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+const (
+	errResolveVariableSource = "cannot resolve variable source"
+	errWriteVariablesSecret  = "cannot write variables secret"
+
+	// variablesSecretSuffix is appended to the name of a WorkspaceTemplateApply, followed by
+	// a revision, to name the Secret holding the var file with the values of its Secret sources
+	variablesSecretSuffix = "-variables"
+
+	// variablesSecretKey is the key of the var file in the variables Secret
+	variablesSecretKey = "terraform.tfvars.json"
+)
+
+// sourceNamespace returns the namespace of a variable source, defaulting to the
+// namespace of the WorkspaceTemplateApply
+func sourceNamespace(cr *v1beta1.WorkspaceTemplateApply, namespace string) string {
+	if namespace != "" {
+		return namespace
+	}
+	return cr.Namespace
+}
+
+// resolveVariableSources resolves the variablesFrom of the WorkspaceTemplateApply.
+// It returns a copy of the WorkspaceTemplateApply whose variables and structured variables
+// include the resolved values of ConfigMaps and outputs, the values of Secrets, which are
+// kept out of the copy so that they are never rendered into the Workspace spec, and a
+// description of every required source that is not available yet.
+func (r *workspaceTemplateApplyReconciler) resolveVariableSources(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply) (*v1beta1.WorkspaceTemplateApply, map[string]string, []string, error) {
+	if len(cr.Spec.VariablesFrom) == 0 {
+		return cr, nil, nil, nil
+	}
+
+	if err := cr.Spec.ValidateConfiguration(); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := cr.Spec.ValidateSourceNamespaces(cr.Namespace); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The resolved copy carries the values instead of their sources
+	resolved := cr.DeepCopy()
+	resolved.Spec.VariablesFrom = nil
+	if resolved.Spec.Variables == nil {
+		resolved.Spec.Variables = map[string]string{}
+	}
+
+	var secretVariables map[string]string
+	var unavailable []string
+	for _, v := range cr.Spec.VariablesFrom {
+		value, reason, err := r.resolveVariableSource(ctx, cr, v.ValueFrom)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s %q: %w", errResolveVariableSource, v.Name, err)
+		}
+		if value == nil {
+			if !v.ValueFrom.Optional {
+				unavailable = append(unavailable, fmt.Sprintf("%s (%s)", v.Name, reason))
+			}
+			continue
+		}
+
+		// Strings are plain variables; anything else keeps its type as a structured variable
+		decoded, err := decodeJSONValue(value.Raw)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s %q: %w", errResolveVariableSource, v.Name, err)
+		}
+		str, ok := decoded.(string)
+		switch {
+		case v.ValueFrom.SecretKeyRef != nil:
+			if secretVariables == nil {
+				secretVariables = map[string]string{}
+			}
+			secretVariables[v.Name] = str
+		case ok:
+			resolved.Spec.Variables[v.Name] = str
+		default:
+			if resolved.Spec.StructuredVariables == nil {
+				resolved.Spec.StructuredVariables = map[string]apiextensionsv1.JSON{}
+			}
+			resolved.Spec.StructuredVariables[v.Name] = *value
+		}
+	}
+
+	return resolved, secretVariables, unavailable, nil
+}
+
+// secretVariableReferences marks the unresolved template variables that are sourced from
+// Secrets. Their values are only passed to Terraform and never substituted into the template.
+func secretVariableReferences(cr *v1beta1.WorkspaceTemplateApply, unresolved []string) []string {
+	marked := make([]string, 0, len(unresolved))
+	for _, name := range unresolved {
+		for _, v := range cr.Spec.VariablesFrom {
+			if v.Name == name && v.ValueFrom.SecretKeyRef != nil {
+				name = fmt.Sprintf("%s (sourced from a Secret, use var.%s in the module)", name, name)
+				break
+			}
+		}
+		marked = append(marked, name)
+	}
+	return marked
+}
+
+// variablesSecretName returns the name of the Secret holding the var file of a revision
+func variablesSecretName(cr *v1beta1.WorkspaceTemplateApply, revision string) string {
+	return fmt.Sprintf("%s%s-%s", cr.Name, variablesSecretSuffix, revision)
+}
+
+// variablesVarFile returns the var file of a revision to add to the Workspace
+func variablesVarFile(cr *v1beta1.WorkspaceTemplateApply, revision string) tfv1beta1.VarFile {
+	format := tfv1beta1.FileFormatJSON
+	return tfv1beta1.VarFile{
+		Source: tfv1beta1.VarFileSourceSecretKey,
+		Format: &format,
+		SecretKeyReference: &tfv1beta1.KeyReference{
+			Namespace: cr.Namespace,
+			Name:      variablesSecretName(cr, revision),
+			Key:       variablesSecretKey,
+		},
+	}
+}
+
+// writeVariablesSecret stores the values of the Secret sources of the desired rendering as a
+// JSON var file in the variables Secret of its revision, owned by the apply. The revision
+// covers the values, so the Secret of a revision never changes once written.
+func (r *workspaceTemplateApplyReconciler) writeVariablesSecret(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, desired *rendering) error {
+	if len(desired.secretVariables) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(desired.secretVariables)
+	if err != nil {
+		return fmt.Errorf("%s: %w", errWriteVariablesSecret, err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      variablesSecretName(cr, desired.revision),
+			Namespace: cr.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.client, secret, func() error {
+		secret.Labels = map[string]string{revisionApplyLabel: cr.Name}
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{variablesSecretKey: data}
+		return controllerutil.SetControllerReference(cr, secret, r.client.Scheme())
+	}); err != nil {
+		return fmt.Errorf("%s: %w", errWriteVariablesSecret, err)
+	}
+	return nil
+}
+
+// pruneVariablesSecrets deletes the var file Secrets of the WorkspaceTemplateApply that are
+// not in keep
+func (r *workspaceTemplateApplyReconciler) pruneVariablesSecrets(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, keep map[string]bool) error {
+	secrets := &corev1.SecretList{}
+	if err := r.client.List(ctx, secrets, client.InNamespace(cr.Namespace), client.MatchingLabels{revisionApplyLabel: cr.Name}); err != nil {
+		return fmt.Errorf("%s: %w", errPruneRevisions, err)
+	}
+	for i := range secrets.Items {
+		secret := &secrets.Items[i]
+		if keep[secret.Name] || !metav1.IsControlledBy(secret, cr) {
+			continue
+		}
+		if err := r.client.Delete(ctx, secret); client.IgnoreNotFound(err) != nil {
+			return fmt.Errorf("%s: %w", errPruneRevisions, err)
+		}
+	}
+	return nil
+}
+
+// resolveVariableSource resolves a single variable source. A nil value means the source
+// is not available yet, with the reason describing why.
+func (r *workspaceTemplateApplyReconciler) resolveVariableSource(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, source v1beta1.VariableSource) (*apiextensionsv1.JSON, string, error) {
+	switch {
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		namespace := sourceNamespace(cr, ref.Namespace)
+		secret := &corev1.Secret{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Sprintf("secret %s/%s not found", namespace, ref.Name), nil
+			}
+			return nil, "", err
+		}
+		data, ok := secret.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Sprintf("key %s not found in secret %s/%s", ref.Key, namespace, ref.Name), nil
+		}
+		return stringJSON(string(data))
+
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		namespace := sourceNamespace(cr, ref.Namespace)
+		configMap := &corev1.ConfigMap{}
+		if err := r.client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, configMap); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, fmt.Sprintf("configmap %s/%s not found", namespace, ref.Name), nil
+			}
+			return nil, "", err
+		}
+		if data, ok := configMap.Data[ref.Key]; ok {
+			return stringJSON(data)
+		}
+		if data, ok := configMap.BinaryData[ref.Key]; ok {
+			return stringJSON(string(data))
+		}
+		return nil, fmt.Sprintf("key %s not found in configmap %s/%s", ref.Key, namespace, ref.Name), nil
+
+	case source.OutputRef != nil:
+		return r.resolveOutputReference(ctx, cr, source.OutputRef)
+	}
+
+	return nil, "", fmt.Errorf("no variable source specified")
+}
+
+// resolveOutputReference resolves a Terraform output of another WorkspaceTemplateApply
+func (r *workspaceTemplateApplyReconciler) resolveOutputReference(ctx context.Context, cr *v1beta1.WorkspaceTemplateApply, ref *v1beta1.OutputReference) (*apiextensionsv1.JSON, string, error) {
+	namespace := sourceNamespace(cr, ref.Namespace)
+	producer := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, producer); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Sprintf("WorkspaceTemplateApply %s/%s not found", namespace, ref.Name), nil
+		}
+		return nil, "", err
+	}
+	if producer.Status.WorkspaceName == "" {
+		return nil, fmt.Sprintf("WorkspaceTemplateApply %s/%s has not been applied", namespace, ref.Name), nil
+	}
+
+	workspace := &tfv1beta1.Workspace{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: producer.Status.WorkspaceName, Namespace: producer.Namespace}, workspace); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Sprintf("workspace %s/%s not found", producer.Namespace, producer.Status.WorkspaceName), nil
+		}
+		return nil, "", err
+	}
+
+	value, ok := workspace.Status.AtProvider.Outputs[ref.Output]
+	if !ok {
+		return nil, fmt.Sprintf("output %s of WorkspaceTemplateApply %s/%s is not available", ref.Output, namespace, ref.Name), nil
+	}
+	return &value, "", nil
+}
+
+// stringJSON encodes a string as a JSON value
+func stringJSON(value string) (*apiextensionsv1.JSON, string, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return &apiextensionsv1.JSON{Raw: raw}, "", nil
+}
+
+// findAppliesForSources returns reconcile requests for the WorkspaceTemplateApplies that
+// have a variable source matching the given predicate
+func (r *workspaceTemplateApplyReconciler) findAppliesForSources(ctx context.Context, matches func(apply *v1beta1.WorkspaceTemplateApply, source v1beta1.VariableSource) bool) []reconcile.Request {
+	applies := &v1beta1.WorkspaceTemplateApplyList{}
+	if err := r.client.List(ctx, applies); err != nil {
+		r.log.Debug("Failed to list WorkspaceTemplateApplies", "error", err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range applies.Items {
+		apply := &applies.Items[i]
+		for _, v := range apply.Spec.VariablesFrom {
+			if matches(apply, v.ValueFrom) {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: apply.Name, Namespace: apply.Namespace},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// findAppliesForSecret maps a Secret to the WorkspaceTemplateApplies consuming it
+func (r *workspaceTemplateApplyReconciler) findAppliesForSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.findAppliesForSources(ctx, func(apply *v1beta1.WorkspaceTemplateApply, source v1beta1.VariableSource) bool {
+		ref := source.SecretKeyRef
+		return ref != nil && ref.Name == obj.GetName() && sourceNamespace(apply, ref.Namespace) == obj.GetNamespace()
+	})
+}
+
+// findAppliesForConfigMap maps a ConfigMap to the WorkspaceTemplateApplies consuming it
+func (r *workspaceTemplateApplyReconciler) findAppliesForConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.findAppliesForSources(ctx, func(apply *v1beta1.WorkspaceTemplateApply, source v1beta1.VariableSource) bool {
+		ref := source.ConfigMapKeyRef
+		return ref != nil && ref.Name == obj.GetName() && sourceNamespace(apply, ref.Namespace) == obj.GetNamespace()
+	})
+}
+
+// findAppliesForWorkspaceOutputs maps a Workspace to the WorkspaceTemplateApplies consuming
+// the outputs of the WorkspaceTemplateApply that created it. Workspaces are cluster-scoped,
+// so the producer is found through the workspace name recorded in its status.
+func (r *workspaceTemplateApplyReconciler) findAppliesForWorkspaceOutputs(ctx context.Context, obj client.Object) []reconcile.Request {
+	producers := &v1beta1.WorkspaceTemplateApplyList{}
+	if err := r.client.List(ctx, producers); err != nil {
+		r.log.Debug("Failed to list WorkspaceTemplateApplies", "error", err)
+		return nil
+	}
+
+	var producerKeys []types.NamespacedName
+	for _, producer := range producers.Items {
+		if producer.Status.WorkspaceName == obj.GetName() {
+			producerKeys = append(producerKeys, types.NamespacedName{Name: producer.Name, Namespace: producer.Namespace})
+		}
+	}
+	if len(producerKeys) == 0 {
+		return nil
+	}
+
+	return r.findAppliesForSources(ctx, func(apply *v1beta1.WorkspaceTemplateApply, source v1beta1.VariableSource) bool {
+		ref := source.OutputRef
+		if ref == nil {
+			return false
+		}
+		for _, key := range producerKeys {
+			if ref.Name == key.Name && sourceNamespace(apply, ref.Namespace) == key.Namespace {
+				return true
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,525 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func newSourcesScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+	_ = tfv1beta1.SchemeBuilder.AddToScheme(scheme)
+	_ = corev1.AddToScheme(scheme)
+	_ = appsv1.AddToScheme(scheme)
+	return scheme
+}
+
+func newVPCProducer() (*v1beta1.WorkspaceTemplateApply, *tfv1beta1.Workspace) {
+	producer := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-vpc-apply", Namespace: "default"},
+		Status:     v1beta1.WorkspaceTemplateApplyStatus{WorkspaceName: "demo-vpc", Applied: true},
+	}
+	workspace := &tfv1beta1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-vpc", Namespace: "default"},
+		Status: tfv1beta1.WorkspaceStatus{
+			AtProvider: tfv1beta1.WorkspaceObservation{
+				Outputs: map[string]apiextensionsv1.JSON{
+					"vpc_id":          {Raw: []byte(`"vpc-123"`)},
+					"private_subnets": {Raw: []byte(`["subnet-a","subnet-b"]`)},
+				},
+			},
+		},
+	}
+	return producer, workspace
+}
+
+func TestResolveVariableSources(t *testing.T) {
+	producer, workspace := newVPCProducer()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+		Data:       map[string][]byte{"token": []byte("s3cr\"t\n")},
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"},
+		Data:       map[string]string{"region": "ap-northeast-1"},
+	}
+
+	tests := []struct {
+		name                string
+		variablesFrom       []v1beta1.VariableFrom
+		expectedVariables   map[string]string
+		expectedStructured  map[string]string
+		expectedSecrets     map[string]string
+		expectedUnavailable []string
+		expectedErr         bool
+	}{
+		{
+			name: "secret and configmap keys",
+			variablesFrom: []v1beta1.VariableFrom{
+				{Name: "token", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "creds", Key: "token"},
+				}},
+				{Name: "region", ValueFrom: v1beta1.VariableSource{
+					ConfigMapKeyRef: &v1beta1.KeySelector{Name: "settings", Namespace: "default", Key: "region"},
+				}},
+			},
+			expectedVariables: map[string]string{"region": "ap-northeast-1"},
+			expectedSecrets:   map[string]string{"token": "s3cr\"t\n"},
+		},
+		{
+			name: "sources in other namespaces are rejected",
+			variablesFrom: []v1beta1.VariableFrom{
+				{Name: "token", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "creds", Namespace: "kube-system", Key: "token"},
+				}},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "outputs of another apply keep their types",
+			variablesFrom: []v1beta1.VariableFrom{
+				{Name: "vpc_id", ValueFrom: v1beta1.VariableSource{
+					OutputRef: &v1beta1.OutputReference{Name: "demo-vpc-apply", Output: "vpc_id"},
+				}},
+				{Name: "private_subnets", ValueFrom: v1beta1.VariableSource{
+					OutputRef: &v1beta1.OutputReference{Name: "demo-vpc-apply", Output: "private_subnets"},
+				}},
+			},
+			expectedVariables:  map[string]string{"vpc_id": "vpc-123"},
+			expectedStructured: map[string]string{"private_subnets": `["subnet-a","subnet-b"]`},
+		},
+		{
+			name: "missing sources are reported",
+			variablesFrom: []v1beta1.VariableFrom{
+				{Name: "token", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "creds", Key: "missing"},
+				}},
+				{Name: "region", ValueFrom: v1beta1.VariableSource{
+					ConfigMapKeyRef: &v1beta1.KeySelector{Name: "other-settings", Key: "region"},
+				}},
+				{Name: "cluster_sg", ValueFrom: v1beta1.VariableSource{
+					OutputRef: &v1beta1.OutputReference{Name: "demo-vpc-apply", Output: "cluster_sg"},
+				}},
+			},
+			expectedUnavailable: []string{
+				"token (key missing not found in secret default/creds)",
+				"region (configmap default/other-settings not found)",
+				"cluster_sg (output cluster_sg of WorkspaceTemplateApply default/demo-vpc-apply is not available)",
+			},
+		},
+		{
+			name: "optional sources are skipped",
+			variablesFrom: []v1beta1.VariableFrom{
+				{Name: "token", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "other", Key: "token"},
+					Optional:     true,
+				}},
+			},
+			expectedVariables: map[string]string{"name": "demo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := &v1beta1.WorkspaceTemplateApply{
+				ObjectMeta: metav1.ObjectMeta{Name: "demo-apply", Namespace: "default"},
+				Spec: v1beta1.WorkspaceTemplateApplySpec{
+					Variables:     map[string]string{"name": "demo"},
+					VariablesFrom: tt.variablesFrom,
+				},
+			}
+
+			r := &workspaceTemplateApplyReconciler{
+				client: fake.NewClientBuilder().
+					WithScheme(newSourcesScheme()).
+					WithObjects(producer.DeepCopy(), workspace.DeepCopy(), secret, configMap).
+					Build(),
+				log:    logging.NewNopLogger(),
+				record: event.NewNopRecorder(),
+			}
+
+			resolved, secrets, unavailable, err := r.resolveVariableSources(context.Background(), cr)
+			if (err != nil) != tt.expectedErr {
+				t.Fatalf("resolveVariableSources() error = %v, expected error %v", err, tt.expectedErr)
+			}
+			if tt.expectedErr {
+				return
+			}
+			if strings.Join(unavailable, "|") != strings.Join(tt.expectedUnavailable, "|") {
+				t.Errorf("unavailable = %v, expected %v", unavailable, tt.expectedUnavailable)
+			}
+			if len(tt.expectedUnavailable) > 0 {
+				return
+			}
+
+			for name, expected := range tt.expectedVariables {
+				if got := resolved.Spec.Variables[name]; got != expected {
+					t.Errorf("variable %s = %q, expected %q", name, got, expected)
+				}
+			}
+			for name, expected := range tt.expectedStructured {
+				if got := string(resolved.Spec.StructuredVariables[name].Raw); got != expected {
+					t.Errorf("structured variable %s = %s, expected %s", name, got, expected)
+				}
+			}
+			for name, expected := range tt.expectedSecrets {
+				if got := secrets[name]; got != expected {
+					t.Errorf("secret variable %s = %q, expected %q", name, got, expected)
+				}
+				if _, ok := resolved.Spec.Variables[name]; ok {
+					t.Errorf("secret variable %s was added to the rendered variables", name)
+				}
+			}
+			if _, ok := cr.Spec.Variables["token"]; ok {
+				t.Error("original WorkspaceTemplateApply was modified")
+			}
+		})
+	}
+}
+
+func TestReconcileRendersVariablesFromOutputs(t *testing.T) {
+	producer, workspace := newVPCProducer()
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "eks-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{
+						Module: `vpc_id = "${vpc_id}"`,
+						Source: tfv1beta1.ModuleSourceInline,
+					},
+				},
+			},
+		},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "demo-eks-apply",
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "eks-template"},
+			VariablesFrom: []v1beta1.VariableFrom{
+				{Name: "vpc_id", ValueFrom: v1beta1.VariableSource{
+					OutputRef: &v1beta1.OutputReference{Name: "demo-vpc-apply", Output: "vpc_id"},
+				}},
+			},
+		},
+	}
+
+	c := fake.NewClientBuilder().
+		WithScheme(newSourcesScheme()).
+		WithObjects(producer, workspace, template, cr).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}, &tfv1beta1.Workspace{}).
+		Build()
+	r := &workspaceTemplateApplyReconciler{
+		client: c,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "demo-eks-apply", Namespace: "default"}}
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+
+	got := &tfv1beta1.Workspace{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "default-demo-eks", Namespace: "default"}, got); err != nil {
+		t.Fatalf("failed to get workspace: %v", err)
+	}
+	if expected := `vpc_id = "vpc-123"`; got.Spec.ForProvider.Module != expected {
+		t.Errorf("workspace module = %q, expected %q", got.Spec.ForProvider.Module, expected)
+	}
+
+	// A changed output is propagated on the next reconcile
+	vpc := &tfv1beta1.Workspace{}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "demo-vpc", Namespace: "default"}, vpc); err != nil {
+		t.Fatalf("failed to get vpc workspace: %v", err)
+	}
+	vpc.Status.AtProvider.Outputs["vpc_id"] = apiextensionsv1.JSON{Raw: []byte(`"vpc-456"`)}
+	if err := c.Status().Update(context.Background(), vpc); err != nil {
+		t.Fatalf("failed to update vpc workspace: %v", err)
+	}
+
+	requests := r.findAppliesForWorkspaceOutputs(context.Background(), vpc)
+	if len(requests) != 1 || requests[0].NamespacedName != req.NamespacedName {
+		t.Fatalf("findAppliesForWorkspaceOutputs() = %v, expected %v", requests, req)
+	}
+
+	if _, err := r.Reconcile(context.Background(), req); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "default-demo-eks", Namespace: "default"}, got); err != nil {
+		t.Fatalf("failed to get workspace: %v", err)
+	}
+	if expected := `vpc_id = "vpc-456"`; got.Spec.ForProvider.Module != expected {
+		t.Errorf("workspace module = %q, expected %q", got.Spec.ForProvider.Module, expected)
+	}
+}
+
+func TestFindAppliesForSecretAndConfigMap(t *testing.T) {
+	consumer := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "consumer", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			VariablesFrom: []v1beta1.VariableFrom{
+				{Name: "token", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "creds", Key: "token"},
+				}},
+				{Name: "region", ValueFrom: v1beta1.VariableSource{
+					ConfigMapKeyRef: &v1beta1.KeySelector{Name: "settings", Key: "region"},
+				}},
+			},
+		},
+	}
+	r := &workspaceTemplateApplyReconciler{
+		client: fake.NewClientBuilder().WithScheme(newSourcesScheme()).WithObjects(consumer).Build(),
+		log:    logging.NewNopLogger(),
+	}
+
+	tests := []struct {
+		name     string
+		find     func(context.Context, client.Object) []reconcile.Request
+		obj      client.Object
+		expected int
+	}{
+		{
+			name:     "referenced secret",
+			find:     r.findAppliesForSecret,
+			obj:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"}},
+			expected: 1,
+		},
+		{
+			name:     "secret in another namespace",
+			find:     r.findAppliesForSecret,
+			obj:      &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "infra"}},
+			expected: 0,
+		},
+		{
+			name:     "referenced configmap",
+			find:     r.findAppliesForConfigMap,
+			obj:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "settings", Namespace: "default"}},
+			expected: 1,
+		},
+		{
+			name:     "unrelated configmap",
+			find:     r.findAppliesForConfigMap,
+			obj:      &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.find(context.Background(), tt.obj); len(got) != tt.expected {
+				t.Errorf("got %d requests, expected %d", len(got), tt.expected)
+			}
+		})
+	}
+}
+
+func TestFindAppliesForClusterScopedWorkspace(t *testing.T) {
+	producer, _ := newVPCProducer()
+	consumer := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-eks-apply", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			VariablesFrom: []v1beta1.VariableFrom{
+				{Name: "vpc_id", ValueFrom: v1beta1.VariableSource{
+					OutputRef: &v1beta1.OutputReference{Name: "demo-vpc-apply", Output: "vpc_id"},
+				}},
+			},
+		},
+	}
+	// A consumer of a same-named producer in another namespace
+	other := consumer.DeepCopy()
+	other.Namespace = "team-b"
+	r := &workspaceTemplateApplyReconciler{
+		client: fake.NewClientBuilder().WithScheme(newSourcesScheme()).WithObjects(producer, consumer, other).Build(),
+		log:    logging.NewNopLogger(),
+	}
+
+	// Workspaces are cluster-scoped, so their events carry no namespace
+	workspace := &tfv1beta1.Workspace{ObjectMeta: metav1.ObjectMeta{Name: "demo-vpc"}}
+	requests := r.findAppliesForWorkspaceOutputs(context.Background(), workspace)
+	expected := types.NamespacedName{Name: "demo-eks-apply", Namespace: "default"}
+	if len(requests) != 1 || requests[0].NamespacedName != expected {
+		t.Errorf("findAppliesForWorkspaceOutputs() = %v, expected %v", requests, expected)
+	}
+}
+
+// newSecretSourceApply returns a reconciler for the demo-db-apply WorkspaceTemplateApply, whose
+// password variable is sourced from the db-creds Secret, with the given apply policy
+func newSecretSourceApply(policy v1beta1.ApplyPolicy) *workspaceTemplateApplyReconciler {
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-template", Namespace: "default"},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{
+						Module: `variable "password" {}`,
+						Source: tfv1beta1.ModuleSourceInline,
+					},
+				},
+			},
+		},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db-creds", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("hunter2")},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "demo-db-apply",
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "db-template"},
+			ApplyPolicy: policy,
+			VariablesFrom: []v1beta1.VariableFrom{
+				{Name: "password", ValueFrom: v1beta1.VariableSource{
+					SecretKeyRef: &v1beta1.KeySelector{Name: "db-creds", Key: "password"},
+				}},
+			},
+		},
+	}
+
+	return &workspaceTemplateApplyReconciler{
+		client: fake.NewClientBuilder().
+			WithScheme(newSourcesScheme()).
+			WithObjects(template, secret, cr).
+			WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}, &tfv1beta1.Workspace{}).
+			Build(),
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+}
+
+// reconcileSecretSourceApply reconciles demo-db-apply and returns it
+func reconcileSecretSourceApply(t *testing.T, r *workspaceTemplateApplyReconciler) *v1beta1.WorkspaceTemplateApply {
+	t.Helper()
+	key := types.NamespacedName{Name: "demo-db-apply", Namespace: "default"}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: key}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{}
+	if err := r.client.Get(context.Background(), key, cr); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	return cr
+}
+
+// varFileOf returns the var file stored in the variables Secret of a revision of demo-db-apply
+func varFileOf(t *testing.T, r *workspaceTemplateApplyReconciler, revision string) string {
+	t.Helper()
+	vars := &corev1.Secret{}
+	if err := r.client.Get(context.Background(), types.NamespacedName{Name: "demo-db-apply-variables-" + revision, Namespace: "default"}, vars); err != nil {
+		t.Fatalf("failed to get variables secret of revision %s: %v", revision, err)
+	}
+	return string(vars.Data[variablesSecretKey])
+}
+
+func TestReconcilePassesSecretVariablesThroughVarFile(t *testing.T) {
+	r := newSecretSourceApply("")
+	cr := reconcileSecretSourceApply(t, r)
+
+	got := &tfv1beta1.Workspace{}
+	if err := r.client.Get(context.Background(), types.NamespacedName{Name: "default-demo-db", Namespace: "default"}, got); err != nil {
+		t.Fatalf("failed to get workspace: %v", err)
+	}
+	spec, err := json.Marshal(got.Spec)
+	if err != nil {
+		t.Fatalf("failed to marshal workspace spec: %v", err)
+	}
+	if strings.Contains(string(spec), "hunter2") {
+		t.Errorf("workspace spec contains the secret value: %s", spec)
+	}
+	revision := cr.Status.LastAppliedRevision
+	varFiles := got.Spec.ForProvider.VarFiles
+	if len(varFiles) != 1 || varFiles[0].Source != tfv1beta1.VarFileSourceSecretKey || varFiles[0].SecretKeyReference == nil ||
+		varFiles[0].SecretKeyReference.Name != "demo-db-apply-variables-"+revision {
+		t.Fatalf("varFiles = %v, expected the variables secret of revision %s", varFiles, revision)
+	}
+
+	if expected := `{"password":"hunter2"}`; varFileOf(t, r, revision) != expected {
+		t.Errorf("var file = %s, expected %s", varFileOf(t, r, revision), expected)
+	}
+	vars := &corev1.Secret{}
+	if err := r.client.Get(context.Background(), types.NamespacedName{Name: "demo-db-apply-variables-" + revision, Namespace: "default"}, vars); err != nil {
+		t.Fatalf("failed to get variables secret: %v", err)
+	}
+	if len(vars.OwnerReferences) != 1 || vars.OwnerReferences[0].Name != cr.Name {
+		t.Errorf("ownerReferences = %v, expected the WorkspaceTemplateApply", vars.OwnerReferences)
+	}
+}
+
+func TestReconcileChangedSecretNeedsApproval(t *testing.T) {
+	ctx := context.Background()
+	r := newSecretSourceApply(v1beta1.ApplyPolicyManualApproval)
+
+	// Approve and apply the first revision
+	cr := reconcileSecretSourceApply(t, r)
+	if cr.Status.Plan == nil {
+		t.Fatal("expected the first revision to be planned")
+	}
+	applied := cr.Status.Plan.Revision
+	cr.Annotations = map[string]string{v1beta1.ApprovedRevisionAnnotation: applied}
+	if err := r.client.Update(ctx, cr); err != nil {
+		t.Fatalf("failed to approve revision: %v", err)
+	}
+	if cr = reconcileSecretSourceApply(t, r); cr.Status.LastAppliedRevision != applied {
+		t.Fatalf("lastAppliedRevision = %q, expected the approved revision %q", cr.Status.LastAppliedRevision, applied)
+	}
+
+	// Rotate the password
+	secret := &corev1.Secret{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: "db-creds", Namespace: "default"}, secret); err != nil {
+		t.Fatalf("failed to get secret: %v", err)
+	}
+	secret.Data["password"] = []byte("correct-horse")
+	if err := r.client.Update(ctx, secret); err != nil {
+		t.Fatalf("failed to update secret: %v", err)
+	}
+
+	cr = reconcileSecretSourceApply(t, r)
+	if cr.Status.Plan == nil || cr.Status.Plan.Revision == applied {
+		t.Fatalf("plan = %v, expected a new revision to be planned", cr.Status.Plan)
+	}
+	if cr.Status.LastAppliedRevision != applied {
+		t.Errorf("lastAppliedRevision = %q, expected %q until the new revision is approved", cr.Status.LastAppliedRevision, applied)
+	}
+
+	// The applied Workspace keeps reading the approved value
+	workspace := &tfv1beta1.Workspace{}
+	if err := r.client.Get(ctx, types.NamespacedName{Name: "default-demo-db", Namespace: "default"}, workspace); err != nil {
+		t.Fatalf("failed to get workspace: %v", err)
+	}
+	if ref := workspace.Spec.ForProvider.VarFiles[0].SecretKeyReference; ref.Name != "demo-db-apply-variables-"+applied {
+		t.Errorf("applied var file = %s, expected the variables secret of revision %s", ref.Name, applied)
+	}
+	if expected := `{"password":"hunter2"}`; varFileOf(t, r, applied) != expected {
+		t.Errorf("applied var file = %s, expected %s", varFileOf(t, r, applied), expected)
+	}
+	// Only the plan reads the new value
+	if expected := `{"password":"correct-horse"}`; varFileOf(t, r, cr.Status.Plan.Revision) != expected {
+		t.Errorf("planned var file = %s, expected %s", varFileOf(t, r, cr.Status.Plan.Revision), expected)
+	}
+}
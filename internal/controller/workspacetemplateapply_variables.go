@@ -0,0 +1,313 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// variableDefaultSeparator separates a variable name from its default value, e.g. ${name:-default}
+	variableDefaultSeparator = ":-"
+)
+
+// hclForExpression matches the iterator names bound by an HCL for expression,
+// e.g. `for k, v in var.labels`. Those names are resolved by Terraform, not by us.
+var hclForExpression = regexp.MustCompile(`\bfor\s+([A-Za-z_][A-Za-z0-9_-]*)(?:\s*,\s*([A-Za-z_][A-Za-z0-9_-]*))?\s+in\b`)
+
+// variableSubstitution substitutes ${name} and ${name:-default} placeholders in a
+// decoded Workspace spec.
+//
+// Only placeholders whose content is a plain identifier are treated as template
+// variables. Terraform interpolations such as ${var.region}, ${module.eks.cluster_name}
+// or ${jsonencode(...)}, escaped sequences ($${...}) and iterator names bound by an HCL
+// for expression are left untouched.
+type variableSubstitution struct {
+	values     map[string]string
+	unresolved map[string]struct{}
+}
+
+func newVariableSubstitution(values map[string]string) *variableSubstitution {
+	return &variableSubstitution{
+		values:     values,
+		unresolved: map[string]struct{}{},
+	}
+}
+
+// Unresolved returns the sorted names of the placeholders that had neither a value nor a default
+func (s *variableSubstitution) Unresolved() []string {
+	names := make([]string, 0, len(s.unresolved))
+	for name := range s.unresolved {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SubstituteJSON decodes the given JSON document, substitutes placeholders in every
+// string value and object key, and encodes it again. Because values are inserted into
+// decoded strings, quotes, backslashes and newlines are escaped by the encoder.
+func (s *variableSubstitution) SubstituteJSON(data []byte) ([]byte, error) {
+	// Numbers are kept as they are instead of round-tripping them through float64
+	doc, err := decodeJSONValue(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode template spec: %w", err)
+	}
+
+	out, err := json.Marshal(s.substituteValue(doc))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode template spec: %w", err)
+	}
+	return out, nil
+}
+
+// substituteValue walks a decoded JSON value
+func (s *variableSubstitution) substituteValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case string:
+		return s.Substitute(t)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			out[s.Substitute(key)] = s.substituteValue(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, value := range t {
+			out[i] = s.substituteValue(value)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Substitute replaces the placeholders in a single string
+func (s *variableSubstitution) Substitute(in string) string {
+	if !strings.Contains(in, "${") {
+		return in
+	}
+
+	locals := hclLocalNames(in)
+
+	var b strings.Builder
+	for i := 0; i < len(in); {
+		start := strings.Index(in[i:], "${")
+		if start < 0 {
+			b.WriteString(in[i:])
+			break
+		}
+		start += i
+		b.WriteString(in[i:start])
+
+		// $${...} is a Terraform escape for a literal ${...}
+		if start > 0 && in[start-1] == '$' {
+			b.WriteString("${")
+			i = start + 2
+			continue
+		}
+
+		name, def, hasDefault, end, ok := parsePlaceholder(in, start)
+		if !ok {
+			// Not a template variable; keep scanning inside it so nested
+			// placeholders in Terraform expressions are still handled
+			b.WriteString("${")
+			i = start + 2
+			continue
+		}
+
+		switch value, found := s.values[name]; {
+		case found:
+			b.WriteString(value)
+		case hasDefault:
+			b.WriteString(def)
+		default:
+			if _, local := locals[name]; !local {
+				s.unresolved[name] = struct{}{}
+			}
+			b.WriteString(in[start:end])
+		}
+		i = end
+	}
+	return b.String()
+}
+
+// parsePlaceholder parses ${name} or ${name:-default} starting at in[start].
+// It returns the index just past the closing brace.
+func parsePlaceholder(in string, start int) (name, def string, hasDefault bool, end int, ok bool) {
+	pos := start + 2
+	for pos < len(in) && isIdentifierChar(in[pos], pos == start+2) {
+		pos++
+	}
+	if pos == start+2 || pos >= len(in) {
+		return "", "", false, 0, false
+	}
+	name = in[start+2 : pos]
+
+	if in[pos] == '}' {
+		return name, "", false, pos + 1, true
+	}
+	if !strings.HasPrefix(in[pos:], variableDefaultSeparator) {
+		return "", "", false, 0, false
+	}
+
+	defStart := pos + len(variableDefaultSeparator)
+	closing := strings.IndexByte(in[defStart:], '}')
+	if closing < 0 {
+		return "", "", false, 0, false
+	}
+	return name, in[defStart : defStart+closing], true, defStart + closing + 1, true
+}
+
+func isIdentifierChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9', c == '-':
+		return !first
+	default:
+		return false
+	}
+}
+
+// hclLocalNames returns the iterator names bound by HCL for expressions in the given string
+func hclLocalNames(in string) map[string]struct{} {
+	names := map[string]struct{}{}
+	for _, match := range hclForExpression.FindAllStringSubmatch(in, -1) {
+		for _, name := range match[1:] {
+			if name != "" {
+				names[name] = struct{}{}
+			}
+		}
+	}
+	return names
+}
+
+// decodeJSONValue decodes a JSON value, keeping numbers as json.Number
+func decodeJSONValue(data []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// structuredVariableValue renders a structured variable for use in a ${name} placeholder.
+// Strings are inserted as they are, like plain variables; any other value is rendered
+// as an HCL literal so it can be used as a Terraform expression or -var value.
+func structuredVariableValue(raw apiextensionsv1.JSON) (string, error) {
+	value, err := decodeJSONValue(raw.Raw)
+	if err != nil {
+		return "", err
+	}
+	if str, ok := value.(string); ok {
+		return str, nil
+	}
+	return hclLiteral(value), nil
+}
+
+// hclLiteral renders a decoded JSON value as an HCL literal expression
+func hclLiteral(value interface{}) string {
+	switch t := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case string:
+		return hclQuote(t)
+	case []interface{}:
+		items := make([]string, len(t))
+		for i, item := range t {
+			items[i] = hclLiteral(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for key := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		items := make([]string, len(keys))
+		for i, key := range keys {
+			items[i] = hclQuote(key) + " = " + hclLiteral(t[key])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return hclQuote(fmt.Sprintf("%v", t))
+	}
+}
+
+// hclQuote quotes a string as an HCL string literal. Template sequences are escaped so
+// that values are never evaluated by Terraform.
+func hclQuote(in string) string {
+	quoted, _ := json.Marshal(in)
+	out := string(quoted)
+	out = strings.ReplaceAll(out, "${", "$${")
+	out = strings.ReplaceAll(out, "%{", "%%{")
+	return out
+}
+
+// mergeVarMap merges structured variables into a Workspace varmap. Structured variables
+// take precedence over entries of the same name defined by the template.
+func mergeVarMap(varMap *runtime.RawExtension, structured map[string]apiextensionsv1.JSON) (*runtime.RawExtension, error) {
+	if len(structured) == 0 {
+		return varMap, nil
+	}
+
+	merged := map[string]interface{}{}
+	if varMap != nil && len(varMap.Raw) > 0 {
+		existing, err := decodeJSONValue(varMap.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode varmap: %w", err)
+		}
+		values, ok := existing.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("varmap must be a JSON object")
+		}
+		merged = values
+	}
+
+	for name, raw := range structured {
+		value, err := decodeJSONValue(raw.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode structured variable %q: %w", name, err)
+		}
+		merged[name] = value
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode varmap: %w", err)
+	}
+	return &runtime.RawExtension{Raw: data}, nil
+}
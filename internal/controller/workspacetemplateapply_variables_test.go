@@ -0,0 +1,365 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/crossplane/crossplane-runtime/pkg/event"
+	"github.com/crossplane/crossplane-runtime/pkg/logging"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestVariableSubstitution(t *testing.T) {
+	tests := []struct {
+		name               string
+		input              string
+		values             map[string]string
+		expected           string
+		expectedUnresolved []string
+	}{
+		{
+			name:     "simple variable",
+			input:    "${cluster_name}-vpc",
+			values:   map[string]string{"cluster_name": "demo"},
+			expected: "demo-vpc",
+		},
+		{
+			name:     "multiple variables",
+			input:    "${a}/${b}/${a}",
+			values:   map[string]string{"a": "x", "b": "y"},
+			expected: "x/y/x",
+		},
+		{
+			name:     "value with quotes and newlines",
+			input:    "data = \"${ca}\"",
+			values:   map[string]string{"ca": "line1\n\"quoted\"\\line2"},
+			expected: "data = \"line1\n\"quoted\"\\line2\"",
+		},
+		{
+			name:     "default value is used when variable is missing",
+			input:    "${region:-us-west-2}",
+			values:   map[string]string{},
+			expected: "us-west-2",
+		},
+		{
+			name:     "provided value wins over default",
+			input:    "${region:-us-west-2}",
+			values:   map[string]string{"region": "ap-northeast-1"},
+			expected: "ap-northeast-1",
+		},
+		{
+			name:     "empty default",
+			input:    "prefix-${suffix:-}",
+			values:   map[string]string{},
+			expected: "prefix-",
+		},
+		{
+			name:               "unresolved variable is reported and kept",
+			input:              "${cluster_name}-${missing}",
+			values:             map[string]string{"cluster_name": "demo"},
+			expected:           "demo-${missing}",
+			expectedUnresolved: []string{"missing"},
+		},
+		{
+			name:     "terraform interpolations are left untouched",
+			input:    "${var.region} ${module.eks.cluster_name} ${jsonencode(local.tags)} ${path.module}",
+			values:   map[string]string{"var": "x", "module": "y", "path": "z"},
+			expected: "${var.region} ${module.eks.cluster_name} ${jsonencode(local.tags)} ${path.module}",
+		},
+		{
+			name:     "hcl for expression iterators are not variables",
+			input:    `${join(",", [for k, v in var.labels : "${k}=${v}"])}`,
+			values:   map[string]string{},
+			expected: `${join(",", [for k, v in var.labels : "${k}=${v}"])}`,
+		},
+		{
+			name:     "escaped interpolation is kept literally",
+			input:    "$${cluster_name}",
+			values:   map[string]string{"cluster_name": "demo"},
+			expected: "$${cluster_name}",
+		},
+		{
+			name:     "value is not substituted again",
+			input:    "${a}",
+			values:   map[string]string{"a": "${b}", "b": "nested"},
+			expected: "${b}",
+		},
+		{
+			name:     "unterminated placeholder",
+			input:    "${cluster_name",
+			values:   map[string]string{"cluster_name": "demo"},
+			expected: "${cluster_name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newVariableSubstitution(tt.values)
+			got := s.Substitute(tt.input)
+			if got != tt.expected {
+				t.Errorf("Substitute() = %q, expected %q", got, tt.expected)
+			}
+			unresolved := s.Unresolved()
+			if len(unresolved) == 0 && len(tt.expectedUnresolved) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(unresolved, tt.expectedUnresolved) {
+				t.Errorf("Unresolved() = %v, expected %v", unresolved, tt.expectedUnresolved)
+			}
+		})
+	}
+}
+
+func TestReplaceTemplateVariables(t *testing.T) {
+	ca := "-----BEGIN CERTIFICATE-----\nMIIC\"quoted\"\\\n-----END CERTIFICATE-----\n"
+
+	template := &v1beta1.WorkspaceTemplate{
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{
+						Module: "name = \"${WORKSPACE_NAME}\"\nregion = \"${region:-us-west-2}\"",
+						Source: tfv1beta1.ModuleSourceInline,
+						Vars: []tfv1beta1.Var{
+							{Key: "cluster_certificate_authority_data", Value: "${ca}"},
+						},
+					},
+				},
+			},
+		},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-apply"},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			Variables: map[string]string{
+				"ca":             ca,
+				"WORKSPACE_NAME": "ignored",
+			},
+		},
+	}
+
+	rendered, unresolved, err := replaceTemplateVariables(template, cr)
+	if err != nil {
+		t.Fatalf("replaceTemplateVariables() error = %v", err)
+	}
+	if len(unresolved) != 0 {
+		t.Errorf("unresolved = %v, expected none", unresolved)
+	}
+
+	forProvider := rendered.Spec.Template.Spec.ForProvider
+	if expected := "name = \"demo\"\nregion = \"us-west-2\""; forProvider.Module != expected {
+		t.Errorf("module = %q, expected %q", forProvider.Module, expected)
+	}
+	if forProvider.Vars[0].Value != ca {
+		t.Errorf("var value = %q, expected %q", forProvider.Vars[0].Value, ca)
+	}
+	if template.Spec.Template.Spec.ForProvider.Vars[0].Value != "${ca}" {
+		t.Error("original template was modified")
+	}
+}
+
+func TestReconcileReportsUnresolvedVariables(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = v1beta1.AddToScheme(scheme)
+	_ = tfv1beta1.SchemeBuilder.AddToScheme(scheme)
+
+	template := &v1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "vpc-template",
+			Namespace: "default",
+		},
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{
+						Module: `name = "${name}-${environment}"`,
+						Source: tfv1beta1.ModuleSourceInline,
+					},
+				},
+			},
+		},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:       "test-vpc",
+			Namespace:  "default",
+			Finalizers: []string{workspaceTemplateApplyFinalizer},
+		},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: v1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+			Variables:   map[string]string{"name": "demo"},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(cr, template).
+		WithStatusSubresource(&v1beta1.WorkspaceTemplateApply{}).
+		Build()
+
+	r := &workspaceTemplateApplyReconciler{
+		client: client,
+		log:    logging.NewNopLogger(),
+		record: event.NewNopRecorder(),
+	}
+
+	req := ctrl.Request{NamespacedName: types.NamespacedName{Name: "test-vpc", Namespace: "default"}}
+	result, err := r.Reconcile(context.Background(), req)
+	if err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	if result.RequeueAfter != requeueAfterSecret {
+		t.Errorf("RequeueAfter = %v, expected %v", result.RequeueAfter, requeueAfterSecret)
+	}
+
+	err = client.Get(context.Background(), req.NamespacedName, &tfv1beta1.Workspace{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("expected no workspace to be created, got error %v", err)
+	}
+
+	apply := &v1beta1.WorkspaceTemplateApply{}
+	if err := client.Get(context.Background(), req.NamespacedName, apply); err != nil {
+		t.Fatalf("failed to get WorkspaceTemplateApply: %v", err)
+	}
+	condition := FindStatusCondition(apply.Status.Conditions, v1beta1.VariablesResolvedCondition)
+	if condition == nil {
+		t.Fatal("VariablesResolved condition not set")
+	}
+	expected := xpv1.Condition{
+		Type:    v1beta1.VariablesResolvedCondition,
+		Status:  corev1.ConditionFalse,
+		Reason:  v1beta1.ReasonUnresolvedVariables,
+		Message: "Unresolved variables: environment",
+	}
+	if condition.Status != expected.Status || condition.Reason != expected.Reason || condition.Message != expected.Message {
+		t.Errorf("condition = %+v, expected %+v", *condition, expected)
+	}
+	if apply.Status.Applied {
+		t.Error("expected WorkspaceTemplateApply not to be applied")
+	}
+}
+
+func TestHCLLiteral(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "number", input: `3`, expected: `3`},
+		{name: "large number keeps precision", input: `12345678901234567890`, expected: `12345678901234567890`},
+		{name: "bool", input: `true`, expected: `true`},
+		{name: "null", input: `null`, expected: `null`},
+		{name: "list", input: `["subnet-a","subnet-b"]`, expected: `["subnet-a", "subnet-b"]`},
+		{name: "map keys are sorted", input: `{"role":"worker","env":"dev"}`, expected: `{"env" = "dev", "role" = "worker"}`},
+		{
+			name:     "list of objects",
+			input:    `[{"key":"dedicated","value":"gpu","effect":"NO_SCHEDULE"}]`,
+			expected: `[{"effect" = "NO_SCHEDULE", "key" = "dedicated", "value" = "gpu"}]`,
+		},
+		{name: "strings are escaped", input: `["a\"b\nc"]`, expected: `["a\"b\nc"]`},
+		{name: "template sequences are escaped", input: `["${var.x}","%{if}"]`, expected: `["$${var.x}", "%%{if}"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := decodeJSONValue([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("decodeJSONValue() error = %v", err)
+			}
+			if got := hclLiteral(value); got != tt.expected {
+				t.Errorf("hclLiteral() = %s, expected %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderWorkspaceSpecStructuredVariables(t *testing.T) {
+	template := &v1beta1.WorkspaceTemplate{
+		Spec: v1beta1.WorkspaceTemplateSpec{
+			Template: v1beta1.WorkspaceTemplateDefinition{
+				Spec: tfv1beta1.WorkspaceSpec{
+					ForProvider: tfv1beta1.WorkspaceParameters{
+						Module: "subnets = ${subnet_ids}\nname = \"${name}\"",
+						Source: tfv1beta1.ModuleSourceInline,
+						Vars: []tfv1beta1.Var{
+							{Key: "desired_size", Value: "${desired_size}"},
+						},
+						VarMap: &runtime.RawExtension{Raw: []byte(`{"region":"${region:-us-west-2}","tags":{"Owner":"template"}}`)},
+					},
+				},
+			},
+		},
+	}
+	cr := &v1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo"},
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			Variables: map[string]string{"name": "demo"},
+		},
+	}
+	for name, value := range map[string]interface{}{
+		"subnet_ids":   []string{"subnet-a", "subnet-b"},
+		"desired_size": 3,
+		"tags":         map[string]string{"Environment": "dev"},
+		"name_prefix":  "demo",
+	} {
+		if err := cr.Spec.SetStructuredVariable(name, value); err != nil {
+			t.Fatalf("SetStructuredVariable() error = %v", err)
+		}
+	}
+
+	spec, unresolved, err := renderWorkspaceSpec(template, cr)
+	if err != nil {
+		t.Fatalf("renderWorkspaceSpec() error = %v", err)
+	}
+	if len(unresolved) != 0 {
+		t.Errorf("unresolved = %v, expected none", unresolved)
+	}
+
+	if expected := "subnets = [\"subnet-a\", \"subnet-b\"]\nname = \"demo\""; spec.ForProvider.Module != expected {
+		t.Errorf("module = %q, expected %q", spec.ForProvider.Module, expected)
+	}
+	if spec.ForProvider.Vars[0].Value != "3" {
+		t.Errorf("desired_size = %q, expected %q", spec.ForProvider.Vars[0].Value, "3")
+	}
+
+	varMap, err := decodeJSONValue(spec.ForProvider.VarMap.Raw)
+	if err != nil {
+		t.Fatalf("failed to decode varmap: %v", err)
+	}
+	expected, _ := decodeJSONValue([]byte(`{
+		"region": "us-west-2",
+		"tags": {"Environment": "dev"},
+		"subnet_ids": ["subnet-a", "subnet-b"],
+		"desired_size": 3,
+		"name_prefix": "demo"
+	}`))
+	if !reflect.DeepEqual(varMap, expected) {
+		t.Errorf("varmap = %s, expected %v", spec.ForProvider.VarMap.Raw, expected)
+	}
+}
+
+func TestRenderWorkspaceSpecRejectsDuplicateVariables(t *testing.T) {
+	cr := &v1beta1.WorkspaceTemplateApply{
+		Spec: v1beta1.WorkspaceTemplateApplySpec{
+			Variables: map[string]string{"tags": "a"},
+		},
+	}
+	if err := cr.Spec.SetStructuredVariable("tags", map[string]string{"a": "b"}); err != nil {
+		t.Fatalf("SetStructuredVariable() error = %v", err)
+	}
+
+	if _, _, err := renderWorkspaceSpec(&v1beta1.WorkspaceTemplate{}, cr); err == nil {
+		t.Error("expected an error for a variable defined twice")
+	}
+}
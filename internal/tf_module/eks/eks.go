@@ -26,7 +26,8 @@ type EKSConfig struct {
 	CreateNodeSecurityGroup              *hcl.HclField `hcl:"create_node_security_group"`
 	EnableClusterCreatorAdminPermissions *hcl.HclField `hcl:"enable_cluster_creator_admin_permissions"`
 
-	// Fargate settings
+	// Fargate settings. These are the profiles of the system workloads; additional profiles
+	// are managed with CaptFargateProfiles.
 	FargateProfiles *hcl.HclField `hcl:"fargate_profiles"`
 
 	// Tags
@@ -0,0 +1,326 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+var (
+	// kubernetesVersion matches Kubernetes versions such as v1.31.0 or 1.31
+	kubernetesVersion = regexp.MustCompile(`^v?\d+\.\d+(\.\d+)?$`)
+
+	// awsRegion matches AWS region names such as ap-northeast-1 or us-gov-west-1
+	awsRegion = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+)
+
+// maxPublicCIDRs is the number of public access CIDR blocks EKS allows
+const maxPublicCIDRs = 40
+
+// SetupCAPTControlPlaneWebhookWithManager registers the webhook for CAPTControlPlane in the manager.
+func SetupCAPTControlPlaneWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&controlplanev1beta1.CAPTControlPlane{}).
+		WithValidator(&CAPTControlPlaneCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&CAPTControlPlaneCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-controlplane-cluster-x-k8s-io-v1beta1-captcontrolplane,mutating=true,failurePolicy=fail,sideEffects=None,groups=controlplane.cluster.x-k8s.io,resources=captcontrolplanes,verbs=create;update,versions=v1beta1,name=default.captcontrolplane.controlplane.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CAPTControlPlaneCustomDefaulter sets the WorkspaceTemplateApply name and the timeouts of CAPTControlPlanes.
+type CAPTControlPlaneCustomDefaulter struct{}
+
+var _ admission.CustomDefaulter = &CAPTControlPlaneCustomDefaulter{}
+
+// Default implements admission.CustomDefaulter.
+func (d *CAPTControlPlaneCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	controlPlane, ok := obj.(*controlplanev1beta1.CAPTControlPlane)
+	if !ok {
+		return fmt.Errorf("expected a CAPTControlPlane object but got %T", obj)
+	}
+
+	// Generated names are not known yet
+	if controlPlane.Name != "" {
+		controlPlane.Spec.WorkspaceTemplateApplyName = controlPlane.GetWorkspaceTemplateApplyName()
+	}
+
+	config := controlPlane.Spec.ControlPlaneConfig
+	if config == nil {
+		return nil
+	}
+	if config.Timeouts == nil {
+		config.Timeouts = &controlplanev1beta1.TimeoutConfig{}
+	}
+	if config.Timeouts.ControlPlaneTimeout == nil {
+		config.Timeouts.ControlPlaneTimeout = ptr.To(controlplanev1beta1.DefaultControlPlaneTimeout)
+	}
+	if config.Timeouts.VPCReadyTimeout == nil {
+		config.Timeouts.VPCReadyTimeout = ptr.To(controlplanev1beta1.DefaultVPCReadyTimeout)
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-controlplane-cluster-x-k8s-io-v1beta1-captcontrolplane,mutating=false,failurePolicy=fail,sideEffects=None,groups=controlplane.cluster.x-k8s.io,resources=captcontrolplanes,verbs=create;update,versions=v1beta1,name=validation.captcontrolplane.controlplane.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CAPTControlPlaneCustomValidator validates CAPTControlPlanes on creation and update.
+type CAPTControlPlaneCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CAPTControlPlaneCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CAPTControlPlaneCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	controlPlane, ok := obj.(*controlplanev1beta1.CAPTControlPlane)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTControlPlane object but got %T", obj)
+	}
+	return v.validate(ctx, controlPlane, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CAPTControlPlaneCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*controlplanev1beta1.CAPTControlPlane)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTControlPlane object but got %T", oldObj)
+	}
+	controlPlane, ok := newObj.(*controlplanev1beta1.CAPTControlPlane)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTControlPlane object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !controlPlane.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, controlPlane, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CAPTControlPlaneCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CAPTControlPlaneCustomValidator) validate(ctx context.Context, controlPlane, old *controlplanev1beta1.CAPTControlPlane) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	var allErrs field.ErrorList
+
+	if !kubernetesVersion.MatchString(controlPlane.Spec.Version) {
+		allErrs = append(allErrs, field.Invalid(spec.Child("version"), controlPlane.Spec.Version, "must be a Kubernetes version, e.g. v1.31.0"))
+	}
+	if controlPlane.Spec.WorkspaceTemplateRef.Name == "" {
+		allErrs = append(allErrs, field.Required(spec.Child("workspaceTemplateRef", "name"), "workspace template name is required"))
+	}
+	if config := controlPlane.Spec.ControlPlaneConfig; config != nil {
+		allErrs = append(allErrs, validateControlPlaneConfig(config, spec.Child("controlPlaneConfig"))...)
+	}
+
+	if old != nil && region(controlPlane) != region(old) {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("controlPlaneConfig", "region"), "region is immutable"))
+	}
+	if old != nil {
+		allErrs = append(allErrs, validateVersionUpgrade(controlPlane, old, spec.Child("version"))...)
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(controlplanev1beta1.GroupVersion.WithKind("CAPTControlPlane").GroupKind(), controlPlane.Name, allErrs)
+	}
+
+	var warnings admission.Warnings
+	if old != nil {
+		warnings = endpointAccessWarnings(controlPlane, old, spec.Child("controlPlaneConfig", "endpointAccess", "public"))
+	}
+	templateWarnings, err := v.templateRefWarnings(ctx, controlPlane, controlPlane.Spec.WorkspaceTemplateRef, spec.Child("workspaceTemplateRef"))
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, templateWarnings...)
+	if templates := controlPlane.Spec.SpotRoleTemplates; templates != nil {
+		path := spec.Child("spotRoleTemplates")
+		if templates.CheckTemplateRef != nil {
+			templateWarnings, err := v.templateRefWarnings(ctx, controlPlane, *templates.CheckTemplateRef, path.Child("checkTemplateRef"))
+			if err != nil {
+				return nil, err
+			}
+			warnings = append(warnings, templateWarnings...)
+		}
+		if templates.CreateTemplateRef != nil {
+			templateWarnings, err := v.templateRefWarnings(ctx, controlPlane, *templates.CreateTemplateRef, path.Child("createTemplateRef"))
+			if err != nil {
+				return nil, err
+			}
+			warnings = append(warnings, templateWarnings...)
+		}
+	}
+	return warnings, nil
+}
+
+func validateControlPlaneConfig(config *controlplanev1beta1.ControlPlaneConfig, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if !awsRegion.MatchString(config.Region) {
+		allErrs = append(allErrs, field.Invalid(path.Child("region"), config.Region, "must be an AWS region name, e.g. ap-northeast-1"))
+	}
+
+	if access := config.EndpointAccess; access != nil {
+		accessPath := path.Child("endpointAccess")
+		if !access.Public && !access.Private {
+			allErrs = append(allErrs, field.Invalid(accessPath, field.OmitValueType{}, "at least one of public or private endpoint access must be enabled"))
+		}
+		if len(access.PublicCIDRs) > 0 && !access.Public {
+			allErrs = append(allErrs, field.Forbidden(accessPath.Child("publicCIDRs"), "may only be specified with public endpoint access"))
+		}
+		allErrs = append(allErrs, validatePublicCIDRs(access.PublicCIDRs, accessPath.Child("publicCIDRs"))...)
+	}
+
+	seen := make(map[string]bool, len(config.Addons))
+	for i, addon := range config.Addons {
+		addonPath := path.Child("addons").Index(i)
+		switch {
+		case addon.Name == "":
+			allErrs = append(allErrs, field.Required(addonPath.Child("name"), "addon name is required"))
+		case seen[addon.Name]:
+			allErrs = append(allErrs, field.Duplicate(addonPath.Child("name"), addon.Name))
+		}
+		seen[addon.Name] = true
+	}
+
+	if timeouts := config.Timeouts; timeouts != nil {
+		if timeouts.ControlPlaneTimeout != nil && *timeouts.ControlPlaneTimeout <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("timeouts", "controlPlaneTimeout"), *timeouts.ControlPlaneTimeout, "must be positive"))
+		}
+		if timeouts.VPCReadyTimeout != nil && *timeouts.VPCReadyTimeout <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("timeouts", "vpcReadyTimeout"), *timeouts.VPCReadyTimeout, "must be positive"))
+		}
+	}
+	return allErrs
+}
+
+// validatePublicCIDRs checks that the public access CIDR blocks are unique public IPv4 networks,
+// which is what EKS accepts for the public endpoint
+func validatePublicCIDRs(cidrs []string, path *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if len(cidrs) > maxPublicCIDRs {
+		allErrs = append(allErrs, field.TooMany(path, len(cidrs), maxPublicCIDRs))
+	}
+	seen := make(map[string]bool, len(cidrs))
+	for i, cidr := range cidrs {
+		ip, network, err := net.ParseCIDR(cidr)
+		switch {
+		case err != nil || ip.To4() == nil:
+			allErrs = append(allErrs, field.Invalid(path.Index(i), cidr, "must be an IPv4 CIDR block, e.g. 203.0.113.0/24"))
+		case ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast():
+			allErrs = append(allErrs, field.Invalid(path.Index(i), cidr, "must be a public CIDR block, use private endpoint access for private networks"))
+		case seen[network.String()]:
+			allErrs = append(allErrs, field.Duplicate(path.Index(i), cidr))
+		}
+		if network != nil {
+			seen[network.String()] = true
+		}
+	}
+	return allErrs
+}
+
+// endpointAccessWarnings warns when the public endpoint of a running control plane is disabled,
+// as the controller has to reach the private endpoint to regenerate the kubeconfig afterwards
+func endpointAccessWarnings(controlPlane, old *controlplanev1beta1.CAPTControlPlane, path *field.Path) admission.Warnings {
+	access, oldAccess := endpointAccess(controlPlane), endpointAccess(old)
+	if access == nil || oldAccess == nil || access.Public || !oldAccess.Public {
+		return nil
+	}
+	return admission.Warnings{fmt.Sprintf("%s: disabling public endpoint access requires the management cluster to reach the private endpoint of the control plane", path)}
+}
+
+// validateVersionUpgrade allows upgrading the control plane one minor version at a time.
+// The step is checked against the running version in status.version if it is known, so that
+// a new upgrade cannot skip a minor version while the previous one is still in progress.
+func validateVersionUpgrade(controlPlane, old *controlplanev1beta1.CAPTControlPlane, path *field.Path) field.ErrorList {
+	if controlPlane.Spec.Version == old.Spec.Version {
+		return nil
+	}
+	// Malformed versions are reported by the version pattern check
+	desired, err := version.ParseGeneric(controlPlane.Spec.Version)
+	if err != nil {
+		return nil
+	}
+	previous, err := version.ParseGeneric(old.Spec.Version)
+	if err != nil {
+		return nil
+	}
+
+	if desired.LessThan(previous) {
+		return field.ErrorList{field.Forbidden(path, fmt.Sprintf("cannot downgrade from %s to %s", old.Spec.Version, controlPlane.Spec.Version))}
+	}
+
+	current, currentVersion := previous, old.Spec.Version
+	if running, err := version.ParseGeneric(old.Status.Version); err == nil {
+		current, currentVersion = running, old.Status.Version
+	}
+	if desired.Major() != current.Major() || desired.Minor() > current.Minor()+1 {
+		return field.ErrorList{field.Forbidden(path, fmt.Sprintf("can only be upgraded one minor version at a time, the control plane runs %s", currentVersion))}
+	}
+	return nil
+}
+
+// templateRefWarnings warns when the referenced WorkspaceTemplate does not exist yet.
+// Missing templates are not rejected, so that templates and control planes can be
+// applied together; the controller waits for the template instead.
+func (v *CAPTControlPlaneCustomValidator) templateRefWarnings(ctx context.Context, controlPlane *controlplanev1beta1.CAPTControlPlane, ref controlplanev1beta1.WorkspaceTemplateReference, path *field.Path) (admission.Warnings, error) {
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = controlPlane.Namespace
+	}
+
+	err := v.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, &infrastructurev1beta1.WorkspaceTemplate{})
+	if apierrors.IsNotFound(err) {
+		return admission.Warnings{fmt.Sprintf("%s: WorkspaceTemplate %s/%s not found", path, namespace, ref.Name)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WorkspaceTemplate %s/%s: %w", namespace, ref.Name, err)
+	}
+	return nil, nil
+}
+
+// endpointAccess returns the configured endpoint access of the CAPTControlPlane
+func endpointAccess(controlPlane *controlplanev1beta1.CAPTControlPlane) *controlplanev1beta1.EndpointAccess {
+	if controlPlane.Spec.ControlPlaneConfig == nil {
+		return nil
+	}
+	return controlPlane.Spec.ControlPlaneConfig.EndpointAccess
+}
+
+// region returns the configured region of the CAPTControlPlane
+func region(controlPlane *controlplanev1beta1.CAPTControlPlane) string {
+	if controlPlane.Spec.ControlPlaneConfig == nil {
+		return ""
+	}
+	return controlPlane.Spec.ControlPlaneConfig.Region
+}
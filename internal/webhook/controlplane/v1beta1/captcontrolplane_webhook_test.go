@@ -0,0 +1,253 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newFakeReader(objs ...client.Object) client.Reader {
+	scheme := runtime.NewScheme()
+	_ = controlplanev1beta1.AddToScheme(scheme)
+	_ = infrastructurev1beta1.AddToScheme(scheme)
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+}
+
+func newCAPTControlPlane(mutate func(*controlplanev1beta1.CAPTControlPlaneSpec)) *controlplanev1beta1.CAPTControlPlane {
+	controlPlane := &controlplanev1beta1.CAPTControlPlane{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cp", Namespace: "default"},
+		Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+			Version:              "v1.31.0",
+			WorkspaceTemplateRef: controlplanev1beta1.WorkspaceTemplateReference{Name: "eks-template"},
+			ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{
+				Region: "ap-northeast-1",
+				EndpointAccess: &controlplanev1beta1.EndpointAccess{
+					Public:      true,
+					Private:     true,
+					PublicCIDRs: []string{"203.0.113.0/24"},
+				},
+				Addons: []controlplanev1beta1.Addon{{Name: "coredns"}, {Name: "vpc-cni"}},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(&controlPlane.Spec)
+	}
+	return controlPlane
+}
+
+func TestCAPTControlPlaneValidateCreate(t *testing.T) {
+	template := &infrastructurev1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "eks-template", Namespace: "default"},
+	}
+
+	tests := []struct {
+		name         string
+		mutate       func(*controlplanev1beta1.CAPTControlPlaneSpec)
+		wantErr      string
+		wantWarnings int
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "invalid version",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.Version = "latest"
+			},
+			wantErr: "spec.version",
+		},
+		{
+			name: "missing template name",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.WorkspaceTemplateRef.Name = ""
+			},
+			wantErr: "spec.workspaceTemplateRef.name",
+		},
+		{
+			name: "no endpoint access",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.EndpointAccess = &controlplanev1beta1.EndpointAccess{}
+			},
+			wantErr: "at least one of public or private endpoint access must be enabled",
+		},
+		{
+			name: "public CIDRs without public access",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.EndpointAccess.Public = false
+			},
+			wantErr: "spec.controlPlaneConfig.endpointAccess.publicCIDRs",
+		},
+		{
+			name: "invalid public CIDR",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.EndpointAccess.PublicCIDRs = []string{"203.0.113.0"}
+			},
+			wantErr: "spec.controlPlaneConfig.endpointAccess.publicCIDRs[0]",
+		},
+		{
+			name: "private public CIDR",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.EndpointAccess.PublicCIDRs = []string{"203.0.113.0/24", "10.0.0.0/8"}
+			},
+			wantErr: "spec.controlPlaneConfig.endpointAccess.publicCIDRs[1]",
+		},
+		{
+			name: "IPv6 public CIDR",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.EndpointAccess.PublicCIDRs = []string{"2001:db8::/32"}
+			},
+			wantErr: "must be an IPv4 CIDR block",
+		},
+		{
+			name: "duplicate public CIDR",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.EndpointAccess.PublicCIDRs = []string{"203.0.113.0/24", "203.0.113.1/24"}
+			},
+			wantErr: "spec.controlPlaneConfig.endpointAccess.publicCIDRs[1]: Duplicate value",
+		},
+		{
+			name: "duplicate addon",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.Addons = append(spec.ControlPlaneConfig.Addons, controlplanev1beta1.Addon{Name: "coredns"})
+			},
+			wantErr: "spec.controlPlaneConfig.addons[2].name",
+		},
+		{
+			name: "non-positive timeout",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.ControlPlaneConfig.Timeouts = &controlplanev1beta1.TimeoutConfig{VPCReadyTimeout: ptr.To(0)}
+			},
+			wantErr: "spec.controlPlaneConfig.timeouts.vpcReadyTimeout",
+		},
+		{
+			name: "missing template",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.WorkspaceTemplateRef.Name = "missing"
+			},
+			wantWarnings: 1,
+		},
+		{
+			name: "missing spot role templates",
+			mutate: func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+				spec.SpotRoleTemplates = &controlplanev1beta1.SpotRoleTemplates{
+					CheckTemplateRef:  &controlplanev1beta1.WorkspaceTemplateReference{Name: "eks-template"},
+					CreateTemplateRef: &controlplanev1beta1.WorkspaceTemplateReference{Name: "missing"},
+				}
+			},
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CAPTControlPlaneCustomValidator{Client: newFakeReader(template)}
+
+			warnings, err := v.ValidateCreate(context.Background(), newCAPTControlPlane(tt.mutate))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, warnings, tt.wantWarnings)
+		})
+	}
+}
+
+func TestCAPTControlPlaneValidateUpdate(t *testing.T) {
+	template := &infrastructurev1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "eks-template", Namespace: "default"},
+	}
+	v := &CAPTControlPlaneCustomValidator{Client: newFakeReader(template)}
+	old := newCAPTControlPlane(nil)
+
+	_, err := v.ValidateUpdate(context.Background(), old, newCAPTControlPlane(func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+		spec.Version = "v1.32.0"
+	}))
+	assert.NoError(t, err)
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCAPTControlPlane(func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+		spec.ControlPlaneConfig.Region = "us-west-2"
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "region is immutable")
+
+	// Switching to private endpoint access is allowed with a warning
+	warnings, err := v.ValidateUpdate(context.Background(), old, newCAPTControlPlane(func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+		spec.ControlPlaneConfig.EndpointAccess = &controlplanev1beta1.EndpointAccess{Private: true}
+	}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "spec.controlPlaneConfig.endpointAccess.public")
+}
+
+func TestCAPTControlPlaneDefault(t *testing.T) {
+	d := &CAPTControlPlaneCustomDefaulter{}
+
+	controlPlane := newCAPTControlPlane(nil)
+	require.NoError(t, d.Default(context.Background(), controlPlane))
+	assert.Equal(t, "test-cp-eks-controlplane-apply", controlPlane.Spec.WorkspaceTemplateApplyName)
+	require.NotNil(t, controlPlane.Spec.ControlPlaneConfig.Timeouts)
+	assert.Equal(t, ptr.To(controlplanev1beta1.DefaultControlPlaneTimeout), controlPlane.Spec.ControlPlaneConfig.Timeouts.ControlPlaneTimeout)
+	assert.Equal(t, ptr.To(controlplanev1beta1.DefaultVPCReadyTimeout), controlPlane.Spec.ControlPlaneConfig.Timeouts.VPCReadyTimeout)
+
+	// Configured values are kept
+	controlPlane = newCAPTControlPlane(func(spec *controlplanev1beta1.CAPTControlPlaneSpec) {
+		spec.WorkspaceTemplateApplyName = "custom-apply"
+		spec.ControlPlaneConfig.Timeouts = &controlplanev1beta1.TimeoutConfig{ControlPlaneTimeout: ptr.To(60)}
+	})
+	require.NoError(t, d.Default(context.Background(), controlPlane))
+	assert.Equal(t, "custom-apply", controlPlane.Spec.WorkspaceTemplateApplyName)
+	assert.Equal(t, ptr.To(60), controlPlane.Spec.ControlPlaneConfig.Timeouts.ControlPlaneTimeout)
+	assert.Equal(t, ptr.To(controlplanev1beta1.DefaultVPCReadyTimeout), controlPlane.Spec.ControlPlaneConfig.Timeouts.VPCReadyTimeout)
+}
+
+func TestCAPTControlPlaneValidateVersionUpgrade(t *testing.T) {
+	template := &infrastructurev1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "eks-template", Namespace: "default"},
+	}
+	v := &CAPTControlPlaneCustomValidator{Client: newFakeReader(template)}
+
+	tests := []struct {
+		name          string
+		oldVersion    string
+		statusVersion string
+		newVersion    string
+		wantErr       string
+	}{
+		{name: "patch upgrade", oldVersion: "v1.31.0", newVersion: "v1.31.2"},
+		{name: "minor upgrade", oldVersion: "v1.31.0", statusVersion: "v1.31.0", newVersion: "v1.32.0"},
+		{name: "EKS style versions", oldVersion: "1.31", newVersion: "1.32"},
+		{name: "skipping a minor version", oldVersion: "v1.31.0", newVersion: "v1.33.0", wantErr: "one minor version at a time"},
+		{name: "skipping during an upgrade", oldVersion: "v1.32.0", statusVersion: "v1.31.0", newVersion: "v1.33.0", wantErr: "runs v1.31.0"},
+		{name: "downgrade", oldVersion: "v1.31.0", newVersion: "v1.30.0", wantErr: "cannot downgrade"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := newCAPTControlPlane(func(spec *controlplanev1beta1.CAPTControlPlaneSpec) { spec.Version = tt.oldVersion })
+			old.Status.Version = tt.statusVersion
+			controlPlane := old.DeepCopy()
+			controlPlane.Spec.Version = tt.newVersion
+
+			_, err := v.ValidateUpdate(context.Background(), old, controlPlane)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
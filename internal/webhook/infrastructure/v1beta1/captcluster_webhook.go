@@ -0,0 +1,157 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// vpcID matches AWS VPC IDs
+var vpcID = regexp.MustCompile(`^vpc-[0-9a-f]{8}([0-9a-f]{9})?$`)
+
+// SetupCAPTClusterWebhookWithManager registers the webhook for CAPTCluster in the manager.
+func SetupCAPTClusterWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CAPTCluster{}).
+		WithValidator(&CAPTClusterCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&CAPTClusterCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-captcluster,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captclusters,verbs=create;update,versions=v1beta1,name=default.captcluster.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CAPTClusterCustomDefaulter sets the VPC name and the VPC WorkspaceTemplateApply name of managed VPCs.
+type CAPTClusterCustomDefaulter struct{}
+
+var _ admission.CustomDefaulter = &CAPTClusterCustomDefaulter{}
+
+// Default implements admission.CustomDefaulter.
+func (d *CAPTClusterCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	cluster, ok := obj.(*infrastructurev1beta1.CAPTCluster)
+	if !ok {
+		return fmt.Errorf("expected a CAPTCluster object but got %T", obj)
+	}
+	// Existing VPCs are not managed by CAPT, and generated names are not known yet
+	if cluster.Spec.VPCTemplateRef == nil || cluster.Name == "" {
+		return nil
+	}
+
+	if cluster.Spec.VPCConfig == nil {
+		cluster.Spec.VPCConfig = &infrastructurev1beta1.VPCConfig{}
+	}
+	cluster.Spec.VPCConfig.Name = cluster.GetVPCName()
+	cluster.Spec.WorkspaceTemplateApplyName = cluster.GetWorkspaceTemplateApplyName()
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captcluster,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captclusters,verbs=create;update,versions=v1beta1,name=validation.captcluster.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CAPTClusterCustomValidator validates CAPTClusters on creation and update.
+type CAPTClusterCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CAPTClusterCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CAPTClusterCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	cluster, ok := obj.(*infrastructurev1beta1.CAPTCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTCluster object but got %T", obj)
+	}
+	return v.validate(ctx, cluster, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CAPTClusterCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CAPTCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTCluster object but got %T", oldObj)
+	}
+	cluster, ok := newObj.(*infrastructurev1beta1.CAPTCluster)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTCluster object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !cluster.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, cluster, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CAPTClusterCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CAPTClusterCustomValidator) validate(ctx context.Context, cluster, old *infrastructurev1beta1.CAPTCluster) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateRegion(cluster.Spec.Region, spec.Child("region"))
+
+	if err := cluster.Spec.ValidateVPCConfiguration(); err != nil {
+		allErrs = append(allErrs, field.Invalid(spec, field.OmitValueType{}, err.Error()))
+	}
+	if cluster.Spec.VPCTemplateRef != nil {
+		allErrs = append(allErrs, validateTemplateRef(*cluster.Spec.VPCTemplateRef, spec.Child("vpcTemplateRef"))...)
+	}
+	if ref := cluster.Spec.IdentityRef; ref != nil && ref.Name == "" {
+		allErrs = append(allErrs, field.Required(spec.Child("identityRef", "name"), "identity name is required"))
+	}
+	if id := cluster.Spec.ExistingVPCID; id != "" && !vpcID.MatchString(id) {
+		allErrs = append(allErrs, field.Invalid(spec.Child("existingVpcId"), id, "must be a VPC ID, e.g. vpc-0123456789abcdef0"))
+	}
+
+	if old != nil {
+		if cluster.Spec.Region != old.Spec.Region {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("region"), "region is immutable"))
+		}
+		if cluster.Spec.ExistingVPCID != old.Spec.ExistingVPCID {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("existingVpcId"), "existingVpcId is immutable"))
+		}
+		if (cluster.Spec.VPCTemplateRef == nil) != (old.Spec.VPCTemplateRef == nil) {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("vpcTemplateRef"), "cannot switch between a managed and an existing VPC"))
+		}
+		// Compare the effective names, so that defaulting the name of existing clusters is allowed
+		if cluster.Spec.VPCTemplateRef != nil && old.Spec.VPCTemplateRef != nil && cluster.GetVPCName() != old.GetVPCName() {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("vpcConfig", "name"), "VPC name is immutable"))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CAPTCluster").GroupKind(), cluster.Name, allErrs)
+	}
+
+	warnings, err := identityRefWarnings(ctx, v.Client, cluster.Spec.IdentityRef, cluster.Namespace, spec.Child("identityRef"))
+	if err != nil || cluster.Spec.VPCTemplateRef == nil {
+		return warnings, err
+	}
+	templateWarnings, err := templateRefWarnings(ctx, v.Client, *cluster.Spec.VPCTemplateRef, cluster.Namespace, spec.Child("vpcTemplateRef"))
+	if err != nil {
+		return nil, err
+	}
+	return append(warnings, templateWarnings...), nil
+}
@@ -0,0 +1,178 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	_ = infrastructurev1beta1.AddToScheme(scheme)
+	return scheme
+}
+
+func newFakeReader(objs ...client.Object) client.Reader {
+	return fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(objs...).Build()
+}
+
+func newVPCTemplate() *infrastructurev1beta1.WorkspaceTemplate {
+	return &infrastructurev1beta1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "vpc-template", Namespace: "default"},
+	}
+}
+
+func newCAPTCluster(mutate func(*infrastructurev1beta1.CAPTClusterSpec)) *infrastructurev1beta1.CAPTCluster {
+	cluster := &infrastructurev1beta1.CAPTCluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"},
+		Spec: infrastructurev1beta1.CAPTClusterSpec{
+			Region:         "ap-northeast-1",
+			VPCTemplateRef: &infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+		},
+	}
+	if mutate != nil {
+		mutate(&cluster.Spec)
+	}
+	return cluster
+}
+
+func TestCAPTClusterValidateCreate(t *testing.T) {
+	tests := []struct {
+		name           string
+		cluster        *infrastructurev1beta1.CAPTCluster
+		wantErr        string
+		wantWarnings   int
+		withoutObjects bool
+	}{
+		{
+			name:    "valid managed VPC",
+			cluster: newCAPTCluster(nil),
+		},
+		{
+			name: "valid existing VPC",
+			cluster: newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+				spec.VPCTemplateRef = nil
+				spec.ExistingVPCID = "vpc-0123456789abcdef0"
+			}),
+		},
+		{
+			name: "both VPC options",
+			cluster: newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+				spec.ExistingVPCID = "vpc-0123456789abcdef0"
+			}),
+			wantErr: "cannot specify both VPCTemplateRef and ExistingVPCID",
+		},
+		{
+			name: "invalid VPC ID",
+			cluster: newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+				spec.VPCTemplateRef = nil
+				spec.ExistingVPCID = "my-vpc"
+			}),
+			wantErr: "spec.existingVpcId",
+		},
+		{
+			name: "invalid region",
+			cluster: newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+				spec.Region = "Tokyo"
+			}),
+			wantErr: "spec.region",
+		},
+		{
+			name:           "missing template",
+			cluster:        newCAPTCluster(nil),
+			withoutObjects: true,
+			wantWarnings:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newFakeReader(newVPCTemplate())
+			if tt.withoutObjects {
+				reader = newFakeReader()
+			}
+			v := &CAPTClusterCustomValidator{Client: reader}
+
+			warnings, err := v.ValidateCreate(context.Background(), tt.cluster)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, warnings, tt.wantWarnings)
+		})
+	}
+}
+
+func TestCAPTClusterValidateUpdate(t *testing.T) {
+	v := &CAPTClusterCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	old := newCAPTCluster(nil)
+
+	_, err := v.ValidateUpdate(context.Background(), old, newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+		spec.RetainVPCOnDelete = true
+	}))
+	assert.NoError(t, err)
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+		spec.Region = "us-west-2"
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "region is immutable")
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+		spec.VPCTemplateRef = nil
+		spec.ExistingVPCID = "vpc-0123456789abcdef0"
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot switch between a managed and an existing VPC")
+
+	// Finalizers can be removed from deleted objects regardless of their spec
+	deleting := newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) { spec.Region = "" })
+	now := metav1.Now()
+	deleting.DeletionTimestamp = &now
+	_, err = v.ValidateUpdate(context.Background(), old, deleting)
+	assert.NoError(t, err)
+}
+
+func TestCAPTClusterDefault(t *testing.T) {
+	d := &CAPTClusterCustomDefaulter{}
+
+	cluster := newCAPTCluster(nil)
+	require.NoError(t, d.Default(context.Background(), cluster))
+	assert.Equal(t, "test-cluster-vpc", cluster.Spec.VPCConfig.Name)
+	assert.Equal(t, "test-cluster-vpc", cluster.Spec.WorkspaceTemplateApplyName)
+
+	// Configured names are kept
+	cluster = newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+		spec.VPCConfig = &infrastructurev1beta1.VPCConfig{Name: "shared-vpc"}
+		spec.WorkspaceTemplateApplyName = "shared-vpc-apply"
+	})
+	require.NoError(t, d.Default(context.Background(), cluster))
+	assert.Equal(t, "shared-vpc", cluster.Spec.VPCConfig.Name)
+	assert.Equal(t, "shared-vpc-apply", cluster.Spec.WorkspaceTemplateApplyName)
+
+	// Existing VPCs are not named by CAPT
+	cluster = newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+		spec.VPCTemplateRef = nil
+		spec.ExistingVPCID = "vpc-0123456789abcdef0"
+	})
+	require.NoError(t, d.Default(context.Background(), cluster))
+	assert.Nil(t, cluster.Spec.VPCConfig)
+	assert.Empty(t, cluster.Spec.WorkspaceTemplateApplyName)
+
+	// Defaulting the VPC name of a cluster created without it is not a change of the name
+	v := &CAPTClusterCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	defaulted := newCAPTCluster(nil)
+	require.NoError(t, d.Default(context.Background(), defaulted))
+	_, err := v.ValidateUpdate(context.Background(), newCAPTCluster(nil), defaulted)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,120 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+var (
+	// iamRoleARN matches IAM role ARNs in all AWS partitions
+	iamRoleARN = regexp.MustCompile(`^arn:aws[a-z-]*:iam::\d{12}:role/[\w+=,.@/-]+$`)
+
+	// awsProviderBlock matches a provider "aws" block in Terraform configuration
+	awsProviderBlock = regexp.MustCompile(`(?m)^\s*provider\s+"aws"\s*\{`)
+)
+
+// SetupCAPTClusterIdentityWebhookWithManager registers the webhook for CAPTClusterIdentity in the manager.
+func SetupCAPTClusterIdentityWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CAPTClusterIdentity{}).
+		WithValidator(&CAPTClusterIdentityCustomValidator{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captclusteridentity,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captclusteridentities,verbs=create;update,versions=v1beta1,name=validation.captclusteridentity.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CAPTClusterIdentityCustomValidator validates CAPTClusterIdentities on creation and update.
+type CAPTClusterIdentityCustomValidator struct{}
+
+var _ admission.CustomValidator = &CAPTClusterIdentityCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CAPTClusterIdentityCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	identity, ok := obj.(*infrastructurev1beta1.CAPTClusterIdentity)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTClusterIdentity object but got %T", obj)
+	}
+	return validateCAPTClusterIdentity(identity)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CAPTClusterIdentityCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	identity, ok := newObj.(*infrastructurev1beta1.CAPTClusterIdentity)
+	if !ok {
+		return nil, fmt.Errorf("expected a CAPTClusterIdentity object but got %T", newObj)
+	}
+	return validateCAPTClusterIdentity(identity)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CAPTClusterIdentityCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validateCAPTClusterIdentity(identity *infrastructurev1beta1.CAPTClusterIdentity) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	var allErrs field.ErrorList
+
+	switch {
+	case identity.Spec.SecretRef == nil && identity.Spec.RoleARN == "":
+		allErrs = append(allErrs, field.Required(spec, "one of secretRef or roleARN is required"))
+	case identity.Spec.SecretRef != nil && identity.Spec.RoleARN != "":
+		allErrs = append(allErrs, field.Forbidden(spec.Child("roleARN"), "secretRef and roleARN are mutually exclusive"))
+	}
+	if ref := identity.Spec.SecretRef; ref != nil {
+		path := spec.Child("secretRef")
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(path.Child("name"), "secret name is required"))
+		}
+		if ref.Namespace == "" {
+			allErrs = append(allErrs, field.Required(path.Child("namespace"), "secret namespace is required"))
+		}
+		if ref.Key == "" {
+			allErrs = append(allErrs, field.Required(path.Child("key"), "secret key is required"))
+		}
+	}
+	if arn := identity.Spec.RoleARN; arn != "" && !iamRoleARN.MatchString(arn) {
+		allErrs = append(allErrs, field.Invalid(spec.Child("roleARN"), arn, "must be an IAM role ARN, e.g. arn:aws:iam::123456789012:role/capt"))
+	}
+	if awsProviderBlock.MatchString(identity.Spec.Configuration) {
+		allErrs = append(allErrs, field.Invalid(spec.Child("configuration"), field.OmitValueType{}, "must not declare the aws provider, which is configured from the identity"))
+	}
+	if allowed := identity.Spec.AllowedNamespaces; allowed != nil && allowed.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(allowed.Selector); err != nil {
+			allErrs = append(allErrs, field.Invalid(spec.Child("allowedNamespaces", "selector"), allowed.Selector, err.Error()))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CAPTClusterIdentity").GroupKind(), identity.Name, allErrs)
+	}
+	if identity.Spec.AllowedNamespaces == nil {
+		return admission.Warnings{fmt.Sprintf("%s: no namespace may use the identity until allowed namespaces are set", spec.Child("allowedNamespaces"))}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,144 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newCAPTClusterIdentity(mutate func(*infrastructurev1beta1.CAPTClusterIdentitySpec)) *infrastructurev1beta1.CAPTClusterIdentity {
+	identity := &infrastructurev1beta1.CAPTClusterIdentity{
+		ObjectMeta: metav1.ObjectMeta{Name: "tenant-a"},
+		Spec: infrastructurev1beta1.CAPTClusterIdentitySpec{
+			AllowedNamespaces: &infrastructurev1beta1.AllowedNamespaces{List: []string{"tenant-a"}},
+			RoleARN:           "arn:aws:iam::123456789012:role/tenant-a",
+		},
+	}
+	if mutate != nil {
+		mutate(&identity.Spec)
+	}
+	return identity
+}
+
+func TestCAPTClusterIdentityValidateCreate(t *testing.T) {
+	tests := []struct {
+		name         string
+		identity     *infrastructurev1beta1.CAPTClusterIdentity
+		wantErr      string
+		wantWarnings int
+	}{
+		{
+			name:     "valid role identity",
+			identity: newCAPTClusterIdentity(nil),
+		},
+		{
+			name: "valid secret identity",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.RoleARN = ""
+				spec.SecretRef = &xpv1.SecretKeySelector{
+					SecretReference: xpv1.SecretReference{Name: "tenant-a-creds", Namespace: "crossplane-system"},
+					Key:             "credentials",
+				}
+			}),
+		},
+		{
+			name: "no credentials",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.RoleARN = ""
+			}),
+			wantErr: "one of secretRef or roleARN is required",
+		},
+		{
+			name: "secretRef and roleARN",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.SecretRef = &xpv1.SecretKeySelector{
+					SecretReference: xpv1.SecretReference{Name: "tenant-a-creds", Namespace: "crossplane-system"},
+					Key:             "credentials",
+				}
+			}),
+			wantErr: "mutually exclusive",
+		},
+		{
+			name: "incomplete secretRef",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.RoleARN = ""
+				spec.SecretRef = &xpv1.SecretKeySelector{SecretReference: xpv1.SecretReference{Name: "tenant-a-creds"}}
+			}),
+			wantErr: "spec.secretRef.namespace",
+		},
+		{
+			name: "invalid role ARN",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.RoleARN = "arn:aws:iam::123456789012:user/tenant-a"
+			}),
+			wantErr: "must be an IAM role ARN",
+		},
+		{
+			name: "configuration declares the aws provider",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.Configuration = "provider \"aws\" {\n  region = \"us-east-1\"\n}\n"
+			}),
+			wantErr: "must not declare the aws provider",
+		},
+		{
+			name: "invalid selector",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.AllowedNamespaces.Selector = &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "tenant", Operator: "Like"}},
+				}
+			}),
+			wantErr: "spec.allowedNamespaces.selector",
+		},
+		{
+			name: "no allowed namespaces",
+			identity: newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+				spec.AllowedNamespaces = nil
+			}),
+			wantWarnings: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := &CAPTClusterIdentityCustomValidator{}
+			warnings, err := validator.ValidateCreate(context.Background(), tt.identity)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, warnings, tt.wantWarnings)
+		})
+	}
+}
+
+func TestCAPTClusterIdentityRefWarnings(t *testing.T) {
+	cluster := newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+		spec.IdentityRef = &infrastructurev1beta1.IdentityReference{Name: "tenant-a"}
+	})
+	validator := &CAPTClusterCustomValidator{}
+
+	validator.Client = newFakeReader(newVPCTemplate())
+	warnings, err := validator.ValidateCreate(context.Background(), cluster)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1)
+
+	validator.Client = newFakeReader(newVPCTemplate(), newCAPTClusterIdentity(nil))
+	warnings, err = validator.ValidateCreate(context.Background(), cluster)
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1, "namespace default is not allowed")
+
+	validator.Client = newFakeReader(newVPCTemplate(), newCAPTClusterIdentity(func(spec *infrastructurev1beta1.CAPTClusterIdentitySpec) {
+		spec.AllowedNamespaces = &infrastructurev1beta1.AllowedNamespaces{}
+	}))
+	warnings, err = validator.ValidateCreate(context.Background(), cluster)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// maxFargateSelectors is the number of selectors EKS allows per Fargate profile
+const maxFargateSelectors = 5
+
+// SetupCaptFargateProfileWebhookWithManager registers the webhook for CaptFargateProfile in the manager.
+func SetupCaptFargateProfileWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CaptFargateProfile{}).
+		WithValidator(&CaptFargateProfileCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captfargateprofile,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captfargateprofiles,verbs=create;update,versions=v1beta1,name=validation.captfargateprofile.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptFargateProfileCustomValidator validates CaptFargateProfiles on creation and update.
+type CaptFargateProfileCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CaptFargateProfileCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CaptFargateProfileCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	profile, ok := obj.(*infrastructurev1beta1.CaptFargateProfile)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptFargateProfile object but got %T", obj)
+	}
+	return v.validate(ctx, profile, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CaptFargateProfileCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CaptFargateProfile)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptFargateProfile object but got %T", oldObj)
+	}
+	profile, ok := newObj.(*infrastructurev1beta1.CaptFargateProfile)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptFargateProfile object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !profile.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, profile, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CaptFargateProfileCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CaptFargateProfileCustomValidator) validate(ctx context.Context, profile, old *infrastructurev1beta1.CaptFargateProfile) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateTemplateRef(profile.Spec.WorkspaceTemplateRef, spec.Child("workspaceTemplateRef"))
+	if profile.Spec.ClusterName == "" {
+		allErrs = append(allErrs, field.Required(spec.Child("clusterName"), "cluster name is required"))
+	}
+
+	selectorsPath := spec.Child("selectors")
+	switch {
+	case len(profile.Spec.Selectors) == 0:
+		allErrs = append(allErrs, field.Required(selectorsPath, "at least one selector is required"))
+	case len(profile.Spec.Selectors) > maxFargateSelectors:
+		allErrs = append(allErrs, field.TooMany(selectorsPath, len(profile.Spec.Selectors), maxFargateSelectors))
+	}
+	for i, selector := range profile.Spec.Selectors {
+		if selector.Namespace == "" {
+			allErrs = append(allErrs, field.Required(selectorsPath.Index(i).Child("namespace"), "namespace is required"))
+		}
+	}
+
+	for i, subnet := range profile.Spec.SubnetIDs {
+		if !strings.HasPrefix(subnet, "subnet-") {
+			allErrs = append(allErrs, field.Invalid(spec.Child("subnetIDs").Index(i), subnet, "must be a subnet ID"))
+		}
+	}
+	if arn := profile.Spec.PodExecutionRoleARN; arn != "" && !strings.HasPrefix(arn, "arn:") {
+		allErrs = append(allErrs, field.Invalid(spec.Child("podExecutionRoleARN"), arn, "must be an IAM role ARN"))
+	}
+
+	// The profile is not moved or renamed. Changed selectors, subnets and roles re-create it.
+	if old != nil {
+		if profile.Spec.ClusterName != old.Spec.ClusterName {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("clusterName"), "clusterName is immutable"))
+		}
+		if profile.Spec.ProfileName != old.Spec.ProfileName {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("profileName"), "profileName is immutable"))
+		}
+		if profile.Spec.WorkspaceTemplateRef != old.Spec.WorkspaceTemplateRef {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("workspaceTemplateRef"), "workspaceTemplateRef is immutable"))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CaptFargateProfile").GroupKind(), profile.Name, allErrs)
+	}
+	return templateRefWarnings(ctx, v.Client, profile.Spec.WorkspaceTemplateRef, profile.Namespace, spec.Child("workspaceTemplateRef"))
+}
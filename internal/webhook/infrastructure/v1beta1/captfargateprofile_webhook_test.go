@@ -0,0 +1,124 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newCaptFargateProfile(mutate func(*infrastructurev1beta1.CaptFargateProfileSpec)) *infrastructurev1beta1.CaptFargateProfile {
+	profile := &infrastructurev1beta1.CaptFargateProfile{
+		ObjectMeta: metav1.ObjectMeta{Name: "batch", Namespace: "default"},
+		Spec: infrastructurev1beta1.CaptFargateProfileSpec{
+			ClusterName:          "demo-cluster",
+			WorkspaceTemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+			Selectors: []infrastructurev1beta1.FargateSelector{
+				{Namespace: "batch", Labels: map[string]string{"compute": "fargate"}},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(&profile.Spec)
+	}
+	return profile
+}
+
+func TestCaptFargateProfileValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*infrastructurev1beta1.CaptFargateProfileSpec)
+		wantErr string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "valid with subnets and role",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				spec.SubnetIDs = []string{"subnet-0123456789abcdef0"}
+				spec.PodExecutionRoleARN = "arn:aws:iam::123456789012:role/fargate-pods"
+			},
+		},
+		{
+			name: "no cluster name",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				spec.ClusterName = ""
+			},
+			wantErr: "spec.clusterName",
+		},
+		{
+			name: "no selectors",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				spec.Selectors = nil
+			},
+			wantErr: "spec.selectors",
+		},
+		{
+			name: "too many selectors",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				for _, namespace := range []string{"a", "b", "c", "d", "e"} {
+					spec.Selectors = append(spec.Selectors, infrastructurev1beta1.FargateSelector{Namespace: namespace})
+				}
+			},
+			wantErr: "spec.selectors",
+		},
+		{
+			name: "selector without namespace",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				spec.Selectors[0].Namespace = ""
+			},
+			wantErr: "spec.selectors[0].namespace",
+		},
+		{
+			name: "invalid subnet",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				spec.SubnetIDs = []string{"10.0.1.0/24"}
+			},
+			wantErr: "spec.subnetIDs[0]",
+		},
+		{
+			name: "invalid pod execution role",
+			mutate: func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+				spec.PodExecutionRoleARN = "fargate-pods"
+			},
+			wantErr: "spec.podExecutionRoleARN",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CaptFargateProfileCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+			_, err := v.ValidateCreate(context.Background(), newCaptFargateProfile(tt.mutate))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCaptFargateProfileValidateUpdate(t *testing.T) {
+	v := &CaptFargateProfileCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	old := newCaptFargateProfile(nil)
+
+	// Selectors and tags may change, the profile is re-created
+	_, err := v.ValidateUpdate(context.Background(), old, newCaptFargateProfile(func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+		spec.Selectors = append(spec.Selectors, infrastructurev1beta1.FargateSelector{Namespace: "jobs"})
+		spec.AdditionalTags = map[string]string{"Team": "batch"}
+	}))
+	assert.NoError(t, err)
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCaptFargateProfile(func(spec *infrastructurev1beta1.CaptFargateProfileSpec) {
+		spec.ClusterName = "other-cluster"
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec.clusterName")
+}
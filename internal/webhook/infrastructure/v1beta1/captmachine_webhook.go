@@ -0,0 +1,128 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// SetupCaptMachineWebhookWithManager registers the webhook for CaptMachine in the manager.
+func SetupCaptMachineWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CaptMachine{}).
+		WithValidator(&CaptMachineCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captmachine,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachines,verbs=create;update,versions=v1beta1,name=validation.captmachine.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachineCustomValidator validates CaptMachines on creation and update.
+type CaptMachineCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CaptMachineCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CaptMachineCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	machine, ok := obj.(*infrastructurev1beta1.CaptMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachine object but got %T", obj)
+	}
+	return v.validate(ctx, machine, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CaptMachineCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CaptMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachine object but got %T", oldObj)
+	}
+	machine, ok := newObj.(*infrastructurev1beta1.CaptMachine)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachine object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !machine.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, machine, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CaptMachineCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CaptMachineCustomValidator) validate(ctx context.Context, machine, old *infrastructurev1beta1.CaptMachine) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateMachineSpec(&machine.Spec, spec)
+
+	// Machines cloned from a CaptMachineTemplate default to the node group of their MachineDeployment
+	if _, cloned := machine.Annotations[clusterv1.TemplateClonedFromNameAnnotation]; !cloned {
+		allErrs = append(allErrs, validateNodeGroupRef(machine.Spec.NodeGroupRef, spec.Child("nodeGroupRef"))...)
+	}
+
+	// The machine is backed by a node group workspace that is not re-created
+	if old != nil {
+		if !ptr.Equal(machine.Spec.NodeGroupRef, old.Spec.NodeGroupRef) {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("nodeGroupRef"), "nodeGroupRef is immutable"))
+		}
+		if machine.Spec.WorkspaceTemplateRef != old.Spec.WorkspaceTemplateRef {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("workspaceTemplateRef"), "workspaceTemplateRef is immutable"))
+		}
+		if old.Spec.ProviderID != nil && !ptr.Equal(machine.Spec.ProviderID, old.Spec.ProviderID) {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("providerID"), "providerID is immutable once set"))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CaptMachine").GroupKind(), machine.Name, allErrs)
+	}
+	return templateRefWarnings(ctx, v.Client, machine.Spec.WorkspaceTemplateRef, machine.Namespace, spec.Child("workspaceTemplateRef"))
+}
+
+// validateMachineSpec validates a CaptMachine spec, either of a CaptMachine or of a machine template
+func validateMachineSpec(machine *infrastructurev1beta1.CaptMachineSpec, path *field.Path) field.ErrorList {
+	allErrs := validateTemplateRef(machine.WorkspaceTemplateRef, path.Child("workspaceTemplateRef"))
+	if machine.InstanceType == "" {
+		allErrs = append(allErrs, field.Required(path.Child("instanceType"), "instance type is required"))
+	}
+	return allErrs
+}
+
+// validateNodeGroupRef validates the reference to the node group a machine joins
+func validateNodeGroupRef(ref *infrastructurev1beta1.NodeGroupReference, path *field.Path) field.ErrorList {
+	if ref == nil {
+		return field.ErrorList{field.Required(path, "node group reference is required")}
+	}
+	if ref.Name == "" {
+		return field.ErrorList{field.Required(path.Child("name"), "node group name is required")}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newCaptMachine(mutate func(*infrastructurev1beta1.CaptMachine)) *infrastructurev1beta1.CaptMachine {
+	machine := &infrastructurev1beta1.CaptMachine{
+		ObjectMeta: metav1.ObjectMeta{Name: "worker-1", Namespace: "default"},
+		Spec: infrastructurev1beta1.CaptMachineSpec{
+			NodeGroupRef:         &infrastructurev1beta1.NodeGroupReference{Name: "workers", Namespace: "default"},
+			WorkspaceTemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+			InstanceType:         "t3.medium",
+		},
+	}
+	if mutate != nil {
+		mutate(machine)
+	}
+	return machine
+}
+
+func TestCaptMachineValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		machine *infrastructurev1beta1.CaptMachine
+		wantErr string
+	}{
+		{
+			name:    "valid",
+			machine: newCaptMachine(nil),
+		},
+		{
+			name: "no node group",
+			machine: newCaptMachine(func(machine *infrastructurev1beta1.CaptMachine) {
+				machine.Spec.NodeGroupRef = nil
+			}),
+			wantErr: "spec.nodeGroupRef",
+		},
+		{
+			name: "cloned from a CaptMachineTemplate without node group",
+			machine: newCaptMachine(func(machine *infrastructurev1beta1.CaptMachine) {
+				machine.Annotations = map[string]string{clusterv1.TemplateClonedFromNameAnnotation: "workers"}
+				machine.Spec.NodeGroupRef = nil
+			}),
+		},
+		{
+			name: "no instance type",
+			machine: newCaptMachine(func(machine *infrastructurev1beta1.CaptMachine) {
+				machine.Spec.InstanceType = ""
+			}),
+			wantErr: "spec.instanceType",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CaptMachineCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+			_, err := v.ValidateCreate(context.Background(), tt.machine)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCaptMachineValidateUpdate(t *testing.T) {
+	v := &CaptMachineCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	old := newCaptMachine(nil)
+
+	// The controller sets the providerID once
+	withProviderID := newCaptMachine(func(machine *infrastructurev1beta1.CaptMachine) {
+		machine.Spec.ProviderID = ptr.To("aws:///us-west-2a/i-0abc")
+	})
+	_, err := v.ValidateUpdate(context.Background(), old, withProviderID)
+	assert.NoError(t, err)
+
+	changed := newCaptMachine(func(machine *infrastructurev1beta1.CaptMachine) {
+		machine.Spec.ProviderID = ptr.To("aws:///us-west-2b/i-0def")
+	})
+	_, err = v.ValidateUpdate(context.Background(), withProviderID, changed)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec.providerID")
+
+	otherNodeGroup := newCaptMachine(func(machine *infrastructurev1beta1.CaptMachine) {
+		machine.Spec.NodeGroupRef = &infrastructurev1beta1.NodeGroupReference{Name: "spot", Namespace: "default"}
+	})
+	_, err = v.ValidateUpdate(context.Background(), old, otherNodeGroup)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec.nodeGroupRef")
+}
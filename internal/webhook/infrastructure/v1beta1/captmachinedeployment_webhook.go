@@ -0,0 +1,213 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+const (
+	// rollingUpdateStrategy replaces machines gradually
+	rollingUpdateStrategy = "RollingUpdate"
+	// recreateStrategy deletes all machines before creating new ones
+	recreateStrategy = "Recreate"
+)
+
+// SetupCaptMachineDeploymentWebhookWithManager registers the webhook for CaptMachineDeployment in the manager.
+func SetupCaptMachineDeploymentWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CaptMachineDeployment{}).
+		WithValidator(&CaptMachineDeploymentCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&CaptMachineDeploymentCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-captmachinedeployment,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachinedeployments,verbs=create;update,versions=v1beta1,name=default.captmachinedeployment.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachineDeploymentCustomDefaulter sets the replicas, rollout strategy and rollout limits of CaptMachineDeployments.
+type CaptMachineDeploymentCustomDefaulter struct{}
+
+var _ admission.CustomDefaulter = &CaptMachineDeploymentCustomDefaulter{}
+
+// Default implements admission.CustomDefaulter.
+func (d *CaptMachineDeploymentCustomDefaulter) Default(ctx context.Context, obj runtime.Object) error {
+	deployment, ok := obj.(*infrastructurev1beta1.CaptMachineDeployment)
+	if !ok {
+		return fmt.Errorf("expected a CaptMachineDeployment object but got %T", obj)
+	}
+
+	spec := &deployment.Spec
+	if spec.Replicas == nil {
+		spec.Replicas = ptr.To[int32](infrastructurev1beta1.DefaultReplicas)
+	}
+	if spec.RevisionHistoryLimit == nil {
+		spec.RevisionHistoryLimit = ptr.To[int32](infrastructurev1beta1.DefaultRevisionHistoryLimit)
+	}
+	if spec.ProgressDeadlineSeconds == nil {
+		spec.ProgressDeadlineSeconds = ptr.To[int32](infrastructurev1beta1.DefaultProgressDeadlineSeconds)
+	}
+
+	// Only new deployments get a strategy: defaulting it on update would change how the
+	// machines of existing deployments are replaced, which is Recreate without a strategy
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Operation == admissionv1.Create {
+		if spec.Strategy == nil {
+			spec.Strategy = &infrastructurev1beta1.MachineDeploymentStrategy{}
+		}
+		if spec.Strategy.Type == "" {
+			spec.Strategy.Type = rollingUpdateStrategy
+		}
+	}
+	if spec.Strategy == nil || spec.Strategy.Type != rollingUpdateStrategy {
+		return nil
+	}
+	if spec.Strategy.RollingUpdate == nil {
+		spec.Strategy.RollingUpdate = &infrastructurev1beta1.MachineRollingUpdateDeployment{}
+	}
+	if spec.Strategy.RollingUpdate.MaxSurge == nil {
+		spec.Strategy.RollingUpdate.MaxSurge = ptr.To(intstr.FromInt32(infrastructurev1beta1.DefaultRollingUpdateMaxSurge))
+	}
+	if spec.Strategy.RollingUpdate.MaxUnavailable == nil {
+		spec.Strategy.RollingUpdate.MaxUnavailable = ptr.To(intstr.FromInt32(infrastructurev1beta1.DefaultRollingUpdateMaxUnavailable))
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captmachinedeployment,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachinedeployments,verbs=create;update,versions=v1beta1,name=validation.captmachinedeployment.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachineDeploymentCustomValidator validates CaptMachineDeployments on creation and update.
+type CaptMachineDeploymentCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CaptMachineDeploymentCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CaptMachineDeploymentCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	deployment, ok := obj.(*infrastructurev1beta1.CaptMachineDeployment)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineDeployment object but got %T", obj)
+	}
+	return v.validate(ctx, deployment, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CaptMachineDeploymentCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CaptMachineDeployment)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineDeployment object but got %T", oldObj)
+	}
+	deployment, ok := newObj.(*infrastructurev1beta1.CaptMachineDeployment)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineDeployment object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !deployment.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, deployment, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CaptMachineDeploymentCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CaptMachineDeploymentCustomValidator) validate(ctx context.Context, deployment, old *infrastructurev1beta1.CaptMachineDeployment) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateMachineTemplate(deployment.Spec.Selector, &deployment.Spec.Template, spec)
+	allErrs = append(allErrs, validateStrategy(deployment.Spec.Strategy, spec.Child("strategy"))...)
+
+	if deadline := deployment.Spec.ProgressDeadlineSeconds; deadline != nil && *deadline <= deployment.Spec.MinReadySeconds {
+		allErrs = append(allErrs, field.Invalid(spec.Child("progressDeadlineSeconds"), *deadline, "must be greater than minReadySeconds"))
+	}
+	if old != nil {
+		allErrs = append(allErrs, validateSelectorUnchanged(deployment.Spec.Selector, old.Spec.Selector, spec.Child("selector"))...)
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CaptMachineDeployment").GroupKind(), deployment.Name, allErrs)
+	}
+	return templateRefWarnings(ctx, v.Client, deployment.Spec.Template.Spec.WorkspaceTemplateRef, deployment.Namespace,
+		spec.Child("template", "spec", "workspaceTemplateRef"))
+}
+
+// validateStrategy validates the strategy of a CaptMachineDeployment
+func validateStrategy(strategy *infrastructurev1beta1.MachineDeploymentStrategy, path *field.Path) field.ErrorList {
+	if strategy == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+	switch strategy.Type {
+	case "", rollingUpdateStrategy:
+	case recreateStrategy:
+		if strategy.RollingUpdate != nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("rollingUpdate"), "may not be specified when strategy type is Recreate"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("type"), strategy.Type, []string{rollingUpdateStrategy, recreateStrategy}))
+	}
+
+	rollingUpdate := strategy.RollingUpdate
+	if rollingUpdate == nil {
+		return allErrs
+	}
+	allErrs = append(allErrs, validateIntOrPercent(rollingUpdate.MaxSurge, path.Child("rollingUpdate", "maxSurge"))...)
+	allErrs = append(allErrs, validateIntOrPercent(rollingUpdate.MaxUnavailable, path.Child("rollingUpdate", "maxUnavailable"))...)
+	// maxUnavailable defaults to 0, which would never let a rollout make progress
+	if isZero(rollingUpdate.MaxSurge) && (rollingUpdate.MaxUnavailable == nil || isZero(rollingUpdate.MaxUnavailable)) {
+		allErrs = append(allErrs, field.Forbidden(path.Child("rollingUpdate", "maxUnavailable"), "may not be 0 when maxSurge is 0"))
+	}
+	return allErrs
+}
+
+// validateIntOrPercent validates a non-negative number or percentage
+func validateIntOrPercent(value *intstr.IntOrString, path *field.Path) field.ErrorList {
+	if value == nil {
+		return nil
+	}
+	if value.Type == intstr.Int {
+		if value.IntVal < 0 {
+			return field.ErrorList{field.Invalid(path, value.IntVal, "must be greater than or equal to 0")}
+		}
+		return nil
+	}
+	percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+	if !strings.HasSuffix(value.StrVal, "%") || err != nil || percent < 0 || percent > 100 {
+		return field.ErrorList{field.Invalid(path, value.StrVal, "must be a number or a percentage between 0% and 100%")}
+	}
+	return nil
+}
+
+// isZero returns true if the given number or percentage is set to zero
+func isZero(value *intstr.IntOrString) bool {
+	return value != nil && (value.Type == intstr.Int && value.IntVal == 0 || value.Type == intstr.String && value.StrVal == "0%")
+}
@@ -0,0 +1,193 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newCaptMachineDeployment(mutate func(*infrastructurev1beta1.CaptMachineDeploymentSpec)) *infrastructurev1beta1.CaptMachineDeployment {
+	deployment := &infrastructurev1beta1.CaptMachineDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "default"},
+		Spec: infrastructurev1beta1.CaptMachineDeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "workers"}},
+			Template: infrastructurev1beta1.CaptMachineTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"pool": "workers"}},
+				Spec: infrastructurev1beta1.CaptMachineSpec{
+					NodeGroupRef:         &infrastructurev1beta1.NodeGroupReference{Name: "workers", Namespace: "default"},
+					WorkspaceTemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+					InstanceType:         "t3.medium",
+				},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(&deployment.Spec)
+	}
+	return deployment
+}
+
+func TestCaptMachineDeploymentValidateCreate(t *testing.T) {
+	intOrString := func(value intstr.IntOrString) *intstr.IntOrString { return &value }
+
+	tests := []struct {
+		name    string
+		mutate  func(*infrastructurev1beta1.CaptMachineDeploymentSpec)
+		wantErr string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "valid rolling update",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Strategy = &infrastructurev1beta1.MachineDeploymentStrategy{
+					Type: rollingUpdateStrategy,
+					RollingUpdate: &infrastructurev1beta1.MachineRollingUpdateDeployment{
+						MaxSurge:       intOrString(intstr.FromString("25%")),
+						MaxUnavailable: intOrString(intstr.FromInt32(0)),
+					},
+				}
+			},
+		},
+		{
+			name: "missing selector",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Selector = nil
+			},
+			wantErr: "spec.selector.matchLabels",
+		},
+		{
+			name: "template labels do not match selector",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Template.ObjectMeta.Labels = map[string]string{"pool": "other"}
+			},
+			wantErr: "spec.template.metadata.labels",
+		},
+		{
+			name: "missing instance type",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Template.Spec.InstanceType = ""
+			},
+			wantErr: "spec.template.spec.instanceType",
+		},
+		{
+			name: "unsupported strategy",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Strategy = &infrastructurev1beta1.MachineDeploymentStrategy{Type: "BlueGreen"}
+			},
+			wantErr: "spec.strategy.type",
+		},
+		{
+			name: "invalid percentage",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Strategy = &infrastructurev1beta1.MachineDeploymentStrategy{
+					RollingUpdate: &infrastructurev1beta1.MachineRollingUpdateDeployment{
+						MaxSurge: intOrString(intstr.FromString("150%")),
+					},
+				}
+			},
+			wantErr: "spec.strategy.rollingUpdate.maxSurge",
+		},
+		{
+			name: "rollout cannot progress",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.Strategy = &infrastructurev1beta1.MachineDeploymentStrategy{
+					RollingUpdate: &infrastructurev1beta1.MachineRollingUpdateDeployment{
+						MaxSurge: intOrString(intstr.FromInt32(0)),
+					},
+				}
+			},
+			wantErr: "may not be 0 when maxSurge is 0",
+		},
+		{
+			name: "progress deadline shorter than minReadySeconds",
+			mutate: func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+				spec.MinReadySeconds = 600
+				spec.ProgressDeadlineSeconds = ptr.To[int32](300)
+			},
+			wantErr: "spec.progressDeadlineSeconds",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CaptMachineDeploymentCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+			warnings, err := v.ValidateCreate(context.Background(), newCaptMachineDeployment(tt.mutate))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Empty(t, warnings)
+		})
+	}
+}
+
+func TestCaptMachineDeploymentValidateUpdate(t *testing.T) {
+	v := &CaptMachineDeploymentCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	old := newCaptMachineDeployment(nil)
+
+	_, err := v.ValidateUpdate(context.Background(), old, newCaptMachineDeployment(func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+		spec.Template.Spec.InstanceType = "m5.large"
+	}))
+	assert.NoError(t, err)
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCaptMachineDeployment(func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+		spec.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"pool": "workers", "tier": "batch"}}
+		spec.Template.ObjectMeta.Labels = map[string]string{"pool": "workers", "tier": "batch"}
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "selector is immutable")
+}
+
+func TestCaptMachineDeploymentDefault(t *testing.T) {
+	d := &CaptMachineDeploymentCustomDefaulter{}
+	create := admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Create},
+	})
+	update := admission.NewContextWithRequest(context.Background(), admission.Request{
+		AdmissionRequest: admissionv1.AdmissionRequest{Operation: admissionv1.Update},
+	})
+
+	deployment := newCaptMachineDeployment(nil)
+	require.NoError(t, d.Default(create, deployment))
+	assert.Equal(t, ptr.To[int32](1), deployment.Spec.Replicas)
+	assert.Equal(t, ptr.To[int32](10), deployment.Spec.RevisionHistoryLimit)
+	assert.Equal(t, ptr.To[int32](600), deployment.Spec.ProgressDeadlineSeconds)
+	require.NotNil(t, deployment.Spec.Strategy)
+	assert.Equal(t, rollingUpdateStrategy, deployment.Spec.Strategy.Type)
+	require.NotNil(t, deployment.Spec.Strategy.RollingUpdate)
+	assert.Equal(t, intstr.FromInt32(1), *deployment.Spec.Strategy.RollingUpdate.MaxSurge)
+	assert.Equal(t, intstr.FromInt32(0), *deployment.Spec.Strategy.RollingUpdate.MaxUnavailable)
+
+	// Defaulting is idempotent
+	defaulted := deployment.DeepCopy()
+	require.NoError(t, d.Default(create, defaulted))
+	assert.Equal(t, deployment, defaulted)
+
+	// Existing deployments keep replacing machines the way they did
+	deployment = newCaptMachineDeployment(nil)
+	require.NoError(t, d.Default(update, deployment))
+	assert.Nil(t, deployment.Spec.Strategy)
+
+	// Recreate deployments do not get rolling update parameters
+	deployment = newCaptMachineDeployment(func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+		spec.Replicas = ptr.To[int32](3)
+		spec.Strategy = &infrastructurev1beta1.MachineDeploymentStrategy{Type: recreateStrategy}
+	})
+	require.NoError(t, d.Default(create, deployment))
+	assert.Equal(t, ptr.To[int32](3), deployment.Spec.Replicas)
+	assert.Nil(t, deployment.Spec.Strategy.RollingUpdate)
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// SetupCaptMachinePoolWebhookWithManager registers the webhook for CaptMachinePool in the manager.
+func SetupCaptMachinePoolWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CaptMachinePool{}).
+		WithValidator(&CaptMachinePoolCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captmachinepool,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachinepools,verbs=create;update,versions=v1beta1,name=validation.captmachinepool.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachinePoolCustomValidator validates CaptMachinePools on creation and update.
+type CaptMachinePoolCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CaptMachinePoolCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CaptMachinePoolCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	pool, ok := obj.(*infrastructurev1beta1.CaptMachinePool)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachinePool object but got %T", obj)
+	}
+	return v.validate(ctx, pool, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CaptMachinePoolCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CaptMachinePool)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachinePool object but got %T", oldObj)
+	}
+	pool, ok := newObj.(*infrastructurev1beta1.CaptMachinePool)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachinePool object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !pool.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, pool, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CaptMachinePoolCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CaptMachinePoolCustomValidator) validate(ctx context.Context, pool, old *infrastructurev1beta1.CaptMachinePool) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateTemplateRef(pool.Spec.WorkspaceTemplateRef, spec.Child("workspaceTemplateRef"))
+	if pool.Spec.InstanceType == "" {
+		allErrs = append(allErrs, field.Required(spec.Child("instanceType"), "instance type is required"))
+	}
+
+	if scaling := pool.Spec.Scaling; scaling != nil {
+		scalingPath := spec.Child("scaling")
+		if scaling.MinSize != nil && *scaling.MinSize < 0 {
+			allErrs = append(allErrs, field.Invalid(scalingPath.Child("minSize"), *scaling.MinSize, "must be greater than or equal to 0"))
+		}
+		if scaling.MaxSize != nil && (*scaling.MaxSize < 1 || *scaling.MaxSize < ptr.Deref(scaling.MinSize, 0)) {
+			allErrs = append(allErrs, field.Invalid(scalingPath.Child("maxSize"), *scaling.MaxSize, "must be at least 1 and not less than minSize"))
+		}
+	}
+
+	// The node group is not renamed or re-created from another template
+	if old != nil {
+		if pool.Spec.NodeGroupName != old.Spec.NodeGroupName {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("nodeGroupName"), "nodeGroupName is immutable"))
+		}
+		if pool.Spec.WorkspaceTemplateRef != old.Spec.WorkspaceTemplateRef {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("workspaceTemplateRef"), "workspaceTemplateRef is immutable"))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CaptMachinePool").GroupKind(), pool.Name, allErrs)
+	}
+	return templateRefWarnings(ctx, v.Client, pool.Spec.WorkspaceTemplateRef, pool.Namespace, spec.Child("workspaceTemplateRef"))
+}
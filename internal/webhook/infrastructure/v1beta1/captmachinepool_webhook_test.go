@@ -0,0 +1,92 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newCaptMachinePool(mutate func(*infrastructurev1beta1.CaptMachinePoolSpec)) *infrastructurev1beta1.CaptMachinePool {
+	pool := &infrastructurev1beta1.CaptMachinePool{
+		ObjectMeta: metav1.ObjectMeta{Name: "pool-0", Namespace: "default"},
+		Spec: infrastructurev1beta1.CaptMachinePoolSpec{
+			WorkspaceTemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+			InstanceType:         "t3.medium",
+			Scaling:              &infrastructurev1beta1.MachinePoolScaling{MinSize: ptr.To[int32](1), MaxSize: ptr.To[int32](5)},
+		},
+	}
+	if mutate != nil {
+		mutate(&pool.Spec)
+	}
+	return pool
+}
+
+func TestCaptMachinePoolValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*infrastructurev1beta1.CaptMachinePoolSpec)
+		wantErr string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "no scaling bounds",
+			mutate: func(spec *infrastructurev1beta1.CaptMachinePoolSpec) {
+				spec.Scaling = nil
+			},
+		},
+		{
+			name: "no instance type",
+			mutate: func(spec *infrastructurev1beta1.CaptMachinePoolSpec) {
+				spec.InstanceType = ""
+			},
+			wantErr: "spec.instanceType",
+		},
+		{
+			name: "max size below min size",
+			mutate: func(spec *infrastructurev1beta1.CaptMachinePoolSpec) {
+				spec.Scaling.MinSize = ptr.To[int32](6)
+			},
+			wantErr: "spec.scaling.maxSize",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CaptMachinePoolCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+			_, err := v.ValidateCreate(context.Background(), newCaptMachinePool(tt.mutate))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCaptMachinePoolValidateUpdate(t *testing.T) {
+	v := &CaptMachinePoolCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	old := newCaptMachinePool(nil)
+
+	// Scaling bounds and instances may change
+	_, err := v.ValidateUpdate(context.Background(), old, newCaptMachinePool(func(spec *infrastructurev1beta1.CaptMachinePoolSpec) {
+		spec.Scaling.MaxSize = ptr.To[int32](10)
+		spec.ProviderIDList = []string{"aws:///us-west-2a/i-0aaa"}
+	}))
+	assert.NoError(t, err)
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCaptMachinePool(func(spec *infrastructurev1beta1.CaptMachinePoolSpec) {
+		spec.NodeGroupName = "renamed"
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spec.nodeGroupName")
+}
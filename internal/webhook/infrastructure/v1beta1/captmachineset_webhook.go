@@ -0,0 +1,150 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// SetupCaptMachineSetWebhookWithManager registers the webhook for CaptMachineSet in the manager.
+func SetupCaptMachineSetWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CaptMachineSet{}).
+		WithValidator(&CaptMachineSetCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&CaptMachineSetCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-infrastructure-cluster-x-k8s-io-v1beta1-captmachineset,mutating=true,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachinesets,verbs=create;update,versions=v1beta1,name=default.captmachineset.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachineSetCustomDefaulter sets the replicas of CaptMachineSets.
+type CaptMachineSetCustomDefaulter struct{}
+
+var _ admission.CustomDefaulter = &CaptMachineSetCustomDefaulter{}
+
+// Default implements admission.CustomDefaulter.
+func (d *CaptMachineSetCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	machineSet, ok := obj.(*infrastructurev1beta1.CaptMachineSet)
+	if !ok {
+		return fmt.Errorf("expected a CaptMachineSet object but got %T", obj)
+	}
+	if machineSet.Spec.Replicas == nil {
+		machineSet.Spec.Replicas = ptr.To[int32](infrastructurev1beta1.DefaultReplicas)
+	}
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captmachineset,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachinesets,verbs=create;update,versions=v1beta1,name=validation.captmachineset.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachineSetCustomValidator validates CaptMachineSets on creation and update.
+type CaptMachineSetCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CaptMachineSetCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CaptMachineSetCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	machineSet, ok := obj.(*infrastructurev1beta1.CaptMachineSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineSet object but got %T", obj)
+	}
+	return v.validate(ctx, machineSet, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CaptMachineSetCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CaptMachineSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineSet object but got %T", oldObj)
+	}
+	machineSet, ok := newObj.(*infrastructurev1beta1.CaptMachineSet)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineSet object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !machineSet.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, machineSet, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CaptMachineSetCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CaptMachineSetCustomValidator) validate(ctx context.Context, machineSet, old *infrastructurev1beta1.CaptMachineSet) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateMachineTemplate(machineSet.Spec.Selector, &machineSet.Spec.Template, spec)
+	if old != nil {
+		allErrs = append(allErrs, validateSelectorUnchanged(machineSet.Spec.Selector, old.Spec.Selector, spec.Child("selector"))...)
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CaptMachineSet").GroupKind(), machineSet.Name, allErrs)
+	}
+	return templateRefWarnings(ctx, v.Client, machineSet.Spec.Template.Spec.WorkspaceTemplateRef, machineSet.Namespace,
+		spec.Child("template", "spec", "workspaceTemplateRef"))
+}
+
+// validateMachineTemplate validates the selector and machine template of a CaptMachineSet or CaptMachineDeployment.
+// Machines are listed by the match labels of the selector, so they must select the template labels.
+func validateMachineTemplate(selector *metav1.LabelSelector, template *infrastructurev1beta1.CaptMachineTemplateSpec, path *field.Path) field.ErrorList {
+	allErrs := validateMachineSpec(&template.Spec, path.Child("template", "spec"))
+	allErrs = append(allErrs, validateNodeGroupRef(template.Spec.NodeGroupRef, path.Child("template", "spec", "nodeGroupRef"))...)
+
+	switch {
+	case selector == nil || len(selector.MatchLabels) == 0:
+		allErrs = append(allErrs, field.Required(path.Child("selector", "matchLabels"), "selector must have match labels"))
+	default:
+		parsed, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("selector"), selector, err.Error()))
+		} else if !parsed.Matches(labels.Set(template.ObjectMeta.Labels)) {
+			allErrs = append(allErrs, field.Invalid(path.Child("template", "metadata", "labels"), template.ObjectMeta.Labels,
+				"must match the selector"))
+		}
+	}
+	return allErrs
+}
+
+// validateSelectorUnchanged forbids selector changes, which would orphan the existing machines
+func validateSelectorUnchanged(selector, old *metav1.LabelSelector, path *field.Path) field.ErrorList {
+	oldSelector, err := metav1.LabelSelectorAsSelector(old)
+	if err != nil {
+		// Let objects created with an invalid selector be fixed
+		return nil
+	}
+	newSelector, err := metav1.LabelSelectorAsSelector(selector)
+	if err == nil && newSelector.String() == oldSelector.String() {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(path, "selector is immutable")}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// SetupCaptMachineTemplateWebhookWithManager registers the webhook for CaptMachineTemplate in the manager.
+func SetupCaptMachineTemplateWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.CaptMachineTemplate{}).
+		WithValidator(&CaptMachineTemplateCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-captmachinetemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=captmachinetemplates,verbs=create;update,versions=v1beta1,name=validation.captmachinetemplate.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// CaptMachineTemplateCustomValidator validates CaptMachineTemplates on creation and update.
+type CaptMachineTemplateCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &CaptMachineTemplateCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *CaptMachineTemplateCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template, ok := obj.(*infrastructurev1beta1.CaptMachineTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineTemplate object but got %T", obj)
+	}
+	return v.validate(ctx, template, nil)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *CaptMachineTemplateCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	old, ok := oldObj.(*infrastructurev1beta1.CaptMachineTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineTemplate object but got %T", oldObj)
+	}
+	template, ok := newObj.(*infrastructurev1beta1.CaptMachineTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected a CaptMachineTemplate object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !template.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, template, old)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *CaptMachineTemplateCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *CaptMachineTemplateCustomValidator) validate(ctx context.Context, template, old *infrastructurev1beta1.CaptMachineTemplate) (admission.Warnings, error) {
+	path := field.NewPath("spec", "template", "spec")
+	resource := &template.Spec.Template.Spec
+	allErrs := validateTemplateRef(resource.WorkspaceTemplateRef, path.Child("workspaceTemplateRef"))
+
+	if resource.NodeGroupRef != nil {
+		allErrs = append(allErrs, validateNodeGroupRef(resource.NodeGroupRef, path.Child("nodeGroupRef"))...)
+	}
+
+	switch resource.NodeType {
+	case infrastructurev1beta1.ManagedNodeGroup:
+		// CaptMachines cloned from the template require an instance type
+		if resource.InstanceType == "" {
+			allErrs = append(allErrs, field.Required(path.Child("instanceType"), "instance type is required for ManagedNodeGroup"))
+		}
+	case infrastructurev1beta1.Fargate:
+		if resource.InstanceType != "" {
+			allErrs = append(allErrs, field.Forbidden(path.Child("instanceType"), "may not be specified for Fargate"))
+		}
+		if resource.Scaling != nil {
+			allErrs = append(allErrs, field.Forbidden(path.Child("scaling"), "may not be specified for Fargate"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(path.Child("nodeType"), resource.NodeType,
+			[]infrastructurev1beta1.NodeType{infrastructurev1beta1.ManagedNodeGroup, infrastructurev1beta1.Fargate}))
+	}
+
+	if scaling := resource.Scaling; scaling != nil {
+		scalingPath := path.Child("scaling")
+		if scaling.MinSize < 0 {
+			allErrs = append(allErrs, field.Invalid(scalingPath.Child("minSize"), scaling.MinSize, "must be greater than or equal to 0"))
+		}
+		if scaling.MaxSize < 1 || scaling.MaxSize < scaling.MinSize {
+			allErrs = append(allErrs, field.Invalid(scalingPath.Child("maxSize"), scaling.MaxSize, "must be at least 1 and not less than minSize"))
+		}
+		if scaling.DesiredSize < scaling.MinSize || scaling.DesiredSize > scaling.MaxSize {
+			allErrs = append(allErrs, field.Invalid(scalingPath.Child("desiredSize"), scaling.DesiredSize, "must be between minSize and maxSize"))
+		}
+	}
+
+	// Machine templates are immutable; a new template is rolled out instead
+	if old != nil && !reflect.DeepEqual(template.Spec, old.Spec) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec"), "CaptMachineTemplate spec is immutable"))
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("CaptMachineTemplate").GroupKind(), template.Name, allErrs)
+	}
+	warnings, err := templateRefWarnings(ctx, v.Client, resource.WorkspaceTemplateRef, template.Namespace, path.Child("workspaceTemplateRef"))
+	if err != nil {
+		return nil, err
+	}
+	// Machines are always EC2 instances; Fargate capacity is declared with CaptFargateProfiles
+	if resource.NodeType == infrastructurev1beta1.Fargate {
+		warnings = append(warnings, fmt.Sprintf("%s: CaptMachines are not run on Fargate, use a CaptFargateProfile to schedule pods on Fargate", path.Child("nodeType")))
+	}
+	return warnings, nil
+}
@@ -0,0 +1,140 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newCaptMachineTemplate(mutate func(*infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec)) *infrastructurev1beta1.CaptMachineTemplate {
+	template := &infrastructurev1beta1.CaptMachineTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "workers", Namespace: "default"},
+		Spec: infrastructurev1beta1.CaptInfraMachineTemplateSpec{
+			Template: infrastructurev1beta1.CaptInfraMachineTemplateResource{
+				Spec: infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec{
+					WorkspaceTemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+					NodeType:             infrastructurev1beta1.ManagedNodeGroup,
+					InstanceType:         "t3.medium",
+					Scaling:              &infrastructurev1beta1.ScalingConfig{MinSize: 1, MaxSize: 3, DesiredSize: 2},
+				},
+			},
+		},
+	}
+	if mutate != nil {
+		mutate(&template.Spec.Template.Spec)
+	}
+	return template
+}
+
+func TestCaptMachineTemplateValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec)
+		wantErr string
+	}{
+		{
+			name: "valid managed node group",
+		},
+		{
+			name: "valid fargate",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.NodeType = infrastructurev1beta1.Fargate
+				spec.InstanceType = ""
+				spec.Scaling = nil
+			},
+		},
+		{
+			name: "fargate with instance type",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.NodeType = infrastructurev1beta1.Fargate
+				spec.Scaling = nil
+			},
+			wantErr: "spec.template.spec.instanceType",
+		},
+		{
+			name: "managed node group without instance type",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.InstanceType = ""
+			},
+			wantErr: "spec.template.spec.instanceType",
+		},
+		{
+			name: "node group reference without name",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.NodeGroupRef = &infrastructurev1beta1.NodeGroupReference{Namespace: "default"}
+			},
+			wantErr: "spec.template.spec.nodeGroupRef.name",
+		},
+		{
+			name: "unsupported node type",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.NodeType = "SelfManaged"
+			},
+			wantErr: "spec.template.spec.nodeType",
+		},
+		{
+			name: "desired size out of bounds",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.Scaling.DesiredSize = 5
+			},
+			wantErr: "spec.template.spec.scaling.desiredSize",
+		},
+		{
+			name: "max size below min size",
+			mutate: func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+				spec.Scaling = &infrastructurev1beta1.ScalingConfig{MinSize: 3, MaxSize: 2, DesiredSize: 3}
+			},
+			wantErr: "spec.template.spec.scaling.maxSize",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &CaptMachineTemplateCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+			_, err := v.ValidateCreate(context.Background(), newCaptMachineTemplate(tt.mutate))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestCaptMachineTemplateValidateUpdate(t *testing.T) {
+	v := &CaptMachineTemplateCustomValidator{Client: newFakeReader(newVPCTemplate())}
+	old := newCaptMachineTemplate(nil)
+
+	_, err := v.ValidateUpdate(context.Background(), old, newCaptMachineTemplate(nil))
+	assert.NoError(t, err)
+
+	_, err = v.ValidateUpdate(context.Background(), old, newCaptMachineTemplate(func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+		spec.InstanceType = "m5.large"
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "CaptMachineTemplate spec is immutable")
+}
+
+func TestCaptMachineTemplateFargateWarning(t *testing.T) {
+	v := &CaptMachineTemplateCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+	warnings, err := v.ValidateCreate(context.Background(), newCaptMachineTemplate(nil))
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	warnings, err = v.ValidateCreate(context.Background(), newCaptMachineTemplate(func(spec *infrastructurev1beta1.CaptInfraMachineTemplateResourceSpec) {
+		spec.NodeType = infrastructurev1beta1.Fargate
+		spec.InstanceType = ""
+		spec.Scaling = nil
+	}))
+	require.NoError(t, err)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "CaptFargateProfile")
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	"github.com/appthrust/capt/internal/controller/identity"
+)
+
+// awsRegion matches AWS region names such as ap-northeast-1 or us-gov-west-1
+var awsRegion = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+
+// validateRegion validates an AWS region name
+func validateRegion(region string, path *field.Path) field.ErrorList {
+	if region == "" {
+		return field.ErrorList{field.Required(path, "region is required")}
+	}
+	if !awsRegion.MatchString(region) {
+		return field.ErrorList{field.Invalid(path, region, "must be an AWS region name, e.g. ap-northeast-1")}
+	}
+	return nil
+}
+
+// validateTemplateRef validates a WorkspaceTemplate reference
+func validateTemplateRef(ref infrastructurev1beta1.WorkspaceTemplateReference, path *field.Path) field.ErrorList {
+	if ref.Name == "" {
+		return field.ErrorList{field.Required(path.Child("name"), "workspace template name is required")}
+	}
+	return nil
+}
+
+// templateRefWarnings warns when the referenced WorkspaceTemplate does not exist yet.
+// Missing templates are not rejected, so that templates and the resources referencing
+// them can be applied together; the controllers wait for the template instead.
+func templateRefWarnings(ctx context.Context, c client.Reader, ref infrastructurev1beta1.WorkspaceTemplateReference, namespace string, path *field.Path) (admission.Warnings, error) {
+	if ref.Name == "" {
+		return nil, nil
+	}
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+
+	err := c.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, &infrastructurev1beta1.WorkspaceTemplate{})
+	if apierrors.IsNotFound(err) {
+		return admission.Warnings{fmt.Sprintf("%s: WorkspaceTemplate %s/%s not found", path, namespace, ref.Name)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get WorkspaceTemplate %s/%s: %w", namespace, ref.Name, err)
+	}
+	return nil, nil
+}
+
+// identityRefWarnings warns when the referenced CAPTClusterIdentity does not exist yet or does
+// not allow the namespace. Workspaces wait until the identity can be used.
+func identityRefWarnings(ctx context.Context, c client.Reader, ref *infrastructurev1beta1.IdentityReference, namespace string, path *field.Path) (admission.Warnings, error) {
+	if ref == nil || ref.Name == "" {
+		return nil, nil
+	}
+
+	clusterIdentity := &infrastructurev1beta1.CAPTClusterIdentity{}
+	err := c.Get(ctx, types.NamespacedName{Name: ref.Name}, clusterIdentity)
+	if apierrors.IsNotFound(err) {
+		return admission.Warnings{fmt.Sprintf("%s: CAPTClusterIdentity %s not found", path, ref.Name)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CAPTClusterIdentity %s: %w", ref.Name, err)
+	}
+	allowed, err := identity.Allowed(ctx, c, clusterIdentity, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return admission.Warnings{fmt.Sprintf("%s: CAPTClusterIdentity %s does not allow namespace %s", path, ref.Name, namespace)}, nil
+	}
+	return nil, nil
+}
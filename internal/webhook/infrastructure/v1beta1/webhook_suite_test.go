@@ -0,0 +1,235 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	apimachineryruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	controlplanev1beta1 "github.com/appthrust/capt/api/controlplane/v1beta1"
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+	webhookcontrolplanev1beta1 "github.com/appthrust/capt/internal/webhook/controlplane/v1beta1"
+)
+
+// These tests use Ginkgo (BDD-style Go testing framework). Refer to
+// http://onsi.github.io/ginkgo/ to learn more about Ginkgo.
+
+var cfg *rest.Config
+var k8sClient client.Client
+var testEnv *envtest.Environment
+var ctx context.Context
+var cancel context.CancelFunc
+
+func TestWebhooks(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "Webhook Suite")
+}
+
+// binaryAssetsDirectory returns the envtest binaries directory, or an empty string if none is installed.
+func binaryAssetsDirectory() string {
+	if dir := os.Getenv("KUBEBUILDER_ASSETS"); dir != "" {
+		return dir
+	}
+	for _, dir := range []string{
+		filepath.Join("..", "..", "..", "..", "bin", "k8s", fmt.Sprintf("1.31.0-%s-%s", runtime.GOOS, runtime.GOARCH)),
+		filepath.Join("/usr", "local", "kubebuilder", "bin"),
+	} {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+	}
+	return ""
+}
+
+var _ = BeforeSuite(func() {
+	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
+
+	assets := binaryAssetsDirectory()
+	if assets == "" {
+		Skip("envtest binaries not found, run `make test` or set KUBEBUILDER_ASSETS")
+	}
+
+	ctx, cancel = context.WithCancel(context.TODO())
+
+	By("bootstrapping test environment")
+	testEnv = &envtest.Environment{
+		CRDDirectoryPaths: []string{
+			filepath.Join("..", "..", "..", "..", "config", "clusterapi", "infrastructure", "bases"),
+			filepath.Join("..", "..", "..", "..", "config", "clusterapi", "controlplane", "bases"),
+		},
+		ErrorIfCRDPathMissing: true,
+		BinaryAssetsDirectory: assets,
+		WebhookInstallOptions: envtest.WebhookInstallOptions{
+			Paths: []string{filepath.Join("..", "..", "..", "..", "config", "webhook", "manifests.yaml")},
+		},
+	}
+
+	var err error
+	cfg, err = testEnv.Start()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cfg).NotTo(BeNil())
+
+	scheme := apimachineryruntime.NewScheme()
+	Expect(infrastructurev1beta1.AddToScheme(scheme)).To(Succeed())
+	Expect(controlplanev1beta1.AddToScheme(scheme)).To(Succeed())
+
+	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(k8sClient).NotTo(BeNil())
+
+	// Start the webhook server using the manager
+	webhookInstallOptions := &testEnv.WebhookInstallOptions
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
+		Scheme: scheme,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Host:    webhookInstallOptions.LocalServingHost,
+			Port:    webhookInstallOptions.LocalServingPort,
+			CertDir: webhookInstallOptions.LocalServingCertDir,
+		}),
+		LeaderElection: false,
+		Metrics:        metricsserver.Options{BindAddress: "0"},
+	})
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, setup := range []func(ctrl.Manager) error{
+		SetupCAPTClusterWebhookWithManager,
+		SetupWorkspaceTemplateWebhookWithManager,
+		SetupWorkspaceTemplateApplyWebhookWithManager,
+		SetupCaptMachineWebhookWithManager,
+		SetupCaptMachineSetWebhookWithManager,
+		SetupCaptMachineDeploymentWebhookWithManager,
+		SetupCaptMachinePoolWebhookWithManager,
+		SetupCaptMachineTemplateWebhookWithManager,
+		SetupCaptFargateProfileWebhookWithManager,
+		webhookcontrolplanev1beta1.SetupCAPTControlPlaneWebhookWithManager,
+	} {
+		Expect(setup(mgr)).To(Succeed())
+	}
+
+	go func() {
+		defer GinkgoRecover()
+		err = mgr.Start(ctx)
+		Expect(err).NotTo(HaveOccurred())
+	}()
+
+	// Wait for the webhook server to get ready
+	dialer := &net.Dialer{Timeout: time.Second}
+	addrPort := fmt.Sprintf("%s:%d", webhookInstallOptions.LocalServingHost, webhookInstallOptions.LocalServingPort)
+	Eventually(func() error {
+		conn, err := tls.DialWithDialer(dialer, "tcp", addrPort, &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}).Should(Succeed())
+})
+
+var _ = AfterSuite(func() {
+	if testEnv == nil {
+		return
+	}
+	By("tearing down the test environment")
+	cancel()
+	err := testEnv.Stop()
+	Expect(err).NotTo(HaveOccurred())
+})
+
+var _ = Describe("CAPT defaulting webhooks", func() {
+	It("stores the default VPC name of a CAPTCluster", func() {
+		cluster := newCAPTCluster(nil)
+		cluster.Name = "defaulted-vpc-name"
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+
+		Expect(cluster.Spec.VPCConfig).NotTo(BeNil())
+		Expect(cluster.Spec.VPCConfig.Name).To(Equal("defaulted-vpc-name-vpc"))
+		Expect(cluster.Spec.WorkspaceTemplateApplyName).To(Equal("defaulted-vpc-name-vpc"))
+	})
+})
+
+var _ = Describe("CAPT validating webhooks", func() {
+	It("rejects a CAPTCluster with both a managed and an existing VPC", func() {
+		cluster := newCAPTCluster(func(spec *infrastructurev1beta1.CAPTClusterSpec) {
+			spec.ExistingVPCID = "vpc-0123456789abcdef0"
+		})
+		cluster.Name = "both-vpcs"
+
+		err := k8sClient.Create(ctx, cluster)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "unexpected error: %v", err)
+	})
+
+	It("rejects changing the region of a CAPTCluster", func() {
+		cluster := newCAPTCluster(nil)
+		cluster.Name = "immutable-region"
+		Expect(k8sClient.Create(ctx, cluster)).To(Succeed())
+
+		cluster.Spec.Region = "us-west-2"
+		err := k8sClient.Update(ctx, cluster)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "unexpected error: %v", err)
+	})
+
+	It("rejects a CaptMachineDeployment whose template does not match its selector", func() {
+		deployment := newCaptMachineDeployment(func(spec *infrastructurev1beta1.CaptMachineDeploymentSpec) {
+			spec.Template.ObjectMeta.Labels = map[string]string{"pool": "other"}
+		})
+
+		err := k8sClient.Create(ctx, deployment)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "unexpected error: %v", err)
+	})
+
+	It("rejects a CAPTControlPlane with an invalid public CIDR", func() {
+		controlPlane := &controlplanev1beta1.CAPTControlPlane{
+			ObjectMeta: metav1.ObjectMeta{Name: "invalid-cidr", Namespace: "default"},
+			Spec: controlplanev1beta1.CAPTControlPlaneSpec{
+				Version:              "v1.31.0",
+				WorkspaceTemplateRef: controlplanev1beta1.WorkspaceTemplateReference{Name: "eks-template"},
+				ControlPlaneConfig: &controlplanev1beta1.ControlPlaneConfig{
+					Region: "ap-northeast-1",
+					EndpointAccess: &controlplanev1beta1.EndpointAccess{
+						Public:      true,
+						PublicCIDRs: []string{"not-a-cidr"},
+					},
+				},
+			},
+		}
+
+		err := k8sClient.Create(ctx, controlPlane)
+		Expect(apierrors.IsInvalid(err)).To(BeTrue(), "unexpected error: %v", err)
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// SetupWorkspaceTemplateWebhookWithManager registers the webhook for WorkspaceTemplate in the manager.
+func SetupWorkspaceTemplateWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.WorkspaceTemplate{}).
+		WithValidator(&WorkspaceTemplateCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-workspacetemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=workspacetemplates,verbs=create;update;delete,versions=v1beta1,name=validation.workspacetemplate.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// WorkspaceTemplateCustomValidator validates WorkspaceTemplates on creation and update,
+// and warns when a template that is still referenced is deleted.
+type WorkspaceTemplateCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &WorkspaceTemplateCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *WorkspaceTemplateCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template, ok := obj.(*infrastructurev1beta1.WorkspaceTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkspaceTemplate object but got %T", obj)
+	}
+	return nil, validateWorkspaceTemplate(template)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *WorkspaceTemplateCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	template, ok := newObj.(*infrastructurev1beta1.WorkspaceTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkspaceTemplate object but got %T", newObj)
+	}
+	return nil, validateWorkspaceTemplate(template)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *WorkspaceTemplateCustomValidator) ValidateDelete(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	template, ok := obj.(*infrastructurev1beta1.WorkspaceTemplate)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkspaceTemplate object but got %T", obj)
+	}
+
+	applies := &infrastructurev1beta1.WorkspaceTemplateApplyList{}
+	if err := v.Client.List(ctx, applies); err != nil {
+		return nil, fmt.Errorf("failed to list WorkspaceTemplateApplies: %w", err)
+	}
+	var referencing []string
+	for _, apply := range applies.Items {
+		namespace := apply.Spec.TemplateRef.Namespace
+		if namespace == "" {
+			namespace = apply.Namespace
+		}
+		if apply.Spec.TemplateRef.Name == template.Name && namespace == template.Namespace {
+			referencing = append(referencing, apply.Namespace+"/"+apply.Name)
+		}
+	}
+	if len(referencing) == 0 {
+		return nil, nil
+	}
+	return admission.Warnings{fmt.Sprintf("WorkspaceTemplate is still referenced by WorkspaceTemplateApplies %s, which can no longer re-render their workspaces",
+		strings.Join(referencing, ", "))}, nil
+}
+
+func validateWorkspaceTemplate(template *infrastructurev1beta1.WorkspaceTemplate) error {
+	var allErrs field.ErrorList
+	forProvider := field.NewPath("spec", "template", "spec", "forProvider")
+
+	module := template.Spec.Template.Spec.ForProvider.Module
+	switch {
+	case strings.TrimSpace(module) == "":
+		allErrs = append(allErrs, field.Required(forProvider.Child("module"), "module is required"))
+	case template.Spec.Template.Spec.ForProvider.Source == tfv1beta1.ModuleSourceRemote && strings.ContainsAny(module, "\n\r"):
+		allErrs = append(allErrs, field.Invalid(forProvider.Child("module"), module, "a remote module must be a single module address"))
+	}
+
+	// ProviderConfigs of identities are only used through identityRef, which checks the allowed namespaces
+	if ref := template.Spec.Template.Spec.ProviderConfigReference; ref != nil && strings.HasPrefix(ref.Name, infrastructurev1beta1.IdentityProviderConfigPrefix) {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "template", "spec", "providerConfigRef", "name"),
+			"the ProviderConfig of a CAPTClusterIdentity may only be used through identityRef"))
+	}
+
+	if ref := template.Spec.WriteConnectionSecretToRef; ref != nil {
+		if ref.Name == "" {
+			allErrs = append(allErrs, field.Required(field.NewPath("spec", "writeConnectionSecretToRef", "name"), "secret name is required"))
+		}
+	}
+
+	if len(allErrs) > 0 {
+		return apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("WorkspaceTemplate").GroupKind(), template.Name, allErrs)
+	}
+	return nil
+}
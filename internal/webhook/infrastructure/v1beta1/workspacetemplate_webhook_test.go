@@ -0,0 +1,67 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	xpv1 "github.com/crossplane/crossplane-runtime/apis/common/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tfv1beta1 "github.com/upbound/provider-terraform/apis/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func TestWorkspaceTemplateValidateCreate(t *testing.T) {
+	tests := []struct {
+		name           string
+		providerConfig string
+		module         string
+		wantErr        string
+	}{
+		{
+			name:           "valid",
+			providerConfig: "aws-provider-config",
+			module:         "# vpc",
+		},
+		{
+			name:           "missing module",
+			providerConfig: "aws-provider-config",
+			wantErr:        "spec.template.spec.forProvider.module",
+		},
+		{
+			name:           "ProviderConfig of an identity",
+			providerConfig: "capt-identity-tenant-a",
+			module:         "# vpc",
+			wantErr:        "spec.template.spec.providerConfigRef.name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template := &infrastructurev1beta1.WorkspaceTemplate{
+				ObjectMeta: metav1.ObjectMeta{Name: "vpc-template", Namespace: "default"},
+				Spec: infrastructurev1beta1.WorkspaceTemplateSpec{
+					Template: infrastructurev1beta1.WorkspaceTemplateDefinition{
+						Spec: tfv1beta1.WorkspaceSpec{
+							ResourceSpec: xpv1.ResourceSpec{
+								ProviderConfigReference: &xpv1.Reference{Name: tt.providerConfig},
+							},
+							ForProvider: tfv1beta1.WorkspaceParameters{Module: tt.module, Source: tfv1beta1.ModuleSourceInline},
+						},
+					},
+				},
+			}
+			v := &WorkspaceTemplateCustomValidator{Client: newFakeReader()}
+
+			_, err := v.ValidateCreate(context.Background(), template)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+// revisionHash matches the revision hashes recorded by the WorkspaceTemplateApply controller
+var revisionHash = regexp.MustCompile(`^[0-9a-f]{16}$`)
+
+// SetupWorkspaceTemplateApplyWebhookWithManager registers the webhook for WorkspaceTemplateApply in the manager.
+func SetupWorkspaceTemplateApplyWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&infrastructurev1beta1.WorkspaceTemplateApply{}).
+		WithValidator(&WorkspaceTemplateApplyCustomValidator{Client: mgr.GetClient()}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-workspacetemplateapply,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=workspacetemplateapplies,verbs=create;update,versions=v1beta1,name=validation.workspacetemplateapply.infrastructure.cluster.x-k8s.io,admissionReviewVersions=v1
+
+// WorkspaceTemplateApplyCustomValidator validates WorkspaceTemplateApplies on creation and update.
+type WorkspaceTemplateApplyCustomValidator struct {
+	Client client.Reader
+}
+
+var _ admission.CustomValidator = &WorkspaceTemplateApplyCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator.
+func (v *WorkspaceTemplateApplyCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	apply, ok := obj.(*infrastructurev1beta1.WorkspaceTemplateApply)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkspaceTemplateApply object but got %T", obj)
+	}
+	return v.validate(ctx, apply)
+}
+
+// ValidateUpdate implements admission.CustomValidator.
+func (v *WorkspaceTemplateApplyCustomValidator) ValidateUpdate(ctx context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	apply, ok := newObj.(*infrastructurev1beta1.WorkspaceTemplateApply)
+	if !ok {
+		return nil, fmt.Errorf("expected a WorkspaceTemplateApply object but got %T", newObj)
+	}
+	// Objects being deleted only lose their finalizers
+	if !apply.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	return v.validate(ctx, apply)
+}
+
+// ValidateDelete implements admission.CustomValidator.
+func (v *WorkspaceTemplateApplyCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *WorkspaceTemplateApplyCustomValidator) validate(ctx context.Context, apply *infrastructurev1beta1.WorkspaceTemplateApply) (admission.Warnings, error) {
+	spec := field.NewPath("spec")
+	allErrs := validateTemplateRef(apply.Spec.TemplateRef, spec.Child("templateRef"))
+
+	if err := apply.Spec.ValidateConfiguration(); err != nil {
+		allErrs = append(allErrs, field.Invalid(spec, field.OmitValueType{}, err.Error()))
+	}
+	// The controller reads variable sources with its own permissions
+	if err := apply.Spec.ValidateSourceNamespaces(apply.Namespace); err != nil {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("variablesFrom"), err.Error()))
+	}
+	if err := apply.Spec.ValidateDependencyNamespaces(apply.Namespace); err != nil {
+		allErrs = append(allErrs, field.Forbidden(spec.Child("dependsOn"), err.Error()))
+	}
+	for i, dep := range apply.Spec.DependsOn {
+		if dep.Name == apply.Name && (dep.Namespace == "" || dep.Namespace == apply.Namespace) {
+			allErrs = append(allErrs, field.Invalid(spec.Child("dependsOn").Index(i), dep.Name, "a WorkspaceTemplateApply cannot depend on itself"))
+		}
+	}
+	// Variables may render into the providerConfigRef of the template, and ProviderConfigs of
+	// identities are only used through identityRef, which checks the allowed namespaces
+	for _, key := range slices.Sorted(maps.Keys(apply.Spec.Variables)) {
+		if strings.HasPrefix(apply.Spec.Variables[key], infrastructurev1beta1.IdentityProviderConfigPrefix) {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("variables").Key(key),
+				"may not name the ProviderConfig of a CAPTClusterIdentity, use identityRef instead"))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(apply.Spec.StructuredVariables)) {
+		var value string
+		if json.Unmarshal(apply.Spec.StructuredVariables[key].Raw, &value) == nil &&
+			strings.HasPrefix(value, infrastructurev1beta1.IdentityProviderConfigPrefix) {
+			allErrs = append(allErrs, field.Forbidden(spec.Child("structuredVariables").Key(key),
+				"may not name the ProviderConfig of a CAPTClusterIdentity, use identityRef instead"))
+		}
+	}
+	if apply.Spec.RollbackTo != "" && !revisionHash.MatchString(apply.Spec.RollbackTo) {
+		allErrs = append(allErrs, field.Invalid(spec.Child("rollbackTo"), apply.Spec.RollbackTo, "must be a revision hash from status.lastAppliedRevision"))
+	}
+	if drift := apply.Spec.DriftDetection; drift != nil && drift.Interval != nil && drift.Interval.Duration <= 0 {
+		allErrs = append(allErrs, field.Invalid(spec.Child("driftDetection", "interval"), drift.Interval.Duration.String(), "must be positive"))
+	}
+
+	if len(allErrs) > 0 {
+		return nil, apierrors.NewInvalid(infrastructurev1beta1.GroupVersion.WithKind("WorkspaceTemplateApply").GroupKind(), apply.Name, allErrs)
+	}
+	return templateRefWarnings(ctx, v.Client, apply.Spec.TemplateRef, apply.Namespace, spec.Child("templateRef"))
+}
@@ -0,0 +1,114 @@
+package v1beta1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	infrastructurev1beta1 "github.com/appthrust/capt/api/v1beta1"
+)
+
+func newWorkspaceTemplateApply(mutate func(*infrastructurev1beta1.WorkspaceTemplateApplySpec)) *infrastructurev1beta1.WorkspaceTemplateApply {
+	apply := &infrastructurev1beta1.WorkspaceTemplateApply{
+		ObjectMeta: metav1.ObjectMeta{Name: "demo-apply", Namespace: "default"},
+		Spec: infrastructurev1beta1.WorkspaceTemplateApplySpec{
+			TemplateRef: infrastructurev1beta1.WorkspaceTemplateReference{Name: "vpc-template"},
+		},
+	}
+	if mutate != nil {
+		mutate(&apply.Spec)
+	}
+	return apply
+}
+
+func TestWorkspaceTemplateApplyValidateCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*infrastructurev1beta1.WorkspaceTemplateApplySpec)
+		wantErr string
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "sources in the namespace of the apply",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.VariablesFrom = []infrastructurev1beta1.VariableFrom{
+					{Name: "token", ValueFrom: infrastructurev1beta1.VariableSource{
+						SecretKeyRef: &infrastructurev1beta1.KeySelector{Name: "creds", Key: "token"},
+					}},
+					{Name: "vpc_id", ValueFrom: infrastructurev1beta1.VariableSource{
+						OutputRef: &infrastructurev1beta1.OutputReference{Name: "demo-vpc-apply", Namespace: "default", Output: "vpc_id"},
+					}},
+				}
+			},
+		},
+		{
+			name: "secret in another namespace",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.VariablesFrom = []infrastructurev1beta1.VariableFrom{
+					{Name: "token", ValueFrom: infrastructurev1beta1.VariableSource{
+						SecretKeyRef: &infrastructurev1beta1.KeySelector{Name: "creds", Namespace: "kube-system", Key: "token"},
+					}},
+				}
+			},
+			wantErr: "spec.variablesFrom",
+		},
+		{
+			name: "output of another namespace",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.VariablesFrom = []infrastructurev1beta1.VariableFrom{
+					{Name: "vpc_id", ValueFrom: infrastructurev1beta1.VariableSource{
+						OutputRef: &infrastructurev1beta1.OutputReference{Name: "demo-vpc-apply", Namespace: "team-b", Output: "vpc_id"},
+					}},
+				}
+			},
+			wantErr: "spec.variablesFrom",
+		},
+		{
+			name: "dependency in the namespace of the apply",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.DependsOn = []infrastructurev1beta1.WorkspaceTemplateApplyReference{{Name: "demo-vpc-apply", Namespace: "default"}}
+			},
+		},
+		{
+			name: "dependency in another namespace",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.DependsOn = []infrastructurev1beta1.WorkspaceTemplateApplyReference{{Name: "demo-vpc-apply", Namespace: "team-b"}}
+			},
+			wantErr: "spec.dependsOn",
+		},
+		{
+			name: "variable naming the ProviderConfig of an identity",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.Variables = map[string]string{"provider_config": "capt-identity-tenant-a"}
+			},
+			wantErr: "spec.variables[provider_config]",
+		},
+		{
+			name: "structured variable naming the ProviderConfig of an identity",
+			mutate: func(spec *infrastructurev1beta1.WorkspaceTemplateApplySpec) {
+				spec.StructuredVariables = map[string]apiextensionsv1.JSON{"provider_config": {Raw: []byte(`"capt-identity-tenant-a"`)}}
+			},
+			wantErr: "spec.structuredVariables[provider_config]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := &WorkspaceTemplateApplyCustomValidator{Client: newFakeReader(newVPCTemplate())}
+
+			_, err := v.ValidateCreate(context.Background(), newWorkspaceTemplateApply(tt.mutate))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}